@@ -0,0 +1,70 @@
+// Copyright 2013 Julian Phillips.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lib
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// PkgSpec describes one of the packages to be generated by MakePkgs.
+type PkgSpec struct {
+	SrcPath string // directory holding the source of the package
+	DstPath string // directory to write the generated package into
+	PkgName string // import path of the package
+	Mock    bool   // mock the package by default (as for MakePkg)
+}
+
+// PkgResult is the result of generating one of the packages given to
+// MakePkgs.
+type PkgResult struct {
+	Spec    PkgSpec
+	Imports importSet
+	Err     error
+}
+
+// MakePkgs runs MakePkg for each of specs using cfg (creating the destination
+// directories as needed), so that a set of related packages can be generated
+// in one go - sharing the cache of package names, rather than looking them up
+// again for each package.  Every package is generated even if some of them
+// fail, and the results are returned in the same order as specs, along with
+// an error naming the packages that failed (if any).
+func MakePkgs(specs []PkgSpec, cfg *MockConfig) ([]PkgResult, error) {
+	results := make([]PkgResult, len(specs))
+	failed := []string{}
+
+	for i, spec := range specs {
+		results[i].Spec = spec
+		results[i].Imports, results[i].Err = makeSpec(spec, cfg)
+		if results[i].Err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", spec.PkgName,
+				results[i].Err))
+		}
+	}
+
+	if len(failed) > 0 {
+		return results, fmt.Errorf("Failed to generate %d of %d packages:\n%s",
+			len(failed), len(specs), strings.Join(failed, "\n"))
+	}
+
+	return results, nil
+}
+
+// makeSpec generates the package described by spec, creating the destination
+// directory first.
+func makeSpec(spec PkgSpec, cfg *MockConfig) (importSet, error) {
+	if err := os.MkdirAll(spec.DstPath, 0700); err != nil {
+		return nil, Cerr{"os.MkdirAll", err}
+	}
+
+	imports, err := MakePkg(spec.SrcPath, spec.DstPath, spec.PkgName,
+		spec.Mock, cfg)
+	if err != nil {
+		return nil, Cerr{"MakePkg", err}
+	}
+
+	return imports, nil
+}
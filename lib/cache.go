@@ -5,8 +5,15 @@
 package lib
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 )
 
 type Cache struct {
@@ -16,25 +23,34 @@ type Cache struct {
 }
 
 func NewCache(tmpDir string) *Cache {
-	enabled := os.Getenv("WITHMOCK_DISABLE_CACHE") == ""
-
-	home := os.Getenv("HOME")
-
-	root := os.Getenv("WITHMOCK_CACHE_DIR")
-	if root == "" {
-		if home == "" {
-			enabled = false
-		}
-		filepath.Join(home, ".withmock", "cache")
-	}
+	root := cacheRoot()
 
 	return &Cache{
-		enabled: enabled,
+		enabled: root != "",
 		root:    root,
 		tmpDir:  tmpDir,
 	}
 }
 
+// cacheRoot returns the directory to be used for the cache, or "" if the cache
+// is disabled (or there is nowhere to put it).
+func cacheRoot() string {
+	if os.Getenv("WITHMOCK_DISABLE_CACHE") != "" {
+		return ""
+	}
+
+	if root := os.Getenv("WITHMOCK_CACHE_DIR"); root != "" {
+		return root
+	}
+
+	home := os.Getenv("HOME")
+	if home == "" {
+		return ""
+	}
+
+	return filepath.Join(home, ".withmock", "cache")
+}
+
 func (c *Cache) Store(path string) error {
 	if !c.enabled {
 		return nil
@@ -55,6 +71,130 @@ func (c *Cache) Fetch(path string) (Package, error) {
 	return nil, nil
 }
 
+// CacheFileKey identifies the content used to generate a file (i.e. the source
+// file and the config), so that we can tell if a previously generated file is
+// still up to date without generating it again.  The empty key is never stored,
+// and never matches.
+type CacheFileKey string
+
+// NewCacheFileKey returns the key for a file generated from parts.
+func NewCacheFileKey(parts ...[]byte) CacheFileKey {
+	h := sha256.New()
+	for _, part := range parts {
+		// Include the length, so that moving data between parts changes the
+		// key.
+		fmt.Fprintf(h, "%d:", len(part))
+		h.Write(part)
+	}
+	return CacheFileKey(hex.EncodeToString(h.Sum(nil)))
+}
+
+// keysDir returns the directory that the keys are kept in, or "" if keys
+// aren't being kept.
+func keysDir() string {
+	root := cacheRoot()
+	if root == "" {
+		return ""
+	}
+	return filepath.Join(root, "keys")
+}
+
+// keyPath returns the path used to store the key for the generated file path,
+// or "" if keys aren't being kept.  The keys are kept in the cache, named for
+// the absolute path of the generated file.
+func keyPath(path string) string {
+	dir := keysDir()
+	if dir == "" {
+		return ""
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(dir, hex.EncodeToString(sum[:]))
+}
+
+// readKey returns the key, and the path of the generated file, stored in the
+// key file kp.
+func readKey(kp string) (CacheFileKey, string, error) {
+	data, err := ioutil.ReadFile(kp)
+	if err != nil {
+		return "", "", err
+	}
+	lines := strings.SplitN(string(data), "\n", 3)
+	if len(lines) < 2 {
+		return "", "", fmt.Errorf("Invalid key file: %s", kp)
+	}
+	return CacheFileKey(lines[0]), lines[1], nil
+}
+
+// Matches returns true if path exists, and was generated from content with
+// this key.
+func (k CacheFileKey) Matches(path string) bool {
+	kp := keyPath(path)
+	if k == "" || kp == "" {
+		return false
+	}
+	if _, err := os.Stat(path); err != nil {
+		return false
+	}
+	stored, _, err := readKey(kp)
+	if err != nil {
+		return false
+	}
+	return stored == k
+}
+
+// Store records that path was generated from content with this key.  The path
+// is stored too, so that the key can be removed once the file is gone.
+func (k CacheFileKey) Store(path string) error {
+	kp := keyPath(path)
+	if k == "" || kp == "" {
+		return nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(kp), 0755); err != nil {
+		return err
+	}
+	pruneKeysOnce.Do(func() {
+		if err := pruneKeys(filepath.Dir(kp)); err != nil {
+			log.Printf("Failed to prune keys: %s", err)
+		}
+	})
+	return ioutil.WriteFile(kp, []byte(string(k)+"\n"+abs+"\n"), 0644)
+}
+
+// pruneKeysOnce makes sure that we only prune the keys once per run.
+var pruneKeysOnce sync.Once
+
+// pruneKeys removes the keys in dir for generated files that no longer exist
+// (or that can't be read).
+func pruneKeys(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		kp := filepath.Join(dir, entry.Name())
+		_, path, err := readKey(kp)
+		if err == nil {
+			_, err = os.Stat(path)
+		}
+		if err != nil {
+			if err := os.Remove(kp); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // ----------------------------------------------------------------------------
 // cachePackage
 // ----------------------------------------------------------------------------
@@ -6,8 +6,13 @@ package lib
 
 import (
 	"bufio"
+	"fmt"
+	"go/build"
+	"go/token"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"gopkg.in/yaml.v2"
@@ -37,21 +42,405 @@ func readPackages(path string) ([]string, error) {
 	return pkgs, nil
 }
 
+// defaultGomock is the import path of gomock, unless configured otherwise.
+const defaultGomock = "github.com/golang/mock/gomock"
+
+// defaultEnvControlVar is the environment variable checked when EnvControl is
+// set, unless configured otherwise.
+const defaultEnvControlVar = "WITHMOCK_ENABLE"
+
+// gomockPath returns path, or the default gomock import path if path is empty.
+func gomockPath(path string) string {
+	if path == "" {
+		return defaultGomock
+	}
+	return path
+}
+
 type MockConfig struct {
 	// Local configuration
-	MockPrototypes   bool // Mock prototypes (i.e. functions without bodies)
-	IgnoreInits      bool // Don't call the original init functions
-	MatchOSArch      bool // only use files for GOOS & GOARCH
-	IgnoreNonGoFiles bool // Don't copy non-go files into the mocked package
+	MockPrototypes   bool   // Mock prototypes (i.e. functions without bodies)
+	IgnoreInits      bool   // Don't call the original init functions
+	MatchOSArch      bool   // only use files for GOOS & GOARCH
+	IgnoreNonGoFiles bool   // Don't copy non-go files into the mocked package
+	Gomock           string // import path of gomock (empty for the default)
+
+	// InterfaceOnly makes MakePkg generate just the mocks for the interfaces
+	// of the package, into a separate package (named <pkg>_mocks, unless
+	// OutputPackageName is set) that imports the real package - rather than
+	// copying and rewriting the whole package.
+	InterfaceOnly bool
+
+	// ResolvePackageName, if set, is used to find the name of each package
+	// imported by the mocked package (given the import path, and the
+	// directory of the importing package) instead of go list and the vendor
+	// directories - for environments where they don't find the right package
+	// (e.g. Bazel, or a tree of symlinks).
+	ResolvePackageName func(impPath, srcPath string) (string, error) `yaml:"-"`
+
+	// tempOutput is set when the package is generated into a temporary
+	// directory (e.g. by withmock), where it won't be found next time - so
+	// there is no point in keeping the keys of the generated files.
+	tempOutput bool
 
 	// File based configuration
 	MOCK      string `yaml:"MOCK"`
 	EXPECT    string `yaml:"EXPECT"`
-	ObjEXPECT string `yaml:"obj.EXPECT"`
+	ObjEXPECT string `yaml:"obj.EXPECT" json:"obj.EXPECT"`
+
+	// GeneratedBuildTag, if set, is added as a //go:build constraint to every
+	// generated file, so that mocks kept in-tree (e.g. generated by mkgomock)
+	// are only compiled when the tag is given.
+	GeneratedBuildTag string `yaml:"GeneratedBuildTag"`
+
+	// PreserveComments copies the doc and line comments on declarations into
+	// the generated code, so that it stays readable.
+	PreserveComments bool `yaml:"PreserveComments"`
+
+	// PreserveHeaders copies the comments before the package clause of each
+	// file (e.g. a license header) into the generated code.
+	PreserveHeaders bool `yaml:"PreserveHeaders"`
+
+	// PreserveGenerate copies any //go:generate directives into the generated
+	// code, otherwise they are removed.  Running "go generate" over the mocks
+	// will then run the directives again - which can be dangerous, as a
+	// generator that runs withmock (or mkgomock) will keep generating mocks
+	// of the mocks.
+	PreserveGenerate bool `yaml:"PreserveGenerate"`
+
+	// PackageDoc adds a package doc comment to the generated code, saying
+	// that it is a mock generated by withmock (and naming the original
+	// package), in place of the package doc of the original package - so
+	// that running go doc on the mock by mistake isn't misleading.
+	PackageDoc bool `yaml:"PackageDoc"`
+
+	// StubReturns gives the values to be returned by the stubs generated for
+	// functions without bodies when MockPrototypes is set (instead of
+	// panicking), e.g. {"Read": ["0", "io.EOF"]}.  Methods are given as
+	// "Type.Method".
+	StubReturns map[string][]string `yaml:"StubReturns"`
+
+	// TypedDo adds a XxxDo method to the recorders for each mocked function,
+	// that takes a function with the same parameters as the mocked function -
+	// so that callbacks are type checked, unlike those passed to Do.
+	TypedDo bool `yaml:"TypedDo"`
+
+	// NoRecorders leaves out the recorders (i.e. EXPECT) for the package's
+	// functions and methods, which makes the generated code smaller when a
+	// test never records calls to them (e.g. it only wants the mocks of the
+	// package's interfaces, which still have their recorders).
+	NoRecorders bool `yaml:"NoRecorders"`
+
+	// TraceCalls makes every mocked call report its name and arguments to
+	// the tracer set with SetTracer (if any) before it is passed to gomock,
+	// which helps to find out why an expectation didn't match.
+	TraceCalls bool `yaml:"TraceCalls"`
+
+	// CountCalls makes every mocked call of the package's functions and
+	// methods add one to a count kept for its name, which can be read back
+	// with CallCount - a quick way to check whether something was called at
+	// all, without recording any expectations.  The counts are reset by
+	// SetController and MockAll.
+	CountCalls bool `yaml:"CountCalls"`
+
+	// EnvControl turns on mocking for the whole package when the program
+	// starts, if its import path is listed in the comma separated environment
+	// variable named by EnvControlVar (WITHMOCK_ENABLE by default).  This
+	// can't be used for packages imported by syscall, as it uses syscall to
+	// read the variable.
+	EnvControl    bool   `yaml:"EnvControl"`
+	EnvControlVar string `yaml:"EnvControlVar"`
+
+	// MockRegistry adds a MockRegistry map to the generated package, from the
+	// name of each interface to a function that returns a new mock of it - so
+	// that mocks can be created by name (e.g. by a dependency injector).
+	MockRegistry bool `yaml:"MockRegistry"`
+
+	// Fallbacks adds a Fallback field to the interface mocks.  If it is set,
+	// then calls to a method that hasn't had any expectations recorded on the
+	// mock are passed to the Fallback instead - so that a real implementation
+	// can be used for the methods that aren't of interest to a test.
+	Fallbacks bool `yaml:"Fallbacks"`
+
+	// Fakes adds a Fake<Name> struct alongside each interface mock, with a
+	// <Method>Func field for each method of the interface.  The methods of
+	// the fake call the field if it is set, and return zero values otherwise
+	// - for tests that would rather stub a method by hand than set up
+	// expectations.
+	Fakes bool `yaml:"Fakes"`
+
+	// Strict makes generating the package fail if the mock can't faithfully
+	// represent the source, rather than writing out what it can - e.g. when
+	// an import can't be resolved in a file with build constraints, or
+	// comments would be dropped with PreserveComments.
+	Strict bool `yaml:"Strict"`
+
+	// SingleFile generates all of the code for the package into a single
+	// file (other than the interface mocks), rather than one file for each
+	// source file.  If the files can't be merged (e.g. they have different
+	// build constraints, or use cgo) then separate files are still used.
+	SingleFile bool `yaml:"SingleFile"`
+
+	// PerTypeFiles puts the recorder type (and constructor) of each mocked
+	// type into a file of its own (e.g. lib_Cache_mock.go), rather than into
+	// the package's main mock file.  It is ignored if SingleFile is set.
+	PerTypeFiles bool `yaml:"PerTypeFiles"`
+
+	// ExcludeSubpackages lists the names of sub-directories of the package
+	// that should be linked in unchanged, rather than being processed as
+	// packages of their own.
+	ExcludeSubpackages []string `yaml:"ExcludeSubpackages"`
+
+	// MockAll makes the generated package start with all of its functions
+	// mocked, as if MOCK().MockAll(true) had been called, rather than with
+	// all of them real.
+	MockAll bool `yaml:"MockAll"`
+
+	// SubpackageMockAll sets MockAll for the sub-packages of the package, by
+	// the name of their sub-directory - so that e.g. a package can start with
+	// everything mocked while its sub-packages don't.  A "*" entry applies to
+	// any sub-package that isn't listed.  It takes precedence over the
+	// configuration of the sub-package itself.
+	SubpackageMockAll map[string]bool `yaml:"SubpackageMockAll"`
+
+	// NeverMock lists import paths that are never mocked, even if they are
+	// marked for mocking or listed in a manifest - the real package is always
+	// used instead (e.g. for context or sync).  It applies to every package,
+	// so it is only read from the DEFAULT configuration.
+	NeverMock []string `yaml:"NeverMock"`
+
+	// GOOS and GOARCH, if set, replace those of the host when MatchOSArch is
+	// used to select the files of the package - so that mocks can be
+	// generated for a different platform (e.g. windows on a linux CI box).
+	GOOS   string `yaml:"GOOS"`
+	GOARCH string `yaml:"GOARCH"`
+
+	// CgoEnabled, if set to "0" or "1", replaces CGO_ENABLED when MatchOSArch
+	// is used - so that the files for cgo (or pure Go) builds are selected
+	// (e.g. those with a "cgo" or "!cgo" build constraint).
+	CgoEnabled string `yaml:"CgoEnabled"`
+
+	// OutputPackageName, if set, replaces the package name in the package
+	// clause of the generated files - so that different variants of the mocks
+	// for a package can be generated into distinct packages.
+	OutputPackageName string `yaml:"OutputPackageName"`
+
+	// InterfacesDir, if set, gives the base directory that MockInterfaces
+	// generates the interface mocks under, instead of the GOPATH used for the
+	// build (they are linked into that GOPATH, so that they can still be
+	// imported).  Environment variables are expanded, with $TMPDIR defaulting
+	// to the system temp directory if it isn't set (e.g. "$TMPDIR/withmock").
+	InterfacesDir string `yaml:"InterfacesDir"`
+
+	// InterfacesPerm gives the permissions (in octal) of the directories
+	// created by MockInterfaces, "0700" by default.
+	InterfacesPerm string `yaml:"InterfacesPerm"`
+
+	// InterfacesCleanup decides when the directory generated by MockInterfaces
+	// is removed again - "never" (the default), "failure", "success" or
+	// "always".  After a failure it is removed straight away, otherwise once
+	// the mocks are no longer needed (i.e. when withmock is done).
+	InterfacesCleanup string `yaml:"InterfacesCleanup"`
+}
+
+// interfacesDir returns the base directory that MockInterfaces should use,
+// which is tmpPath unless InterfacesDir is set.
+func (m *MockConfig) interfacesDir(tmpPath string) string {
+	if m.InterfacesDir == "" {
+		return tmpPath
+	}
+	return os.Expand(m.InterfacesDir, func(name string) string {
+		if name == "TMPDIR" {
+			// os.TempDir checks TMPDIR for us
+			return os.TempDir()
+		}
+		return os.Getenv(name)
+	})
+}
+
+// interfacesPerm returns the permissions for the directories created by
+// MockInterfaces.
+func (m *MockConfig) interfacesPerm() (os.FileMode, error) {
+	if m.InterfacesPerm == "" {
+		return 0700, nil
+	}
+	perm, err := strconv.ParseUint(m.InterfacesPerm, 8, 32)
+	if err != nil || perm&^uint64(os.ModePerm) != 0 {
+		return 0, fmt.Errorf("Invalid InterfacesPerm %q, expected octal "+
+			"permissions (e.g. \"0750\")", m.InterfacesPerm)
+	}
+	return os.FileMode(perm), nil
+}
+
+// cleanupInterfaces returns true if the directory generated by MockInterfaces
+// should be removed, given whether the generation succeeded or not.
+func (m *MockConfig) cleanupInterfaces(success bool) (bool, error) {
+	switch m.InterfacesCleanup {
+	case "", "never":
+		return false, nil
+	case "failure":
+		return !success, nil
+	case "success":
+		return success, nil
+	case "always":
+		return true, nil
+	}
+	return false, fmt.Errorf("Invalid InterfacesCleanup %q, expected one of "+
+		"never, failure, success or always", m.InterfacesCleanup)
+}
+
+// envControlVar returns the name of the environment variable used to turn on
+// mocking if EnvControl is set, or an empty string if it isn't.
+func (m *MockConfig) envControlVar() string {
+	switch {
+	case !m.EnvControl:
+		return ""
+	case m.EnvControlVar != "":
+		return m.EnvControlVar
+	}
+	return defaultEnvControlVar
+}
+
+// reservedNames are the names declared by the generated code that MOCK,
+// EXPECT or ObjEXPECT would clash with - e.g. the methods of the value
+// returned by MOCK, and the functions of an interface mock package.
+var reservedNames = map[string]bool{
+	"CallCount":           true,
+	"DisableMock":         true,
+	"EnableMock":          true,
+	"ExpectInOrder":       true,
+	"Fallback":            true,
+	"Finish":              true,
+	"Install":             true,
+	"MockAll":             true,
+	"MockRegistry":        true,
+	"PendingExpectations": true,
+	"SetController":       true,
+	"SetStubHandler":      true,
+	"SetTracer":           true,
+	"WithController":      true,
+	"callInits":           true,
+	"init":                true,
+}
+
+// checkNames returns an error if the names configured for MOCK, EXPECT and
+// ObjEXPECT can't be used by the generated code.  Each must be a valid
+// identifier (exported or not), and MOCK and EXPECT can't be the same as they
+// are both functions of the package.  ObjEXPECT is a method, so it can share
+// a name with EXPECT (as it does by default).  If ifOnly is set only EXPECT is
+// checked, as only interface mocks are being generated.
+func (m *MockConfig) checkNames(ifOnly bool) error {
+	if err := checkName("EXPECT", m.EXPECT); err != nil || ifOnly {
+		return err
+	}
+	if err := checkName("MOCK", m.MOCK); err != nil {
+		return err
+	}
+	if err := checkName("obj.EXPECT", m.ObjEXPECT); err != nil {
+		return err
+	}
+	if m.MOCK == m.EXPECT {
+		return fmt.Errorf("MOCK and EXPECT can't both be %q", m.MOCK)
+	}
+	return nil
+}
+
+// checkName returns an error if name (the value of the setting field) can't
+// be used as the name of a function or method in the generated code.
+func checkName(field, name string) error {
+	switch {
+	case !token.IsIdentifier(name):
+		return fmt.Errorf("%s %q is not a valid identifier", field, name)
+	case strings.HasPrefix(name, "_"):
+		return fmt.Errorf("%s %q can't start with an underscore, as those "+
+			"names are used by the generated code", field, name)
+	case reservedNames[name]:
+		return fmt.Errorf("%s %q clashes with the %s declared by the "+
+			"generated code", field, name, name)
+	}
+	return nil
+}
+
+// buildContext returns the build context for the platform that files should
+// be selected for.
+func (m *MockConfig) buildContext() *build.Context {
+	ctxt := build.Default
+	if m.GOOS != "" {
+		ctxt.GOOS = m.GOOS
+	}
+	if m.GOARCH != "" {
+		ctxt.GOARCH = m.GOARCH
+	}
+	if m.CgoEnabled != "" {
+		ctxt.CgoEnabled = m.CgoEnabled == "1"
+	}
+	return &ctxt
+}
+
+// cacheKey returns the settings in a form that can be included in the keys of
+// the files generated using them (see CacheFileKey).
+func (m *MockConfig) cacheKey() ([]byte, error) {
+	return yaml.Marshal(m)
+}
+
+// excludesSubpackage returns true if the sub-directory name of the package
+// is listed in ExcludeSubpackages.
+func (m *MockConfig) excludesSubpackage(name string) bool {
+	for _, sub := range m.ExcludeSubpackages {
+		if filepath.Clean(sub) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// subpackageMockAll returns the MockAll setting that SubpackageMockAll gives
+// for the sub-directory name of the package, with found false if it doesn't
+// give one.
+func (m *MockConfig) subpackageMockAll(name string) (mockAll, found bool) {
+	for sub, mockAll := range m.SubpackageMockAll {
+		if filepath.Clean(sub) == name {
+			return mockAll, true
+		}
+	}
+	mockAll, found = m.SubpackageMockAll["*"]
+	return mockAll, found
 }
 
 type Config struct {
+	// Gomock is the import path of the gomock package that the generated code
+	// should use, if not the default (e.g. to use a fork).
+	Gomock string `yaml:"gomock"`
+
 	Mocks map[string]*MockConfig
+
+	// mocked holds the import paths that should be mocked even if they aren't
+	// marked (i.e. those listed in a Manifest).
+	mocked map[string]bool
+
+	// names holds the package names given in a Manifest, by import path.
+	names map[string]string
+}
+
+// isMocked returns true if the package impPath should be mocked, even if it
+// isn't marked for mocking.
+func (c *Config) isMocked(impPath string) bool {
+	return c.mocked[impPath] && !c.neverMocked(impPath)
+}
+
+// neverMocked returns true if the package impPath should never be mocked, as
+// it is listed in NeverMock.
+func (c *Config) neverMocked(impPath string) bool {
+	dc, found := c.Mocks["DEFAULT"]
+	if !found {
+		return false
+	}
+	for _, never := range dc.NeverMock {
+		if never == impPath {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *Config) Mock(path string) *MockConfig {
@@ -59,6 +448,7 @@ func (c *Config) Mock(path string) *MockConfig {
 		MOCK:      "MOCK",
 		EXPECT:    "EXPECT",
 		ObjEXPECT: "EXPECT",
+		Gomock:    c.Gomock,
 	}
 
 	dc, found := c.Mocks["DEFAULT"]
@@ -92,6 +482,127 @@ func (c *Config) Mock(path string) *MockConfig {
 		m.ObjEXPECT = dc.ObjEXPECT
 	}
 
+	switch {
+	case mc.GeneratedBuildTag != "":
+		m.GeneratedBuildTag = mc.GeneratedBuildTag
+	case dc.GeneratedBuildTag != "":
+		m.GeneratedBuildTag = dc.GeneratedBuildTag
+	}
+
+	m.PreserveComments = mc.PreserveComments || dc.PreserveComments
+	m.PreserveHeaders = mc.PreserveHeaders || dc.PreserveHeaders
+	m.PreserveGenerate = mc.PreserveGenerate || dc.PreserveGenerate
+	m.PackageDoc = mc.PackageDoc || dc.PackageDoc
+	m.MockPrototypes = mc.MockPrototypes || dc.MockPrototypes
+	m.IgnoreInits = mc.IgnoreInits || dc.IgnoreInits
+	m.IgnoreNonGoFiles = mc.IgnoreNonGoFiles || dc.IgnoreNonGoFiles
+	m.TypedDo = mc.TypedDo || dc.TypedDo
+	m.NoRecorders = mc.NoRecorders || dc.NoRecorders
+	m.TraceCalls = mc.TraceCalls || dc.TraceCalls
+	m.CountCalls = mc.CountCalls || dc.CountCalls
+	m.EnvControl = mc.EnvControl || dc.EnvControl
+	m.MockRegistry = mc.MockRegistry || dc.MockRegistry
+	m.Fallbacks = mc.Fallbacks || dc.Fallbacks
+	m.Fakes = mc.Fakes || dc.Fakes
+	m.Strict = mc.Strict || dc.Strict
+	m.SingleFile = mc.SingleFile || dc.SingleFile
+	m.PerTypeFiles = mc.PerTypeFiles || dc.PerTypeFiles
+	m.MockAll = mc.MockAll || dc.MockAll
+
+	// The parent's SubpackageMockAll takes precedence over our own MockAll
+	if parent, sub := filepath.Split(path); parent != "" {
+		pc := c.Mock(filepath.Clean(parent))
+		if mockAll, found := pc.subpackageMockAll(sub); found {
+			m.MockAll = mockAll
+		}
+	}
+
+	m.NeverMock = dc.NeverMock
+
+	switch {
+	case mc.ExcludeSubpackages != nil:
+		m.ExcludeSubpackages = mc.ExcludeSubpackages
+	case dc.ExcludeSubpackages != nil:
+		m.ExcludeSubpackages = dc.ExcludeSubpackages
+	}
+
+	switch {
+	case mc.SubpackageMockAll != nil:
+		m.SubpackageMockAll = mc.SubpackageMockAll
+	case dc.SubpackageMockAll != nil:
+		m.SubpackageMockAll = dc.SubpackageMockAll
+	}
+
+	switch {
+	case mc.EnvControlVar != "":
+		m.EnvControlVar = mc.EnvControlVar
+	case dc.EnvControlVar != "":
+		m.EnvControlVar = dc.EnvControlVar
+	}
+
+	switch {
+	case mc.GOOS != "":
+		m.GOOS = mc.GOOS
+	case dc.GOOS != "":
+		m.GOOS = dc.GOOS
+	}
+
+	switch {
+	case mc.GOARCH != "":
+		m.GOARCH = mc.GOARCH
+	case dc.GOARCH != "":
+		m.GOARCH = dc.GOARCH
+	}
+
+	switch {
+	case mc.CgoEnabled != "":
+		m.CgoEnabled = mc.CgoEnabled
+	case dc.CgoEnabled != "":
+		m.CgoEnabled = dc.CgoEnabled
+	}
+
+	switch {
+	case mc.OutputPackageName != "":
+		m.OutputPackageName = mc.OutputPackageName
+	case dc.OutputPackageName != "":
+		m.OutputPackageName = dc.OutputPackageName
+	}
+
+	switch {
+	case mc.InterfacesDir != "":
+		m.InterfacesDir = mc.InterfacesDir
+	case dc.InterfacesDir != "":
+		m.InterfacesDir = dc.InterfacesDir
+	}
+
+	switch {
+	case mc.InterfacesPerm != "":
+		m.InterfacesPerm = mc.InterfacesPerm
+	case dc.InterfacesPerm != "":
+		m.InterfacesPerm = dc.InterfacesPerm
+	}
+
+	switch {
+	case mc.InterfacesCleanup != "":
+		m.InterfacesCleanup = mc.InterfacesCleanup
+	case dc.InterfacesCleanup != "":
+		m.InterfacesCleanup = dc.InterfacesCleanup
+	}
+
+	switch {
+	case mc.StubReturns != nil:
+		m.StubReturns = mc.StubReturns
+	case dc.StubReturns != nil:
+		m.StubReturns = dc.StubReturns
+	}
+
+	switch {
+	case mc.ResolvePackageName != nil:
+		m.ResolvePackageName = mc.ResolvePackageName
+	case dc.ResolvePackageName != nil:
+		m.ResolvePackageName = dc.ResolvePackageName
+	}
+
 	return m
 }
 
@@ -7,76 +7,115 @@ package lib
 import (
 	"go/ast"
 	"go/build"
+	"go/build/constraint"
 	"strings"
 )
 
-var (
-	goos   = build.Default.GOOS
-	goarch = build.Default.GOARCH
-)
-
-func goodOSArchConstraints(file *ast.File) (ok bool) {
-	max := file.Package
+// goodOSArchConstraints returns false if the build constraints of file exclude
+// the system described by ctxt (or the file is ignored).  A //go:build line is
+// used in preference to any +build lines, as the go command does.
+func goodOSArchConstraints(ctxt *build.Context, file *ast.File) (ok bool) {
+	var goBuild constraint.Expr
+	plusBuild := []constraint.Expr{}
 
 	for _, comment := range file.Comments {
-		if comment.Pos() >= max {
+		if comment.Pos() >= file.Package {
 			break
 		}
 
-		if len(comment.List) == 0 {
-			continue
-		}
-
-		line := comment.List[0].Text
-		line = strings.TrimLeft(line, "/")
-		line = strings.TrimSpace(line)
-
-		if !strings.HasPrefix(line, "+build ") {
-			continue
-		}
-
-		// Loop over lines == AND
-		for _, cmt := range comment.List {
-			line := cmt.Text
-			line = strings.TrimLeft(line, "/")
-			line = strings.TrimSpace(line)
-
-			if len(line) == 0 {
+		for _, c := range comment.List {
+			if !constraint.IsGoBuild(c.Text) && !constraint.IsPlusBuild(c.Text) {
 				continue
 			}
-			line = line[7:]
-
-			satisfied := false
+			x, err := constraint.Parse(c.Text)
+			if err != nil {
+				// Leave it to the compiler to complain about
+				continue
+			}
+			if constraint.IsGoBuild(c.Text) {
+				goBuild = x
+			} else {
+				plusBuild = append(plusBuild, x)
+			}
+		}
+	}
 
-			// Loop over groups == OR
-			for _, group := range strings.Split(line, " ") {
-				gSatisfied := true
+	if goBuild != nil {
+		return matchConstraint(ctxt, goBuild, false)
+	}
 
-				// Loop over constraints == AND
-				for _, constraint := range strings.Split(group, ",") {
-					if constraint == goos || constraint == goarch {
-						continue
-					}
+	// Each +build line must be satisfied
+	for _, x := range plusBuild {
+		if !matchConstraint(ctxt, x, false) {
+			return false
+		}
+	}
 
-					if knownOS[constraint] || knownArch[constraint] {
-						gSatisfied = false
-					}
+	return true
+}
 
-					if constraint == "ignore" {
-						gSatisfied = false
-					}
-				}
+// matchConstraint returns true if x is satisfied for ctxt (or the opposite if
+// negate is set).  Only the tags that we know about (the OS, the architecture,
+// unix, cgo, the compiler, the release and experiment tags of the toolchain,
+// and ignore) are checked - any other tag is assumed to be satisfied whether
+// it is negated or not, as we don't know what tags will be used.
+func matchConstraint(ctxt *build.Context, x constraint.Expr, negate bool) bool {
+	switch x := x.(type) {
+	case *constraint.NotExpr:
+		return matchConstraint(ctxt, x.X, !negate)
+	case *constraint.AndExpr:
+		if negate {
+			return matchConstraint(ctxt, x.X, true) || matchConstraint(ctxt, x.Y, true)
+		}
+		return matchConstraint(ctxt, x.X, false) && matchConstraint(ctxt, x.Y, false)
+	case *constraint.OrExpr:
+		if negate {
+			return matchConstraint(ctxt, x.X, true) && matchConstraint(ctxt, x.Y, true)
+		}
+		return matchConstraint(ctxt, x.X, false) || matchConstraint(ctxt, x.Y, false)
+	case *constraint.TagExpr:
+		switch {
+		case knownOS[x.Tag]:
+			return matchOS(ctxt, x.Tag) != negate
+		case knownArch[x.Tag]:
+			return (x.Tag == ctxt.GOARCH) != negate
+		case x.Tag == "unix":
+			return unixOS[ctxt.GOOS] != negate
+		case x.Tag == "cgo":
+			return ctxt.CgoEnabled != negate
+		case x.Tag == "gc" || x.Tag == "gccgo":
+			return (x.Tag == ctxt.Compiler) != negate
+		case x.Tag == "boringcrypto":
+			// boringcrypto is the old name for the experiment
+			return hasTag(ctxt.ToolTags, "goexperiment.boringcrypto") != negate
+		case strings.HasPrefix(x.Tag, "goexperiment."):
+			return hasTag(ctxt.ToolTags, x.Tag) != negate
+		case strings.HasPrefix(x.Tag, "go1."):
+			return hasTag(ctxt.ReleaseTags, x.Tag) != negate
+		case x.Tag == "ignore":
+			return negate
+		}
+	}
+	return true
+}
 
-				if gSatisfied {
-					satisfied = true
-				}
-			}
+// validBuildTag returns true if tag can be used on its own as a build
+// constraint - i.e. it is a single tag, not an expression or arbitrary text.
+func validBuildTag(tag string) bool {
+	x, err := constraint.Parse("//go:build " + tag)
+	if err != nil {
+		return false
+	}
+	t, ok := x.(*constraint.TagExpr)
+	return ok && t.Tag == tag
+}
 
-			if !satisfied {
-				return false
-			}
+// hasTag returns true if tag is one of tags.
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
 		}
 	}
-
-	return true
+	return false
 }
@@ -42,6 +42,10 @@ type Context struct {
 
 	cache    *Cache
 	packages map[string]Package
+
+	// cleanups are run by Close, to remove anything we generated outside of
+	// tmpDir (or that we were asked to remove even if tmpDir is kept).
+	cleanups []func() error
 }
 
 type codeLoc struct {
@@ -99,7 +103,7 @@ func NewContext() (*Context, error) {
 		cache:          cache,
 		packages:       make(map[string]Package),
 		// create excludes already including gomock, as we can't mock it.
-		excludes: map[string]bool{"github.com/golang/mock/gomock": true},
+		excludes: map[string]bool{defaultGomock: true},
 	}, nil
 }
 
@@ -115,6 +119,12 @@ func (c *Context) DisableRewrite() {
 }
 
 func (c *Context) Close() error {
+	for _, cleanup := range c.cleanups {
+		if err := cleanup(); err != nil {
+			return err
+		}
+	}
+
 	if c.removeTmp {
 		if err := os.RemoveAll(c.tmpDir); err != nil {
 			return err
@@ -130,9 +140,24 @@ func (c *Context) Close() error {
 
 func (c *Context) LoadConfig(path string) (err error) {
 	c.cfg, err = ReadConfig(path)
+	if err == nil {
+		c.excludes[gomockPath(c.cfg.Gomock)] = true
+	}
 	return
 }
 
+// LoadManifest loads the config from the manifest at path, all the packages
+// listed in the manifest will be mocked.
+func (c *Context) LoadManifest(path string) error {
+	m, err := ReadManifest(path)
+	if err != nil {
+		return err
+	}
+	c.cfg = m.Config()
+	c.excludes[gomockPath(c.cfg.Gomock)] = true
+	return nil
+}
+
 func (c *Context) insideCommand(command string, args ...string) *exec.Cmd {
 	env := os.Environ()
 
@@ -261,6 +286,17 @@ func internalPkg(path string) bool {
 	return false
 }
 
+// excludedSubpackage returns true if the package name is listed in the
+// ExcludeSubpackages of its parent package, so that it is linked in along
+// with the parent rather than processed itself.
+func (c *Context) excludedSubpackage(name string) bool {
+	parent, sub := filepath.Split(name)
+	if parent == "" {
+		return false
+	}
+	return c.cfg.Mock(filepath.Clean(parent)).excludesSubpackage(sub)
+}
+
 func (c *Context) installImports(imports importSet) (map[string]string, error) {
 	// Start by updating processed to include anything in imports we haven't
 	// seen before, this also gives us the name rewrite map we need to return
@@ -303,6 +339,7 @@ func (c *Context) installImports(imports importSet) (map[string]string, error) {
 				if err != nil {
 					return nil, Cerr{"ReplacePkg", err}
 				}
+				explain(name, "replaced by %s", srcPath)
 
 				// Update imports from the package we just processed, but it
 				// can only add actual packages, not mocks
@@ -313,12 +350,15 @@ func (c *Context) installImports(imports importSet) (map[string]string, error) {
 
 			if c.stdlibImports[name] && !mock {
 				// Ignore standard packages that we aren't mocking
+				explain(name, "skipped, as it is in the standard library")
 				continue
 			}
 
 			if internalPkg(name) {
 				// Internal packages should already be sorted by linking the
 				// internal directory elsewhere
+				explain(name, "skipped, as it is an internal package "+
+					"(linked along with its parent)")
 				continue
 			}
 
@@ -328,17 +368,35 @@ func (c *Context) installImports(imports importSet) (map[string]string, error) {
 			}
 
 			cfg := c.cfg.Mock(name)
+			cfg.tempOutput = true
 
 			if !imports[name].ShouldInstall() {
 				pkg.DisableInstall()
 			}
 
+			if c.excludedSubpackage(name) {
+				// The parent links the whole directory into place - so if that
+				// has already happened, writing to it would change the original
+				// source.  Otherwise it is linked here, and the parent's link
+				// is then not needed.
+				if exists(filepath.Join(c.tmpPath, "src", name)) {
+					explain(name, "skipped, as it is linked along with its parent")
+					continue
+				}
+				if _, err := pkg.Link(); err != nil {
+					return nil, Cerr{"pkg.Link", err}
+				}
+				explain(name, "linked unchanged, as it is excluded by its parent")
+				continue
+			}
+
 			if c.excludes[name] {
 				// this package has been specifically excluded from mocking, so
 				// we just link it, even if mocked is indicated.
 				if _, err := pkg.Link(); err != nil {
 					return nil, Cerr{"pkg.Link", err}
 				}
+				explain(name, "linked unchanged, as it is excluded from mocking")
 				continue
 			}
 
@@ -349,6 +407,7 @@ func (c *Context) installImports(imports importSet) (map[string]string, error) {
 				if err != nil {
 					return nil, Cerr{"MockStandard", err}
 				}
+				explain(name, "mocked as %s (from the standard library)", label)
 				continue
 			}
 
@@ -357,6 +416,11 @@ func (c *Context) installImports(imports importSet) (map[string]string, error) {
 			if err != nil {
 				return nil, Cerr{"GenPkg", err}
 			}
+			if mock {
+				explain(name, "mocked as %s", label)
+			} else {
+				explain(name, "left real")
+			}
 
 			log.Printf("process deps")
 
@@ -419,11 +483,39 @@ func (c *Context) AddPackage(pkgName string) (string, error) {
 		return "", Cerr{"pkg.GetImports", err}
 	}
 
+	never := []string{}
+	for impPath, i := range imports {
+		if c.cfg.neverMocked(impPath) {
+			if i.IsMock() {
+				imports[impPath] = importCfg{}
+				never = append(never, impPath)
+				explain(impPath, "not mocked, as it is in NeverMock "+
+					"(although marked for mocking)")
+			}
+			continue
+		}
+		if !c.cfg.isMocked(impPath) {
+			continue
+		}
+		if !i.IsMock() {
+			explain(impPath, "marked for mocking by the config")
+		}
+		if err := imports.Set(impPath, importMock, ""); err != nil {
+			return "", Cerr{"imports.Set", err}
+		}
+	}
+
 	importNames, err := c.installImports(imports)
 	if err != nil {
 		return "", Cerr{"installImports", err}
 	}
 
+	// Imports of packages that are never mocked may still have the _mock_/
+	// prefix, which needs to be removed.
+	for _, impPath := range never {
+		importNames[impPath] = impPath
+	}
+
 	newName := pkg.Label()
 	c.importRewrites[newName] = pkgName
 	importNames[pkgName] = newName
@@ -435,10 +527,11 @@ func (c *Context) AddPackage(pkgName string) (string, error) {
 
 	cfg := c.cfg.Mock(pkgName)
 
-	err = MockInterfaces(c.tmpPath, pkgName, cfg)
+	_, cleanup, err := MockInterfaces(c.tmpPath, pkgName, cfg)
 	if err != nil {
 		return "", Cerr{"MockInterfaces", err}
 	}
+	c.cleanups = append(c.cleanups, cleanup)
 
 	c.code = append(c.code, pkg.Loc())
 
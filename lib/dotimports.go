@@ -0,0 +1,278 @@
+// Copyright 2013 Julian Phillips.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lib
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// dotPackage is what we need to know about a dot imported package to be able
+// to qualify the uses of it.
+type dotPackage struct {
+	name     string
+	exported map[string]bool
+}
+
+// dotPackages caches the dot imported packages that have been loaded, by
+// import path.
+var dotPackages = map[string]*dotPackage{}
+
+// dotAlias returns the name that a dot import of the package name is given
+// when the dot import is qualified.
+func dotAlias(name string) string {
+	return "_dot_" + name
+}
+
+// loadDotPackage returns the name and exported top level names of the package
+// impPath, as imported by the package in srcPath.
+func loadDotPackage(impPath, srcPath string) (*dotPackage, error) {
+	if dp, found := dotPackages[impPath]; found {
+		return dp, nil
+	}
+
+	dir := importDir(impPath, srcPath)
+	if dir == "" {
+		return nil, fmt.Errorf("Unable to find dot imported package %s", impPath)
+	}
+
+	pkg, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, Cerr{"ImportDir", err}
+	}
+
+	dp := &dotPackage{name: pkg.Name, exported: make(map[string]bool)}
+
+	fset := token.NewFileSet()
+	for _, name := range append(pkg.GoFiles, pkg.CgoFiles...) {
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			return nil, Cerr{"ParseFile", err}
+		}
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Recv == nil && d.Name.IsExported() {
+					dp.exported[d.Name.Name] = true
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch s := spec.(type) {
+					case *ast.TypeSpec:
+						if s.Name.IsExported() {
+							dp.exported[s.Name.Name] = true
+						}
+					case *ast.ValueSpec:
+						for _, n := range s.Names {
+							if n.IsExported() {
+								dp.exported[n.Name] = true
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if !isRelativeImport(impPath) {
+		dotPackages[impPath] = dp
+	}
+
+	return dp, nil
+}
+
+// qualifyDotImports replaces any dot imports in files with a named import
+// (using dotAlias), and qualifies the uses of the names that the dot imports
+// provide.  Every package we generate exports MOCK and EXPECT, so a dot import
+// of one would clash with the ones we add.  The files that are changed are
+// parsed again (into fset), and the new source returned by base filename, as
+// the function bodies are copied from the source.
+func qualifyDotImports(fset *token.FileSet, files []*ast.File, srcPath string) ([]*ast.File, map[string][]byte, error) {
+	sources := make(map[string][]byte)
+	result := make([]*ast.File, 0, len(files))
+
+	for _, file := range files {
+		if !hasDotImport(file) {
+			result = append(result, file)
+			continue
+		}
+
+		filename := fset.Position(file.Package).Filename
+
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, nil, Cerr{"ReadFile", err}
+		}
+
+		src, err = qualifyFile(filename, src, srcPath)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+		if err != nil {
+			return nil, nil, Cerr{"ParseFile", err}
+		}
+
+		sources[filepath.Base(filename)] = src
+		result = append(result, f)
+	}
+
+	return result, sources, nil
+}
+
+func hasDotImport(file *ast.File) bool {
+	for _, s := range file.Imports {
+		if s.Name != nil && s.Name.Name == "." {
+			return true
+		}
+	}
+	return false
+}
+
+// dotEdit is a change to be made to the source of a file - replacing the
+// length bytes at offset with text.
+type dotEdit struct {
+	offset, length int
+	text           string
+}
+
+// qualifyFile returns src (read from filename) with the dot imports qualified.
+func qualifyFile(filename string, src []byte, srcPath string) ([]byte, error) {
+	// We need the identifiers to be resolved, so that we don't qualify names
+	// that are declared in the file or package.
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, Cerr{"ParseFile", err}
+	}
+
+	// aliases maps each name provided by a dot import to the alias for the
+	// package that provides it.
+	aliases := make(map[string]string)
+	dots := make(map[string]*ast.ImportSpec)
+	for _, s := range file.Imports {
+		if s.Name == nil || s.Name.Name != "." {
+			continue
+		}
+		impPath, err := strconv.Unquote(s.Path.Value)
+		if err != nil {
+			return nil, Cerr{"strconv.Unquote", err}
+		}
+		dp, err := loadDotPackage(impPath, srcPath)
+		if err != nil {
+			return nil, err
+		}
+		alias := dotAlias(dp.name)
+		for name := range dp.exported {
+			if _, found := aliases[name]; !found {
+				aliases[name] = alias
+			}
+		}
+		dots[alias] = s
+	}
+
+	edits := []dotEdit{}
+	used := make(map[string]bool)
+
+	qualify := func(id *ast.Ident) {
+		alias, found := aliases[id.Name]
+		if !found || id.Obj != nil {
+			return
+		}
+		edits = append(edits, dotEdit{
+			offset: fset.Position(id.Pos()).Offset,
+			text:   alias + ".",
+		})
+		used[alias] = true
+	}
+
+	var visit func(n ast.Node) bool
+	walk := func(n ast.Node) {
+		if n != nil {
+			ast.Inspect(n, visit)
+		}
+	}
+	visit = func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.Ident:
+			qualify(x)
+		case *ast.ImportSpec:
+			return false
+		case *ast.SelectorExpr:
+			// Only the left hand side can be a name from a dot import
+			walk(x.X)
+			return false
+		case *ast.FuncDecl:
+			// Method names aren't resolved, but aren't from a dot import
+			// either.
+			if x.Recv != nil {
+				walk(x.Recv)
+			}
+			walk(x.Type)
+			if x.Body != nil {
+				walk(x.Body)
+			}
+			return false
+		case *ast.CompositeLit:
+			walk(x.Type)
+			// The keys of a struct literal are field names, but those of a
+			// map or array literal are expressions.  When the type is elided
+			// we assume a struct.
+			keyed := true
+			switch x.Type.(type) {
+			case *ast.MapType, *ast.ArrayType:
+				keyed = false
+			}
+			for _, elt := range x.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok && keyed {
+					walk(kv.Value)
+					continue
+				}
+				walk(elt)
+			}
+			return false
+		}
+		return true
+	}
+
+	for _, decl := range file.Decls {
+		walk(decl)
+	}
+
+	// Name each dot import, or make it a blank import if nothing from it is
+	// used any more (e.g. it only provided struct field keys).
+	for alias, s := range dots {
+		name := "_"
+		if used[alias] {
+			name = alias
+		}
+		edits = append(edits, dotEdit{
+			offset: fset.Position(s.Name.Pos()).Offset,
+			length: len(s.Name.Name),
+			text:   name,
+		})
+	}
+
+	// Apply the edits from the end, so that the offsets stay valid.
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].offset > edits[j].offset
+	})
+
+	out := append([]byte{}, src...)
+	for _, e := range edits {
+		tail := append([]byte(e.text), out[e.offset+e.length:]...)
+		out = append(out[:e.offset], tail...)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,25 @@
+// Copyright 2013 Julian Phillips.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lib
+
+import (
+	"fmt"
+	"log"
+)
+
+// Explainer, if set, is told what was decided about each import - whether it
+// was mocked (and why), left real, linked unchanged or skipped as part of the
+// standard library - so that it can be seen why a package was (or wasn't)
+// mocked.  Unlike the debug logging, this is just the decisions.
+var Explainer *log.Logger
+
+// explain passes the decision about impPath to the Explainer, if there is
+// one.
+func explain(impPath, format string, args ...interface{}) {
+	if Explainer == nil {
+		return
+	}
+	Explainer.Printf("%s: %s", impPath, fmt.Sprintf(format, args...))
+}
@@ -5,9 +5,16 @@
 package lib
 
 import (
+	"bytes"
 	"fmt"
 	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"log"
 	"os"
+	"sort"
+	"strings"
 )
 
 type external struct {
@@ -70,21 +77,77 @@ func (id *ifDetails) addExternal(name, importPath, selector string) {
 }
 
 type ifInfo struct {
-	filename string
-	types    map[string]*ifDetails
-	imports  map[string]string
-	EXPECT   string
+	filename   string
+	pkgClause  string
+	types      map[string]*ifDetails
+	imports    map[string]string
+	EXPECT     string
+	buildTag   string
+	gomock     string
+	gomockName string
+	typedDo    bool
+	traceCalls bool
+	registry   bool
+	fallbacks  bool
+	fakes      bool
+
+	// declared holds the names of all the types declared in the package
+	declared map[string]bool
+	// dotImports holds the import paths of any dot imports
+	dotImports map[string]bool
+	// used holds the imports used by the generated mocks, which can include
+	// packages not imported by the package itself (e.g. those used by
+	// methods promoted from an interface in another package).
+	used map[string]string
 }
 
 func (ii *ifInfo) addImport(name, path string) {
 	ii.imports[name] = path
 }
 
-func (ii *ifInfo) addType(t *ast.TypeSpec, imports map[string]string) {
+func (ii *ifInfo) addDotImport(path string) {
+	ii.dotImports[path] = true
+}
+
+// isConstraint returns true if i contains type elements (e.g. "~int | float64"
+// or "[]byte"), which means it can only be used as a type constraint - and so
+// can't be mocked.
+func isConstraint(i *ast.InterfaceType) bool {
+	for _, f := range i.Methods.List {
+		switch v := f.Type.(type) {
+		case *ast.FuncType:
+			// Without a name, this is a func type rather than a method
+			if len(f.Names) == 0 {
+				return true
+			}
+		case *ast.Ident:
+			// Embedding comparable, or a predeclared type that isn't an
+			// interface (e.g. "int"), also makes a constraint.
+			if v.Name != "error" && v.Name != "any" && !isLocalExpr(v.Name) {
+				return true
+			}
+		case *ast.InterfaceType:
+			if isConstraint(v) {
+				return true
+			}
+		case *ast.SelectorExpr, *ast.IndexExpr, *ast.IndexListExpr:
+			// Embedded interfaces (as far as we can tell)
+		default:
+			// Anything else is a type element
+			return true
+		}
+	}
+	return false
+}
+
+func (ii *ifInfo) addType(t *ast.TypeSpec, imports map[string]string) error {
+	ii.declared[t.Name.String()] = true
+
 	i, ok := t.Type.(*ast.InterfaceType)
-	if !ok {
-		// Only care about interfaces
-		return
+	if !ok || isConstraint(i) || t.TypeParams != nil {
+		// Only care about interfaces that can be mocked (we don't generate
+		// generic mocks)
+		return nil
 	}
 
 	id := &ifDetails{}
@@ -96,8 +159,8 @@ func (ii *ifInfo) addType(t *ast.TypeSpec, imports map[string]string) {
 			for _, scope := range scopes {
 				impPath, ok := imports[scope]
 				if !ok {
-					panic(fmt.Sprintf("Unkown package %s in interface %s",
-						scope, t.Name))
+					return fmt.Errorf("Unknown package %s in interface %s",
+						scope, t.Name)
 				}
 				ii.addImport(scope, impPath)
 			}
@@ -106,22 +169,24 @@ func (ii *ifInfo) addType(t *ast.TypeSpec, imports map[string]string) {
 		case *ast.SelectorExpr:
 			p, ok := v.X.(*ast.Ident)
 			if !ok {
-				panic(fmt.Sprintf("Don't know how to handle selector of non"+
-					" Ident value: %T", v.X))
+				return fmt.Errorf("Don't know how to handle selector of non"+
+					" Ident value: %T", v.X)
 			}
 			impPath, ok := imports[p.String()]
 			if !ok {
-				panic(fmt.Sprintf("Unkown package %s in interface %s",
-					p, t.Name))
+				return fmt.Errorf("Unknown package %s in interface %s",
+					p, t.Name)
 			}
 			ii.addImport(p.String(), impPath)
 			id.addExternal(p.String(), impPath, v.Sel.String())
 		default:
-			panic(fmt.Sprintf("Don't expect %T in interface", f.Type))
+			return fmt.Errorf("Don't expect %T in interface %s", f.Type, t.Name)
 		}
 	}
 
 	ii.types[t.Name.String()] = id
+
+	return nil
 }
 
 type Interfaces map[string]*ifInfo
@@ -131,7 +196,25 @@ func newIfInfo(filename string) *ifInfo {
 		filename: filename,
 		types:    make(map[string]*ifDetails),
 		imports:  make(map[string]string),
+
+		declared:   make(map[string]bool),
+		dotImports: make(map[string]bool),
+	}
+}
+
+// dotInfo returns the information for the dot imported package impPath,
+// loading it if required.
+func (i Interfaces) dotInfo(impPath string) (*ifInfo, error) {
+	key := "." + impPath
+	if info, ok := i[key]; ok {
+		return info, nil
 	}
+	info, err := loadInterfaceInfo(impPath)
+	if err != nil {
+		return nil, Cerr{"loadInterfaceInfo", err}
+	}
+	i[key] = info
+	return info, nil
 }
 
 func (i Interfaces) getMethods(name string, tname string) ([]*funcInfo, error) {
@@ -154,14 +237,37 @@ func (i Interfaces) getMethods(name string, tname string) ([]*funcInfo, error) {
 			})
 			continue
 		}
-		if _, ok := info.types[n]; !ok {
-			return nil, fmt.Errorf("Unknown type %s in package %s", n, name)
+		if _, ok := info.types[n]; ok {
+			m, err := i.getMethods(name, n)
+			if err != nil {
+				return nil, Cerr{"i.getMethods", err}
+			}
+			methods = append(methods, m...)
+			continue
 		}
-		m, err := i.getMethods(name, n)
-		if err != nil {
-			return nil, Cerr{"i.getMethods", err}
+		// Not declared in the package, so it might be from a dot import -
+		// in which case the methods don't need scoping, as the mocks will
+		// also dot import the package.
+		found := false
+		for impPath := range info.dotImports {
+			dinfo, err := i.dotInfo(impPath)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := dinfo.types[n]; !ok {
+				continue
+			}
+			m, err := i.getMethods("."+impPath, n)
+			if err != nil {
+				return nil, Cerr{"i.getMethods", err}
+			}
+			methods = append(methods, m...)
+			found = true
+			break
+		}
+		if !found {
+			return nil, fmt.Errorf("Unknown type %s in package %s", n, name)
 		}
-		methods = append(methods, m...)
 	}
 
 	for _, e := range t.externals {
@@ -182,7 +288,359 @@ func (i Interfaces) getMethods(name string, tname string) ([]*funcInfo, error) {
 		}
 	}
 
-	return methods, nil
+	// The same method can come from more than one embedded interface (e.g.
+	// both embed io.Closer), but the mock must only have it once.
+	seen := make(map[string]bool)
+	unique := make([]*funcInfo, 0, len(methods))
+	for _, method := range methods {
+		if seen[method.name] {
+			continue
+		}
+		seen[method.name] = true
+		unique = append(unique, method)
+	}
+
+	return unique, nil
+}
+
+// isFormatter returns true if fi is a String or Error method, which gomock
+// may call itself when formatting the arguments of a call.
+func isFormatter(fi *funcInfo) bool {
+	if fi.name != "String" && fi.name != "Error" {
+		return false
+	}
+	return len(fi.params) == 0 && len(fi.results) == 1 &&
+		len(fi.results[0].names) <= 1 && fi.results[0].expr == "string"
+}
+
+// writeInController writes the _inController function, which reports whether
+// we are inside the gomock controller (e.g. it is formatting an argument for
+// an error message, with its lock held).  Routing a String or Error method
+// back through the controller at that point would deadlock.  Rather than
+// looking at the stack on every call, a count is kept around the calls that
+// the generated code makes into the controller (_callController, and
+// _finishController for the missing calls reported by Finish).  The count is
+// for the package, so String and Error mocks called by a Do action (or
+// another goroutine) during a call don't call back into the controller
+// either.  As with the call counts, a buffered channel is used as the lock.
+// gomock is the name that gomock is imported as.
+func writeInController(out io.Writer, gomock string) {
+	fmt.Fprintf(out, "var (\n")
+	fmt.Fprintf(out, "\t_inCtrlLock = make(chan struct{}, 1)\n")
+	fmt.Fprintf(out, "\t_inCtrl int\n")
+	fmt.Fprintf(out, ")\n\n")
+
+	fmt.Fprintf(out, "func _inController() bool {\n")
+	fmt.Fprintf(out, "\t_inCtrlLock <- struct{}{}\n")
+	fmt.Fprintf(out, "\tdefer func() { <-_inCtrlLock }()\n")
+	fmt.Fprintf(out, "\treturn _inCtrl > 0\n")
+	fmt.Fprintf(out, "}\n\n")
+
+	fmt.Fprintf(out, "func _enterController() (leave func()) {\n")
+	fmt.Fprintf(out, "\t_inCtrlLock <- struct{}{}\n")
+	fmt.Fprintf(out, "\t_inCtrl++\n")
+	fmt.Fprintf(out, "\t<-_inCtrlLock\n")
+	fmt.Fprintf(out, "\treturn func() {\n")
+	fmt.Fprintf(out, "\t\t_inCtrlLock <- struct{}{}\n")
+	fmt.Fprintf(out, "\t\t_inCtrl--\n")
+	fmt.Fprintf(out, "\t\t<-_inCtrlLock\n")
+	fmt.Fprintf(out, "\t}\n")
+	fmt.Fprintf(out, "}\n\n")
+
+	fmt.Fprintf(out, "func _callController(ctrl *%s.Controller, receiver interface{}, method string, args ...interface{}) []interface{} {\n", gomock)
+	fmt.Fprintf(out, "\tdefer _enterController()()\n")
+	fmt.Fprintf(out, "\treturn ctrl.Call(receiver, method, args...)\n")
+	fmt.Fprintf(out, "}\n\n")
+
+	fmt.Fprintf(out, "func _finishController(ctrl *%s.Controller) {\n", gomock)
+	fmt.Fprintf(out, "\tdefer _enterController()()\n")
+	fmt.Fprintf(out, "\tctrl.Finish()\n")
+	fmt.Fprintf(out, "}\n\n")
+}
+
+// writeController writes out the functions used to get and set the package
+// controller (_ctrl), which is guarded by a lock so that it can safely be
+// replaced (e.g. by WithController) while other goroutines are using mocks.
+// As with the call counts, a buffered channel is used as the lock.  Interface
+// mocks with their own controller use _mockController to choose it instead.
+// gomock is the name that gomock is imported as.
+func writeController(out io.Writer, gomock string) {
+	fmt.Fprintf(out, "var _ctrlLock = make(chan struct{}, 1)\n\n")
+
+	fmt.Fprintf(out, "func _controller() *%s.Controller {\n", gomock)
+	fmt.Fprintf(out, "\t_ctrlLock <- struct{}{}\n")
+	fmt.Fprintf(out, "\tdefer func() { <-_ctrlLock }()\n")
+	fmt.Fprintf(out, "\treturn _ctrl\n")
+	fmt.Fprintf(out, "}\n\n")
+
+	fmt.Fprintf(out, "func _setController(controller *%s.Controller) *%s.Controller {\n", gomock, gomock)
+	fmt.Fprintf(out, "\t_ctrlLock <- struct{}{}\n")
+	fmt.Fprintf(out, "\tdefer func() { <-_ctrlLock }()\n")
+	fmt.Fprintf(out, "\tprevious := _ctrl\n")
+	fmt.Fprintf(out, "\t_ctrl = controller\n")
+	fmt.Fprintf(out, "\treturn previous\n")
+	fmt.Fprintf(out, "}\n\n")
+
+	fmt.Fprintf(out, "func _mockController(ctrl *%s.Controller) *%s.Controller {\n", gomock, gomock)
+	fmt.Fprintf(out, "\tif ctrl != nil {\n")
+	fmt.Fprintf(out, "\t\treturn ctrl\n")
+	fmt.Fprintf(out, "\t}\n")
+	fmt.Fprintf(out, "\treturn _controller()\n")
+	fmt.Fprintf(out, "}\n\n")
+}
+
+// writeInstall writes out Install, which creates a controller for a test and
+// sets it - and if the test has a Cleanup method (as *testing.T does),
+// registers a cleanup that finishes the controller and puts back the previous
+// one.  decl is the start of the declaration, as Install is a method of _meta
+// in a mocked package.  resetCounts is set if there are call counters to reset
+// along with the calls.  gomock is the name that gomock is imported as.
+func writeInstall(out io.Writer, decl, gomock string, resetCounts bool) {
+	fmt.Fprintf(out, "%s(t %s.TestReporter) *%s.Controller {\n", decl, gomock, gomock)
+	fmt.Fprintf(out, "\tcontroller := %s.NewController(t)\n", gomock)
+	fmt.Fprintf(out, "\tprevious := _setController(controller)\n")
+	fmt.Fprintf(out, "\t_resetCalls()\n")
+	if resetCounts {
+		fmt.Fprintf(out, "\t_resetCallCounts()\n")
+	}
+	fmt.Fprintf(out, "\tif c, ok := t.(interface{ Cleanup(func()) }); ok {\n")
+	fmt.Fprintf(out, "\t\tc.Cleanup(func() {\n")
+	fmt.Fprintf(out, "\t\t\t_finishController(controller)\n")
+	fmt.Fprintf(out, "\t\t\t_setController(previous)\n")
+	fmt.Fprintf(out, "\t\t\t_resetCalls()\n")
+	if resetCounts {
+		fmt.Fprintf(out, "\t\t\t_resetCallCounts()\n")
+	}
+	fmt.Fprintf(out, "\t\t})\n")
+	fmt.Fprintf(out, "\t}\n")
+	fmt.Fprintf(out, "\treturn controller\n")
+	fmt.Fprintf(out, "}\n")
+}
+
+// writeCallsLock writes the lock shared by the bookkeeping of calls and
+// expectations (see writeCallCounts, writeCallCounters and writeFallbacks).  A
+// buffered channel is used as the lock, since importing sync (or anything
+// else) could create an import cycle when that package is the one being
+// mocked.
+func writeCallsLock(out io.Writer) {
+	fmt.Fprintf(out, "var _callsLock = make(chan struct{}, 1)\n\n")
+}
+
+// writeCallCounts writes the bookkeeping used to report expectations that
+// have been recorded but not yet called.  Each recorded call is kept, and the
+// number of calls it still needs is read from it when asked - so that Times,
+// MinTimes and AnyTimes are taken into account.  gomock doesn't export the
+// counts, so they have to be read with reflect, which is safe to import as
+// gomock already does.  If a version of gomock doesn't have the fields then
+// _pendingCalls panics, rather than quietly reporting nothing pending.
+func writeCallCounts(out io.Writer, gomock string) {
+	fmt.Fprintf(out, "type _expected struct{\n")
+	fmt.Fprintf(out, "\tname string\n")
+	fmt.Fprintf(out, "\tcall *%s.Call\n", gomock)
+	fmt.Fprintf(out, "}\n\n")
+
+	fmt.Fprintf(out, "var _expectedCalls []_expected\n\n")
+
+	fmt.Fprintf(out, "func _expectCall(name string, call *%s.Call) *%s.Call {\n", gomock, gomock)
+	fmt.Fprintf(out, "\t_callsLock <- struct{}{}\n")
+	fmt.Fprintf(out, "\t_expectedCalls = append(_expectedCalls, _expected{name, call})\n")
+	fmt.Fprintf(out, "\t<-_callsLock\n")
+	fmt.Fprintf(out, "\treturn call\n")
+	fmt.Fprintf(out, "}\n\n")
+
+	fmt.Fprintf(out, "func _resetCalls() {\n")
+	fmt.Fprintf(out, "\t_callsLock <- struct{}{}\n")
+	fmt.Fprintf(out, "\t_expectedCalls = nil\n")
+	fmt.Fprintf(out, "\t<-_callsLock\n")
+	fmt.Fprintf(out, "}\n\n")
+
+	// The result is sorted by hand, as sort may be the package being mocked.
+	fmt.Fprintf(out, "func _pendingCalls() []string {\n")
+	fmt.Fprintf(out, "\t_callsLock <- struct{}{}\n")
+	fmt.Fprintf(out, "\tdefer func() { <-_callsLock }()\n")
+	fmt.Fprintf(out, "\tpending := []string{}\n")
+	fmt.Fprintf(out, "\tfor _, e := range _expectedCalls {\n")
+	fmt.Fprintf(out, "\t\tc := _reflect.ValueOf(e.call).Elem()\n")
+	fmt.Fprintf(out, "\t\tmin, num := c.FieldByName(\"minCalls\"), c.FieldByName(\"numCalls\")\n")
+	fmt.Fprintf(out, "\t\tif !min.IsValid() || !num.IsValid() {\n")
+	fmt.Fprintf(out, "\t\t\tpanic(\"withmock: can't find the call counts in %s.Call for PendingExpectations\")\n", gomock)
+	fmt.Fprintf(out, "\t\t}\n")
+	fmt.Fprintf(out, "\t\tfor i := num.Int(); i < min.Int(); i++ {\n")
+	fmt.Fprintf(out, "\t\t\tpending = append(pending, e.name)\n")
+	fmt.Fprintf(out, "\t\t}\n")
+	fmt.Fprintf(out, "\t}\n")
+	fmt.Fprintf(out, "\tfor i := 1; i < len(pending); i++ {\n")
+	fmt.Fprintf(out, "\t\tfor j := i; j > 0 && pending[j] < pending[j-1]; j-- {\n")
+	fmt.Fprintf(out, "\t\t\tpending[j], pending[j-1] = pending[j-1], pending[j]\n")
+	fmt.Fprintf(out, "\t\t}\n")
+	fmt.Fprintf(out, "\t}\n")
+	fmt.Fprintf(out, "\treturn pending\n")
+	fmt.Fprintf(out, "}\n\n")
+}
+
+// writeCallCounters writes the functions used to keep the counts of mocked
+// calls by name for CallCount (when CountCalls is set).  Unlike the counts
+// used for PendingExpectations, these are also reset by MockAll.  They share
+// the lock written by writeCallsLock.
+func writeCallCounters(out io.Writer) {
+	fmt.Fprintf(out, "var _callCounts = make(map[string]int)\n\n")
+
+	fmt.Fprintf(out, "func _addCallCount(name string) {\n")
+	fmt.Fprintf(out, "\t_callsLock <- struct{}{}\n")
+	fmt.Fprintf(out, "\t_callCounts[name]++\n")
+	fmt.Fprintf(out, "\t<-_callsLock\n")
+	fmt.Fprintf(out, "}\n\n")
+
+	fmt.Fprintf(out, "func _callCount(name string) int {\n")
+	fmt.Fprintf(out, "\t_callsLock <- struct{}{}\n")
+	fmt.Fprintf(out, "\tdefer func() { <-_callsLock }()\n")
+	fmt.Fprintf(out, "\treturn _callCounts[name]\n")
+	fmt.Fprintf(out, "}\n\n")
+
+	fmt.Fprintf(out, "func _resetCallCounts() {\n")
+	fmt.Fprintf(out, "\t_callsLock <- struct{}{}\n")
+	fmt.Fprintf(out, "\t_callCounts = make(map[string]int)\n")
+	fmt.Fprintf(out, "\t<-_callsLock\n")
+	fmt.Fprintf(out, "}\n\n")
+}
+
+// canFallback returns true if the mock of an interface with methods can have a
+// Fallback field, which it can't if one of the methods has the same name.
+func canFallback(methods []*funcInfo) bool {
+	for _, m := range methods {
+		if m.name == "Fallback" {
+			return false
+		}
+	}
+	return true
+}
+
+// writeMockType writes out the struct for the mock of the interface tname,
+// the struct for its recorder, and the NewMock constructor.  Each mock can
+// have its own controller, given to NewMock - otherwise (or if it is nil) the
+// package controller is used.  If fallback is set, then the mock has a
+// Fallback field - calls to methods without any expectations recorded on the
+// mock are passed to the Fallback (if it has been set) instead of gomock
+// (which is imported as the name gomock).
+func writeMockType(out io.Writer, tname string, fallback bool, gomock string) {
+	fmt.Fprintf(out, "type Mock%s struct{\n", tname)
+	if fallback {
+		fmt.Fprintf(out, "\tFallback %s\n", tname)
+		fmt.Fprintf(out, "\t_expected map[string]bool\n")
+	}
+	fmt.Fprintf(out, "\t_ctrl *%s.Controller\n", gomock)
+	fmt.Fprintf(out, "}\n")
+	fmt.Fprintf(out, "type _mock_%s_rec struct{\n", tname)
+	fmt.Fprintf(out, "\tmock *Mock%s\n", tname)
+	fmt.Fprintf(out, "}\n\n")
+
+	fmt.Fprintf(out, "func NewMock%s(ctrl *%s.Controller) *Mock%s {\n", tname, gomock, tname)
+	fmt.Fprintf(out, "\treturn &Mock%s{_ctrl: ctrl}\n", tname)
+	fmt.Fprintf(out, "}\n\n")
+}
+
+// writeFallbacks writes the functions used to keep track of which methods of
+// a mock with a Fallback have had expectations recorded.  They share the lock
+// written by writeCallsLock.
+func writeFallbacks(out io.Writer) {
+	fmt.Fprintf(out, "func _expectMethod(expected *map[string]bool, name string) {\n")
+	fmt.Fprintf(out, "\t_callsLock <- struct{}{}\n")
+	fmt.Fprintf(out, "\tif *expected == nil {\n")
+	fmt.Fprintf(out, "\t\t*expected = make(map[string]bool)\n")
+	fmt.Fprintf(out, "\t}\n")
+	fmt.Fprintf(out, "\t(*expected)[name] = true\n")
+	fmt.Fprintf(out, "\t<-_callsLock\n")
+	fmt.Fprintf(out, "}\n\n")
+
+	fmt.Fprintf(out, "func _isExpected(expected *map[string]bool, name string) bool {\n")
+	fmt.Fprintf(out, "\t_callsLock <- struct{}{}\n")
+	fmt.Fprintf(out, "\tdefer func() { <-_callsLock }()\n")
+	fmt.Fprintf(out, "\treturn (*expected)[name]\n")
+	fmt.Fprintf(out, "}\n\n")
+}
+
+// writeRegistry writes out MockRegistry, which maps each of the interface names
+// to its NewMock constructor - so the new mock uses the controller passed to
+// the function, or the package controller if that is nil.  gomock is the name
+// that gomock is imported as.
+func writeRegistry(out io.Writer, names []string, gomock string) {
+	sort.Strings(names)
+
+	fmt.Fprintf(out, "var MockRegistry = map[string]func(*%s.Controller) interface{}{\n", gomock)
+	for _, tname := range names {
+		fmt.Fprintf(out, "\t\"%s\": func(ctrl *%s.Controller) interface{} {\n", tname, gomock)
+		fmt.Fprintf(out, "\t\treturn NewMock%s(ctrl)\n", tname)
+		fmt.Fprintf(out, "\t},\n")
+	}
+	fmt.Fprintf(out, "}\n\n")
+}
+
+// canFake returns true if a fake can be written for an interface with methods,
+// which it can't if a method has the same name as the func field for another
+// method (e.g. Get and GetFunc).
+func canFake(methods []*funcInfo) bool {
+	names := make(map[string]bool)
+	for _, m := range methods {
+		names[m.name] = true
+	}
+	for _, m := range methods {
+		if names[m.name+"Func"] {
+			return false
+		}
+	}
+	return true
+}
+
+// writeFake writes out the Fake<tname> struct for the interface tname, which
+// has a func field for each of methods.  Each method of the fake calls the
+// field if it has been set, and otherwise returns the zero values of its
+// results.
+func writeFake(out io.Writer, tname string, methods []*funcInfo) {
+	fmt.Fprintf(out, "type Fake%s struct{\n", tname)
+	for _, m := range methods {
+		fmt.Fprintf(out, "\t%sFunc func(", m.name)
+		m.writeParams(out, "")
+		fmt.Fprintf(out, ") (%s)\n", strings.Join(m.retTypes(), ", "))
+	}
+	fmt.Fprintf(out, "}\n\n")
+
+	// Make sure that our fake satisifies the interface
+	fmt.Fprintf(out, "var _ %s = &Fake%s{}\n\n", tname, tname)
+
+	for _, m := range methods {
+		// The results are named, so that a bare return gives the zero values
+		returns := m.retTypes()
+		l := localPrefix(returns)
+		fmt.Fprintf(out, "func (_f *Fake%s) %s(", tname, m.name)
+		args := m.writeParams(out, l)
+		fmt.Fprintf(out, ") (")
+		for i, ret := range returns {
+			if i > 0 {
+				fmt.Fprintf(out, ", ")
+			}
+			fmt.Fprintf(out, "%sret%d %s", l, i, ret)
+		}
+		fmt.Fprintf(out, ") {\n")
+		fmt.Fprintf(out, "\tif _f.%sFunc != nil {\n", m.name)
+		fmt.Fprintf(out, "\t\t")
+		if len(returns) > 0 {
+			fmt.Fprintf(out, "return ")
+		}
+		fmt.Fprintf(out, "_f.%sFunc(", m.name)
+		for i := 0; i < args; i++ {
+			if i > 0 {
+				fmt.Fprintf(out, ", ")
+			}
+			fmt.Fprintf(out, "%sp%d", l, i)
+		}
+		if m.varidic {
+			fmt.Fprintf(out, "...")
+		}
+		fmt.Fprintf(out, ")\n")
+		fmt.Fprintf(out, "\t}\n")
+		fmt.Fprintf(out, "\treturn\n")
+		fmt.Fprintf(out, "}\n\n")
+	}
 }
 
 func (i Interfaces) genInterface(name string) error {
@@ -194,40 +652,100 @@ func (i Interfaces) genInterface(name string) error {
 	}
 	defer out.Close()
 
-	fmt.Fprintf(out, "package %s\n\n", name)
-	fmt.Fprintf(out, "import (\n")
-	for name, impPath := range info.imports {
-		fmt.Fprintf(out, "\t%s \"%s\"\n", name, impPath)
+	if info.buildTag != "" {
+		if err := writeBuildTag(out, info.buildTag, nil); err != nil {
+			return err
+		}
 	}
-	fmt.Fprintf(out, "\tgomock \"github.com/golang/mock/gomock\"\n")
-	fmt.Fprintf(out, ")\n\n")
-	for tname := range info.types {
-		fmt.Fprintf(out, "type Mock%s struct{int}\n", tname)
-		fmt.Fprintf(out, "type _mock_%s_rec struct{\n", tname)
-		fmt.Fprintf(out, "\tmock *Mock%s\n", tname)
-		fmt.Fprintf(out, "}\n\n")
 
-		// Make sure that our mock satisifies the interface
-		fmt.Fprintf(out, "var _ %s = &Mock%s{}\n", tname, tname)
+	// Write the mocks into a buffer first, so that we know which imports are
+	// actually needed.
+	body := &bytes.Buffer{}
+	gomock := gomockName(info.gomockName)
 
-		fmt.Fprintf(out, "func (_ *_meta) New%s() *Mock%s {\n", tname, tname)
-		fmt.Fprintf(out, "\treturn &Mock%s{}\n", tname)
-		fmt.Fprintf(out, "}\n")
-		fmt.Fprintf(out, "func (_m *Mock%s) %s() *_mock_%s_rec {\n",
-			tname, info.EXPECT, tname)
-		fmt.Fprintf(out, "\treturn &_mock_%s_rec{_m}\n", tname)
-		fmt.Fprintf(out, "}\n\n")
+	if info.fallbacks {
+		writeFallbacks(body)
+	}
 
+	for tname := range info.types {
 		methods, err := i.getMethods(name, tname)
 		if err != nil {
 			return Cerr{"getMethods", err}
 		}
 
+		fallback := info.fallbacks && canFallback(methods)
+		writeMockType(body, tname, fallback, gomock)
+
+		// Make sure that our mock satisifies the interface
+		fmt.Fprintf(body, "var _ %s = &Mock%s{}\n", tname, tname)
+
+		fmt.Fprintf(body, "func (_ *_meta) New%s() *Mock%s {\n", tname, tname)
+		fmt.Fprintf(body, "\treturn &Mock%s{}\n", tname)
+		fmt.Fprintf(body, "}\n")
+		fmt.Fprintf(body, "func (_m *Mock%s) %s() *_mock_%s_rec {\n",
+			tname, info.EXPECT, tname)
+		fmt.Fprintf(body, "\treturn &_mock_%s_rec{_m}\n", tname)
+		fmt.Fprintf(body, "}\n\n")
+
 		for _, m := range methods {
 			m.recv.expr = "*Mock" + tname
-			m.writeMock(out)
-			m.writeRecorder(out, "_mock_"+tname+"_rec")
+			m.formatter = isFormatter(m)
+			m.trace = info.traceCalls
+			m.fallback = fallback
+			m.ownCtrl = true
+			m.gomock = info.gomockName
+			m.writeMock(body)
+			m.writeRecorder(body, "_mock_"+tname+"_rec")
+			if info.typedDo {
+				m.writeTypedDo(body, "_mock_"+tname+"_rec")
+			}
+		}
+
+		if info.fakes {
+			if canFake(methods) {
+				writeFake(body, tname, methods)
+			} else {
+				log.Printf("Not writing Fake%s, as a method clashes with a Func field", tname)
+			}
+		}
+	}
+
+	if info.registry {
+		names := make([]string, 0, len(info.types))
+		for tname := range info.types {
+			names = append(names, tname)
 		}
+		writeRegistry(body, names, gomock)
+	}
+
+	imports, err := i.usedImports(name, body.Bytes())
+	if err != nil {
+		return Cerr{"usedImports", err}
+	}
+	info.used = imports
+
+	dotImports, err := i.usedDotImports(name, body.Bytes())
+	if err != nil {
+		return Cerr{"usedDotImports", err}
+	}
+
+	pkgClause := name
+	if info.pkgClause != "" {
+		pkgClause = info.pkgClause
+	}
+
+	fmt.Fprintf(out, "package %s\n\n", pkgClause)
+	fmt.Fprintf(out, "import (\n")
+	for _, impPath := range dotImports {
+		fmt.Fprintf(out, "\t. \"%s\"\n", impPath)
+	}
+	for name, impPath := range imports {
+		fmt.Fprintf(out, "\t%s \"%s\"\n", name, impPath)
+	}
+	fmt.Fprintf(out, ")\n\n")
+
+	if _, err := out.Write(body.Bytes()); err != nil {
+		return Cerr{"out.Write", err}
 	}
 
 	return nil
@@ -242,50 +760,234 @@ func (i Interfaces) genExtInterface(name string, extPkg string) error {
 	}
 	defer out.Close()
 
-	fmt.Fprintf(out, "package %s\n\n", name)
-	fmt.Fprintf(out, "import (\n")
-	fmt.Fprintf(out, "\t. \"%s\"\n", extPkg)
-	for name, impPath := range info.imports {
-		fmt.Fprintf(out, "\t%s \"%s\"\n", name, impPath)
+	if info.buildTag != "" {
+		if err := writeBuildTag(out, info.buildTag, nil); err != nil {
+			return err
+		}
 	}
-	fmt.Fprintf(out, "\tgomock \"github.com/golang/mock/gomock\"\n")
-	fmt.Fprintf(out, ")\n\n")
 
-	fmt.Fprintf(out, "var (\n")
-	fmt.Fprintf(out, "\t_ctrl *gomock.Controller\n")
-	fmt.Fprintf(out, ")\n\n")
+	body := &bytes.Buffer{}
+	gomock := gomockName(info.gomockName)
 
-	fmt.Fprintf(out, "func SetController(controller *gomock.Controller) {\n")
-	fmt.Fprintf(out, "\t_ctrl = controller\n")
-	fmt.Fprintf(out, "}\n")
+	fmt.Fprintf(body, "var (\n")
+	fmt.Fprintf(body, "\t_ctrl *%s.Controller\n", gomock)
+	if info.traceCalls {
+		fmt.Fprintf(body, "\t_tracer func(name string, args []interface{})\n")
+	}
+	fmt.Fprintf(body, ")\n\n")
 
-	for tname := range info.types {
-		fmt.Fprintf(out, "type Mock%s struct{int}\n", tname)
-		fmt.Fprintf(out, "type _mock_%s_rec struct{\n", tname)
-		fmt.Fprintf(out, "\tmock *Mock%s\n", tname)
-		fmt.Fprintf(out, "}\n\n")
+	fmt.Fprintf(body, "func SetController(controller *%s.Controller) {\n", gomock)
+	fmt.Fprintf(body, "\t_setController(controller)\n")
+	fmt.Fprintf(body, "\t_resetCalls()\n")
+	fmt.Fprintf(body, "}\n")
 
-		// Make sure that our mock satisifies the interface
-		fmt.Fprintf(out, "var _ %s = &Mock%s{}\n", tname, tname)
+	fmt.Fprintf(body, "func WithController(controller *%s.Controller) (restore func()) {\n", gomock)
+	fmt.Fprintf(body, "\tprevious := _setController(controller)\n")
+	fmt.Fprintf(body, "\treturn func() { _setController(previous) }\n")
+	fmt.Fprintf(body, "}\n")
 
-		fmt.Fprintf(out, "func (_m *Mock%s) %s() *_mock_%s_rec {\n",
-			tname, info.EXPECT, tname)
-		fmt.Fprintf(out, "\treturn &_mock_%s_rec{_m}\n", tname)
-		fmt.Fprintf(out, "}\n\n")
+	writeInstall(body, "func Install", gomock, false)
+
+	if info.traceCalls {
+		fmt.Fprintf(body, "func SetTracer(tracer func(name string, args []interface{})) {\n")
+		fmt.Fprintf(body, "\t_tracer = tracer\n")
+		fmt.Fprintf(body, "}\n")
+	}
+
+	fmt.Fprintf(body, "func Finish() {\n")
+	fmt.Fprintf(body, "\t_finishController(_controller())\n")
+	fmt.Fprintf(body, "}\n")
+
+	fmt.Fprintf(body, "func PendingExpectations() []string {\n")
+	fmt.Fprintf(body, "\treturn _pendingCalls()\n")
+	fmt.Fprintf(body, "}\n")
+
+	fmt.Fprintf(body, "func ExpectInOrder(calls ...*%s.Call) {\n", gomock)
+	fmt.Fprintf(body, "\t%s.InOrder(calls...)\n", gomock)
+	fmt.Fprintf(body, "}\n")
+
+	writeInController(body, gomock)
+	writeController(body, gomock)
+	writeCallsLock(body)
+	writeCallCounts(body, gomock)
+
+	if info.fallbacks {
+		writeFallbacks(body)
+	}
+
+	mocked := []string{}
+	for tname := range info.types {
+		if !ast.IsExported(tname) {
+			// Unexported interfaces can't be used through the dot import
+			continue
+		}
+		mocked = append(mocked, tname)
 
 		methods, err := i.getMethods(name, tname)
 		if err != nil {
 			return err
 		}
 
+		fallback := info.fallbacks && canFallback(methods)
+		writeMockType(body, tname, fallback, gomock)
+
+		// Make sure that our mock satisifies the interface
+		fmt.Fprintf(body, "var _ %s = &Mock%s{}\n", tname, tname)
+
+		fmt.Fprintf(body, "func (_m *Mock%s) %s() *_mock_%s_rec {\n",
+			tname, info.EXPECT, tname)
+		fmt.Fprintf(body, "\treturn &_mock_%s_rec{_m}\n", tname)
+		fmt.Fprintf(body, "}\n\n")
+
 		for _, m := range methods {
 			m.recv.expr = "*Mock" + tname
-			m.writeMock(out)
-			m.writeRecorder(out, "_mock_"+tname+"_rec")
+			m.formatter = isFormatter(m)
+			m.trace = info.traceCalls
+			m.fallback = fallback
+			m.ownCtrl = true
+			m.gomock = info.gomockName
+			m.writeMock(body)
+			m.writeRecorder(body, "_mock_"+tname+"_rec")
+			if info.typedDo {
+				m.writeTypedDo(body, "_mock_"+tname+"_rec")
+			}
+		}
+
+		if info.fakes {
+			if canFake(methods) {
+				writeFake(body, tname, methods)
+			} else {
+				log.Printf("Not writing Fake%s, as a method clashes with a Func field", tname)
+			}
 		}
 	}
 
-	return nil
+	if info.registry {
+		writeRegistry(body, mocked, gomock)
+	}
+
+	imports, err := i.usedImports(name, body.Bytes())
+	if err != nil {
+		return err
+	}
+
+	info.used = imports
+
+	dotImports, err := i.usedDotImports(name, body.Bytes())
+	if err != nil {
+		return err
+	}
+
+	pkgClause := name
+	if info.pkgClause != "" {
+		pkgClause = info.pkgClause
+	}
+
+	fmt.Fprintf(out, "package %s\n\n", pkgClause)
+	fmt.Fprintf(out, "import (\n")
+	if len(mocked) > 0 {
+		// The dot import is only used by the interface assertions
+		fmt.Fprintf(out, "\t. \"%s\"\n", extPkg)
+	}
+	for _, impPath := range dotImports {
+		fmt.Fprintf(out, "\t. \"%s\"\n", impPath)
+	}
+	for name, impPath := range imports {
+		fmt.Fprintf(out, "\t%s \"%s\"\n", name, impPath)
+	}
+	fmt.Fprintf(out, ")\n\n")
+
+	_, err = out.Write(body.Bytes())
+	return err
+}
+
+// usedImports returns the imports that are referenced by src, which should be
+// the generated declarations for the interface mocks of the named package.
+// Methods promoted from embedded interfaces in other packages may refer to
+// that package's imports, so those are considered too.
+func (i Interfaces) usedImports(name string, src []byte) (map[string]string, error) {
+	available := map[string]string{
+		gomockName(i[name].gomockName): gomockPath(i[name].gomock),
+		"_reflect":                     "reflect",
+	}
+	for n, impPath := range i[name].imports {
+		available[n] = impPath
+	}
+	for _, info := range i {
+		for n, impPath := range info.imports {
+			if _, found := available[n]; !found {
+				available[n] = impPath
+			}
+		}
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", append([]byte("package "+name+"\n"), src...), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]string)
+	ast.Inspect(f, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil {
+			if impPath, found := available[x.Name]; found {
+				used[x.Name] = impPath
+			}
+		}
+		return true
+	})
+
+	return used, nil
+}
+
+// usedDotImports returns the dot imports of the named package that declare
+// types referenced by src (as with usedImports).  Unused dot imports would stop
+// the generated code compiling, so we only return those that are needed.
+func (i Interfaces) usedDotImports(name string, src []byte) ([]string, error) {
+	if len(i[name].dotImports) == 0 {
+		return nil, nil
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", append([]byte("package "+name+"\n"), src...), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	idents := make(map[string]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch v := n.(type) {
+		case *ast.SelectorExpr:
+			// Qualified identifiers can't come from a dot import
+			return false
+		case *ast.Ident:
+			if v.Obj == nil {
+				idents[v.Name] = true
+			}
+		}
+		return true
+	})
+
+	used := []string{}
+	for impPath := range i[name].dotImports {
+		info, err := i.dotInfo(impPath)
+		if err != nil {
+			return nil, err
+		}
+		for n := range info.declared {
+			if idents[n] {
+				used = append(used, impPath)
+				break
+			}
+		}
+	}
+	sort.Strings(used)
+
+	return used, nil
 }
 
 func genInterfaces(interfaces Interfaces) error {
@@ -300,8 +1002,6 @@ func genInterfaces(interfaces Interfaces) error {
 			return Cerr{"genInterface", err}
 		}
 
-		// TODO: currently we need to use goimports to add missing imports, we
-		// need to sort out our own imports, then we can switch to gofmt.
 		if err := fixup(i.filename); err != nil {
 			return Cerr{"fixup", err}
 		}
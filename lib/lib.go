@@ -9,19 +9,28 @@ import (
 	"fmt"
 	"go/parser"
 	"go/token"
+	"io"
 	"log"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"strings"
 )
 
+// LookupImportPath returns the directory containing the source for the package
+// impPath.  impPath may include a version (e.g. example.com/mod/pkg@v1.2.3), in
+// which case the source is found in the module cache.
 func LookupImportPath(impPath string) (string, error) {
 	if strings.HasPrefix(impPath, "_/") {
 		// special case if impPath is outside of GOPATH
 		return impPath[1:], nil
 	}
 
+	if i := strings.Index(impPath, "@"); i >= 0 {
+		return lookupModulePath(impPath[:i], impPath[i+1:])
+	}
+
 	path, err := GetOutput("go", "list", "-e", "-f", "{{.Dir}}", impPath)
 	if err != nil {
 		return "", err
@@ -31,17 +40,65 @@ func LookupImportPath(impPath string) (string, error) {
 		return "", fmt.Errorf("Unable to find package: %s", impPath)
 	}
 
+	// A pattern (e.g. "./...") lists a directory for each matching package,
+	// but we need exactly one.
+	if strings.Contains(path, "\n") {
+		return "", fmt.Errorf("Import path %s matches more than one "+
+			"package:\n%s", impPath, path)
+	}
+
+	if !exists(path) {
+		return "", fmt.Errorf("Directory %s for package %s does not exist",
+			path, impPath)
+	}
+
 	return path, nil
 }
 
+// lookupModulePath finds the directory for the package impPath at the given
+// version of the module that contains it.  We don't know which part of impPath
+// is the module path, so we try each parent path in turn.  Versions are only
+// known to the go command in module mode, so GOPATH mode is an error.
+func lookupModulePath(impPath, version string) (string, error) {
+	if gomod, err := GetOutput("go", "env", "GOMOD"); err == nil && gomod == "" {
+		return "", fmt.Errorf("Unable to find %s@%s: module mode is needed "+
+			"for a version (GO111MODULE is off)", impPath, version)
+	}
+
+	modPath, sub := impPath, ""
+	for modPath != "." && modPath != "/" {
+		dir, err := GetOutput("go", "list", "-m", "-f", "{{.Dir}}",
+			modPath+"@"+version)
+		if err == nil {
+			if dir == "" {
+				return "", fmt.Errorf("Module %s@%s is not in the module "+
+					"cache (try go mod download)", modPath, version)
+			}
+			return filepath.Join(dir, filepath.FromSlash(sub)), nil
+		}
+		sub = path.Join(path.Base(modPath), sub)
+		modPath = path.Dir(modPath)
+	}
+	return "", fmt.Errorf("Unable to find module for package: %s@%s", impPath,
+		version)
+}
+
 func GetOutput(name string, args ...string) (string, error) {
 	return GetCmdOutput(exec.Command(name, args...))
 }
 
+// GetOutputIn is like GetOutput, but runs the command in dir (or the current
+// directory if dir is empty) - rather than having to change directory.
+func GetOutputIn(dir, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	return GetCmdOutput(cmd)
+}
+
 func GetCmdOutput(cmd *exec.Cmd) (string, error) {
 	buf := &bytes.Buffer{}
 	cmd.Stderr = buf
-	out, err := cmd.Output()
+	out, err := Runner.Output(cmd)
 	if err != nil {
 		return "", fmt.Errorf("External program '%s' failed (%s), with "+
 			"output:\n%s", cmd.Args[0], err, buf.String())
@@ -109,8 +166,8 @@ func GetImports(path string, tests bool) (importSet, error) {
 				path := strings.Trim(i.Path.Value, "\"")
 				comment := strings.TrimSpace(i.Comment.Text())
 
-				if strings.HasPrefix(path, "_mock_/") {
-					path = path[7:]
+				if real, found := splitMockPrefix(path); found {
+					path = real
 					comment = "mock"
 				}
 
@@ -136,6 +193,12 @@ func GetImports(path string, tests bool) (importSet, error) {
 }
 
 func GetMockedPackages(path string) (map[string]string, error) {
+	return getMockedPackages(path, &Config{})
+}
+
+// getMockedPackages is the same as GetMockedPackages, but also includes any
+// packages that cfg says should be mocked.
+func getMockedPackages(path string, cfg *Config) (map[string]string, error) {
 	imports := make(map[string]string)
 
 	fset := token.NewFileSet()
@@ -146,22 +209,37 @@ func GetMockedPackages(path string) (map[string]string, error) {
 	}
 
 	for _, i := range file.Imports {
-		impPath := strings.Trim(i.Path.Value, "\"")
+		impPath, prefixed := splitMockPrefix(strings.Trim(i.Path.Value, "\""))
 		comment := strings.TrimSpace(i.Comment.Text())
-		mock := strings.ToLower(comment) == "mock"
-		if strings.HasPrefix(impPath, "_mock_/") {
-			mock = true
+		reason := ""
+		switch {
+		case prefixed:
+			reason = "the " + mockPrefix + " prefix"
+		case strings.ToLower(comment) == "mock":
+			reason = "a \"// " + comment + "\" comment"
+		case cfg.isMocked(impPath):
+			reason = "the config"
 		}
 
-		if !mock {
+		switch {
+		case reason == "":
+			explain(impPath, "left real, as it isn't marked for mocking")
+			continue
+		case cfg.neverMocked(impPath):
+			explain(impPath, "left real, as it is in NeverMock (although "+
+				"marked for mocking by %s)", reason)
 			continue
 		}
+		explain(impPath, "mocked, as it is marked for mocking by %s", reason)
 
 		if i.Name != nil {
 			imports[i.Name.String()] = impPath
+		} else if name := cfg.names[impPath]; name != "" {
+			imports[name] = impPath
 		} else {
 			// TODO: pkgName for vendor paths?
-			name, err := getPackageName(impPath, filepath.Dir(path), "")
+			resolve := cfg.Mock(impPath).ResolvePackageName
+			name, err := resolvePackageName(resolve, impPath, filepath.Dir(path), "")
 			if err != nil {
 				return nil, err
 			}
@@ -196,17 +274,31 @@ func getStdlibImports(path string) (map[string]bool, error) {
 //  + : normal (no mark actually applied)
 //  @ : test
 //  = : replace
-type mark string
+type Mark string
 
 const (
-	noMark      mark = ""
-	normalMark  mark = "+"
-	mockMark    mark = "_"
-	testMark    mark = "@"
-	replaceMark mark = "="
+	noMark      Mark = ""
+	normalMark  Mark = "+"
+	mockMark    Mark = "_"
+	testMark    Mark = "@"
+	replaceMark Mark = "="
 )
 
-func markImport(name string, m mark) string {
+// mockPrefix can be put at the start of an import path in the source to mark
+// it for mocking, instead of using a "// mock" comment - e.g.
+// "_mock_/example.com/pkg" imports a mock of example.com/pkg.
+const mockPrefix = "_mock_/"
+
+// splitMockPrefix returns impPath without mockPrefix, and true if it was
+// there.
+func splitMockPrefix(impPath string) (string, bool) {
+	if strings.HasPrefix(impPath, mockPrefix) {
+		return impPath[len(mockPrefix):], true
+	}
+	return impPath, false
+}
+
+func markImport(name string, m Mark) string {
 	switch m {
 	case noMark, normalMark:
 		return name
@@ -217,7 +309,7 @@ func markImport(name string, m mark) string {
 	}
 }
 
-func getMark(label string) mark {
+func getMark(label string) Mark {
 	switch label[0] {
 	case mockMark[0]:
 		return mockMark
@@ -443,3 +535,44 @@ func symlinkPackage(src, dst string) error {
 	// Now use walk to process the files in src
 	return filepath.Walk(src, fn)
 }
+
+// copyTree copies src (which can be a file or a directory) to dst.  This is
+// needed for files used by //go:embed, as it refuses to follow symlinks.
+func copyTree(src, dst string) error {
+	fn := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+
+		if info.Mode().IsDir() {
+			return os.MkdirAll(target, 0700)
+		}
+
+		r, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		w, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(w, r); err != nil {
+			w.Close()
+			return err
+		}
+
+		return w.Close()
+	}
+
+	return filepath.Walk(src, fn)
+}
@@ -0,0 +1,752 @@
+// Copyright 2013 Julian Phillips.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Don't keep the keys of the files generated by the tests in the user's
+	// cache (tests that want them set WITHMOCK_CACHE_DIR).
+	os.Setenv("WITHMOCK_DISABLE_CACHE", "1")
+	os.Exit(m.Run())
+}
+
+// stubRunner is a CommandRunner that returns canned output for known command
+// lines, and fails for anything else.  Commands run in a directory have the
+// directory in parens at the start of the line.
+type stubRunner struct {
+	outputs map[string]string
+	calls   []string
+}
+
+func (s *stubRunner) Output(cmd *exec.Cmd) ([]byte, error) {
+	line := strings.Join(cmd.Args, " ")
+	if cmd.Dir != "" {
+		line = "(" + cmd.Dir + ") " + line
+	}
+	s.calls = append(s.calls, line)
+	out, found := s.outputs[line]
+	if !found {
+		if cmd.Stderr != nil {
+			fmt.Fprintf(cmd.Stderr, "unknown command: %s\n", line)
+		}
+		return nil, fmt.Errorf("exit status 1")
+	}
+	return []byte(out + "\n"), nil
+}
+
+func (s *stubRunner) CombinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	return s.Output(cmd)
+}
+
+func useStubRunner(t *testing.T, outputs map[string]string) *stubRunner {
+	s := &stubRunner{outputs: outputs}
+	orig, origNames := Runner, pkgNames
+	Runner, pkgNames = s, map[string]string{}
+	t.Cleanup(func() {
+		Runner, pkgNames = orig, origNames
+	})
+	return s
+}
+
+func TestLookupImportPath(t *testing.T) {
+	found := t.TempDir()
+	other := t.TempDir()
+
+	useStubRunner(t, map[string]string{
+		"go list -e -f {{.Dir}} example.com/found":   found,
+		"go list -e -f {{.Dir}} example.com/missing": "",
+		"go list -e -f {{.Dir}} example.com/gone":    "/src/example.com/gone",
+		"go list -e -f {{.Dir}} example.com/...":     found + "\n" + other,
+	})
+
+	path, err := LookupImportPath("example.com/found")
+	if err != nil || path != found {
+		t.Errorf("Expected %s, got %q (err: %v)", found, path, err)
+	}
+
+	if _, err := LookupImportPath("example.com/missing"); err == nil {
+		t.Errorf("Expected error for missing package")
+	}
+
+	// The directory must exist, even if go list gave it
+	_, err = LookupImportPath("example.com/gone")
+	if err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("Expected error for missing directory, got: %v", err)
+	}
+
+	// Patterns can match more than one package, which is an error
+	_, err = LookupImportPath("example.com/...")
+	if err == nil || !strings.Contains(err.Error(), "more than one package") {
+		t.Errorf("Expected error for multiple directories, got: %v", err)
+	}
+
+	path, err = LookupImportPath("_/outside/gopath")
+	if err != nil || path != "/outside/gopath" {
+		t.Errorf("Expected /outside/gopath, got %q (err: %v)", path, err)
+	}
+}
+
+func TestLookupImportPathVersioned(t *testing.T) {
+	useStubRunner(t, map[string]string{
+		"go env GOMOD": "/work/go.mod",
+		"go list -m -f {{.Dir}} example.com/mod@v1.2.3":     "/cache/example.com/mod@v1.2.3",
+		"go list -m -f {{.Dir}} example.com/notcached@v1.0": "",
+	})
+
+	path, err := LookupImportPath("example.com/mod@v1.2.3")
+	if err != nil || path != "/cache/example.com/mod@v1.2.3" {
+		t.Errorf("Expected module dir, got %q (err: %v)", path, err)
+	}
+
+	// Packages inside the module are found relative to the module dir
+	path, err = LookupImportPath("example.com/mod/sub/pkg@v1.2.3")
+	if err != nil || path != "/cache/example.com/mod@v1.2.3/sub/pkg" {
+		t.Errorf("Expected package dir, got %q (err: %v)", path, err)
+	}
+
+	if _, err := LookupImportPath("example.com/notcached@v1.0"); err == nil {
+		t.Errorf("Expected error for module not in cache")
+	}
+
+	if _, err := LookupImportPath("example.com/unknown@v1.0"); err == nil {
+		t.Errorf("Expected error for unknown module")
+	}
+
+	// In GOPATH mode GOMOD is empty, and go list -m can't be used
+	s := useStubRunner(t, map[string]string{
+		"go env GOMOD": "",
+		"go list -m -f {{.Dir}} example.com/mod@v1.2.3": "/cache/example.com/mod@v1.2.3",
+	})
+	_, err = LookupImportPath("example.com/mod@v1.2.3")
+	if err == nil || !strings.Contains(err.Error(), "module mode") {
+		t.Errorf("Expected module mode error, got: %v", err)
+	}
+	if len(s.calls) != 1 {
+		t.Errorf("Expected only go env to be run, but ran: %v", s.calls)
+	}
+}
+
+func TestGetPackageName(t *testing.T) {
+	s := useStubRunner(t, map[string]string{
+		"go list -f {{.Name}} example.com/a/b":              "bee",
+		"go list -f {{.Name}} example.com/app/vendor/dep/x": "ex",
+		"go list -f {{.Name}} example.com/cmd/tool":         "main",
+	})
+
+	name, err := getPackageName("example.com/a/b", "", "")
+	if err != nil || name != "bee" {
+		t.Errorf("Expected bee, got %q (err: %v)", name, err)
+	}
+
+	// The second lookup should be served from the cache
+	calls := len(s.calls)
+	if name, _ := getPackageName("example.com/a/b", "", ""); name != "bee" {
+		t.Errorf("Expected bee from cache, got %q", name)
+	}
+	if len(s.calls) != calls {
+		t.Errorf("Expected cached lookup, but ran: %v", s.calls[calls:])
+	}
+
+	// Vendored packages are found via the importing package's vendor dirs
+	name, err = getPackageName("dep/x", "", "example.com/app/pkg")
+	if err != nil || name != "ex" {
+		t.Errorf("Expected ex, got %q (err: %v)", name, err)
+	}
+
+	// The magic "C" package never runs anything
+	calls = len(s.calls)
+	if name, err := getPackageName("C", "", ""); err != nil || name != "" {
+		t.Errorf("Expected empty name for C, got %q (err: %v)", name, err)
+	}
+	if len(s.calls) != calls {
+		t.Errorf("Expected no commands for C, but ran: %v", s.calls[calls:])
+	}
+
+	if _, err := getPackageName("example.com/missing", "", ""); err == nil {
+		t.Errorf("Expected error for missing package")
+	}
+
+	// Commands can't be imported, so "main" is an error
+	_, err = getPackageName("example.com/cmd/tool", "", "")
+	if err == nil || !strings.Contains(err.Error(), "package main") {
+		t.Errorf("Expected package main error, got: %v", err)
+	}
+	if _, found := pkgNames["example.com/cmd/tool"]; found {
+		t.Errorf("Expected main package name not to be cached")
+	}
+}
+
+func TestGetPackageNameFromSource(t *testing.T) {
+	// With cgo disabled, go list can't give the name of a package that only
+	// has cgo files - so the package clause is read instead.
+	t.Setenv("CGO_ENABLED", "0")
+
+	dir := t.TempDir()
+	cgoDir := filepath.Join(dir, "cgoonly")
+	if err := os.MkdirAll(cgoDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"cgo_linux.go":  "//go:build linux\n\npackage cgoonly\n\nimport \"C\"\n",
+		"cgo_darwin.go": "//go:build darwin\n\npackage cgoonly\n\nimport \"C\"\n",
+		"cgo_test.go":   "package cgoonly_test\n",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(cgoDir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useStubRunner(t, map[string]string{
+		"go list -e -f {{.Dir}} example.com/cgoonly": cgoDir,
+		"(" + dir + ") go env GOMOD":                 "",
+	})
+
+	name, err := getPackageName("example.com/cgoonly", "", "")
+	if err != nil || name != "cgoonly" {
+		t.Errorf("Expected cgoonly, got %q (err: %v)", name, err)
+	}
+	if pkgNames["example.com/cgoonly"] != "cgoonly" {
+		t.Errorf("Expected name to be cached, got %v", pkgNames)
+	}
+
+	// Relative imports are found from the importing package
+	name, err = getPackageName("./cgoonly", dir, "app")
+	if err != nil || name != "cgoonly" {
+		t.Errorf("Expected cgoonly, got %q (err: %v)", name, err)
+	}
+
+	// The go list error is kept if the source doesn't help
+	_, err = getPackageName("example.com/missing", "", "")
+	if err == nil || !strings.Contains(err.Error(), "exit status 1") {
+		t.Errorf("Expected go list error, got: %v", err)
+	}
+}
+
+func TestGetPackageNameRelative(t *testing.T) {
+	useStubRunner(t, map[string]string{
+		"(/work/mod/pkg) go env GOMOD":                     "/work/mod/go.mod",
+		"go list -f {{.Name}} example.com/mod/pkg/sub":     "sub",
+		"go list -f {{.Name}} example.com/mod/other":       "other",
+		"(/gopath/src/app) go env GOMOD":                   "",
+		"(/gopath/src/app) go list -f {{.Name}} ./rel":     "rel",
+		"(/outside/gopath) go list -f {{.Name}} .":         "outside",
+		"(/gopath/src/app) go list -f {{.Name}} ../shared": "shared",
+	})
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("os.Getwd failed: %s", err)
+	}
+
+	// In a module, relative imports are resolved to the full import path
+	name, err := getPackageName("./sub", "/work/mod/pkg", "example.com/mod/pkg")
+	if err != nil || name != "sub" {
+		t.Errorf("Expected sub, got %q (err: %v)", name, err)
+	}
+	if pkgNames["example.com/mod/pkg/sub"] != "sub" {
+		t.Errorf("Expected full import path to be cached, got %v", pkgNames)
+	}
+
+	name, err = getPackageName("../other", "/work/mod/pkg", "example.com/mod/pkg")
+	if err != nil || name != "other" {
+		t.Errorf("Expected other, got %q (err: %v)", name, err)
+	}
+
+	// Otherwise they are looked up in the source directory, and not cached
+	name, err = getPackageName("./rel", "/gopath/src/app", "app")
+	if err != nil || name != "rel" {
+		t.Errorf("Expected rel, got %q (err: %v)", name, err)
+	}
+	name, err = getPackageName("../shared", "/gopath/src/app", "app")
+	if err != nil || name != "shared" {
+		t.Errorf("Expected shared, got %q (err: %v)", name, err)
+	}
+	if _, found := pkgNames["./rel"]; found {
+		t.Errorf("Expected relative import not to be cached")
+	}
+
+	name, err = getPackageName("_/outside/gopath", "", "")
+	if err != nil || name != "outside" {
+		t.Errorf("Expected outside, got %q (err: %v)", name, err)
+	}
+
+	if dir, _ := os.Getwd(); dir != cwd {
+		t.Errorf("Expected working directory to be unchanged, got %s", dir)
+	}
+}
+
+func TestGetMockedPackages(t *testing.T) {
+	dir := t.TempDir()
+
+	s := useStubRunner(t, map[string]string{
+		"go list -f {{.Name}} example.com/a/b":     "bee",
+		"(" + dir + ") go list -f {{.Name}} ./rel": "rel",
+	})
+
+	path := filepath.Join(dir, "code_test.go")
+	data := "package code\n\n" +
+		"import (\n" +
+		"\t\"example.com/a/b\" // mock\n" +
+		"\tx \"example.com/named\" // MOCK\n" +
+		"\t\"./rel\" // mock\n" +
+		"\t\"example.com/plain\"\n" +
+		"\t\"example.com/other\" // not mocked\n" +
+		")\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Relative imports are looked up from the directory holding the file
+	imports, err := GetMockedPackages(path)
+	if err != nil {
+		t.Fatalf("GetMockedPackages failed: %s", err)
+	}
+	expected := map[string]string{
+		"bee": "example.com/a/b",
+		"x":   "example.com/named",
+		"rel": "./rel",
+	}
+	if !reflect.DeepEqual(imports, expected) {
+		t.Errorf("Expected %v, got %v", expected, imports)
+	}
+
+	// Named imports don't need their package name to be looked up
+	for _, call := range s.calls {
+		if strings.Contains(call, "example.com/named") {
+			t.Errorf("Expected no lookup for named import, but ran: %s", call)
+		}
+	}
+
+	// Packages listed in the config are mocked without the comment
+	cfg := &Config{mocked: map[string]bool{"example.com/plain": true}}
+	s.outputs["go list -f {{.Name}} example.com/plain"] = "plain"
+	imports, err = getMockedPackages(path, cfg)
+	if err != nil {
+		t.Fatalf("getMockedPackages failed: %s", err)
+	}
+	if imports["plain"] != "example.com/plain" {
+		t.Errorf("Expected example.com/plain to be mocked, got %v", imports)
+	}
+
+	// Packages listed in NeverMock are never mocked, however they are marked
+	cfg.Mocks = map[string]*MockConfig{
+		"DEFAULT": {NeverMock: []string{"example.com/plain", "example.com/a/b"}},
+	}
+	imports, err = getMockedPackages(path, cfg)
+	if err != nil {
+		t.Fatalf("getMockedPackages failed: %s", err)
+	}
+	expected = map[string]string{
+		"x":   "example.com/named",
+		"rel": "./rel",
+	}
+	if !reflect.DeepEqual(imports, expected) {
+		t.Errorf("Expected %v, got %v", expected, imports)
+	}
+	if cfg.isMocked("example.com/plain") {
+		t.Errorf("Expected example.com/plain not to be mocked")
+	}
+}
+
+func TestExplainMockedPackages(t *testing.T) {
+	dir := t.TempDir()
+
+	useStubRunner(t, map[string]string{
+		"go list -f {{.Name}} example.com/a":      "a",
+		"go list -f {{.Name}} example.com/config": "config",
+		"go list -f {{.Name}} example.com/pre":    "pre",
+	})
+
+	out := &bytes.Buffer{}
+	orig := Explainer
+	Explainer = log.New(out, "", 0)
+	t.Cleanup(func() {
+		Explainer = orig
+	})
+
+	path := filepath.Join(dir, "code_test.go")
+	data := "package code\n\n" +
+		"import (\n" +
+		"\t\"example.com/a\" // mock\n" +
+		"\t\"_mock_/example.com/pre\"\n" +
+		"\t\"example.com/config\"\n" +
+		"\t\"example.com/never\" // mock\n" +
+		"\t\"example.com/plain\"\n" +
+		")\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{
+		mocked: map[string]bool{"example.com/config": true},
+		Mocks: map[string]*MockConfig{
+			"DEFAULT": {NeverMock: []string{"example.com/never"}},
+		},
+	}
+	if _, err := getMockedPackages(path, cfg); err != nil {
+		t.Fatalf("getMockedPackages failed: %s", err)
+	}
+
+	expected := "example.com/a: mocked, as it is marked for mocking by a \"// mock\" comment\n" +
+		"example.com/pre: mocked, as it is marked for mocking by the _mock_/ prefix\n" +
+		"example.com/config: mocked, as it is marked for mocking by the config\n" +
+		"example.com/never: left real, as it is in NeverMock (although marked for mocking by a \"// mock\" comment)\n" +
+		"example.com/plain: left real, as it isn't marked for mocking\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	// Nothing is explained without an Explainer
+	Explainer = nil
+	out.Reset()
+	if _, err := getMockedPackages(path, cfg); err != nil {
+		t.Fatalf("getMockedPackages failed: %s", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected no explanation, got:\n%s", out.String())
+	}
+}
+
+func TestMockPrefix(t *testing.T) {
+	useStubRunner(t, map[string]string{
+		"go list -f {{.Name}} example.com/a/b": "bee",
+	})
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "code_test.go")
+	data := "package code\n\n" +
+		"import (\n" +
+		"\t\"_mock_/example.com/a/b\"\n" +
+		"\t\"example.com/c\"\n" +
+		")\n\n" +
+		"var _ = bee.Get\n"
+	if err := ioutil.WriteFile(src, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	imports, err := GetImports(dir, true)
+	if err != nil {
+		t.Fatalf("GetImports failed: %s", err)
+	}
+	if !imports["example.com/a/b"].IsMock() {
+		t.Errorf("Expected example.com/a/b to be mocked, got %v", imports)
+	}
+	if _, found := imports["_mock_/example.com/a/b"]; found {
+		t.Errorf("Expected the _mock_/ prefix to be removed, got %v", imports)
+	}
+
+	change := map[string]string{
+		"example.com/a/b": markImport("example.com/a/b", mockMark),
+		"example.com/c":   markImport("example.com/c", mockMark),
+	}
+	dst := filepath.Join(dir, "out_test.go")
+	if err := mockFileImports(src, dst, change, &Config{}); err != nil {
+		t.Fatalf("mockFileImports failed: %s", err)
+	}
+
+	out, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The import is rewritten without moving the rest of the file, and the
+	// unmarked import is left alone.
+	expected := "\t\"_xample.com/a/b\"       \n\t\"example.com/c\"\n)\n\nvar _ = bee.Get\n"
+	if !strings.Contains(string(out), expected) {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+	if !strings.Contains(string(out), "\tbee.MOCK().MockAll(true)\n") {
+		t.Errorf("Expected mocks to be enabled for bee, got:\n%s", out)
+	}
+
+	// Packages that keep their own path aren't in change, but the prefix
+	// still has to go.
+	if err := mockFileImports(src, dst, map[string]string{}, &Config{}); err != nil {
+		t.Fatalf("mockFileImports failed: %s", err)
+	}
+
+	out, err = ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = "\t\"example.com/a/b\"       \n\t\"example.com/c\"\n"
+	if !strings.Contains(string(out), expected) {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+}
+
+func TestReadManifest(t *testing.T) {
+	useStubRunner(t, map[string]string{
+		"go list -f {{.Name}} example.com/some/package": "pkg",
+	})
+
+	path := filepath.Join(t.TempDir(), "withmock.json")
+	data := `{
+		"gomock": "example.com/fork/gomock",
+		"mocks": {
+			"DEFAULT": {"EXPECT": "E"},
+			"example.com/yaml.v2": {"name": "yaml"},
+			"example.com/some/package": {"MockPrototypes": true, "MOCK": "M"}
+		}
+	}`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := ReadManifest(path)
+	if err != nil {
+		t.Fatalf("ReadManifest failed: %s", err)
+	}
+
+	pkgs, err := m.MockedPackages()
+	if err != nil {
+		t.Fatalf("MockedPackages failed: %s", err)
+	}
+	expected := map[string]string{
+		"yaml": "example.com/yaml.v2",
+		"pkg":  "example.com/some/package",
+	}
+	if !reflect.DeepEqual(pkgs, expected) {
+		t.Errorf("Expected packages %v, got %v", expected, pkgs)
+	}
+
+	cfg := m.Config()
+	if !cfg.isMocked("example.com/yaml.v2") || cfg.isMocked("DEFAULT") || cfg.isMocked("os") {
+		t.Errorf("Unexpected mocked packages: %v", cfg.mocked)
+	}
+
+	// The name from the manifest is used for imports without a name, rather
+	// than running go list.
+	src := filepath.Join(t.TempDir(), "lib_test.go")
+	data = "package lib\n\nimport (\n\t\"example.com/yaml.v2\"\n\tp \"example.com/some/package\"\n)\n"
+	if err := ioutil.WriteFile(src, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pkgs, err = getMockedPackages(src, cfg)
+	if err != nil {
+		t.Fatalf("getMockedPackages failed: %s", err)
+	}
+	expected = map[string]string{
+		"yaml": "example.com/yaml.v2",
+		"p":    "example.com/some/package",
+	}
+	if !reflect.DeepEqual(pkgs, expected) {
+		t.Errorf("Expected packages %v, got %v", expected, pkgs)
+	}
+
+	mc := cfg.Mock("example.com/some/package")
+	if !mc.MockPrototypes || mc.MOCK != "M" || mc.EXPECT != "E" {
+		t.Errorf("Unexpected config for example.com/some/package: %+v", mc)
+	}
+	if mc.Gomock != "example.com/fork/gomock" {
+		t.Errorf("Expected gomock fork, got %q", mc.Gomock)
+	}
+
+	if _, err := ReadManifest(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("Expected error for missing manifest")
+	}
+}
+
+func TestMarkImport(t *testing.T) {
+	for _, m := range []Mark{MockMark, TestMark, ReplaceMark, NormalMark} {
+		label := MarkImport("github.com/a/b", m)
+		if got := GetMark(label); got != m {
+			t.Errorf("Expected mark %q from %q, got %q", m, label, got)
+		}
+	}
+}
+
+func TestImportMarks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "code_test.go")
+	src := `package code
+
+import (
+	"fmt"
+	"testing"
+
+	"example.com/lib" // mock
+)
+`
+	if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(impPath string, expected Mark) {
+		t.Helper()
+		m, err := GetImportMark(path, impPath)
+		if err != nil || m != expected {
+			t.Errorf("Expected %q for %s, got %q (err: %v)", expected, impPath, m, err)
+		}
+	}
+
+	check("example.com/lib", MockMark)
+	check("fmt", NormalMark)
+
+	// Round trip: mock fmt, and unmock lib
+	if old, err := SetImportMark(path, "fmt", MockMark); err != nil || old != NormalMark {
+		t.Errorf("Expected old mark %q for fmt, got %q (err: %v)", NormalMark, old, err)
+	}
+	if old, err := SetImportMark(path, "example.com/lib", NormalMark); err != nil || old != MockMark {
+		t.Errorf("Expected old mark %q for lib, got %q (err: %v)", MockMark, old, err)
+	}
+
+	check("example.com/lib", NormalMark)
+	check("fmt", MockMark)
+
+	if _, err := SetImportMark(path, "fmt", NormalMark); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if _, err := SetImportMark(path, "example.com/lib", MockMark); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != src {
+		t.Errorf("Expected original source after round trip, got:\n%s", data)
+	}
+
+	if _, err := GetImportMark(path, "os"); err == nil {
+		t.Errorf("Expected error for missing import")
+	}
+	if _, err := SetImportMark(path, "fmt", TestMark); err == nil {
+		t.Errorf("Expected error for setting TestMark")
+	}
+}
+
+func TestExcludesSubpackage(t *testing.T) {
+	cfg := &Config{
+		Mocks: map[string]*MockConfig{
+			"example.com/lib": {ExcludeSubpackages: []string{"real", "other/"}},
+		},
+	}
+
+	mc := cfg.Mock("example.com/lib")
+	for name, expected := range map[string]bool{"real": true, "other": true, "mocked": false} {
+		if got := mc.excludesSubpackage(name); got != expected {
+			t.Errorf("excludesSubpackage(%q): expected %v, got %v", name, expected, got)
+		}
+	}
+
+	if cfg.Mock("example.com/else").excludesSubpackage("real") {
+		t.Errorf("Expected other packages not to exclude anything")
+	}
+}
+
+func TestExcludedSubpackage(t *testing.T) {
+	c := &Context{cfg: &Config{
+		Mocks: map[string]*MockConfig{
+			"example.com/lib": {ExcludeSubpackages: []string{"real"}},
+		},
+	}}
+
+	for name, expected := range map[string]bool{
+		"example.com/lib/real":      true,
+		"example.com/lib/other":     false,
+		"example.com/lib/real/deep": false,
+		"example.com/lib":           false,
+		"real":                      false,
+	} {
+		if got := c.excludedSubpackage(name); got != expected {
+			t.Errorf("excludedSubpackage(%q): expected %v, got %v", name, expected, got)
+		}
+	}
+}
+
+func TestSubpackageMockAll(t *testing.T) {
+	cfg := &Config{
+		Mocks: map[string]*MockConfig{
+			"DEFAULT":         {SubpackageMockAll: map[string]bool{"*": true}},
+			"example.com/lib": {SubpackageMockAll: map[string]bool{"fake/": true, "live": false}},
+		},
+	}
+
+	mc := cfg.Mock("example.com/lib")
+	for name, expected := range map[string]bool{"fake": true, "live": false} {
+		if got, found := mc.subpackageMockAll(name); !found || got != expected {
+			t.Errorf("subpackageMockAll(%q): expected %v, got %v (found: %v)", name, expected, got, found)
+		}
+	}
+	if _, found := mc.subpackageMockAll("other"); found {
+		t.Errorf("Expected no setting for an unlisted sub-package")
+	}
+
+	// Other packages use the default
+	if got, found := cfg.Mock("example.com/else").subpackageMockAll("other"); !found || !got {
+		t.Errorf("Expected the default to apply to other packages")
+	}
+}
+
+func TestSubpackageMockAllPrecedence(t *testing.T) {
+	cfg := &Config{
+		Mocks: map[string]*MockConfig{
+			"example.com/lib": {
+				MockAll:           true,
+				SubpackageMockAll: map[string]bool{"fake": true, "live": false},
+			},
+			"example.com/lib/live":  {MockAll: true},
+			"example.com/lib/other": {MockAll: true},
+		},
+	}
+
+	tests := map[string]bool{
+		"example.com/lib":      true,
+		"example.com/lib/fake": true,
+		// lib's config takes precedence over that of the sub-package
+		"example.com/lib/live": false,
+		// but the sub-package's config is used if lib doesn't list it
+		"example.com/lib/other": true,
+		// and lib's own MockAll doesn't pass down to its sub-packages
+		"example.com/lib/none": false,
+		// only the direct parent counts
+		"example.com/lib/fake/deeper": false,
+	}
+
+	for path, expected := range tests {
+		if got := cfg.Mock(path).MockAll; got != expected {
+			t.Errorf("%s: expected MockAll %v, got %v", path, expected, got)
+		}
+	}
+}
+
+func TestIgnoreNonGoFiles(t *testing.T) {
+	cfg := &Config{}
+	if cfg.Mock("example.com/lib").IgnoreNonGoFiles {
+		t.Errorf("Expected non-Go files to be kept by default")
+	}
+
+	cfg = &Config{
+		Mocks: map[string]*MockConfig{
+			"example.com/lib": {IgnoreNonGoFiles: true},
+		},
+	}
+	if !cfg.Mock("example.com/lib").IgnoreNonGoFiles {
+		t.Errorf("Expected IgnoreNonGoFiles from the package config")
+	}
+	if cfg.Mock("example.com/other").IgnoreNonGoFiles {
+		t.Errorf("Expected IgnoreNonGoFiles to only apply to example.com/lib")
+	}
+
+	cfg.Mocks["DEFAULT"] = &MockConfig{IgnoreNonGoFiles: true}
+	if !cfg.Mock("example.com/other").IgnoreNonGoFiles {
+		t.Errorf("Expected IgnoreNonGoFiles from the DEFAULT config")
+	}
+}
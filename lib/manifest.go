@@ -0,0 +1,113 @@
+// Copyright 2013 Julian Phillips.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+)
+
+// Manifest describes which packages should be mocked, as an alternative to
+// marking the imports with "// mock" comments.  It is read from a JSON file,
+// e.g.:
+//
+//	{
+//	    "gomock": "github.com/golang/mock/gomock",
+//	    "mocks": {
+//	        "gopkg.in/yaml.v2": {"name": "yaml"},
+//	        "example.com/some/package": {"MockPrototypes": true, "NoRecorders": true}
+//	    }
+//	}
+//
+// The options for each package are the same as MockConfig.
+type Manifest struct {
+	// Gomock is the import path of the gomock package to use, if not the
+	// default.
+	Gomock string `json:"gomock"`
+
+	// Mocks maps the import path of each package to be mocked to the options
+	// for that package.
+	Mocks map[string]*ManifestEntry `json:"mocks"`
+}
+
+type ManifestEntry struct {
+	// Name is the name of the package, if set - so that it doesn't have to
+	// be found with go list when the package is imported without a name.
+	Name string `json:"name"`
+
+	MockConfig
+}
+
+func ReadManifest(path string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{}
+
+	err = json.Unmarshal(data, m)
+	if err != nil {
+		return nil, Cerr{"json.Unmarshal", err}
+	}
+
+	return m, nil
+}
+
+// Config returns the Config described by the manifest.  Every package listed
+// in the manifest is treated as if it was marked for mocking.
+func (m *Manifest) Config() *Config {
+	cfg := &Config{
+		Gomock: m.Gomock,
+		Mocks:  make(map[string]*MockConfig),
+		mocked: make(map[string]bool),
+		names:  make(map[string]string),
+	}
+
+	for impPath, entry := range m.Mocks {
+		mc := entry.MockConfig
+		cfg.Mocks[impPath] = &mc
+		if impPath != "DEFAULT" {
+			cfg.mocked[impPath] = true
+			if entry.Name != "" {
+				cfg.names[impPath] = entry.Name
+			}
+		}
+	}
+
+	return cfg
+}
+
+// MockedPackages returns the packages to be mocked, as a map of name to import
+// path - i.e. the same as GetMockedPackages, but from the manifest.
+func (m *Manifest) MockedPackages() (map[string]string, error) {
+	imports := make(map[string]string)
+
+	for impPath, entry := range m.Mocks {
+		if impPath == "DEFAULT" {
+			continue
+		}
+
+		name := entry.Name
+		if name == "" {
+			var err error
+			name, err = getPackageName(impPath, "", "")
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		imports[name] = impPath
+	}
+
+	return imports, nil
+}
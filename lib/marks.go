@@ -0,0 +1,141 @@
+// Copyright 2013 Julian Phillips.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lib
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// The import marks, for use with MarkImport and GetMark.
+const (
+	NormalMark  = normalMark
+	MockMark    = mockMark
+	TestMark    = testMark
+	ReplaceMark = replaceMark
+)
+
+// MarkImport returns the import path name, marked with m.
+func MarkImport(name string, m Mark) string {
+	return markImport(name, m)
+}
+
+// GetMark returns the mark applied to the import path label.
+func GetMark(label string) Mark {
+	return getMark(label)
+}
+
+// findImport returns the import of impPath in f, or nil if there isn't one.
+func findImport(f *ast.File, impPath string) *ast.ImportSpec {
+	for _, i := range f.Imports {
+		if strings.Trim(i.Path.Value, "\"") == impPath {
+			return i
+		}
+	}
+	return nil
+}
+
+// importMark returns the mark for import i, as given by a "// mock" comment.
+func importMark(i *ast.ImportSpec) Mark {
+	_, prefixed := splitMockPrefix(strings.Trim(i.Path.Value, "\""))
+	comment := strings.TrimSpace(i.Comment.Text())
+	if strings.ToLower(comment) == "mock" || prefixed {
+		return MockMark
+	}
+	return NormalMark
+}
+
+// GetImportMark returns the effective mark of the import of impPath in the Go
+// source file path - i.e. MockMark if the import is marked for mocking with a
+// "// mock" comment, and NormalMark otherwise.
+func GetImportMark(path, impPath string) (Mark, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, nil,
+		parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return noMark, err
+	}
+
+	i := findImport(f, impPath)
+	if i == nil {
+		return noMark, fmt.Errorf("%s does not import %s", path, impPath)
+	}
+
+	return importMark(i), nil
+}
+
+// SetImportMark changes the import of impPath in the Go source file path so
+// that it has the mark m, adding or removing the "// mock" comment as needed.
+// Only NormalMark and MockMark can be given in source.  The previous mark is
+// returned.
+func SetImportMark(path, impPath string, m Mark) (Mark, error) {
+	if m != NormalMark && m != MockMark {
+		return noMark, fmt.Errorf("Can't set import mark %q in source", m)
+	}
+
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return noMark, err
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, src,
+		parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return noMark, err
+	}
+
+	i := findImport(f, impPath)
+	if i == nil {
+		return noMark, fmt.Errorf("%s does not import %s", path, impPath)
+	}
+
+	old := importMark(i)
+	if old == m {
+		return old, nil
+	}
+
+	end := fset.Position(i.End()).Offset
+
+	var out []byte
+	switch {
+	case m == MockMark && i.Comment != nil:
+		return old, fmt.Errorf("Import of %s already has a comment", impPath)
+	case m == MockMark:
+		out = append(out, src[:end]...)
+		out = append(out, " // mock"...)
+		out = append(out, src[end:]...)
+	case i.Comment == nil:
+		// Marked by a _mock_/ import path, not something we can change
+		return old, fmt.Errorf("Import of %s is not marked with a comment",
+			impPath)
+	default:
+		cend := fset.Position(i.Comment.End()).Offset
+		out = append(out, src[:end]...)
+		out = append(out, src[cend:]...)
+	}
+
+	out, err = format.Source(out)
+	if err != nil {
+		return old, Cerr{"format.Source", err}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return old, err
+	}
+
+	if err := ioutil.WriteFile(path, out, info.Mode()); err != nil {
+		return old, err
+	}
+
+	return old, nil
+}
@@ -5,17 +5,24 @@
 package lib
 
 import (
+	"bytes"
 	"fmt"
 	"go/ast"
+	"go/build"
+	"go/build/constraint"
 	"go/parser"
 	"go/token"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode"
 )
 
 func isLocalExpr(expr string) (ret bool) {
@@ -31,41 +38,239 @@ func isLocalExpr(expr string) (ret bool) {
 		return false
 	case "string", "bool", "error", "complex64", "complex128":
 		return false
+	case "any", "comparable":
+		return false
 	}
-	if strings.HasPrefix(expr, "struct{") {
+	// exprString writes empty types as "struct{}", and others as "struct {"
+	if strings.HasPrefix(expr, "struct{") || strings.HasPrefix(expr, "struct {") {
 		return false
 	}
-	if strings.HasPrefix(expr, "interface{") {
+	if strings.HasPrefix(expr, "interface{") || strings.HasPrefix(expr, "interface {") {
 		return false
 	}
 	return !strings.Contains(expr, ".")
 }
 
+// isArray splits a fixed size array type (e.g. "[N]Item") into the length and
+// element type.  If expr isn't a fixed size array, then length is empty.
+func isArray(expr string) (length, elem string) {
+	if !strings.HasPrefix(expr, "[") || strings.HasPrefix(expr, "[]") {
+		return "", ""
+	}
+	depth := 0
+	for i, c := range expr {
+		switch c {
+		case '[', '(':
+			depth++
+		case ']', ')':
+			depth--
+			if depth == 0 {
+				return expr[1:i], expr[i+1:]
+			}
+		}
+	}
+	return "", ""
+}
+
+// isMap splits a map type (e.g. "map[pkg.Key][]Value") into the key and value
+// types.  If expr isn't a map, then key is empty.
+func isMap(expr string) (key, value string) {
+	if !strings.HasPrefix(expr, "map[") {
+		return "", ""
+	}
+	depth := 0
+	for i := len("map"); i < len(expr); i++ {
+		switch expr[i] {
+		case '[', '(', '{':
+			depth++
+		case ']', ')', '}':
+			depth--
+			if depth == 0 {
+				return expr[len("map["):i], expr[i+1:]
+			}
+		}
+	}
+	return "", ""
+}
+
 func isChannel(expr string) (prefix, subtype string) {
 	if !strings.Contains(expr, " ") {
 		return "", ""
 	}
 	parts := strings.SplitN(expr, " ", 2)
 	switch parts[0] {
-	case "chan", "<-chan", "chan->":
+	case "chan", "<-chan", "chan<-":
 		return parts[0], parts[1]
 	}
 	return "", ""
 }
 
 func scopeName(name, scope string) string {
+	if strings.HasPrefix(name, "*") {
+		return "*" + scopeName(name[1:], scope)
+	}
 	if strings.HasPrefix(name, "[]") {
 		return "[]" + scopeName(name[2:], scope)
 	}
+	if length, elem := isArray(name); length != "" {
+		// Only a plain constant name is scoped, not a more complicated
+		// expression (e.g. "N * 2").
+		if token.IsIdentifier(length) && isLocalExpr(length) {
+			length = scope + "." + length
+		}
+		return "[" + length + "]" + scopeName(elem, scope)
+	}
+	if key, value := isMap(name); key != "" {
+		return "map[" + scopeName(key, scope) + "]" + scopeName(value, scope)
+	}
 	if channel, sub := isChannel(name); channel != "" {
 		return channel + " " + scopeName(sub, scope)
 	}
+	if params, results, ok := isFunc(name); ok {
+		s := "func(" + scopeParams(params, scope) + ")"
+		switch {
+		case results == "":
+		case strings.HasPrefix(results, "("):
+			s += " (" + scopeParams(results[1:len(results)-1], scope) + ")"
+		default:
+			s += " " + scopeName(results, scope)
+		}
+		return s
+	}
+	if base, args := isInstance(name); base != "" {
+		for i, arg := range args {
+			args[i] = scopeName(arg, scope)
+		}
+		return scopeName(base, scope) + "[" + strings.Join(args, ", ") + "]"
+	}
 	if isLocalExpr(name) {
 		return scope + "." + name
 	}
 	return name
 }
 
+// isFunc splits a func type (e.g. "func(a, b Key) (Value, error)") into the
+// parameters and the results (still in parens, if they were).  If expr isn't a
+// func type, then ok is false.
+func isFunc(expr string) (params, results string, ok bool) {
+	if !strings.HasPrefix(expr, "func(") {
+		return "", "", false
+	}
+	depth := 0
+	for i := len("func"); i < len(expr); i++ {
+		switch expr[i] {
+		case '[', '(', '{':
+			depth++
+		case ']', ')', '}':
+			depth--
+			if depth == 0 {
+				return expr[len("func("):i], strings.TrimSpace(expr[i+1:]), true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// splitList splits a comma separated list (e.g. the parameters of a func
+// type), ignoring any commas inside brackets.
+func splitList(list string) []string {
+	items := []string{}
+	depth, start := 0, 0
+	for i := 0; i < len(list); i++ {
+		switch list[i] {
+		case '[', '(', '{':
+			depth++
+		case ']', ')', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				items = append(items, strings.TrimSpace(list[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if rest := strings.TrimSpace(list[start:]); rest != "" {
+		items = append(items, rest)
+	}
+	return items
+}
+
+// paramName splits a parameter (e.g. "a Key" or "b ...Key") into its name
+// and type.  If the parameter doesn't have a name (e.g. "chan Key"), then
+// name is empty.
+func paramName(param string) (name, typ string) {
+	i := strings.Index(param, " ")
+	if i < 0 || !token.IsIdentifier(param[:i]) || token.IsKeyword(param[:i]) {
+		return "", param
+	}
+	return param[:i], param[i+1:]
+}
+
+// scopeParams scopes the types in a list of parameters (or results) of a
+// func type.  Either all of the parameters have names, or none of them do -
+// but when they do, only the last of a group sharing a type has it (e.g.
+// "a, b Key").
+func scopeParams(list, scope string) string {
+	params := splitList(list)
+	named := false
+	for _, param := range params {
+		if name, _ := paramName(param); name != "" {
+			named = true
+		}
+	}
+	for i, param := range params {
+		name, typ := param, ""
+		if named {
+			name, typ = paramName(param)
+			if name == "" {
+				// Just a name, sharing the type of a later parameter
+				continue
+			}
+			name += " "
+		} else {
+			name, typ = "", param
+		}
+		if strings.HasPrefix(typ, "...") {
+			params[i] = name + "..." + scopeName(typ[3:], scope)
+		} else {
+			params[i] = name + scopeName(typ, scope)
+		}
+	}
+	return strings.Join(params, ", ")
+}
+
+// isInstance splits an instantiated generic type (e.g. "Map[string, *List[T]]")
+// into the generic type and its type arguments.  If expr isn't an
+// instantiation, then base is empty.
+func isInstance(expr string) (base string, args []string) {
+	i := strings.Index(expr, "[")
+	if i <= 0 || !strings.HasSuffix(expr, "]") || strings.HasPrefix(expr, "map[") {
+		return "", nil
+	}
+	if strings.ContainsAny(expr[:i], " ()*{}") {
+		// Not a type name, e.g. a function returning a generic type
+		return "", nil
+	}
+
+	depth, start := 0, i+1
+	for j := start; j < len(expr)-1; j++ {
+		switch expr[j] {
+		case '[', '(', '{':
+			depth++
+		case ']', ')', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(expr[start:j]))
+				start = j + 1
+			}
+		}
+	}
+	args = append(args, strings.TrimSpace(expr[start:len(expr)-1]))
+
+	return expr[:i], args
+}
+
 func scopeFields(fields []field, scope string) []field {
 	newFields := make([]field, len(fields))
 	for i, f := range fields {
@@ -85,8 +290,17 @@ type field struct {
 type funcInfo struct {
 	name         string
 	export       string
+	doc          []string
+	pragmas      []string
 	varidic      bool
 	realDisabled bool
+	formatter    bool
+	trace        bool
+	count        bool
+	fallback     bool
+	ownCtrl      bool
+	gomock       string
+	typeParams   string
 	recv         struct {
 		name, expr string
 	}
@@ -113,18 +327,58 @@ func (fi *funcInfo) IsMethod() bool {
 	return fi.recv.expr != ""
 }
 
+// receiver returns the receiver of the original method, as written before
+// its name - the receiver may not have a name (e.g. "func (*T) M()"), in which
+// case the method can't refer to it, but can still be called as _real_M.
+func (fi *funcInfo) receiver() string {
+	if fi.recv.name == "" {
+		return "(" + fi.recv.expr + ")"
+	}
+	return "(" + fi.recv.name + " " + fi.recv.expr + ")"
+}
+
+// ScopedName returns the name used to refer to the function at runtime (i.e.
+// with EnableMock), which is "Type.Method" for methods.
+func (fi *funcInfo) ScopedName() string {
+	if !fi.IsMethod() {
+		return fi.name
+	}
+	recv := strings.TrimPrefix(fi.recv.expr, "*")
+	if i := strings.Index(recv, "["); i >= 0 {
+		// Methods of generic types are named without the type parameters
+		recv = recv[:i]
+	}
+	return recv + "." + fi.name
+}
+
 func (fi *funcInfo) writeReal(out io.Writer) {
+	// C expects to find an exported function under its original name, so we
+	// can't rename those.
+	rename := ast.IsExported(fi.name) && fi.export == "" && fi.typeParams == ""
+	if !rename {
+		// If we aren't renaming, then the doc belongs here (otherwise it goes
+		// on the mock, which has the original name).
+		fi.writeDoc(out)
+	}
+	// Pragmas apply to the code, so they always stay with the real function
+	// (or method) - and have to come directly before it.
+	for _, pragma := range fi.pragmas {
+		if rename {
+			pragma = renameLinkname(pragma, fi.name, "_real_"+fi.name)
+		}
+		fmt.Fprintf(out, "%s\n", pragma)
+	}
 	if fi.export != "" {
 		fmt.Fprintf(out, "//export %s\n", fi.export)
 	}
 	fmt.Fprintf(out, "func ")
 	if fi.IsMethod() {
-		fmt.Fprintf(out, "(%s %s) ", fi.recv.name, fi.recv.expr)
+		fmt.Fprintf(out, "%s ", fi.receiver())
 	}
-	if ast.IsExported(fi.name) {
+	if rename {
 		fmt.Fprintf(out, "_real_")
 	}
-	fmt.Fprintf(out, "%s(", fi.name)
+	fmt.Fprintf(out, "%s%s(", fi.name, fi.typeParams)
 	for i, param := range fi.params {
 		if i > 0 {
 			fmt.Fprintf(out, ", ")
@@ -148,10 +402,19 @@ func (fi *funcInfo) writeReal(out io.Writer) {
 	fmt.Fprintf(out, "\n")
 }
 
-func (fi *funcInfo) writeStub(out io.Writer) {
+func (fi *funcInfo) writeDoc(out io.Writer) {
+	for _, line := range fi.doc {
+		fmt.Fprintf(out, "%s\n", line)
+	}
+}
+
+// writeStub writes a stub for a function without a body.  The stub will return
+// the given expressions, or if there aren't any call the stub handler (e.g. so
+// that a test can call t.Fatalf) and then panic.
+func (fi *funcInfo) writeStub(out io.Writer, returns []string) {
 	fmt.Fprintf(out, "func ")
 	if fi.IsMethod() {
-		fmt.Fprintf(out, "(%s %s) ", fi.recv.name, fi.recv.expr)
+		fmt.Fprintf(out, "%s ", fi.receiver())
 	}
 	if ast.IsExported(fi.name) {
 		fmt.Fprintf(out, "_real_")
@@ -177,11 +440,37 @@ func (fi *funcInfo) writeStub(out io.Writer) {
 		fmt.Fprintf(out, ") ")
 	}
 	fmt.Fprintf(out, "{\n")
-	fmt.Fprintf(out, "\tpanic(\"This is only a stub!\")\n")
+	if len(returns) > 0 {
+		fmt.Fprintf(out, "\treturn %s\n", strings.Join(returns, ", "))
+	} else {
+		fmt.Fprintf(out, "\tif _stubHandler != nil {\n")
+		fmt.Fprintf(out, "\t\t_stubHandler(%q)\n", fi.ScopedName())
+		fmt.Fprintf(out, "\t}\n")
+		fmt.Fprintf(out, "\tpanic(\"This is only a stub!\")\n")
+	}
 	fmt.Fprintf(out, "}\n")
 	fmt.Fprintf(out, "\n")
 }
 
+// checkStubReturns makes sure that the configured stub returns for fi (if any)
+// are valid expressions, and that there is one for each result.
+func checkStubReturns(fi *funcInfo, returns []string) error {
+	if len(returns) == 0 {
+		return nil
+	}
+	if n := len(fi.retTypes()); len(returns) != n {
+		return fmt.Errorf("StubReturns for %s: got %d values, want %d",
+			fi.ScopedName(), len(returns), n)
+	}
+	for _, ret := range returns {
+		if _, err := parser.ParseExpr(ret); err != nil {
+			return fmt.Errorf("StubReturns for %s: invalid expression %q: %s",
+				fi.ScopedName(), ret, err)
+		}
+	}
+	return nil
+}
+
 func (fi *funcInfo) countParams() int {
 	p := 0
 	for _, param := range fi.params {
@@ -194,21 +483,23 @@ func (fi *funcInfo) countParams() int {
 	return p
 }
 
-func (fi *funcInfo) writeParams(out io.Writer) int {
+// writeParams writes out the parameters of fi, named p0, p1 etc. (with prefix
+// added), and returns the number of parameters.
+func (fi *funcInfo) writeParams(out io.Writer, prefix string) int {
 	p := 0
 	for i, param := range fi.params {
 		if i > 0 {
 			fmt.Fprintf(out, ", ")
 		}
 		if len(param.names) == 0 {
-			fmt.Fprintf(out, "p%d", p)
+			fmt.Fprintf(out, "%sp%d", prefix, p)
 			p++
 		} else {
 			for j := range param.names {
 				if j > 0 {
 					fmt.Fprintf(out, ", ")
 				}
-				fmt.Fprintf(out, "p%d", p)
+				fmt.Fprintf(out, "%sp%d", prefix, p)
 				p++
 			}
 		}
@@ -217,6 +508,40 @@ func (fi *funcInfo) writeParams(out io.Writer) int {
 	return p
 }
 
+// isMockLocal returns true if name is one of the names of the locals declared
+// in the body of a mock (i.e. p0, p1, ..., ret, ret0, ret1, ... or args).
+func isMockLocal(name string) bool {
+	switch {
+	case name == "args" || name == "ret":
+		return true
+	case strings.HasPrefix(name, "ret"):
+		_, err := strconv.Atoi(name[3:])
+		return err == nil
+	case strings.HasPrefix(name, "p") && len(name) > 1:
+		_, err := strconv.Atoi(name[1:])
+		return err == nil
+	}
+	return false
+}
+
+// localPrefix returns the prefix for the names of the locals in the body of a
+// mock with the result types returns - which is normally empty, but is "_" if
+// one of the names is used by the result types (e.g. "type ret int"), as the
+// locals would shadow it otherwise.
+func localPrefix(returns []string) string {
+	notIdent := func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}
+	for _, ret := range returns {
+		for _, name := range strings.FieldsFunc(ret, notIdent) {
+			if isMockLocal(name) {
+				return "_"
+			}
+		}
+	}
+	return ""
+}
+
 func (fi *funcInfo) retTypes() []string {
 	results := make([]string, 0, len(fi.results))
 	for _, result := range fi.results {
@@ -232,24 +557,53 @@ func (fi *funcInfo) retTypes() []string {
 }
 
 func (fi *funcInfo) writeMock(out io.Writer) {
-	scopedName := fi.name
+	scopedName := fi.ScopedName()
+	fi.writeDoc(out)
 	fmt.Fprintf(out, "func ")
 	if fi.IsMethod() {
 		fmt.Fprintf(out, "(_m %s) ", fi.recv.expr)
-		if fi.recv.expr[0] == '*' {
-			scopedName = fi.recv.expr[1:] + "." + scopedName
-		} else {
-			scopedName = fi.recv.expr + "." + scopedName
-		}
 	}
+	// The result types are used in the body, so the locals may need a prefix
+	// to avoid shadowing them.
+	returns := fi.retTypes()
+	l := localPrefix(returns)
 	fmt.Fprintf(out, "%s(", fi.name)
-	args := fi.writeParams(out)
+	args := fi.writeParams(out, l)
 	fmt.Fprintf(out, ") ")
-	returns := fi.retTypes()
 	if len(returns) > 0 {
 		fmt.Fprintf(out, "(%s) ", strings.Join(returns, ", "))
 	}
 	fmt.Fprintf(out, "{\n")
+	if fi.formatter {
+		// gomock formats arguments while handling a call, so calling into the
+		// controller again would deadlock (or recurse).
+		fmt.Fprintf(out, "\tif _inController() {\n")
+		fmt.Fprintf(out, "\t\treturn \"%s\"\n", fi.recv.expr)
+		fmt.Fprintf(out, "\t}\n")
+	}
+	if fi.fallback {
+		// Only interface mocks have a Fallback, so this is always a method
+		fmt.Fprintf(out, "\tif _m.Fallback != nil && !_isExpected(&_m._expected, \"%s\") {\n", fi.name)
+		fmt.Fprintf(out, "\t\t")
+		if len(fi.results) > 0 {
+			fmt.Fprintf(out, "return ")
+		}
+		fmt.Fprintf(out, "_m.Fallback.%s(", fi.name)
+		for i := 0; i < args; i++ {
+			if i > 0 {
+				fmt.Fprintf(out, ", ")
+			}
+			fmt.Fprintf(out, "%sp%d", l, i)
+		}
+		if fi.varidic {
+			fmt.Fprintf(out, "...")
+		}
+		fmt.Fprintf(out, ")\n")
+		if len(fi.results) == 0 {
+			fmt.Fprintf(out, "\t\treturn\n")
+		}
+		fmt.Fprintf(out, "\t}\n")
+	}
 	if !fi.IsMethod() {
 		fmt.Fprintf(out, "\t")
 		if len(fi.results) > 0 {
@@ -260,7 +614,7 @@ func (fi *funcInfo) writeMock(out io.Writer) {
 			if i > 0 {
 				fmt.Fprintf(out, ", ")
 			}
-			fmt.Fprintf(out, "p%d", i)
+			fmt.Fprintf(out, "%sp%d", l, i)
 		}
 		if fi.varidic {
 			fmt.Fprintf(out, "...")
@@ -268,7 +622,7 @@ func (fi *funcInfo) writeMock(out io.Writer) {
 		fmt.Fprintf(out, ")\n")
 		fmt.Fprintf(out, "}\n")
 		fmt.Fprintf(out, "func (_m *_packageMock) %s(", fi.name)
-		fi.writeParams(out)
+		fi.writeParams(out, l)
 		fmt.Fprintf(out, ") ")
 		if len(returns) > 0 {
 			fmt.Fprintf(out, "(%s) ", strings.Join(returns, ", "))
@@ -277,8 +631,7 @@ func (fi *funcInfo) writeMock(out io.Writer) {
 	}
 	if fi.varidic {
 		if !fi.realDisabled {
-			fmt.Fprintf(out, "\tif (!_allMocked && !_enabledMocks[\"%s\"]) "+
-				"|| _disabledMocks[\"%s\"] {\n", scopedName, scopedName)
+			fmt.Fprintf(out, "\tif !_isMocked(\"%s\") {\n", scopedName)
 			fmt.Fprintf(out, "\t\t")
 			if len(fi.results) > 0 {
 				fmt.Fprintf(out, "return ")
@@ -288,35 +641,42 @@ func (fi *funcInfo) writeMock(out io.Writer) {
 			}
 			fmt.Fprintf(out, "_real_%s(", fi.name)
 			for i := 0; i < args-1; i++ {
-				fmt.Fprintf(out, "p%d, ", i)
+				fmt.Fprintf(out, "%sp%d, ", l, i)
 			}
-			fmt.Fprintf(out, "p%d...", args-1)
+			fmt.Fprintf(out, "%sp%d...", l, args-1)
 			fmt.Fprintf(out, ")\n")
 			if len(fi.results) == 0 {
 				fmt.Fprintf(out, "\treturn")
 			}
 			fmt.Fprintf(out, "\t}\n")
 		}
-		fmt.Fprintf(out, "\targs := []interface{}{")
+		fmt.Fprintf(out, "\t%sargs := []interface{}{", l)
 		for i := 0; i < args-1; i++ {
 			if i > 0 {
 				fmt.Fprintf(out, ", ")
 			}
-			fmt.Fprintf(out, "p%d", i)
+			fmt.Fprintf(out, "%sp%d", l, i)
 		}
 		fmt.Fprintf(out, "}\n")
-		fmt.Fprintf(out, "\tfor _, v := range p%d {\n", args-1)
-		fmt.Fprintf(out, "\t\targs = append(args, v)\n")
+		fmt.Fprintf(out, "\tfor _, v := range %sp%d {\n", l, args-1)
+		fmt.Fprintf(out, "\t\t%sargs = append(%sargs, v)\n", l, l)
 		fmt.Fprintf(out, "\t}\n")
+		if fi.trace {
+			fmt.Fprintf(out, "\tif _tracer != nil {\n")
+			fmt.Fprintf(out, "\t\t_tracer(\"%s\", %sargs)\n", scopedName, l)
+			fmt.Fprintf(out, "\t}\n")
+		}
+		if fi.count {
+			fmt.Fprintf(out, "\t_addCallCount(\"%s\")\n", scopedName)
+		}
 		fmt.Fprintf(out, "\t")
 		if len(fi.results) > 0 {
-			fmt.Fprintf(out, "ret := ")
+			fmt.Fprintf(out, "%sret := ", l)
 		}
-		fmt.Fprintf(out, "_ctrl.Call(_m, \"%s\", args...)\n", fi.name)
+		fmt.Fprintf(out, "_callController(%s, _m, \"%s\", %sargs...)\n", fi.controller("_m"), fi.name, l)
 	} else {
 		if !fi.realDisabled {
-			fmt.Fprintf(out, "\tif (!_allMocked && !_enabledMocks[\"%s\"]) "+
-				"||  _disabledMocks[\"%s\"] {\n", scopedName, scopedName)
+			fmt.Fprintf(out, "\tif !_isMocked(\"%s\") {\n", scopedName)
 			fmt.Fprintf(out, "\t\t")
 			if len(fi.results) > 0 {
 				fmt.Fprintf(out, "return ")
@@ -329,7 +689,7 @@ func (fi *funcInfo) writeMock(out io.Writer) {
 				if i > 0 {
 					fmt.Fprintf(out, ", ")
 				}
-				fmt.Fprintf(out, "p%d", i)
+				fmt.Fprintf(out, "%sp%d", l, i)
 			}
 			fmt.Fprintf(out, ")\n")
 			if len(fi.results) == 0 {
@@ -337,18 +697,33 @@ func (fi *funcInfo) writeMock(out io.Writer) {
 			}
 			fmt.Fprintf(out, "\t}\n")
 		}
+		if fi.trace {
+			fmt.Fprintf(out, "\tif _tracer != nil {\n")
+			fmt.Fprintf(out, "\t\t_tracer(\"%s\", []interface{}{", scopedName)
+			for i := 0; i < args; i++ {
+				if i > 0 {
+					fmt.Fprintf(out, ", ")
+				}
+				fmt.Fprintf(out, "%sp%d", l, i)
+			}
+			fmt.Fprintf(out, "})\n")
+			fmt.Fprintf(out, "\t}\n")
+		}
+		if fi.count {
+			fmt.Fprintf(out, "\t_addCallCount(\"%s\")\n", scopedName)
+		}
 		fmt.Fprintf(out, "\t")
 		if len(fi.results) > 0 {
-			fmt.Fprintf(out, "ret := ")
+			fmt.Fprintf(out, "%sret := ", l)
 		}
-		fmt.Fprintf(out, "_ctrl.Call(_m, \"%s\"", fi.name)
+		fmt.Fprintf(out, "_callController(%s, _m, \"%s\"", fi.controller("_m"), fi.name)
 		for i := 0; i < args; i++ {
-			fmt.Fprintf(out, ", p%d", i)
+			fmt.Fprintf(out, ", %sp%d", l, i)
 		}
 		fmt.Fprintf(out, ")\n")
 	}
 	for i, ret := range returns {
-		fmt.Fprintf(out, "\tret%d, _ := ret[%d].(%s)\n", i, i, ret)
+		fmt.Fprintf(out, "\t%sret%d, _ := %sret[%d].(%s)\n", l, i, l, i, ret)
 	}
 	if len(returns) > 0 {
 		fmt.Fprintf(out, "\treturn ")
@@ -356,58 +731,138 @@ func (fi *funcInfo) writeMock(out io.Writer) {
 			if i > 0 {
 				fmt.Fprintf(out, ", ")
 			}
-			fmt.Fprintf(out, "ret%d", i)
+			fmt.Fprintf(out, "%sret%d", l, i)
 		}
 		fmt.Fprintf(out, "\n")
 	}
 	fmt.Fprintf(out, "}\n")
 }
 
+// controller returns the expression used to get the controller for calls to
+// fi, given the expression for the mock.  Interface mocks can have their own
+// controller, which is used in place of the package controller if set.
+func (fi *funcInfo) controller(mock string) string {
+	if fi.ownCtrl {
+		return "_mockController(" + mock + "._ctrl)"
+	}
+	return "_controller()"
+}
+
+// recorderMock returns the expression used by the recorder to get the
+// receiver to record calls against.  The recorder of a type with both pointer
+// and value receivers holds a pointer, so value receiver methods need to
+// dereference it to match the receiver that the mocked method is called with.
+func (fi *funcInfo) recorderMock() string {
+	if fi.IsMethod() && !strings.HasPrefix(fi.recv.expr, "*") {
+		return "_mr._receiver()"
+	}
+	return "_mr.mock"
+}
+
+// writeRecorder writes out the method of recorder used to record expected
+// calls to fi.  The parameters are all interface{}, so they can be given as
+// either values or matchers.  Note that func values (e.g. from a variadic
+// "...func(*Config)" options parameter) can only be matched by gomock.Any() or
+// a custom matcher, as gomock.Eq never considers two non-nil funcs equal.
 func (fi *funcInfo) writeRecorder(out io.Writer, recorder string) {
-	args := fi.countParams()
+	names := fi.recorderParams()
+	args := len(names)
 	fmt.Fprintf(out, "func (_mr *%s) %s(", recorder, fi.name)
 	if args > 0 {
 		if fi.varidic {
 			if args > 1 {
-				for i := 0; i < args-1; i++ {
-					if i > 0 {
-						fmt.Fprintf(out, ", ")
-					}
-					fmt.Fprintf(out, "p%d", i)
-				}
-				fmt.Fprintf(out, " interface{}, ")
+				fmt.Fprintf(out, "%s interface{}, ", strings.Join(names[:args-1], ", "))
 			}
-			fmt.Fprintf(out, "p%d ...interface{}", args-1)
+			fmt.Fprintf(out, "%s ...interface{}", names[args-1])
 		} else {
-			for i := 0; i < args; i++ {
-				if i > 0 {
-					fmt.Fprintf(out, ", ")
-				}
-				fmt.Fprintf(out, "p%d", i)
-			}
-			fmt.Fprintf(out, " interface{}")
+			fmt.Fprintf(out, "%s interface{}", strings.Join(names, ", "))
 		}
 	}
-	fmt.Fprintf(out, ") *gomock.Call {\n")
+	fmt.Fprintf(out, ") *%s.Call {\n", gomockName(fi.gomock))
 	if fi.varidic {
-		fmt.Fprintf(out, "\targs := append([]interface{}{")
-		for i := 0; i < args-1; i++ {
-			if i > 0 {
-				fmt.Fprintf(out, ", ")
-			}
-			fmt.Fprintf(out, "p%d", i)
-		}
-		fmt.Fprintf(out, "}, p%d...)\n", args-1)
+		fmt.Fprintf(out, "\targs := append([]interface{}{%s}, %s...)\n",
+			strings.Join(names[:args-1], ", "), names[args-1])
+	}
+	if fi.fallback {
+		fmt.Fprintf(out, "\t_expectMethod(&_mr.mock._expected, \"%s\")\n", fi.name)
 	}
-	fmt.Fprintf(out, "\treturn _ctrl.RecordCall(_mr.mock, \"%s\"", fi.name)
+	fmt.Fprintf(out, "\treturn ")
+	fi.writeExpectCall(out)
+	fmt.Fprintf(out, "%s.RecordCall(%s, \"%s\"", fi.controller("_mr.mock"),
+		fi.recorderMock(), fi.name)
 	if fi.varidic {
 		fmt.Fprintf(out, ", args...")
 	} else {
-		for i := 0; i < args; i++ {
-			fmt.Fprintf(out, ", p%d", i)
+		for _, name := range names {
+			fmt.Fprintf(out, ", %s", name)
+		}
+	}
+	fmt.Fprintf(out, "))\n")
+	fmt.Fprintf(out, "}\n")
+}
+
+// writeExpectCall writes the start of the call to _expectCall that wraps a
+// recorded call (which the caller must close), so that it is kept for
+// PendingExpectations.
+func (fi *funcInfo) writeExpectCall(out io.Writer) {
+	fmt.Fprintf(out, "_expectCall(\"%s\", ", fi.ScopedName())
+}
+
+// recorderParams returns the names of the parameters of the recorder method
+// for fi, which are the names of the original parameters (so that they show
+// up in signature hints), or p0, p1 etc. for those that are unnamed.  Names
+// that the body of the recorder uses (e.g. args, or anything starting with
+// "_") are replaced too.
+func (fi *funcInfo) recorderParams() []string {
+	names := []string{}
+	used := make(map[string]bool)
+	for _, param := range fi.params {
+		if len(param.names) == 0 {
+			names = append(names, "")
+			continue
+		}
+		for _, name := range param.names {
+			if name == "args" || name == "append" || strings.HasPrefix(name, "_") {
+				name = ""
+			}
+			used[name] = true
+			names = append(names, name)
+		}
+	}
+	for i, name := range names {
+		if name != "" {
+			continue
 		}
+		name = fmt.Sprintf("p%d", i)
+		for used[name] {
+			name += "_"
+		}
+		used[name] = true
+		names[i] = name
 	}
-	fmt.Fprintf(out, ")\n")
+	return names
+}
+
+// writeTypedDo writes a XxxDo method on the recorder, which records a call
+// matching any arguments that will call the given function - which has the
+// same parameters as the function being mocked, so is checked by the
+// compiler.  Variadic functions are skipped, as gomock matches them
+// differently.
+func (fi *funcInfo) writeTypedDo(out io.Writer, recorder string) {
+	if fi.varidic {
+		return
+	}
+	fmt.Fprintf(out, "func (_mr *%s) %sDo(f func(", recorder, fi.name)
+	args := fi.writeParams(out, "")
+	fmt.Fprintf(out, ")) *%s.Call {\n", gomockName(fi.gomock))
+	fmt.Fprintf(out, "\treturn ")
+	fi.writeExpectCall(out)
+	fmt.Fprintf(out, "%s.RecordCall(%s, \"%s\"", fi.controller("_mr.mock"),
+		fi.recorderMock(), fi.name)
+	for i := 0; i < args; i++ {
+		fmt.Fprintf(out, ", %s.Any()", gomockName(fi.gomock))
+	}
+	fmt.Fprintf(out, ").Do(f))\n")
 	fmt.Fprintf(out, "}\n")
 }
 
@@ -421,14 +876,39 @@ type mockGen struct {
 	callInits      bool
 	matchOS        bool
 	types          map[string]ast.Expr
+	generics       map[string]*ast.FieldList
+	genericImports map[string]map[string]string
 	recorders      map[string]string
 	data           io.ReaderAt
+	sources        map[string][]byte
 	ifInfo         *ifInfo
 	scopes         map[string]bool
-	initCount      int
 	MOCK           string
 	EXPECT         string
 	ObjEXPECT      string
+	buildTag       string
+	gomock         string
+	gomockName     string
+	stubReturns    map[string][]string
+	typedDo        bool
+	noRecorders    bool
+	traceCalls     bool
+	countCalls     bool
+	pkgClause      string
+	perTypeFiles   bool
+	envControl     string
+	strict         bool
+	mockAll        bool
+
+	// exprErr records the first expression that exprString couldn't convert,
+	// so that it can be reported as an error when we are being strict.
+	exprErr error
+
+	preserveComments bool
+	preserveHeaders  bool
+	preserveGenerate bool
+	packageDoc       bool
+	resolveName      func(impPath, srcPath string) (string, error)
 }
 
 // MakePkg writes a mock version of the package found at srcPath into dstPath.
@@ -450,6 +930,67 @@ func MakePkg(srcPath, dstPath, pkgName string, mock bool, cfg *MockConfig) (impo
 		return nil, Cerr{"parseDir", err}
 	}
 
+	files := []*ast.File{}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			files = append(files, file)
+		}
+	}
+
+	return MakePkgFromFiles(fset, files, srcPath, dstPath, pkgName, mock, cfg)
+}
+
+// MakePkgFromFiles is like MakePkg, but uses files that have already been
+// parsed (including comments) using fset - e.g. by go/packages - instead of
+// parsing the package itself.  The files should be the non-test files of the
+// package at srcPath, and must still be on disk, as the function bodies are
+// copied from the source.
+func MakePkgFromFiles(fset *token.FileSet, files []*ast.File, srcPath, dstPath, pkgName string, mock bool, cfg *MockConfig) (importSet, error) {
+	if name := cfg.OutputPackageName; name != "" && (!token.IsIdentifier(name) || name == "_") {
+		return nil, fmt.Errorf("OutputPackageName %q is not a valid package name", name)
+	}
+
+	if v := cfg.CgoEnabled; v != "" && v != "0" && v != "1" {
+		return nil, fmt.Errorf("CgoEnabled must be \"0\" or \"1\", not %q", v)
+	}
+
+	if tag := cfg.GeneratedBuildTag; tag != "" && !validBuildTag(tag) {
+		return nil, fmt.Errorf("GeneratedBuildTag %q is not a valid build tag", tag)
+	}
+
+	if err := cfg.checkNames(cfg.InterfaceOnly); err != nil {
+		return nil, err
+	}
+
+	if cfg.InterfaceOnly {
+		return makeInterfacePkg(fset, files, srcPath, dstPath, pkgName, cfg)
+	}
+
+	files, rewritten, err := qualifyDotImports(fset, files, srcPath)
+	if err != nil {
+		return nil, Cerr{"qualifyDotImports", err}
+	}
+
+	cfgKey, err := cfg.cacheKey()
+	if err != nil {
+		return nil, Cerr{"cacheKey", err}
+	}
+
+	newKey := NewCacheFileKey
+	if cfg.tempOutput {
+		newKey = func(...[]byte) CacheFileKey { return "" }
+	}
+
+	// Group the files by package name, as parser.ParseDir would
+	pkgs := make(map[string]map[string]*ast.File)
+	for _, file := range files {
+		name := file.Name.Name
+		if pkgs[name] == nil {
+			pkgs[name] = make(map[string]*ast.File)
+		}
+		pkgs[name][fset.Position(file.Package).Filename] = file
+	}
+
 	imports := make(importSet)
 
 	d, err := os.Open(srcPath)
@@ -458,21 +999,27 @@ func MakePkg(srcPath, dstPath, pkgName string, mock bool, cfg *MockConfig) (impo
 	}
 	defer d.Close()
 
-	files, err := d.Readdir(-1)
+	entries, err := d.Readdir(-1)
 	if err != nil {
 		return nil, Cerr{"Readdirnames", err}
 	}
 
+	embeds := embedPatterns(files)
 	nonGoSources := []string{}
 	nonGoFiles := []string{}
-	for _, entry := range files {
+	embedded := []string{}
+	for _, entry := range entries {
 		name := entry.Name()
 		if strings.HasPrefix(name, ".") {
 			continue
 		}
 		if entry.IsDir() {
-			if name == "internal" || name == "vendor" {
+			if name == "internal" || name == "vendor" || cfg.excludesSubpackage(name) {
 				os.Symlink(filepath.Join(srcPath, name), filepath.Join(dstPath, name))
+				explain(path.Join(pkgName, name), "linked unchanged into the "+
+					"mock of %s", pkgName)
+			} else if isEmbedded(embeds, name) {
+				embedded = append(embedded, name)
 			} else {
 				imports.Set(filepath.Join(pkgName, name), importNoInstall, "")
 			}
@@ -481,6 +1028,10 @@ func MakePkg(srcPath, dstPath, pkgName string, mock bool, cfg *MockConfig) (impo
 		if entry.IsDir() || strings.HasSuffix(name, ".go") {
 			continue
 		}
+		if isEmbedded(embeds, name) {
+			embedded = append(embedded, name)
+			continue
+		}
 		if !strings.HasSuffix(name, ".s") && !strings.HasSuffix(name, ".c") {
 			nonGoFiles = append(nonGoFiles, name)
 			continue
@@ -488,7 +1039,7 @@ func MakePkg(srcPath, dstPath, pkgName string, mock bool, cfg *MockConfig) (impo
 		nonGoSources = append(nonGoSources, name)
 	}
 
-	externalFunctions := []string{}
+	externalFunctions := make(map[string][]string)
 
 	interfaces := make(Interfaces)
 
@@ -503,44 +1054,122 @@ func MakePkg(srcPath, dstPath, pkgName string, mock bool, cfg *MockConfig) (impo
 			matchOS:        cfg.MatchOSArch,
 			types:          make(map[string]ast.Expr),
 			recorders:      make(map[string]string),
+			sources:        rewritten,
 			ifInfo:         newIfInfo(filepath.Join(dstPath, name+"_ifmocks.go")),
 			MOCK:           cfg.MOCK,
 			EXPECT:         cfg.EXPECT,
 			ObjEXPECT:      cfg.ObjEXPECT,
+			buildTag:       cfg.GeneratedBuildTag,
+			gomock:         gomockPath(cfg.Gomock),
+			gomockName:     chooseGomockName(pkg, gomockPath(cfg.Gomock)),
+			stubReturns:    cfg.StubReturns,
+			typedDo:        cfg.TypedDo,
+			noRecorders:    cfg.NoRecorders,
+			traceCalls:     cfg.TraceCalls,
+			countCalls:     cfg.CountCalls,
+			pkgClause:      cfg.OutputPackageName,
+			perTypeFiles:   cfg.PerTypeFiles && !cfg.SingleFile,
+			envControl:     cfg.envControlVar(),
+			strict:         cfg.Strict,
+			mockAll:        cfg.MockAll,
+
+			preserveComments: cfg.PreserveComments,
+			preserveHeaders:  cfg.PreserveHeaders,
+			preserveGenerate: cfg.PreserveGenerate,
+			packageDoc:       cfg.PackageDoc,
+			resolveName:      cfg.ResolvePackageName,
 		}
 
 		m.ifInfo.EXPECT = m.EXPECT
-
-		processed := 0
-
-		for path, file := range pkg.Files {
+		m.ifInfo.buildTag = m.buildTag
+		m.ifInfo.gomock = m.gomock
+		m.ifInfo.gomockName = m.gomockName
+		m.ifInfo.typedDo = m.typedDo
+		m.ifInfo.traceCalls = m.traceCalls
+		m.ifInfo.pkgClause = m.pkgClause
+		m.ifInfo.registry = cfg.MockRegistry
+		m.ifInfo.fallbacks = cfg.Fallbacks
+		m.ifInfo.fakes = cfg.Fakes
+
+		ctxt := cfg.buildContext()
+
+		// Process the files in order, so that the output is the same each
+		// time when they are merged into a single file.
+		paths := make([]string, 0, len(pkg))
+		for path := range pkg {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		selected := []string{}
+		sources := [][]byte{}
+
+		for _, path := range paths {
 			base := filepath.Base(path)
 
-			srcFile := filepath.Join(srcPath, base)
-			filename := filepath.Join(dstPath, base)
-
 			// If only considering files for this OS/Arch, then reject files
 			// that aren't for this OS/Arch based on filename.
-			if cfg.MatchOSArch && !goodOSArchFile(base, nil) {
+			if cfg.MatchOSArch && !goodOSArchFile(ctxt, base, nil) {
 				continue
 			}
 
 			// If only considering files for this OS/Arch, then reject files
 			// that aren't for this OS/Arch based on build constraint (also
 			// excludes files with an ignore build constraint).
-			if cfg.MatchOSArch && !goodOSArchConstraints(file) {
+			if cfg.MatchOSArch && !goodOSArchConstraints(ctxt, pkg[path]) {
 				continue
 			}
 
-			processed++
-
-			out, err := os.Create(filename)
+			src, err := m.source(filepath.Join(srcPath, base))
 			if err != nil {
-				return nil, Cerr{"os.Create", err}
+				return nil, Cerr{"m.source", err}
+			}
+
+			selected = append(selected, path)
+			sources = append(sources, src)
+		}
+
+		// If we skipped over all the files for this package, then ignore it
+		// entirely.
+		if len(selected) == 0 {
+			continue
+		}
+
+		// Each file is keyed on its own source, but the meta file depends on
+		// all of them.
+		settings := []byte(fmt.Sprintf("%s %t %s", pkgName, mock, m.gomockName))
+		filename := filepath.Join(dstPath, name+"_mock.go")
+		pkgKey := newKey(append(sources, cfgKey, settings)...)
+		pkgUpToDate := pkgKey.Matches(filename)
+
+		filenames := []string{}
+		keys := []CacheFileKey{}
+		generated := [][]byte{}
+
+		for n, path := range selected {
+			base := filepath.Base(path)
+
+			srcFile := filepath.Join(srcPath, base)
+			dstFile := filepath.Join(dstPath, base)
+
+			key := newKey(sources[n], cfgKey, settings)
+
+			// A merged file depends on all of the files, so we can only skip
+			// them all together.
+			upToDate := key.Matches(dstFile)
+			if cfg.SingleFile {
+				upToDate = pkgUpToDate
+			}
+
+			// We still need the declarations from a file that is up to date
+			// for the meta file, but don't need the code.
+			var out io.Writer = ioutil.Discard
+			buf := &bytes.Buffer{}
+			if !upToDate {
+				out = buf
 			}
-			defer out.Close()
 
-			i, err := m.file(out, file, srcFile)
+			i, err := m.file(out, pkg[path], srcFile)
 			if err != nil {
 				return nil, Cerr{"m.file", err}
 			}
@@ -549,42 +1178,74 @@ func MakePkg(srcPath, dstPath, pkgName string, mock bool, cfg *MockConfig) (impo
 				imports.Set(path, importNormal, "")
 			}
 
-			/*
-				// TODO: we want to gofmt, goimports can break things ...
-				err = fixup(filename)
-				if err != nil {
-					return err
-				}
-			*/
+			if !upToDate {
+				filenames = append(filenames, dstFile)
+				keys = append(keys, key)
+				generated = append(generated, buf.Bytes())
+			}
 		}
 
-		// If we skipped over all the files for this package, then ignore it
-		// entirely.
-		if processed == 0 {
-			continue
+		pkgClause := name
+		if m.pkgClause != "" {
+			pkgClause = m.pkgClause
 		}
 
-		filename := filepath.Join(dstPath, name+"_mock.go")
+		if !pkgUpToDate {
+			out := &bytes.Buffer{}
 
-		out, err := os.Create(filename)
-		if err != nil {
-			return nil, Cerr{"os.Create", err}
+			m.exprErr = nil
+			err = m.pkg(out, pkgClause)
+			if err == nil && m.strict {
+				err = m.exprErr
+			}
+			if err != nil {
+				return nil, Cerr{"m.pkg", err}
+			}
+
+			if cfg.SingleFile {
+				data, merged, err := mergeGenerated(generated, out.Bytes(), m.gomockName)
+				if err != nil {
+					return nil, Cerr{"mergeGenerated", err}
+				}
+				if merged {
+					filenames = nil
+					keys = nil
+					generated = nil
+					out = bytes.NewBuffer(data)
+				} else {
+					log.Printf("Can't merge files of %s, using separate files", pkgName)
+				}
+			}
+
+			filenames = append(filenames, filename)
+			keys = append(keys, pkgKey)
+			generated = append(generated, out.Bytes())
 		}
-		defer out.Close()
 
-		err = m.pkg(out, name)
-		if err != nil {
-			return nil, Cerr{"m.pkg", err}
+		if m.perTypeFiles {
+			for _, base := range m.recorderTypes() {
+				tname := strings.TrimPrefix(base, "*")
+				tfilename := filepath.Join(dstPath, name+"_"+tname+"_mock.go")
+				if pkgKey.Matches(tfilename) {
+					continue
+				}
+				out := &bytes.Buffer{}
+				if err := m.typeFile(out, pkgClause, base); err != nil {
+					return nil, Cerr{"m.typeFile", err}
+				}
+				filenames = append(filenames, tfilename)
+				keys = append(keys, pkgKey)
+				generated = append(generated, out.Bytes())
+			}
 		}
 
-		// TODO: currently we need to use goimports to add missing imports, we
-		// need to sort out our own imports, then we can switch to gofmt.
-		err = fixup(filename)
-		if err != nil {
-			return nil, Cerr{"fixup", err}
+		for i := range filenames {
+			if err := writeGenerated(filenames[i], keys[i], generated[i]); err != nil {
+				return nil, Cerr{"writeGenerated", err}
+			}
 		}
 
-		externalFunctions = append(externalFunctions, m.extFunctions...)
+		externalFunctions[name] = m.extFunctions
 
 		interfaces[name] = m.ifInfo
 	}
@@ -593,13 +1254,32 @@ func MakePkg(srcPath, dstPath, pkgName string, mock bool, cfg *MockConfig) (impo
 		return nil, Cerr{"genInterfaces", err}
 	}
 
+	for _, info := range interfaces {
+		for n, impPath := range info.used {
+			if n != gomockName(info.gomockName) {
+				imports.Set(impPath, importNormal, "")
+			}
+		}
+	}
+
 	if cfg.IgnoreNonGoFiles {
 		return imports, nil
 	}
 
-	// Load up a rewriter with the rewrites for the external functions
+	// Load up a rewriter with the rewrites for the external functions of the
+	// package that the non go source files belong to.  If we can't tell
+	// which package that is, then we have to use all of them.
+	names := []string{}
+	if name := sourcePackage(cfg.buildContext(), srcPath); name != "" {
+		names = append(names, externalFunctions[name]...)
+	} else {
+		for _, funcs := range externalFunctions {
+			names = append(names, funcs...)
+		}
+	}
+	sort.Strings(names)
 	rw := NewRewriter(nil)
-	for _, name := range externalFunctions {
+	for _, name := range names {
 		rw.Rewrite("·"+name+"(", "·_real_"+name+"(")
 	}
 
@@ -625,10 +1305,129 @@ func MakePkg(srcPath, dstPath, pkgName string, mock bool, cfg *MockConfig) (impo
 		}
 	}
 
-	return imports, nil
-}
+	// Files used by //go:embed have to be copied, as symlinks aren't allowed
+	for _, name := range embedded {
+		input := filepath.Join(srcPath, name)
+		output := filepath.Join(dstPath, name)
 
-func (m *mockGen) exprString(exp ast.Expr) string {
+		err := copyTree(input, output)
+		if err != nil {
+			return nil, Cerr{"copyTree", err}
+		}
+	}
+
+	return imports, nil
+}
+
+// sourcePackage returns the name of the package that the go command would
+// build from srcPath (so that the non go source files there belong to), or ""
+// if it can't be found - e.g. there are multiple packages.
+func sourcePackage(ctxt *build.Context, srcPath string) string {
+	pkg, err := ctxt.ImportDir(srcPath, 0)
+	if err != nil {
+		return ""
+	}
+	return pkg.Name
+}
+
+// makeInterfacePkg writes the mocks for the interfaces of the package made up
+// of files into dstPath, as a package of their own that imports the real
+// package as pkgName.  Nothing else is copied from srcPath, and the functions
+// and types of the package aren't mocked.
+func makeInterfacePkg(fset *token.FileSet, files []*ast.File, srcPath, dstPath, pkgName string, cfg *MockConfig) (importSet, error) {
+	ctxt := cfg.buildContext()
+
+	name := ""
+	selected := []*ast.File{}
+	for _, file := range files {
+		base := filepath.Base(fset.Position(file.Package).Filename)
+		if cfg.MatchOSArch && !goodOSArchFile(ctxt, base, nil) {
+			continue
+		}
+		if cfg.MatchOSArch && !goodOSArchConstraints(ctxt, file) {
+			continue
+		}
+		if name != "" && file.Name.Name != name {
+			return nil, fmt.Errorf("Found packages %s and %s in %s", name,
+				file.Name.Name, srcPath)
+		}
+		name = file.Name.Name
+		selected = append(selected, file)
+	}
+
+	if name == "" {
+		return nil, fmt.Errorf("No Go files found in %s", srcPath)
+	}
+	if name == "main" {
+		return nil, fmt.Errorf("Can't mock the interfaces of %s: it is a "+
+			"command (package main), which can't be imported", pkgName)
+	}
+
+	info, err := filesInterfaceInfo(selected, srcPath, cfg.ResolvePackageName)
+	if err != nil {
+		return nil, Cerr{"filesInterfaceInfo", err}
+	}
+
+	info.filename = filepath.Join(dstPath, name+"_ifmocks.go")
+	info.EXPECT = cfg.EXPECT
+	info.buildTag = cfg.GeneratedBuildTag
+	info.gomock = gomockPath(cfg.Gomock)
+	info.typedDo = cfg.TypedDo
+	info.traceCalls = cfg.TraceCalls
+	info.registry = cfg.MockRegistry
+	info.fallbacks = cfg.Fallbacks
+	info.fakes = cfg.Fakes
+	info.pkgClause = cfg.OutputPackageName
+
+	interfaces := Interfaces{name + "_mocks": info}
+	if err := interfaces.genExtInterface(name+"_mocks", pkgName); err != nil {
+		return nil, Cerr{"genExtInterface", err}
+	}
+
+	if err := fixup(info.filename); err != nil {
+		return nil, Cerr{"fixup", err}
+	}
+
+	imports := make(importSet)
+	imports.Set(pkgName, importNormal, "")
+	for n, impPath := range info.used {
+		if n != gomockName(info.gomockName) {
+			imports.Set(impPath, importNormal, "")
+		}
+	}
+
+	return imports, nil
+}
+
+// CleanMock removes the tree at dstPath created by MakePkg (or the _mocks_
+// directory created by MockInterfaces).  The tree contains symlinks back into
+// the real source (e.g. for internal and vendor directories, and non-Go
+// files), so the links themselves are removed - what they point at is never
+// touched.  It is not an error if dstPath doesn't exist.
+func CleanMock(dstPath string) error {
+	info, err := os.Lstat(dstPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return Cerr{"os.Lstat", err}
+	}
+
+	if !info.IsDir() {
+		// Either a file, or a symlink to the real package - in which case
+		// removing it just removes the link.
+		return os.Remove(dstPath)
+	}
+
+	// RemoveAll doesn't follow symlinks, it just removes them
+	if err := os.RemoveAll(dstPath); err != nil {
+		return Cerr{"os.RemoveAll", err}
+	}
+
+	return nil
+}
+
+func (m *mockGen) exprString(exp ast.Expr) string {
 	switch v := exp.(type) {
 	case *ast.BasicLit:
 		return v.Value
@@ -682,8 +1481,7 @@ func (m *mockGen) exprString(exp ast.Expr) string {
 	case *ast.FuncLit:
 		pos1 := m.fset.Position(v.Body.Lbrace)
 		pos2 := m.fset.Position(v.Body.Rbrace)
-		body := make([]byte, pos2.Offset-pos1.Offset+1)
-		_, err := m.data.ReadAt(body, int64(pos1.Offset))
+		body, err := readSource(m.data, pos1.Offset, pos2.Offset)
 		if err != nil {
 			panic(fmt.Sprintf("Failed to read from m.data: %s", err))
 		}
@@ -704,7 +1502,11 @@ func (m *mockGen) exprString(exp ast.Expr) string {
 			for _, ident := range field.Names {
 				names = append(names, ident.Name)
 			}
-			s += "\t" + strings.Join(names, ", ") + " "
+			s += "\t"
+			if len(names) > 0 {
+				// Not an embedded field
+				s += strings.Join(names, ", ") + " "
+			}
 			s += m.exprString(field.Type)
 			if field.Tag != nil {
 				s += " " + field.Tag.Value
@@ -724,7 +1526,14 @@ func (m *mockGen) exprString(exp ast.Expr) string {
 	case *ast.MapType:
 		return "map[" + m.exprString(v.Key) + "]" + m.exprString(v.Value)
 	case *ast.UnaryExpr:
-		return v.Op.String() + m.exprString(v.X)
+		// "~" only appears in constraints (e.g. "~int | ~string"), as the
+		// compiler rejects it anywhere else.
+		x := m.exprString(v.X)
+		if (v.Op == token.SUB || v.Op == token.ADD) && strings.HasPrefix(x, v.Op.String()) {
+			// Without the space "- -x" would become "--x"
+			return v.Op.String() + " " + x
+		}
+		return v.Op.String() + x
 	case *ast.TypeAssertExpr:
 		s := m.exprString(v.X) + ".("
 		if v.Type == nil {
@@ -736,6 +1545,17 @@ func (m *mockGen) exprString(exp ast.Expr) string {
 		return s
 	case *ast.IndexExpr:
 		return m.exprString(v.X) + "[" + m.exprString(v.Index) + "]"
+	case *ast.IndexListExpr:
+		// Generic type instantiated with multiple type arguments
+		s := m.exprString(v.X) + "["
+		for i, index := range v.Indices {
+			if i > 0 {
+				s += ", "
+			}
+			s += m.exprString(index)
+		}
+		s += "]"
+		return s
 	case *ast.InterfaceType:
 		if len(v.Methods.List) == 0 {
 			return "interface{}"
@@ -745,6 +1565,11 @@ func (m *mockGen) exprString(exp ast.Expr) string {
 				s += "\t"
 				switch v := field.Type.(type) {
 				case *ast.FuncType:
+					if len(field.Names) == 0 {
+						// A func type as a type element (e.g. "func() | int")
+						s += m.exprString(v)
+						break
+					}
 					s += field.Names[0].Name + "("
 					if v.Params != nil {
 						for i, param := range v.Params.List {
@@ -764,10 +1589,13 @@ func (m *mockGen) exprString(exp ast.Expr) string {
 						}
 					}
 					s += ")"
-					if v.Results != nil {
+					if v.Results != nil && len(v.Results.List) > 0 {
+						// Parens are needed for more than one result, or
+						// for a single named result (e.g. "(err error)").
+						parens := len(v.Results.List) > 1 ||
+							len(v.Results.List[0].Names) > 0
 						s += " "
-						if len(v.Results.List) > 1 ||
-							len(v.Results.List[0].Names) > 0 {
+						if parens {
 							s += "("
 						}
 						for i, result := range v.Results.List {
@@ -785,17 +1613,14 @@ func (m *mockGen) exprString(exp ast.Expr) string {
 							}
 							s += m.exprString(result.Type)
 						}
-						if len(v.Results.List) > 1 ||
-							len(v.Results.List[0].Names) > 0 {
+						if parens {
 							s += ")"
 						}
 					}
-				case *ast.SelectorExpr:
-					s += m.exprString(v)
-				case *ast.Ident:
-					s += m.exprString(v)
 				default:
-					panic(fmt.Sprintf("Don't expect %T in interface", field.Type))
+					// Embedded interfaces, and the type elements of a
+					// constraint (e.g. "~int | Ordered" or "[]byte")
+					s += m.exprString(v)
 				}
 				s += "\n"
 			}
@@ -839,7 +1664,7 @@ func (m *mockGen) exprString(exp ast.Expr) string {
 		}
 		return s
 	case *ast.BinaryExpr:
-		return m.exprString(v.X) + v.Op.String() + m.exprString(v.Y)
+		return m.exprString(v.X) + " " + v.Op.String() + " " + m.exprString(v.Y)
 	case *ast.SliceExpr:
 		s := m.exprString(v.X) + "["
 		if v.Low != nil {
@@ -858,8 +1683,144 @@ func (m *mockGen) exprString(exp ast.Expr) string {
 		s += "]"
 		return s
 	default:
-		panic(fmt.Sprintf("Can't convert (%v)%T to string in exprString", exp, exp))
+		if m.exprErr == nil {
+			m.exprErr = fmt.Errorf("%s: can't convert %T to string",
+				m.fset.Position(exp.Pos()), exp)
+		}
+		return fmt.Sprintf("--- unknown expression: %T", exp)
+	}
+}
+
+// typeParams returns the type parameter list for a generic type declaration
+// (e.g. "[K comparable, V any]"), or "" if there isn't one.
+func (m *mockGen) typeParams(params *ast.FieldList) string {
+	if params == nil || len(params.List) == 0 {
+		return ""
+	}
+	s := "["
+	for i, param := range params.List {
+		if i > 0 {
+			s += ", "
+		}
+		for j, name := range param.Names {
+			if j > 0 {
+				s += ", "
+			}
+			s += name.Name
+		}
+		s += " " + m.exprString(param.Type)
+	}
+	s += "]"
+	return s
+}
+
+// addInterface records t with ifInfo if it is an interface that can be
+// mocked.  An interface that we don't understand is an error if we are being
+// strict, otherwise it is just left out of the interface mocks.
+func (m *mockGen) addInterface(t *ast.TypeSpec, imports map[string]string) error {
+	err := m.ifInfo.addType(t, imports)
+	if err == nil {
+		return nil
+	}
+	err = fmt.Errorf("%s: %s", m.fset.Position(t.Pos()), err)
+	if m.strict {
+		return err
+	}
+	log.Printf("Not mocking interface: %s", err)
+	return nil
+}
+
+// addTypeParams records the type parameters of t if it is a generic type, so
+// that a matching recorder type can be declared for its methods.  The imports
+// used by the constraints are recorded too, as the recorder type is declared
+// in a different file.
+func (m *mockGen) addTypeParams(t *ast.TypeSpec, imports map[string]string) {
+	if t.TypeParams == nil || len(t.TypeParams.List) == 0 {
+		return
+	}
+	if m.generics == nil {
+		m.generics = make(map[string]*ast.FieldList)
+		m.genericImports = make(map[string]map[string]string)
+	}
+	m.generics[t.Name.Name] = t.TypeParams
+
+	used := make(map[string]string)
+	ast.Inspect(t.TypeParams, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok && imports[x.Name] != "" {
+				used[x.Name] = imports[x.Name]
+			}
+		}
+		return true
+	})
+	m.genericImports[t.Name.Name] = used
+}
+
+// recorderImports returns the imports needed by the recorder types for the
+// receiver types bases, as a map of name to import path.
+func (m *mockGen) recorderImports(bases ...string) map[string]string {
+	imports := make(map[string]string)
+	for _, base := range bases {
+		for name, impPath := range m.genericImports[strings.TrimPrefix(base, "*")] {
+			imports[name] = impPath
+		}
+	}
+	return imports
+}
+
+// writeImportSpecs writes out imports (a map of name to import path) as the
+// specs of an import declaration, in order.
+func writeImportSpecs(out io.Writer, imports map[string]string) {
+	names := make([]string, 0, len(imports))
+	for name := range imports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "\t%s \"%s\"\n", name, imports[name])
+	}
+}
+
+// typeArgs returns the names of the type parameters in params as type
+// arguments (e.g. "[K, V]"), or "" if there aren't any.
+func typeArgs(params *ast.FieldList) string {
+	if params == nil || len(params.List) == 0 {
+		return ""
+	}
+	names := []string{}
+	for _, param := range params.List {
+		for _, name := range param.Names {
+			names = append(names, name.Name)
+		}
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
+
+// recvType returns the name of the receiver type expr, without any pointer or
+// type arguments, and the type arguments (e.g. "List" and "[T]" for
+// "*List[T]").
+func (m *mockGen) recvType(expr ast.Expr) (string, string) {
+	if s, ok := expr.(*ast.StarExpr); ok {
+		expr = s.X
+	}
+	switch v := expr.(type) {
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		s := m.exprString(v)
+		i := strings.Index(s, "[")
+		return s[:i], s[i:]
 	}
+	return m.exprString(expr), ""
+}
+
+// typeSpec returns the source for the type declared by t (without the type
+// keyword), keeping the type parameters, and the "=" of an alias - which
+// declares another name for the type rather than a new type.
+func (m *mockGen) typeSpec(t *ast.TypeSpec) string {
+	s := t.Name.Name + m.typeParams(t.TypeParams) + " "
+	if t.Assign.IsValid() {
+		s += "= "
+	}
+	return s + m.exprString(t.Type)
 }
 
 func (m *mockGen) registerScope(scope string) {
@@ -881,9 +1842,28 @@ func (m *mockGen) getScopes() []string {
 	return scopes
 }
 
+// writeGenerated writes the generated code in data to filename, runs fixup on
+// it, and records that it was generated from the content identified by key
+// (so that it won't be generated again until that changes).
+func writeGenerated(filename string, key CacheFileKey, data []byte) error {
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		return err
+	}
+
+	if err := fixup(filename); err != nil {
+		return Cerr{"fixup", err}
+	}
+
+	return key.Store(filename)
+}
+
+// fixup formats the generated code in filename.  We generate all of the imports
+// ourselves, so this is just a formatting pass - goimports can't be used, as it
+// will remove imports that it thinks aren't used (or add imports that shadow
+// local names).
 func fixup(filename string) error {
-	cmd := exec.Command("goimports", "-w", filename)
-	out, err := cmd.CombinedOutput()
+	cmd := exec.Command("gofmt", "-w", filename)
+	out, err := Runner.CombinedOutput(cmd)
 	if err != nil {
 		return fmt.Errorf("Failed to run gofmt on '%s': %s\noutput:\n%s",
 			filename, err, out)
@@ -891,53 +1871,269 @@ func fixup(filename string) error {
 	return nil
 }
 
+// writeBuildTag writes out a //go:build line requiring tag, combined with the
+// existing constraint lines, followed by the blank line needed to keep the
+// constraint from becoming the package doc.  As for the go tool, an existing
+// //go:build line is used in preference to any "// +build" lines.  Since the
+// go tool ignores +build lines once a //go:build line is present, we write
+// out +build lines that match the combined constraint too.
+func writeBuildTag(out io.Writer, tag string, lines []string) error {
+	if !validBuildTag(tag) {
+		return fmt.Errorf("GeneratedBuildTag %q is not a valid build tag", tag)
+	}
+
+	var expr constraint.Expr
+	plusBuild := []constraint.Expr{}
+
+	for _, line := range lines {
+		x, err := constraint.Parse(line)
+		if err != nil {
+			return Cerr{"constraint.Parse", err}
+		}
+		if constraint.IsGoBuild(line) {
+			expr = x
+		} else {
+			plusBuild = append(plusBuild, x)
+		}
+	}
+
+	if expr == nil {
+		for _, x := range plusBuild {
+			if expr == nil {
+				expr = x
+			} else {
+				expr = &constraint.AndExpr{X: expr, Y: x}
+			}
+		}
+	}
+
+	if expr == nil {
+		expr = &constraint.TagExpr{Tag: tag}
+	} else {
+		expr = &constraint.AndExpr{X: expr, Y: &constraint.TagExpr{Tag: tag}}
+	}
+
+	fmt.Fprintf(out, "//go:build %s\n", expr)
+
+	plusLines, err := constraint.PlusBuildLines(expr)
+	if err != nil {
+		return Cerr{"constraint.PlusBuildLines", err}
+	}
+	for _, line := range plusLines {
+		fmt.Fprintf(out, "%s\n", line)
+	}
+
+	fmt.Fprintf(out, "\n")
+
+	return nil
+}
+
+// writePackageDoc writes out the package doc for the meta file of the mock of
+// the package impPath, which makes it clear to anyone reading the output of
+// go doc that they are looking at a generated mock.
+func writePackageDoc(out io.Writer, name, impPath string) {
+	fmt.Fprintf(out, "// Package %s is a mock of %s, generated by withmock.\n", name, impPath)
+	fmt.Fprintf(out, "//\n")
+	fmt.Fprintf(out, "// The declarations of the original package are rearranged, and its\n")
+	fmt.Fprintf(out, "// functions are only available through the mocks - so see the\n")
+	fmt.Fprintf(out, "// documentation of %s itself for its API.\n", impPath)
+}
+
+// writeIsMocked writes the _isMocked function, which decides if a call should
+// go to the mock (rather than the real code).  Names given to EnableMock and
+// DisableMock that end in "*" are patterns, which match any name with the
+// same prefix (e.g. "Type.*" for all the methods of Type).  Exact names take
+// precedence over patterns, and then disabled patterns over enabled ones.
+// The exact names are checked first, so that they stay fast.
+func writeIsMocked(out io.Writer) {
+	fmt.Fprintf(out, "func _isPattern(name string) bool {\n")
+	fmt.Fprintf(out, "\treturn len(name) > 0 && name[len(name)-1] == '*'\n")
+	fmt.Fprintf(out, "}\n\n")
+
+	fmt.Fprintf(out, "func _matchPattern(pattern, name string) bool {\n")
+	fmt.Fprintf(out, "\tprefix := pattern[:len(pattern)-1]\n")
+	fmt.Fprintf(out, "\treturn len(name) >= len(prefix) && name[:len(prefix)] == prefix\n")
+	fmt.Fprintf(out, "}\n\n")
+
+	fmt.Fprintf(out, "func _removePattern(patterns []string, pattern string) []string {\n")
+	fmt.Fprintf(out, "\tkept := []string{}\n")
+	fmt.Fprintf(out, "\tfor _, p := range patterns {\n")
+	fmt.Fprintf(out, "\t\tif p != pattern {\n")
+	fmt.Fprintf(out, "\t\t\tkept = append(kept, p)\n")
+	fmt.Fprintf(out, "\t\t}\n")
+	fmt.Fprintf(out, "\t}\n")
+	fmt.Fprintf(out, "\treturn kept\n")
+	fmt.Fprintf(out, "}\n\n")
+
+	fmt.Fprintf(out, "func _isMocked(name string) bool {\n")
+	fmt.Fprintf(out, "\tif _disabledMocks[name] {\n")
+	fmt.Fprintf(out, "\t\treturn false\n")
+	fmt.Fprintf(out, "\t}\n")
+	fmt.Fprintf(out, "\tif _enabledMocks[name] {\n")
+	fmt.Fprintf(out, "\t\treturn true\n")
+	fmt.Fprintf(out, "\t}\n")
+	fmt.Fprintf(out, "\tfor _, pattern := range _disabledPatterns {\n")
+	fmt.Fprintf(out, "\t\tif _matchPattern(pattern, name) {\n")
+	fmt.Fprintf(out, "\t\t\treturn false\n")
+	fmt.Fprintf(out, "\t\t}\n")
+	fmt.Fprintf(out, "\t}\n")
+	fmt.Fprintf(out, "\tfor _, pattern := range _enabledPatterns {\n")
+	fmt.Fprintf(out, "\t\tif _matchPattern(pattern, name) {\n")
+	fmt.Fprintf(out, "\t\t\treturn true\n")
+	fmt.Fprintf(out, "\t\t}\n")
+	fmt.Fprintf(out, "\t}\n")
+	fmt.Fprintf(out, "\treturn _allMocked\n")
+	fmt.Fprintf(out, "}\n\n")
+}
+
 func (m *mockGen) pkg(out io.Writer, name string) error {
+	gomock := gomockName(m.gomockName)
+
+	if m.buildTag != "" {
+		if err := writeBuildTag(out, m.buildTag, nil); err != nil {
+			return err
+		}
+	}
+
+	if m.packageDoc {
+		writePackageDoc(out, name, m.pkgName)
+	}
+
 	fmt.Fprintf(out, "package %s\n\n", name)
 
-	fmt.Fprintf(out, "import \"github.com/golang/mock/gomock\"\n\n")
+	fmt.Fprintf(out, "import (\n")
+	fmt.Fprintf(out, "\t_reflect \"reflect\"\n")
+	if m.envControl != "" {
+		fmt.Fprintf(out, "\t_syscall \"syscall\"\n")
+	}
+	fmt.Fprintf(out, "\n")
+	fmt.Fprintf(out, "\t%s \"%s\"\n", gomock, m.gomock)
+	if !m.perTypeFiles {
+		writeImportSpecs(out, m.recorderImports(m.recorderTypes()...))
+	}
+	fmt.Fprintf(out, ")\n\n")
 
 	fmt.Fprintf(out, "type _meta struct{}\n")
 	fmt.Fprintf(out, "type _packageMock struct{int}\n")
-	fmt.Fprintf(out, "type _package_Rec struct{\n")
-	fmt.Fprintf(out, "\tmock *_packageMock\n")
-	fmt.Fprintf(out, "}\n\n")
+	if !m.noRecorders {
+		fmt.Fprintf(out, "type _package_Rec struct{\n")
+		fmt.Fprintf(out, "\tmock *_packageMock\n")
+		fmt.Fprintf(out, "}\n")
+	}
+	fmt.Fprintf(out, "\n")
 
 	fmt.Fprintf(out, "var (\n")
-	fmt.Fprintf(out, "\t_allMocked = false\n")
+	fmt.Fprintf(out, "\t_allMocked = %v\n", m.mockAll)
 	fmt.Fprintf(out, "\t_enabledMocks = make(map[string]bool)\n")
 	fmt.Fprintf(out, "\t_disabledMocks = make(map[string]bool)\n")
-	fmt.Fprintf(out, "\t_ctrl *gomock.Controller\n")
+	fmt.Fprintf(out, "\t_enabledPatterns []string\n")
+	fmt.Fprintf(out, "\t_disabledPatterns []string\n")
+	fmt.Fprintf(out, "\t_ctrl *%s.Controller\n", gomock)
 	fmt.Fprintf(out, "\t_pkgMock = &_packageMock{}\n")
+	fmt.Fprintf(out, "\t_stubHandler func(name string)\n")
+	if m.traceCalls {
+		fmt.Fprintf(out, "\t_tracer func(name string, args []interface{})\n")
+	}
 	fmt.Fprintf(out, ")\n\n")
 
 	fmt.Fprintf(out, "func callInits(inits ...func()) {\n")
 	fmt.Fprintf(out, "\tmocked := _allMocked\n")
 	fmt.Fprintf(out, "\tenabledMocks := _enabledMocks\n")
+	fmt.Fprintf(out, "\tenabledPatterns := _enabledPatterns\n")
 	fmt.Fprintf(out, "\t_allMocked = false\n")
 	fmt.Fprintf(out, "\t_enabledMocks = nil\n")
+	fmt.Fprintf(out, "\t_enabledPatterns = nil\n")
 	fmt.Fprintf(out, "\tfor _, f := range inits {\n")
 	fmt.Fprintf(out, "\t\tf()\n")
 	fmt.Fprintf(out, "\t}\n")
 	fmt.Fprintf(out, "\t_allMocked = mocked\n")
 	fmt.Fprintf(out, "\t_enabledMocks = enabledMocks\n")
+	fmt.Fprintf(out, "\t_enabledPatterns = enabledPatterns\n")
 	fmt.Fprintf(out, "}\n\n")
 
+	writeIsMocked(out)
+
+	writeInController(out, gomock)
+	writeController(out, gomock)
+	writeCallsLock(out)
+	writeCallCounts(out, gomock)
+	if m.countCalls {
+		writeCallCounters(out)
+	}
+
+	if m.packageDoc {
+		fmt.Fprintf(out, "// %s returns the controls for the mock, e.g. to set the\n", m.MOCK)
+		fmt.Fprintf(out, "// controller or to choose which functions are mocked.\n")
+	}
 	fmt.Fprintf(out, "func %s() *_meta {\n", m.MOCK)
 	fmt.Fprintf(out, "\treturn nil\n")
 	fmt.Fprintf(out, "}\n")
 
-	fmt.Fprintf(out, "func (_ *_meta) SetController(controller *gomock.Controller) {\n")
-	fmt.Fprintf(out, "\t_ctrl = controller\n")
+	fmt.Fprintf(out, "func (_ *_meta) SetController(controller *%s.Controller) {\n", gomock)
+	fmt.Fprintf(out, "\t_setController(controller)\n")
+	fmt.Fprintf(out, "\t_resetCalls()\n")
+	if m.countCalls {
+		fmt.Fprintf(out, "\t_resetCallCounts()\n")
+	}
+	fmt.Fprintf(out, "}\n")
+
+	fmt.Fprintf(out, "func (_ *_meta) WithController(controller *%s.Controller) (restore func()) {\n", gomock)
+	fmt.Fprintf(out, "\tprevious := _setController(controller)\n")
+	fmt.Fprintf(out, "\treturn func() { _setController(previous) }\n")
+	fmt.Fprintf(out, "}\n")
+
+	writeInstall(out, "func (_ *_meta) Install", gomock, m.countCalls)
+
+	fmt.Fprintf(out, "func (_ *_meta) Finish() {\n")
+	fmt.Fprintf(out, "\t_finishController(_controller())\n")
+	fmt.Fprintf(out, "}\n")
+
+	fmt.Fprintf(out, "func (_ *_meta) PendingExpectations() []string {\n")
+	fmt.Fprintf(out, "\treturn _pendingCalls()\n")
+	fmt.Fprintf(out, "}\n")
+
+	fmt.Fprintf(out, "func (_ *_meta) ExpectInOrder(calls ...*%s.Call) {\n", gomock)
+	fmt.Fprintf(out, "\t%s.InOrder(calls...)\n", gomock)
+	fmt.Fprintf(out, "}\n")
+
+	fmt.Fprintf(out, "func (_ *_meta) SetStubHandler(handler func(name string)) {\n")
+	fmt.Fprintf(out, "\t_stubHandler = handler\n")
 	fmt.Fprintf(out, "}\n")
 
+	if m.traceCalls {
+		fmt.Fprintf(out, "func (_ *_meta) SetTracer(tracer func(name string, args []interface{})) {\n")
+		fmt.Fprintf(out, "\t_tracer = tracer\n")
+		fmt.Fprintf(out, "}\n")
+	}
+
+	if m.countCalls {
+		fmt.Fprintf(out, "func (_ *_meta) CallCount(name string) int {\n")
+		fmt.Fprintf(out, "\treturn _callCount(name)\n")
+		fmt.Fprintf(out, "}\n")
+	}
+
 	fmt.Fprintf(out, "func (_ *_meta) MockAll(enabled bool) {\n")
 	fmt.Fprintf(out, "\t_allMocked = enabled\n")
 	fmt.Fprintf(out, "\t_enabledMocks = make(map[string]bool)\n")
 	fmt.Fprintf(out, "\t_disabledMocks = make(map[string]bool)\n")
+	fmt.Fprintf(out, "\t_enabledPatterns = nil\n")
+	fmt.Fprintf(out, "\t_disabledPatterns = nil\n")
+	if m.countCalls {
+		fmt.Fprintf(out, "\t_resetCallCounts()\n")
+	}
 	fmt.Fprintf(out, "}\n")
 
+	if m.envControl != "" {
+		m.writeEnvControl(out)
+	}
+
 	fmt.Fprintf(out, "func (_ *_meta) EnableMock(names ...string) {\n")
 	fmt.Fprintf(out, "\tfor _, name := range names {\n")
+	fmt.Fprintf(out, "\t\tif _isPattern(name) {\n")
+	fmt.Fprintf(out, "\t\t\t_enabledPatterns = append(_removePattern(_enabledPatterns, name), name)\n")
+	fmt.Fprintf(out, "\t\t\t_disabledPatterns = _removePattern(_disabledPatterns, name)\n")
+	fmt.Fprintf(out, "\t\t\tcontinue\n")
+	fmt.Fprintf(out, "\t\t}\n")
 	fmt.Fprintf(out, "\t\t_enabledMocks[name] = true\n")
 	fmt.Fprintf(out, "\t\tdelete(_disabledMocks, name)\n")
 	fmt.Fprintf(out, "\t}\n")
@@ -945,47 +2141,149 @@ func (m *mockGen) pkg(out io.Writer, name string) error {
 
 	fmt.Fprintf(out, "func (_ *_meta) DisableMock(names ...string) {\n")
 	fmt.Fprintf(out, "\tfor _, name := range names {\n")
+	fmt.Fprintf(out, "\t\tif _isPattern(name) {\n")
+	fmt.Fprintf(out, "\t\t\t_disabledPatterns = append(_removePattern(_disabledPatterns, name), name)\n")
+	fmt.Fprintf(out, "\t\t\t_enabledPatterns = _removePattern(_enabledPatterns, name)\n")
+	fmt.Fprintf(out, "\t\t\tcontinue\n")
+	fmt.Fprintf(out, "\t\t}\n")
 	fmt.Fprintf(out, "\t\t_disabledMocks[name] = true\n")
 	fmt.Fprintf(out, "\t\tdelete(_enabledMocks, name)\n")
 	fmt.Fprintf(out, "\t}\n")
 	fmt.Fprintf(out, "}\n\n")
 
+	if m.noRecorders {
+		return nil
+	}
+
+	if m.packageDoc {
+		fmt.Fprintf(out, "// %s returns the recorder for expected calls to the functions of\n", m.EXPECT)
+		fmt.Fprintf(out, "// the package.\n")
+	}
 	fmt.Fprintf(out, "func %s() *_package_Rec {\n", m.EXPECT)
 	fmt.Fprintf(out, "\treturn &_package_Rec{_pkgMock}\n")
 	fmt.Fprintf(out, "}\n\n")
 
-	for base, rec := range m.recorders {
-		if _, found := m.recorders[base[1:]]; base[0] == '*' && found {
-			// If pointer and non-pointer receiver, just use the non-pointer
+	if m.perTypeFiles {
+		// The recorder types are written out by typeFile instead
+		return nil
+	}
+
+	for _, base := range m.recorderTypes() {
+		m.writeRecorderType(out, base)
+	}
+
+	return nil
+}
+
+// writeEnvControl writes out an init function that turns on mocking for the
+// whole package if its import path is listed in the (comma separated)
+// environment variable named by m.envControl.  syscall is used to read the
+// variable, and the list is split by hand, to keep the imports to a minimum.
+func (m *mockGen) writeEnvControl(out io.Writer) {
+	fmt.Fprintf(out, "func init() {\n")
+	fmt.Fprintf(out, "\tvalue, _ := _syscall.Getenv(\"%s\")\n", m.envControl)
+	fmt.Fprintf(out, "\tfor value != \"\" {\n")
+	fmt.Fprintf(out, "\t\tname := value\n")
+	fmt.Fprintf(out, "\t\tvalue = \"\"\n")
+	fmt.Fprintf(out, "\t\tfor i := 0; i < len(name); i++ {\n")
+	fmt.Fprintf(out, "\t\t\tif name[i] == ',' {\n")
+	fmt.Fprintf(out, "\t\t\t\tname, value = name[:i], name[i+1:]\n")
+	fmt.Fprintf(out, "\t\t\t\tbreak\n")
+	fmt.Fprintf(out, "\t\t\t}\n")
+	fmt.Fprintf(out, "\t\t}\n")
+	fmt.Fprintf(out, "\t\tif name == \"%s\" {\n", m.pkgName)
+	fmt.Fprintf(out, "\t\t\t%s().MockAll(true)\n", m.MOCK)
+	fmt.Fprintf(out, "\t\t}\n")
+	fmt.Fprintf(out, "\t}\n")
+	fmt.Fprintf(out, "}\n\n")
+}
+
+// recorderTypes returns the receiver types that need a recorder type, in
+// order.  If a type has both pointer and value receivers, then only the
+// pointer is returned (the value methods can be called through it, but not
+// vice versa).
+func (m *mockGen) recorderTypes() []string {
+	types := make([]string, 0, len(m.recorders))
+	for base := range m.recorders {
+		if _, found := m.recorders["*"+base]; base[0] != '*' && found {
 			continue
 		}
-		name := base
-		mock := "Mock_" + name
-		retType := mock
-		mod := ""
-		if base[0] == '*' {
-			name = base[1:]
-			mock = "Mock_" + name
-			retType = "*" + mock
-			mod = "&"
-		}
-		_, isInterface := m.types[name].(*ast.InterfaceType)
-		if !isInterface && !ast.IsExported(name) {
-			fmt.Fprintf(out, "type %s struct {\n", mock)
-			fmt.Fprintf(out, "\t%s\n", name)
-			fmt.Fprintf(out, "}\n")
+		types = append(types, base)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// writeRecorderType writes out the recorder type for the receiver type base,
+// along with the EXPECT method that returns it (and a wrapper type for
+// unexported types, so that they can be created by the test).
+func (m *mockGen) writeRecorderType(out io.Writer, base string) {
+	rec := m.recorders[base]
+	_, mixed := m.recorders[base[1:]]
+	mixed = mixed && base[0] == '*'
+	name := base
+	mock := "Mock_" + name
+	retType := mock
+	mod := ""
+	if base[0] == '*' {
+		name = base[1:]
+		mock = "Mock_" + name
+		retType = "*" + mock
+		mod = "&"
+	}
+	// A generic type needs a generic recorder, with the same type parameters
+	params := m.typeParams(m.generics[name])
+	args := typeArgs(m.generics[name])
+	_, isInterface := m.types[name].(*ast.InterfaceType)
+	if !isInterface && !ast.IsExported(name) {
+		fmt.Fprintf(out, "type %s%s struct {\n", mock, params)
+		fmt.Fprintf(out, "\t%s%s\n", name, args)
+		fmt.Fprintf(out, "}\n")
+		// _meta can't have a generic method, so the wrapper of a generic
+		// type has to be created directly.
+		if params == "" {
 			fmt.Fprintf(out, "func (_ *_meta) New%s() %s {\n", name,
 				retType)
 			fmt.Fprintf(out, "\treturn %s%s{}\n", mod, mock)
 			fmt.Fprintf(out, "}\n\n")
 		}
-		fmt.Fprintf(out, "type %s struct {\n", rec)
-		fmt.Fprintf(out, "\tmock %s\n", base)
+	}
+	fmt.Fprintf(out, "type %s%s struct {\n", rec, params)
+	fmt.Fprintf(out, "\tmock %s%s\n", base, args)
+	fmt.Fprintf(out, "}\n\n")
+	switch {
+	case mixed:
+		fmt.Fprintf(out, "func (_mr *%s%s) _receiver() %s%s {\n", rec, args, name, args)
+		fmt.Fprintf(out, "\treturn *_mr.mock\n")
 		fmt.Fprintf(out, "}\n\n")
-		fmt.Fprintf(out, "func (_m %s) %s() *%s {\n", base, m.ObjEXPECT, rec)
-		fmt.Fprintf(out, "\treturn &%s{_m}\n", rec)
+	case base[0] != '*':
+		fmt.Fprintf(out, "func (_mr *%s%s) _receiver() %s%s {\n", rec, args, name, args)
+		fmt.Fprintf(out, "\treturn _mr.mock\n")
 		fmt.Fprintf(out, "}\n\n")
 	}
+	fmt.Fprintf(out, "func (_m %s%s) %s() *%s%s {\n", base, args, m.ObjEXPECT, rec, args)
+	fmt.Fprintf(out, "\treturn &%s%s{_m}\n", rec, args)
+	fmt.Fprintf(out, "}\n\n")
+}
+
+// typeFile writes out a file containing just the recorder type for the
+// receiver type base, for when PerTypeFiles is set.
+func (m *mockGen) typeFile(out io.Writer, name, base string) error {
+	if m.buildTag != "" {
+		if err := writeBuildTag(out, m.buildTag, nil); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(out, "package %s\n\n", name)
+
+	if imports := m.recorderImports(base); len(imports) > 0 {
+		fmt.Fprintf(out, "import (\n")
+		writeImportSpecs(out, imports)
+		fmt.Fprintf(out, ")\n\n")
+	}
+
+	m.writeRecorderType(out, base)
 
 	return nil
 }
@@ -1006,19 +2304,84 @@ func getVendorPaths(pkgName string) []string {
 	return append(vendors, "vendor")
 }
 
-func lookupImportName(main string, alternates ...string) (string, error) {
-	name, err := GetOutput("go", "list", "-f", "{{.Name}}", main)
+func lookupImportName(dir, main string, alternates ...string) (string, error) {
+	name, err := GetOutputIn(dir, "go", "list", "-f", "{{.Name}}", main)
 	if err == nil {
 		return name, nil
 	}
 	for _, alternate := range alternates {
-		if name, err := GetOutput("go", "list", "-f", "{{.Name}}", alternate); err == nil {
+		if name, err := GetOutputIn(dir, "go", "list", "-f", "{{.Name}}", alternate); err == nil {
 			return name, nil
 		}
 	}
 	return "", err
 }
 
+// importDir returns the directory holding the source of the package impPath,
+// imported by the package in srcPath, or "" if it can't be found.
+func importDir(impPath, srcPath string) string {
+	if isRelativeImport(impPath) {
+		return filepath.Join(srcPath, impPath)
+	}
+	dir, err := LookupImportPath(impPath)
+	if err != nil {
+		return ""
+	}
+	return dir
+}
+
+// sourcePackageName returns the name of the package in dir, read from the
+// package clauses of its (non-test) Go files - ignoring any build constraints.
+func sourcePackageName(dir string) (string, error) {
+	if dir == "" {
+		return "", fmt.Errorf("No directory for package")
+	}
+
+	isGoFile := func(info os.FileInfo) bool {
+		return strings.HasSuffix(info.Name(), ".go") &&
+			!strings.HasSuffix(info.Name(), "_test.go")
+	}
+
+	pkgs, err := parser.ParseDir(token.NewFileSet(), dir, isGoFile,
+		parser.PackageClauseOnly)
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, 0, len(pkgs))
+	for name := range pkgs {
+		names = append(names, name)
+	}
+	if len(names) != 1 {
+		sort.Strings(names)
+		return "", fmt.Errorf("Expected one package in %s, found %v", dir, names)
+	}
+
+	return names[0], nil
+}
+
+// inModule returns true if the go command treats dir as being inside a module.
+func inModule(dir string) bool {
+	gomod, err := GetOutputIn(dir, "go", "env", "GOMOD")
+	return err == nil && gomod != "" && gomod != os.DevNull
+}
+
+func isRelativeImport(impPath string) bool {
+	return strings.HasPrefix(impPath, "./") || strings.HasPrefix(impPath, "../")
+}
+
+// resolvePackageName returns the name of the package impPath, using resolve
+// (from MockConfig.ResolvePackageName) if it is set, and getPackageName if it
+// isn't.
+func resolvePackageName(resolve func(impPath, srcPath string) (string, error), impPath, srcPath, pkgName string) (string, error) {
+	// The magic "C" package isn't a real package, so there is nothing to
+	// resolve.
+	if resolve == nil || impPath == "C" {
+		return getPackageName(impPath, srcPath, pkgName)
+	}
+	return resolve(impPath, srcPath)
+}
+
 func getPackageName(impPath, srcPath, pkgName string) (string, error) {
 	log.Printf("getPackageName: imp: %s, src: %s, pkg: %s", impPath, srcPath, pkgName)
 
@@ -1027,41 +2390,37 @@ func getPackageName(impPath, srcPath, pkgName string) (string, error) {
 		return "", nil
 	}
 
+	if isRelativeImport(impPath) && pkgName != "" && inModule(srcPath) {
+		// Inside a module the directories match the import paths, so we can
+		// look up the full import path instead (which can be cached).
+		impPath = path.Join(pkgName, impPath)
+	}
+
 	name, found := pkgNames[impPath]
 	if found {
 		return name, nil
 	}
 
-	chdir := ""
+	dir := ""
 	cache := true
 	lookupPath := impPath
 
-	if strings.HasPrefix(impPath, "./") {
-		// relative import, no caching, need to change directory
-		chdir = srcPath
+	if isRelativeImport(impPath) {
+		// relative import, no caching, need to run in the source directory
+		dir = srcPath
 		cache = false
 	}
 
 	if strings.HasPrefix(impPath, "_/") {
-		// outside of GOPATH, need to change directory and use "." for the
-		// lookup path
-		chdir = impPath[1:]
+		// outside of GOPATH, need to run in the package directory and use "."
+		// for the lookup path
+		dir = impPath[1:]
 		lookupPath = "."
 	}
 
-	if chdir != "" {
-		cwd, err := os.Getwd()
-		if err != nil {
-			return "", err
-		}
-		defer os.Chdir(cwd)
-
-		os.Chdir(chdir)
-	}
-
 	lookupPaths := []string{}
 
-	if chdir == "" && pkgName != "" {
+	if dir == "" && pkgName != "" {
 		for _, vsrc := range getVendorPaths(pkgName) {
 			path := vsrc + "/" + lookupPath
 			lookupPaths = append(lookupPaths, path)
@@ -1070,9 +2429,24 @@ func getPackageName(impPath, srcPath, pkgName string) (string, error) {
 
 	log.Printf("LookupPaths: %s", lookupPaths)
 
-	name, err := lookupImportName(lookupPath, lookupPaths...)
+	name, err := lookupImportName(dir, lookupPath, lookupPaths...)
 	if err != nil {
-		return "", fmt.Errorf("Failed to get name for '%s': %s", impPath, err)
+		// go list fails for packages that it can't build (e.g. one with only
+		// cgo files when cgo is disabled), but we can still read the package
+		// clause from the source ourselves.
+		var srcErr error
+		name, srcErr = sourcePackageName(importDir(impPath, srcPath))
+		if srcErr != nil {
+			return "", fmt.Errorf("Failed to get name for '%s': %s", impPath, err)
+		}
+		log.Printf("getPackageName: go list failed (%s), using %s from source", err, name)
+	}
+
+	// A command can't be imported, and "main" isn't usable as an import name,
+	// so we would only generate broken code.
+	if name == "main" {
+		return "", fmt.Errorf("Failed to get name for '%s': it is a command "+
+			"(package main), which can't be imported", impPath)
 	}
 
 	if cache {
@@ -1082,83 +2456,222 @@ func getPackageName(impPath, srcPath, pkgName string) (string, error) {
 	return name, nil
 }
 
+// readSource returns the source from r between the offsets start and end
+// (inclusive).  ReadAt may return io.EOF along with all of the data when the
+// read ends at the end of the input (e.g. a file ending with the closing brace
+// of a function), which isn't an error here.
+func readSource(r io.ReaderAt, start, end int) ([]byte, error) {
+	buf := make([]byte, end-start+1)
+	n, err := r.ReadAt(buf, int64(start))
+	if err == io.EOF && n == len(buf) {
+		err = nil
+	}
+	return buf, err
+}
+
+// gomockAlias is the name that the generated code imports gomock as when the
+// package being mocked already uses the name gomock for something else.
+const gomockAlias = "_wmgomock"
+
+// gomockName returns name, or "gomock" if name is empty - i.e. the name that
+// the generated code refers to gomock by.
+func gomockName(name string) string {
+	if name == "" {
+		return "gomock"
+	}
+	return name
+}
+
+// chooseGomockName returns the name that the mock of the package made up of
+// files should import gomock (found at gomock) as.  The generated code is in
+// the same package as the (rewritten) source files, so if the package declares
+// gomock itself, or imports some other package as gomock, then gomockAlias is
+// used instead of gomock.
+func chooseGomockName(files map[string]*ast.File, gomock string) string {
+	for _, file := range files {
+		for _, spec := range file.Imports {
+			impPath := strings.Trim(spec.Path.Value, "\"")
+			if impPath == gomock {
+				continue
+			}
+			if spec.Name != nil {
+				if spec.Name.Name == "gomock" {
+					return gomockAlias
+				}
+			} else if path.Base(impPath) == "gomock" {
+				// Without a name, we assume that the package is named
+				// after the last element of the import path.
+				return gomockAlias
+			}
+		}
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Recv == nil && d.Name.Name == "gomock" {
+					return gomockAlias
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch s := spec.(type) {
+					case *ast.TypeSpec:
+						if s.Name.Name == "gomock" {
+							return gomockAlias
+						}
+					case *ast.ValueSpec:
+						for _, name := range s.Names {
+							if name.Name == "gomock" {
+								return gomockAlias
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return "gomock"
+}
+
+// isGomockImport returns true if s imports gomock under the name that the
+// generated code uses, and so can be dropped in favour of our own import.  If
+// gomock is imported under a different name (e.g. because gomockAlias is
+// being used) then the import is still needed by the source.
+func (m *mockGen) isGomockImport(s *ast.ImportSpec) bool {
+	if strings.Trim(s.Path.Value, "\"") != m.gomock {
+		return false
+	}
+	name := "gomock"
+	if s.Name != nil {
+		name = s.Name.Name
+	}
+	return name == gomockName(m.gomockName)
+}
+
+// source returns the source of filename, using the rewritten source if we have
+// had to change the file (see qualifyDotImports).
+func (m *mockGen) source(filename string) ([]byte, error) {
+	if src, found := m.sources[filepath.Base(filename)]; found {
+		return src, nil
+	}
+	return ioutil.ReadFile(filename)
+}
+
+// initName returns the name that the n'th init function in filename is renamed
+// to.  The name only depends on the file, so that a generated file that is up
+// to date stays valid when inits are added to the other files.
+func initName(filename string, n int) string {
+	base := strings.TrimSuffix(filepath.Base(filename), ".go")
+	base = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, base)
+	return fmt.Sprintf("_real_init_%s_%d", base, n)
+}
+
 func (m *mockGen) file(out io.Writer, f *ast.File, filename string) (map[string]bool, error) {
 	log.Printf("MOCK: %s", filename)
-	data, err := os.Open(filename)
+
+	src, err := m.source(filename)
 	if err != nil {
-		return nil, Cerr{"Open", err}
+		return nil, Cerr{"m.source", err}
 	}
-	defer data.Close()
 
 	// Make sure data is available to exprString
-	m.data = data
-
-	buildTags := false
-
-	// Look for buildTags
-	if len(f.Comments) > 0 {
-		for _, cg := range f.Comments {
-			if cg.Pos() >= f.Package {
-				// Reached package keyword
-				break
-			}
-			for _, c := range cg.List {
-				if strings.HasPrefix(c.Text, "// +build") {
-					buildTags = true
-					fmt.Fprintf(out, "%s\n", c.Text)
-				}
+	m.data = bytes.NewReader(src)
+	m.exprErr = nil
+
+	// Look for build constraints, which must be kept so that only the files
+	// for the build are used (e.g. if two files declare the same const under
+	// different tags).
+	buildLines := []string{}
+	for _, cg := range f.Comments {
+		if cg.Pos() >= f.Package {
+			// Reached package keyword
+			break
+		}
+		for _, c := range cg.List {
+			if constraint.IsGoBuild(c.Text) || constraint.IsPlusBuild(c.Text) {
+				buildLines = append(buildLines, c.Text)
 			}
 		}
 	}
-	if buildTags {
+
+	buildTags := len(buildLines) > 0
+
+	if m.buildTag != "" {
+		if err := writeBuildTag(out, m.buildTag, buildLines); err != nil {
+			return nil, err
+		}
+	} else if buildTags {
+		for _, line := range buildLines {
+			fmt.Fprintf(out, "%s\n", line)
+		}
 		// Make sure build tags don't touch package statement
 		fmt.Fprintf(out, "\n")
 	}
 
-	if f.Doc != nil {
-		for _, cmt := range f.Doc.List {
-			fmt.Fprintf(out, "%s\n", cmt.Text)
-		}
+	if m.preserveHeaders {
+		m.writeHeaders(out, f)
+	}
+
+	// With PackageDoc the meta file has the package doc instead, as go doc
+	// would otherwise merge it with the (misleading) original one.
+	if !m.packageDoc {
+		writeComments(out, f.Doc, "")
 	}
 
 	imports := make(map[string]string)
 	inits := []string{}
+	initCount := 0
 
-	fmt.Fprintf(out, "package %s\n\n", f.Name)
+	pkgClause := f.Name.Name
+	if m.pkgClause != "" {
+		pkgClause = m.pkgClause
+	}
+
+	fmt.Fprintf(out, "package %s\n\n", pkgClause)
 
-	fmt.Fprintf(out, "import \"github.com/golang/mock/gomock\"\n\n")
+	fmt.Fprintf(out, "import %s \"%s\"\n\n", gomockName(m.gomockName), m.gomock)
 
 	for _, decl := range f.Decls {
 		switch d := decl.(type) {
 		case *ast.GenDecl:
-			if d.Doc != nil && d.Doc.Text() != "" {
-				fmt.Fprintf(out, "/*\n%s*/\n", d.Doc.Text())
+			// We always keep the declaration doc, as it might be a cgo
+			// preamble.  Any //go:embed directives are moved onto the var
+			// spec, as we always write vars in a block.
+			if d.Tok == token.VAR {
+				writeComments(out, withoutEmbeds(d.Doc), "")
+			} else {
+				writeComments(out, d.Doc, "")
 			}
 			switch d.Tok {
 			case token.IMPORT:
 				if len(d.Specs) == 1 {
 					s := d.Specs[0].(*ast.ImportSpec)
 					impPath := strings.Trim(s.Path.Value, "\"")
-					if impPath == "github.com/golang/mock/gomock" {
+					if m.isGomockImport(s) {
 						continue
 					}
-					if s.Doc != nil {
-						fmt.Fprintf(out, "%s", s.Doc.Text())
-					}
+					writeComments(out, s.Doc, "")
 					fmt.Fprintf(out, "import ")
 					if s.Name != nil {
 						fmt.Fprintf(out, "%s ", s.Name)
 						imports[s.Name.String()] = impPath
+						if s.Name.Name == "." {
+							m.ifInfo.addDotImport(impPath)
+						}
 					} else {
-						name, err := getPackageName(impPath, m.srcPath, m.pkgName)
+						name, err := resolvePackageName(m.resolveName, impPath, m.srcPath, m.pkgName)
 						if err == nil {
 							fmt.Fprintf(out, "%s ", name)
 							imports[name] = impPath
-						} else if !buildTags {
+						} else if !buildTags || m.strict {
 							// We only return an error if there are no build
-							// tags.  If there are build tags then this file
-							// might not actually be compiled - so the package
-							// being missing may not be a problem ...
+							// tags (or we are being strict).  If there are
+							// build tags then this file might not actually be
+							// compiled - so the package being missing may not
+							// be a problem ...
 							return nil, Cerr{"getPackageName", err}
 						}
 					}
@@ -1169,24 +2682,28 @@ func (m *mockGen) file(out io.Writer, f *ast.File, filename string) (map[string]
 				for _, spec := range d.Specs {
 					s := spec.(*ast.ImportSpec)
 					impPath := strings.Trim(s.Path.Value, "\"")
-					if impPath == "github.com/golang/mock/gomock" {
+					if m.isGomockImport(s) {
 						continue
 					}
 					fmt.Fprintf(out, "\t")
 					if s.Name != nil {
 						fmt.Fprintf(out, "%s ", s.Name)
 						imports[s.Name.String()] = impPath
+						if s.Name.Name == "." {
+							m.ifInfo.addDotImport(impPath)
+						}
 					} else {
 						log.Printf("Import: %s (src: %s, name: %s)", impPath, m.srcPath, m.pkgName)
-						name, err := getPackageName(impPath, m.srcPath, m.pkgName)
+						name, err := resolvePackageName(m.resolveName, impPath, m.srcPath, m.pkgName)
 						if err == nil {
 							fmt.Fprintf(out, "%s ", name)
 							imports[name] = impPath
-						} else if !buildTags {
+						} else if !buildTags || m.strict {
 							// We only return an error if there are no build
-							// tags.  If there are build tags then this file
-							// might not actually be compiled - so the package
-							// being missing may not be a problem ...
+							// tags (or we are being strict).  If there are
+							// build tags then this file might not actually be
+							// compiled - so the package being missing may not
+							// be a problem ...
 							return nil, Cerr{"getPackageName", err}
 						}
 					}
@@ -1201,16 +2718,28 @@ func (m *mockGen) file(out io.Writer, f *ast.File, filename string) (map[string]
 				// We can't ignore private types, as we might be using them.
 				if len(d.Specs) == 1 {
 					t := d.Specs[0].(*ast.TypeSpec)
-					fmt.Fprintf(out, "type %s %s\n\n", t.Name, m.exprString(t.Type))
+					m.writeDoc(out, t.Doc, "")
+					fmt.Fprintf(out, "type %s", m.typeSpec(t))
+					m.writeLineComment(out, t.Comment)
+					fmt.Fprintf(out, "\n\n")
 					m.types[t.Name.String()] = t.Type
-					m.ifInfo.addType(t, imports)
+					m.addTypeParams(t, imports)
+					if err := m.addInterface(t, imports); err != nil {
+						return nil, err
+					}
 				} else {
 					fmt.Fprintf(out, "type (\n")
 					for i := range d.Specs {
 						t := d.Specs[i].(*ast.TypeSpec)
-						fmt.Fprintf(out, "\t%s %s\n", t.Name, m.exprString(t.Type))
+						m.writeDoc(out, t.Doc, "\t")
+						fmt.Fprintf(out, "\t%s", m.typeSpec(t))
+						m.writeLineComment(out, t.Comment)
+						fmt.Fprintf(out, "\n")
 						m.types[t.Name.String()] = t.Type
-						m.ifInfo.addType(t, imports)
+						m.addTypeParams(t, imports)
+						if err := m.addInterface(t, imports); err != nil {
+							return nil, err
+						}
 					}
 					fmt.Fprintf(out, ")\n\n")
 				}
@@ -1218,11 +2747,18 @@ func (m *mockGen) file(out io.Writer, f *ast.File, filename string) (map[string]
 				fmt.Fprintf(out, "var (\n")
 				for _, spec := range d.Specs {
 					s := spec.(*ast.ValueSpec)
+					m.writeDoc(out, s.Doc, "\t")
+					if !m.preserveComments {
+						writeEmbeds(out, s.Doc, "\t")
+					}
+					if !d.Lparen.IsValid() {
+						writeEmbeds(out, d.Doc, "\t")
+					}
 					names := make([]string, 0, len(s.Names))
 					for _, ident := range s.Names {
 						names = append(names, ident.Name)
 					}
-					fmt.Fprintf(out, "\t"+strings.Join(names, ", "))
+					fmt.Fprintf(out, "\t%s", strings.Join(names, ", "))
 					if s.Type != nil {
 						fmt.Fprintf(out, " %s", m.exprString(s.Type))
 					}
@@ -1235,8 +2771,9 @@ func (m *mockGen) file(out io.Writer, f *ast.File, filename string) (map[string]
 						for _, value := range s.Values {
 							values = append(values, m.exprString(value))
 						}
-						fmt.Fprintf(out, " = "+strings.Join(values, ", "))
+						fmt.Fprintf(out, " = %s", strings.Join(values, ", "))
 					}
+					m.writeLineComment(out, s.Comment)
 					fmt.Fprintf(out, "\n")
 				}
 				fmt.Fprintf(out, ")\n\n")
@@ -1244,11 +2781,12 @@ func (m *mockGen) file(out io.Writer, f *ast.File, filename string) (map[string]
 				fmt.Fprintf(out, "const (\n")
 				for _, spec := range d.Specs {
 					s := spec.(*ast.ValueSpec)
+					m.writeDoc(out, s.Doc, "\t")
 					names := make([]string, 0, len(s.Names))
 					for _, ident := range s.Names {
 						names = append(names, ident.Name)
 					}
-					fmt.Fprintf(out, "\t"+strings.Join(names, ", "))
+					fmt.Fprintf(out, "\t%s", strings.Join(names, ", "))
 					if s.Type != nil {
 						fmt.Fprintf(out, " %s", m.exprString(s.Type))
 					}
@@ -1261,32 +2799,44 @@ func (m *mockGen) file(out io.Writer, f *ast.File, filename string) (map[string]
 						for _, value := range s.Values {
 							values = append(values, m.exprString(value))
 						}
-						fmt.Fprintf(out, " = "+strings.Join(values, ", "))
+						fmt.Fprintf(out, " = %s", strings.Join(values, ", "))
 					}
+					m.writeLineComment(out, s.Comment)
 					fmt.Fprintf(out, "\n")
 				}
 				fmt.Fprintf(out, ")\n\n")
 			default:
+				if m.strict {
+					return nil, fmt.Errorf("Unknown GenDecl Token: %v", d.Tok)
+				}
 				fmt.Fprintf(out, "--- unknown GenDecl Token: %v\n", d.Tok)
 			}
 		case *ast.FuncDecl:
 			fi := &funcInfo{name: d.Name.String()}
-			docstring := d.Doc.Text()
-			if strings.HasPrefix(docstring, "export ") {
-				fi.export = strings.TrimSpace(docstring[7:])
+			fi.export = exportName(d.Doc)
+			fi.pragmas = pragmas(d.Doc)
+			fi.typeParams = m.typeParams(d.Type.TypeParams)
+			if m.preserveComments {
+				fi.doc = docComments(d.Doc)
 			}
 			recorder := "_package_Rec"
 			if d.Recv != nil {
 				if len(d.Recv.List[0].Names) > 0 {
 					fi.recv.name = d.Recv.List[0].Names[0].String()
 				}
-				t := m.exprString(d.Recv.List[0].Type)
-				fi.recv.expr = t
-				recorder = fmt.Sprintf("_%s_Rec", t)
-				if s, ok := d.Recv.List[0].Type.(*ast.StarExpr); ok {
-					recorder = fmt.Sprintf("_%s_Rec", m.exprString(s.X))
+				fi.recv.expr = m.exprString(d.Recv.List[0].Type)
+				// Methods of a generic type share one (generic) recorder,
+				// whatever names they give the type parameters.
+				name, args := m.recvType(d.Recv.List[0].Type)
+				base := name
+				if _, ok := d.Recv.List[0].Type.(*ast.StarExpr); ok {
+					base = "*" + name
 				}
-				m.recorders[t] = recorder
+				recorder = fmt.Sprintf("_%s_Rec", name)
+				if !m.noRecorders {
+					m.recorders[base] = recorder
+				}
+				recorder += args
 			}
 			for _, param := range d.Type.Params.List {
 				p := field{
@@ -1314,40 +2864,81 @@ func (m *mockGen) file(out io.Writer, f *ast.File, filename string) (map[string]
 			if d.Body != nil {
 				pos1 := m.fset.Position(d.Body.Lbrace)
 				pos2 := m.fset.Position(d.Body.Rbrace)
-				fi.body = make([]byte, pos2.Offset-pos1.Offset+1)
-				_, err := data.ReadAt(fi.body, int64(pos1.Offset))
+				body, err := readSource(m.data, pos1.Offset, pos2.Offset)
 				if err != nil {
-					return nil, Cerr{"ReadAt", err}
+					return nil, Cerr{"readSource", err}
 				}
+				fi.body = body
 			}
 
 			if fi.name == "init" && !fi.IsMethod() {
-				fi.name = fmt.Sprintf("_real_init_%d", m.initCount)
+				fi.name = initName(filename, initCount)
 				fi.writeReal(out)
 				if m.callInits {
 					inits = append(inits, fi.name)
 				}
-				m.initCount++
+				initCount++
 			} else if d.Body == nil && m.mockPrototypes {
-				fi.writeStub(out)
+				returns := m.stubReturns[fi.ScopedName()]
+				if err := checkStubReturns(fi, returns); err != nil {
+					return nil, err
+				}
+				fi.writeStub(out, returns)
 			} else {
 				fi.writeReal(out)
 			}
-			if d.Name.IsExported() {
-				if d.Body == nil {
+			if d.Name.IsExported() && fi.export != "" {
+				// cgo won't allow a method with the same name as a function
+				// exported to C, so we can't have a recorder for it - which
+				// means that we can't mock it.
+				log.Printf("Not mocking %s, as it is exported to C", fi.name)
+			} else if d.Name.IsExported() && fi.typeParams != "" {
+				// The mock would have to be a generic method of _packageMock,
+				// which Go doesn't allow - so a generic function is left as
+				// it is.
+				log.Printf("Not mocking %s, as it is generic", fi.name)
+			} else if d.Name.IsExported() {
+				if d.Body == nil && !fi.IsMethod() {
+					// Methods can share a name with a function (or each
+					// other), and we only rewrite function symbols.
 					m.extFunctions = append(m.extFunctions, d.Name.Name)
 				}
+				fi.trace = m.traceCalls
+				fi.count = m.countCalls
+				fi.gomock = m.gomockName
 				fi.writeMock(out)
-				fi.writeRecorder(out, recorder)
+				if !m.noRecorders {
+					fi.writeRecorder(out, recorder)
+				}
+				if m.typedDo && !m.noRecorders {
+					fi.writeTypedDo(out, recorder)
+				}
 			}
 			fmt.Fprintf(out, "\n")
 		default:
+			if m.strict {
+				return nil, fmt.Errorf("Unknown Decl Type: %T", decl)
+			}
 			fmt.Fprintf(out, "--- Unknown Decl Type: %T\n", decl)
 		}
 	}
 
-	fmt.Fprintf(out, "\n// Make sure gomock is used\n")
-	fmt.Fprintf(out, "var _ = gomock.Any()\n")
+	if m.strict && m.exprErr != nil {
+		return nil, m.exprErr
+	}
+
+	if m.strict && m.preserveComments {
+		if cg := droppedComments(f); cg != nil {
+			return nil, fmt.Errorf("%s: comment would be dropped: %s",
+				m.fset.Position(cg.Pos()), cg.List[0].Text)
+		}
+	}
+
+	if m.preserveGenerate {
+		writeGenerates(out, f)
+	}
+
+	fmt.Fprintf(out, "%s", gomockSentinel(m.gomockName))
 
 	fmt.Fprintf(out, "\n// Make sure inits are called\n")
 	fmt.Fprintf(out, "func init() {\n")
@@ -1355,7 +2946,7 @@ func (m *mockGen) file(out io.Writer, f *ast.File, filename string) (map[string]
 	fmt.Fprintf(out, "}\n")
 
 	i := map[string]bool{
-		"github.com/golang/mock/gomock": false,
+		m.gomock: false,
 	}
 
 	for _, impPath := range imports {
@@ -1365,15 +2956,298 @@ func (m *mockGen) file(out io.Writer, f *ast.File, filename string) (map[string]
 	return i, nil
 }
 
+// writeHeaders writes out the comments before the package clause of f (e.g. a
+// license header), other than the package doc and build constraints - which
+// are handled separately.
+func (m *mockGen) writeHeaders(out io.Writer, f *ast.File) {
+	for _, cg := range f.Comments {
+		if cg.Pos() >= f.Package {
+			break
+		}
+		if cg == f.Doc || isBuildConstraint(cg) {
+			continue
+		}
+		writeComments(out, cg, "")
+		fmt.Fprintf(out, "\n")
+	}
+}
+
+// droppedComments returns the first comment group after the package clause of
+// f that isn't kept by PreserveComments, or nil if there isn't one.  Only the
+// doc and line comments of declarations are kept, along with anything in the
+// body of a function (as that is copied as it is) - //go:generate directives
+// are handled separately, so they don't count.
+func droppedComments(f *ast.File) *ast.CommentGroup {
+	kept := make(map[*ast.CommentGroup]bool)
+	bodies := []*ast.BlockStmt{}
+
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			kept[d.Doc] = true
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.ImportSpec:
+					// Only a lone import keeps its doc
+					if len(d.Specs) == 1 {
+						kept[s.Doc] = true
+					}
+				case *ast.TypeSpec:
+					kept[s.Doc] = true
+					kept[s.Comment] = true
+				case *ast.ValueSpec:
+					kept[s.Doc] = true
+					kept[s.Comment] = true
+				}
+			}
+			ast.Inspect(d, func(n ast.Node) bool {
+				if lit, ok := n.(*ast.FuncLit); ok {
+					bodies = append(bodies, lit.Body)
+					return false
+				}
+				return true
+			})
+		case *ast.FuncDecl:
+			kept[d.Doc] = true
+			if d.Body != nil {
+				bodies = append(bodies, d.Body)
+			}
+		}
+	}
+
+	inBody := func(cg *ast.CommentGroup) bool {
+		for _, body := range bodies {
+			if cg.Pos() > body.Lbrace && cg.End() <= body.Rbrace {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, cg := range f.Comments {
+		if cg.Pos() < f.Package || kept[cg] || inBody(cg) {
+			continue
+		}
+		for _, c := range cg.List {
+			if !isGenerate(c) {
+				return cg
+			}
+		}
+	}
+
+	return nil
+}
+
+// isBuildConstraint returns true if cg contains a build constraint.
+func isBuildConstraint(cg *ast.CommentGroup) bool {
+	for _, c := range cg.List {
+		if constraint.IsGoBuild(c.Text) || constraint.IsPlusBuild(c.Text) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeComments writes out the comments in cg exactly as they appeared in the
+// source, with each comment on its own line prefixed by indent.  Any
+// //go:generate directives are left out, see writeGenerates.
+func writeComments(out io.Writer, cg *ast.CommentGroup, indent string) {
+	if cg == nil {
+		return
+	}
+	for _, c := range cg.List {
+		if isGenerate(c) {
+			continue
+		}
+		fmt.Fprintf(out, "%s%s\n", indent, c.Text)
+	}
+}
+
+// isGenerate returns true if c is a //go:generate directive.
+func isGenerate(c *ast.Comment) bool {
+	return strings.HasPrefix(c.Text, "//go:generate ")
+}
+
+// writeGenerates writes out all of the //go:generate directives in f, in the
+// order that they appear.  They are written together at the end of the file,
+// since most of the comments they might be found amongst are dropped.
+func writeGenerates(out io.Writer, f *ast.File) {
+	for _, cg := range f.Comments {
+		for _, c := range cg.List {
+			if isGenerate(c) {
+				fmt.Fprintf(out, "\n%s\n", c.Text)
+			}
+		}
+	}
+}
+
+// isEmbed returns true if c is a //go:embed directive.
+func isEmbed(c *ast.Comment) bool {
+	return strings.HasPrefix(c.Text, "//go:embed ")
+}
+
+// writeEmbeds writes out just the //go:embed directives from cg, which are
+// always needed - whether or not we are preserving comments.
+func writeEmbeds(out io.Writer, cg *ast.CommentGroup, indent string) {
+	if cg == nil {
+		return
+	}
+	for _, c := range cg.List {
+		if isEmbed(c) {
+			fmt.Fprintf(out, "%s%s\n", indent, c.Text)
+		}
+	}
+}
+
+// withoutEmbeds returns cg with any //go:embed directives removed.
+func withoutEmbeds(cg *ast.CommentGroup) *ast.CommentGroup {
+	if cg == nil {
+		return nil
+	}
+	list := []*ast.Comment{}
+	for _, c := range cg.List {
+		if !isEmbed(c) {
+			list = append(list, c)
+		}
+	}
+	return &ast.CommentGroup{List: list}
+}
+
+// embedPatterns returns the patterns from all of the //go:embed directives in
+// files.  Patterns may be quoted, if they contain spaces.
+func embedPatterns(files []*ast.File) []string {
+	patterns := []string{}
+	for _, f := range files {
+		for _, cg := range f.Comments {
+			for _, c := range cg.List {
+				if !isEmbed(c) {
+					continue
+				}
+				args := strings.TrimSpace(strings.TrimPrefix(c.Text, "//go:embed"))
+				for args != "" {
+					end := strings.IndexAny(args, " \t")
+					if args[0] == '"' || args[0] == '`' {
+						end = strings.IndexByte(args[1:], args[0])
+						if end >= 0 {
+							end += 2
+						}
+					}
+					if end < 0 {
+						end = len(args)
+					}
+					pattern := args[:end]
+					if p, err := strconv.Unquote(pattern); err == nil {
+						pattern = p
+					}
+					patterns = append(patterns, pattern)
+					args = strings.TrimSpace(args[end:])
+				}
+			}
+		}
+	}
+	return patterns
+}
+
+// isEmbedded returns true if the top level directory name is matched by one
+// of the embed patterns.
+func isEmbedded(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimPrefix(pattern, "all:")
+		first := strings.SplitN(pattern, "/", 2)[0]
+		if ok, _ := path.Match(first, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// writeDoc writes out a doc comment if we are preserving comments.
+func (m *mockGen) writeDoc(out io.Writer, cg *ast.CommentGroup, indent string) {
+	if m.preserveComments {
+		writeComments(out, cg, indent)
+	}
+}
+
+// writeLineComment writes out a trailing comment if we are preserving
+// comments, the caller is expected to write the newline.
+func (m *mockGen) writeLineComment(out io.Writer, cg *ast.CommentGroup) {
+	if !m.preserveComments || cg == nil {
+		return
+	}
+	for _, c := range cg.List {
+		fmt.Fprintf(out, " %s", c.Text)
+	}
+}
+
+// docComments returns the comments from doc, without any cgo export comment
+// or pragmas (which are handled separately).
+func docComments(doc *ast.CommentGroup) []string {
+	if doc == nil {
+		return nil
+	}
+	comments := make([]string, 0, len(doc.List))
+	for _, c := range doc.List {
+		if strings.HasPrefix(c.Text, "//export ") || isGenerate(c) || isPragma(c) {
+			continue
+		}
+		comments = append(comments, c.Text)
+	}
+	return comments
+}
+
+// isPragma returns true if c is a compiler directive for the function (or
+// method) that it documents, e.g. //go:noinline or //go:linkname.
+func isPragma(c *ast.Comment) bool {
+	return strings.HasPrefix(c.Text, "//go:") && !isGenerate(c)
+}
+
+// pragmas returns the compiler directives from doc, which are needed whether
+// or not we are preserving comments.
+func pragmas(doc *ast.CommentGroup) []string {
+	if doc == nil {
+		return nil
+	}
+	pragmas := []string{}
+	for _, c := range doc.List {
+		if isPragma(c) {
+			pragmas = append(pragmas, c.Text)
+		}
+	}
+	return pragmas
+}
+
+// renameLinkname returns pragma with the local name changed from old to new,
+// if it is a //go:linkname directive for old - otherwise it is returned as it
+// is.
+func renameLinkname(pragma, old, new string) string {
+	fields := strings.Fields(pragma)
+	if len(fields) < 2 || fields[0] != "//go:linkname" || fields[1] != old {
+		return pragma
+	}
+	fields[1] = new
+	return strings.Join(fields, " ")
+}
+
+// exportName returns the name given in a cgo "//export" comment in doc, or ""
+// if there isn't one.  We can't use doc.Text(), as it strips out directives.
+func exportName(doc *ast.CommentGroup) string {
+	if doc == nil {
+		return ""
+	}
+	for _, c := range doc.List {
+		if strings.HasPrefix(c.Text, "//export ") {
+			return strings.TrimSpace(c.Text[9:])
+		}
+	}
+	return ""
+}
+
 func loadInterfaceInfo(impPath string) (*ifInfo, error) {
 	path, err := LookupImportPath(impPath)
 	if err != nil {
 		return nil, err
 	}
 
-	imports := make(map[string]string)
-	ifInfo := newIfInfo("")
-
 	isGoFile := func(info os.FileInfo) bool {
 		if info.IsDir() {
 			return false
@@ -1390,28 +3264,48 @@ func loadInterfaceInfo(impPath string) (*ifInfo, error) {
 		return nil, err
 	}
 
+	files := []*ast.File{}
 	for _, pkg := range pkgs {
 		for _, file := range pkg.Files {
-			for _, i := range file.Imports {
-				impPath := strings.Trim(i.Path.Value, "\"")
-				if i.Name != nil {
-					imports[i.Name.String()] = impPath
-				} else {
-					// TODO: pkgName for vendor paths?
-					name, err := getPackageName(impPath, path, "")
-					if err != nil {
-						return nil, err
-					}
-					imports[name] = impPath
+			files = append(files, file)
+		}
+	}
+
+	return filesInterfaceInfo(files, path, nil)
+}
+
+// filesInterfaceInfo returns the interface information for the package made
+// up of files, which are found in the directory path.  The names of imported
+// packages are found using resolve if it is set.
+func filesInterfaceInfo(files []*ast.File, path string, resolve func(impPath, srcPath string) (string, error)) (*ifInfo, error) {
+	imports := make(map[string]string)
+	ifInfo := newIfInfo("")
+
+	for _, file := range files {
+		for _, i := range file.Imports {
+			impPath := strings.Trim(i.Path.Value, "\"")
+			if i.Name != nil {
+				imports[i.Name.String()] = impPath
+				if i.Name.Name == "." {
+					ifInfo.addDotImport(impPath)
+				}
+			} else {
+				// TODO: pkgName for vendor paths?
+				name, err := resolvePackageName(resolve, impPath, path, "")
+				if err != nil {
+					return nil, err
 				}
+				imports[name] = impPath
 			}
+		}
 
-			for _, decl := range file.Decls {
-				if d, ok := decl.(*ast.GenDecl); ok {
-					if d.Tok == token.TYPE {
-						for i := range d.Specs {
-							t := d.Specs[i].(*ast.TypeSpec)
-							ifInfo.addType(t, imports)
+		for _, decl := range file.Decls {
+			if d, ok := decl.(*ast.GenDecl); ok {
+				if d.Tok == token.TYPE {
+					for i := range d.Specs {
+						t := d.Specs[i].(*ast.TypeSpec)
+						if err := ifInfo.addType(t, imports); err != nil {
+							return nil, fmt.Errorf("%s: %s", path, err)
 						}
 					}
 				}
@@ -1422,47 +3316,111 @@ func loadInterfaceInfo(impPath string) (*ifInfo, error) {
 	return ifInfo, nil
 }
 
-func MockInterfaces(tmpPath, pkgName string, cfg *MockConfig) error {
+// MockInterfaces generates mocks of the interfaces of the package pkgName, to
+// be imported as <pkgName>/_mocks_ from the GOPATH at tmpPath.  They are
+// generated under cfg.InterfacesDir if that is set (and linked into tmpPath),
+// and the directory used is returned - along with a function that removes it
+// again if cfg.InterfacesCleanup asks for it, to be called once the mocks are
+// no longer needed.  If the generation fails, the directory is removed
+// straight away if the policy asks for it.
+func MockInterfaces(tmpPath, pkgName string, cfg *MockConfig) (_ string, _ func() error, err error) {
 	i := make(Interfaces)
 
-	dst := filepath.Join(tmpPath, "src", pkgName, "_mocks_")
-	err := os.MkdirAll(dst, 0700)
+	perm, err := cfg.interfacesPerm()
 	if err != nil {
-		return err
+		return "", nil, err
+	}
+
+	// Check the policy now, rather than finding out it is bad afterwards
+	if _, err := cfg.cleanupInterfaces(true); err != nil {
+		return "", nil, err
+	}
+
+	if err := cfg.checkNames(true); err != nil {
+		return "", nil, err
+	}
+
+	link := filepath.Join(tmpPath, "src", pkgName, "_mocks_")
+	dst := filepath.Join(cfg.interfacesDir(tmpPath), "src", pkgName, "_mocks_")
+	if err := os.MkdirAll(dst, perm); err != nil {
+		return "", nil, err
+	}
+
+	remove := func() error {
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+		if link == dst {
+			return nil
+		}
+		if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	if link != dst {
+		// The mocks can only be imported from the GOPATH used for the build
+		if err := os.MkdirAll(filepath.Dir(link), 0700); err != nil {
+			return "", nil, err
+		}
+		if err := os.Symlink(dst, link); err != nil {
+			return "", nil, err
+		}
+	}
+
+	defer func() {
+		if cleanup, _ := cfg.cleanupInterfaces(false); cleanup && err != nil {
+			if rmErr := remove(); rmErr != nil {
+				log.Printf("Failed to remove %s: %s", dst, rmErr)
+			}
+		}
+	}()
+
+	cleanup := func() error {
+		if cleanup, _ := cfg.cleanupInterfaces(true); cleanup {
+			return remove()
+		}
+		return nil
 	}
 
 	path, err := LookupImportPath(pkgName)
 	if err != nil {
-		return err
+		return "", nil, err
 	}
 
 	// TODO: pkgName for vendor paths?
-	name, err := getPackageName(pkgName, path, "")
+	name, err := resolvePackageName(cfg.ResolvePackageName, pkgName, path, "")
 	if err != nil {
-		return err
+		return "", nil, err
 	}
 
 	info, err := loadInterfaceInfo(pkgName)
 	if err != nil {
-		return err
+		return "", nil, err
 	}
 
 	info.filename = filepath.Join(dst, "ifmocks.go")
 
 	info.EXPECT = cfg.EXPECT
+	info.buildTag = cfg.GeneratedBuildTag
+	info.gomock = gomockPath(cfg.Gomock)
+	info.typedDo = cfg.TypedDo
+	info.traceCalls = cfg.TraceCalls
+	info.registry = cfg.MockRegistry
+	info.fallbacks = cfg.Fallbacks
+	info.fakes = cfg.Fakes
 
 	i[name+"_mocks"] = info
 	extPkg := markImport(pkgName, testMark)
 
 	if err := i.genExtInterface(name+"_mocks", extPkg); err != nil {
-		return err
+		return "", nil, err
 	}
 
-	// TODO: currently we need to use goimports to add missing imports, we
-	// need to sort out our own imports, then we can switch to gofmt.
 	if err := fixup(info.filename); err != nil {
-		return err
+		return "", nil, err
 	}
 
-	return nil
+	return dst, cleanup, nil
 }
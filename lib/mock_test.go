@@ -8,12 +8,16 @@ import (
 	"bytes"
 	"fmt"
 	"go/ast"
+	"go/build"
+	"go/doc"
 	"go/parser"
 	"go/token"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"strings"
 	"testing"
 )
@@ -142,3 +146,3468 @@ func TestMockFile(t *testing.T) {
 
 	os.Setenv("GOPATH", goPath)
 }
+
+func TestWriteBuildTag(t *testing.T) {
+	out := &bytes.Buffer{}
+
+	plusBuild := []string{"// +build linux darwin", "// +build !cgo"}
+	if err := writeBuildTag(out, "withmock", plusBuild); err != nil {
+		t.Fatalf("writeBuildTag failed: %s", err)
+	}
+
+	expected := "//go:build (linux || darwin) && !cgo && withmock\n" +
+		"// +build linux darwin\n" +
+		"// +build !cgo\n" +
+		"// +build withmock\n" +
+		"\n"
+
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+}
+
+func TestWriteBuildTagGoBuild(t *testing.T) {
+	out := &bytes.Buffer{}
+
+	// The //go:build line wins over any +build lines
+	lines := []string{"//go:build debug", "// +build linux"}
+	if err := writeBuildTag(out, "withmock", lines); err != nil {
+		t.Fatalf("writeBuildTag failed: %s", err)
+	}
+
+	expected := "//go:build debug && withmock\n" +
+		"// +build debug,withmock\n" +
+		"\n"
+
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+}
+
+func TestWriteBuildTagInvalid(t *testing.T) {
+	for _, tag := range []string{"a && b", "!withmock", "with mock", "x\npackage y", "(x)"} {
+		out := &bytes.Buffer{}
+		if err := writeBuildTag(out, tag, nil); err == nil {
+			t.Errorf("Expected an error for %q, got:\n%s", tag, out.String())
+		}
+	}
+
+	src := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(src, "lib.go"), []byte("package lib\n"), 0600); err != nil {
+		t.Fatalf("Failed to write lib.go: %s", err)
+	}
+	cfg := (&Config{}).Mock("example.com/lib")
+	cfg.GeneratedBuildTag = "with mock"
+	_, err := MakePkg(src, t.TempDir(), "example.com/lib", true, cfg)
+	if err == nil || !strings.Contains(err.Error(), "GeneratedBuildTag") {
+		t.Errorf("Expected MakePkg to reject an invalid GeneratedBuildTag, got %v", err)
+	}
+}
+
+func TestFileConstraints(t *testing.T) {
+	src := "//go:build !debug\n\npackage lib\n\nconst debug = false\n"
+	filename := filepath.Join(t.TempDir(), "release.go")
+	if err := ioutil.WriteFile(filename, []byte(src), 0600); err != nil {
+		t.Fatalf("Failed to write release.go: %s", err)
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parser.ParseFile failed: %s", err)
+	}
+
+	m := &mockGen{
+		fset:      fset,
+		types:     make(map[string]ast.Expr),
+		recorders: make(map[string]string),
+		ifInfo:    newIfInfo("_ifmocks.go"),
+	}
+	out := &bytes.Buffer{}
+	if _, err := m.file(out, f, filename); err != nil {
+		t.Fatalf("m.file failed: %s", err)
+	}
+
+	// A //go:build line on its own must be kept, or the mock would declare
+	// debug for every build.
+	if !strings.HasPrefix(out.String(), "//go:build !debug\n\npackage lib\n") {
+		t.Errorf("Expected //go:build line to be kept, got:\n%s", out.String())
+	}
+}
+
+func TestExprStringInterfaceResults(t *testing.T) {
+	src := `package p
+
+var x interface {
+	Close()
+	Read() (n int, err error)
+	Get() (v pkg.Type)
+	Next() pkg.Type
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatalf("parser.ParseFile failed: %s", err)
+	}
+
+	spec := file.Decls[0].(*ast.GenDecl).Specs[0].(*ast.ValueSpec)
+	it := spec.Type.(*ast.InterfaceType)
+
+	m := &mockGen{}
+
+	expected := "interface {\n" +
+		"\tClose()\n" +
+		"\tRead() (n int, err error)\n" +
+		"\tGet() (v pkg.Type)\n" +
+		"\tNext() pkg.Type\n" +
+		"}"
+	if s := m.exprString(it); s != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, s)
+	}
+
+	// An empty (but non-nil) result list shouldn't cause a panic
+	it.Methods.List[0].Type.(*ast.FuncType).Results = &ast.FieldList{}
+	if s := m.exprString(it); s != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, s)
+	}
+}
+
+func TestWriteStubReturns(t *testing.T) {
+	fi := &funcInfo{
+		name:    "Count",
+		results: []field{{expr: "int"}, {expr: "error"}},
+	}
+
+	out := &bytes.Buffer{}
+	fi.writeStub(out, []string{"42", "nil"})
+
+	expected := "func _real_Count() ( int,  error) {\n" +
+		"\treturn 42, nil\n" +
+		"}\n\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+
+	// Without returns, the stub handler is called before panicking
+	out.Reset()
+	fi.writeStub(out, nil)
+
+	expected = "func _real_Count() ( int,  error) {\n" +
+		"\tif _stubHandler != nil {\n" +
+		"\t\t_stubHandler(\"Count\")\n" +
+		"\t}\n" +
+		"\tpanic(\"This is only a stub!\")\n" +
+		"}\n\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+
+	if err := checkStubReturns(fi, []string{"42", "nil"}); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if err := checkStubReturns(fi, nil); err != nil {
+		t.Errorf("Unexpected error for no returns: %s", err)
+	}
+	if err := checkStubReturns(fi, []string{"42"}); err == nil {
+		t.Errorf("Expected error for wrong number of returns")
+	}
+	if err := checkStubReturns(fi, []string{"42", "nil)"}); err == nil {
+		t.Errorf("Expected error for invalid expression")
+	}
+
+	fi.recv.expr = "*Thing"
+	if name := fi.ScopedName(); name != "Thing.Count" {
+		t.Errorf("Expected Thing.Count, got %s", name)
+	}
+}
+
+func TestExprStringCompositeLit(t *testing.T) {
+	values := []string{
+		`[]T{{1, 2}, {3, 4}}`,
+		`[][]int{{1}, {2, 3}, {}}`,
+		`map[string][]int{"a": {1, 2}, "b": {}}`,
+		`map[K]V{{1, 2}: {A: 1}, {3, 4}: {B: []int{5}}}`,
+		`[]*T{{A: 1}, nil}`,
+		`[2][]map[string]T{{{"x": {1, 2}}}, nil}`,
+	}
+
+	m := &mockGen{}
+
+	for _, value := range values {
+		expr, err := parser.ParseExpr(value)
+		if err != nil {
+			t.Fatalf("parser.ParseExpr(%s) failed: %s", value, err)
+		}
+		if s := m.exprString(expr); s != value {
+			t.Errorf("Expected %s, got %s", value, s)
+		}
+	}
+}
+
+func TestExprStringTypeAssert(t *testing.T) {
+	values := []string{
+		`v.(Foo)`,
+		`f().(Foo)`,
+		`f(a, b).(*Foo)`,
+		`pkg.F().(pkg.T)`,
+		`pkg.New(1).(*pkg.T).Field`,
+		`m["k"].(fmt.Stringer).String()`,
+		`fs[0]().([]int)`,
+		`(<-ch).(map[string]int)`,
+		`(*p).(Foo)`,
+		`get().(func() int)()`,
+	}
+
+	m := &mockGen{}
+
+	for _, value := range values {
+		expr, err := parser.ParseExpr(value)
+		if err != nil {
+			t.Fatalf("parser.ParseExpr(%s) failed: %s", value, err)
+		}
+		if s := m.exprString(expr); s != value {
+			t.Errorf("Expected %s, got %s", value, s)
+		}
+	}
+}
+
+func TestExprStringBinary(t *testing.T) {
+	values := []string{
+		`a + -b`,
+		`a - -b`,
+		`a - (-b)`,
+		`1 << (10 * iota)`,
+		`[a - b]int`,
+		`x &^ y | z`,
+	}
+
+	m := &mockGen{}
+
+	for _, value := range values {
+		expr, err := parser.ParseExpr(value)
+		if err != nil {
+			t.Fatalf("parser.ParseExpr(%s) failed: %s", value, err)
+		}
+		if s := m.exprString(expr); s != value {
+			t.Errorf("Expected %s, got %s", value, s)
+		}
+	}
+}
+
+func TestExprStringUnary(t *testing.T) {
+	values := []string{
+		`-x`,
+		`!ok`,
+		`&T{A: 1}`,
+		`^mask`,
+		`<-ch`,
+		`- -x`,
+		`+ +x`,
+		`-(-x)`,
+		`!!ok`,
+	}
+
+	m := &mockGen{}
+
+	for _, value := range values {
+		expr, err := parser.ParseExpr(value)
+		if err != nil {
+			t.Fatalf("parser.ParseExpr(%s) failed: %s", value, err)
+		}
+		if s := m.exprString(expr); s != value {
+			t.Errorf("Expected %s, got %s", value, s)
+		}
+	}
+}
+
+func TestExprStringConstraints(t *testing.T) {
+	src := `package lib
+
+type Number interface {
+	~int | ~int64 | float64
+}
+
+type Stringish interface {
+	~string
+	String() string
+}
+
+type Set[T ~int | ~string, U Number] struct{}
+`
+	f, err := parser.ParseFile(token.NewFileSet(), "lib.go", src, 0)
+	if err != nil {
+		t.Fatalf("parser.ParseFile failed: %s", err)
+	}
+
+	m := &mockGen{}
+
+	expected := map[string]string{
+		"Number":    "interface {\n\t~int | ~int64 | float64\n}",
+		"Stringish": "interface {\n\t~string\n\tString() string\n}",
+		"Set":       "[T ~int | ~string, U Number]",
+	}
+
+	for _, decl := range f.Decls {
+		for _, spec := range decl.(*ast.GenDecl).Specs {
+			ts := spec.(*ast.TypeSpec)
+			s := m.exprString(ts.Type)
+			if ts.TypeParams != nil {
+				s = m.typeParams(ts.TypeParams)
+			}
+			if s != expected[ts.Name.Name] {
+				t.Errorf("Expected %q for %s, got %q", expected[ts.Name.Name], ts.Name.Name, s)
+			}
+		}
+	}
+}
+
+func TestScopeNameChannels(t *testing.T) {
+	tests := map[string]string{
+		"chan Event":     "chan ext.Event",
+		"<-chan Event":   "<-chan ext.Event",
+		"chan<- Event":   "chan<- ext.Event",
+		"chan<- *Event":  "chan<- *ext.Event",
+		"[]chan<- Event": "[]chan<- ext.Event",
+		"chan<- int":     "chan<- int",
+		"chan<- os.File": "chan<- os.File",
+	}
+
+	for name, expected := range tests {
+		if s := scopeName(name, "ext"); s != expected {
+			t.Errorf("scopeName(%q): expected %q, got %q", name, expected, s)
+		}
+	}
+}
+
+func TestScopeNameFuncs(t *testing.T) {
+	tests := map[string]string{
+		"func()":                           "func()",
+		"func() error":                     "func() error",
+		"chan func() Event":                "chan func() ext.Event",
+		"chan<- func(Event) error":         "chan<- func(ext.Event) error",
+		"func(a, b Key, c int) Value":      "func(a, b ext.Key, c int) ext.Value",
+		"func(Key, ...Key) (Value, bool)":  "func(ext.Key, ...ext.Key) (ext.Value, bool)",
+		"func(k Key) (v Value, err error)": "func(k ext.Key) (v ext.Value, err error)",
+		"func(chan Key, map[K]V)":          "func(chan ext.Key, map[ext.K]ext.V)",
+		"func(f func(Key) os.File) *Value": "func(f func(ext.Key) os.File) *ext.Value",
+		"[]func() Event":                   "[]func() ext.Event",
+	}
+
+	for name, expected := range tests {
+		if s := scopeName(name, "ext"); s != expected {
+			t.Errorf("scopeName(%q): expected %q, got %q", name, expected, s)
+		}
+	}
+}
+
+func TestScopeNamePredeclared(t *testing.T) {
+	tests := map[string]string{
+		"any":          "any",
+		"[]any":        "[]any",
+		"*any":         "*any",
+		"chan any":     "chan any",
+		"comparable":   "comparable",
+		"interface{}":  "interface{}",
+		"Value":        "ext.Value",
+		"[]complex128": "[]complex128",
+	}
+
+	for name, expected := range tests {
+		if s := scopeName(name, "ext"); s != expected {
+			t.Errorf("scopeName(%q): expected %q, got %q", name, expected, s)
+		}
+	}
+}
+
+func TestScopeNameArrays(t *testing.T) {
+	tests := map[string]string{
+		"[N]Item":              "[ext.N]ext.Item",
+		"[3]Item":              "[3]ext.Item",
+		"[sha256.Size]byte":    "[sha256.Size]byte",
+		"[2][N]int":            "[2][ext.N]int",
+		"*[N]*Item":            "*[ext.N]*ext.Item",
+		"[]*[len(\"ab\")]Item": "[]*[len(\"ab\")]ext.Item",
+	}
+
+	for name, expected := range tests {
+		if s := scopeName(name, "ext"); s != expected {
+			t.Errorf("scopeName(%q): expected %q, got %q", name, expected, s)
+		}
+	}
+}
+
+func TestScopeNameMaps(t *testing.T) {
+	tests := map[string]string{
+		"map[K]V":                 "map[ext.K]ext.V",
+		"map[pkg.K]pkg.V":         "map[pkg.K]pkg.V",
+		"map[string]V":            "map[string]ext.V",
+		"map[pkg.K][]*V":          "map[pkg.K][]*ext.V",
+		"map[[N]byte]map[K]pkg.V": "map[[ext.N]byte]map[ext.K]pkg.V",
+		"[]map[pkg.K]int":         "[]map[pkg.K]int",
+		"*map[[pkg.N]byte]Item":   "*map[[pkg.N]byte]ext.Item",
+	}
+
+	for name, expected := range tests {
+		if s := scopeName(name, "ext"); s != expected {
+			t.Errorf("scopeName(%q): expected %q, got %q", name, expected, s)
+		}
+	}
+}
+
+func TestScopeNameGeneric(t *testing.T) {
+	tests := map[string]string{
+		"List[int]":                 "ext.List[int]",
+		"*List[int]":                "*ext.List[int]",
+		"*Map[string, int]":         "*ext.Map[string, int]",
+		"*Map[string, Key]":         "*ext.Map[string, ext.Key]",
+		"*Map[string, *List[Key]]":  "*ext.Map[string, *ext.List[ext.Key]]",
+		"Map[os.File, []List[int]]": "ext.Map[os.File, []ext.List[int]]",
+		"[]*List[int]":              "[]*ext.List[int]",
+		"other.List[Key]":           "other.List[ext.Key]",
+	}
+
+	for name, expected := range tests {
+		if s := scopeName(name, "ext"); s != expected {
+			t.Errorf("scopeName(%q): expected %q, got %q", name, expected, s)
+		}
+	}
+}
+
+func TestConstraintInterface(t *testing.T) {
+	expr, err := parser.ParseExpr("interface{ ~int | Ordered }")
+	if err != nil {
+		t.Fatalf("parser.ParseExpr failed: %s", err)
+	}
+	it := expr.(*ast.InterfaceType)
+
+	m := &mockGen{}
+
+	expected := "interface {\n\t~int | Ordered\n}"
+	if s := m.exprString(it); s != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, s)
+	}
+
+	if !isConstraint(it) {
+		t.Errorf("Expected interface to be a constraint")
+	}
+
+	// Any element that isn't a method or an embedded interface is a type
+	// element, whatever kind of type it is.
+	for _, src := range []string{
+		"interface{ []byte }",
+		"interface{ ~[]E | map[K]V }",
+		"interface{ func() | chan int }",
+	} {
+		expr, err := parser.ParseExpr(src)
+		if err != nil {
+			t.Fatalf("parser.ParseExpr(%s) failed: %s", src, err)
+		}
+		it := expr.(*ast.InterfaceType)
+		expected := "interface {\n\t" + src[len("interface{ "):len(src)-2] + "\n}"
+		if s := m.exprString(it); s != expected {
+			t.Errorf("Expected:\n%s\nGot:\n%s", expected, s)
+		}
+		if !isConstraint(it) {
+			t.Errorf("Expected %s to be a constraint", src)
+		}
+	}
+
+	tests := map[string]bool{
+		"interface{ comparable }":                  true,
+		"interface{ comparable; String() string }": true,
+		"interface{ int }":                         true,
+		"interface{ interface{ ~int } }":           true,
+		"interface{ io.Reader; Len() int }":        false,
+		"interface{ error; Code() int }":           false,
+		"interface{ any }":                         false,
+		"interface{ Stringer }":                    false,
+	}
+	for src, expected := range tests {
+		expr, err := parser.ParseExpr(src)
+		if err != nil {
+			t.Fatalf("parser.ParseExpr(%s) failed: %s", src, err)
+		}
+		if c := isConstraint(expr.(*ast.InterfaceType)); c != expected {
+			t.Errorf("isConstraint(%s): expected %v, got %v", src, expected, c)
+		}
+	}
+}
+
+func TestMakePkgTypeElements(t *testing.T) {
+	files := map[string]string{
+		"lib.go": "package lib\n\n" +
+			"type Bytes interface{ []byte }\n\n" +
+			"type Container[E any, K comparable, V any] interface{ ~[]E | map[K]V }\n\n" +
+			"func Len[T Bytes](b T) int { return len(b) }\n",
+	}
+
+	dst := makePkgFiles(t, files, func(cfg *MockConfig) {})
+
+	data, err := ioutil.ReadFile(filepath.Join(dst, "lib.go"))
+	if err != nil {
+		t.Fatalf("Failed to read generated lib.go: %s", err)
+	}
+	for _, want := range []string{"[]byte\n", "~[]E | map[K]V\n"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected generated code to contain %q, got:\n%s", want, data)
+		}
+	}
+}
+
+func TestUsedDotImports(t *testing.T) {
+	info := newIfInfo("_ifmocks.go")
+	info.addDotImport("example.com/used")
+	info.addDotImport("example.com/unused")
+
+	used := newIfInfo("")
+	used.declared["Event"] = true
+	unused := newIfInfo("")
+	unused.declared["Other"] = true
+
+	i := Interfaces{
+		"p":                   info,
+		".example.com/used":   used,
+		".example.com/unused": unused,
+	}
+
+	src := "func (_m *MockThing) Send(p0 Event, p1 x.Other) int { return 0 }\n"
+
+	dots, err := i.usedDotImports("p", []byte(src))
+	if err != nil {
+		t.Fatalf("usedDotImports failed: %s", err)
+	}
+	if len(dots) != 1 || dots[0] != "example.com/used" {
+		t.Errorf("Expected [example.com/used], got %v", dots)
+	}
+}
+
+func TestUsedImportsAssertions(t *testing.T) {
+	info := newIfInfo("_ifmocks.go")
+	info.addImport("io", "io")
+	info.addImport("context", "context")
+	info.addImport("strings", "strings")
+
+	i := Interfaces{"p": info}
+
+	// The results are only referred to by the type assertions in the mock,
+	// and the signature.
+	fi := &funcInfo{name: "Open"}
+	fi.recv.expr = "*MockOpener"
+	fi.results = []field{{expr: "[]io.Reader"}, {expr: "map[string]context.Context"}, {expr: "*io.Reader"}}
+
+	out := &bytes.Buffer{}
+	fi.writeMock(out)
+
+	s := out.String()
+	for _, want := range []string{
+		"\tret0, _ := ret[0].([]io.Reader)\n",
+		"\tret1, _ := ret[1].(map[string]context.Context)\n",
+		"\tret2, _ := ret[2].(*io.Reader)\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Expected %q, got:\n%s", want, s)
+		}
+	}
+
+	used, err := i.usedImports("p", out.Bytes())
+	if err != nil {
+		t.Fatalf("usedImports failed: %s", err)
+	}
+	expected := map[string]string{"io": "io", "context": "context"}
+	if !reflect.DeepEqual(used, expected) {
+		t.Errorf("Expected %v, got %v", expected, used)
+	}
+}
+
+func TestWriteTypedDo(t *testing.T) {
+	fi := &funcInfo{
+		name: "Send",
+		params: []field{
+			{names: []string{"to", "msg"}, expr: "string"},
+			{expr: "int"},
+		},
+		results: []field{{expr: "error"}},
+	}
+
+	out := &bytes.Buffer{}
+	fi.writeTypedDo(out, "_package_Rec")
+
+	expected := "func (_mr *_package_Rec) SendDo(f func(p0, p1 string, p2 int)) *gomock.Call {\n" +
+		"\treturn _expectCall(\"Send\", _controller().RecordCall(_mr.mock, \"Send\", gomock.Any(), gomock.Any(), gomock.Any()).Do(f))\n" +
+		"}\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+
+	// Variadic functions are skipped
+	out.Reset()
+	fi.varidic = true
+	fi.writeTypedDo(out, "_package_Rec")
+	if out.Len() != 0 {
+		t.Errorf("Expected nothing for variadic function, got:\n%s", out.String())
+	}
+}
+
+func TestWriteHeaders(t *testing.T) {
+	src := `// Copyright 2024 Example Corp.
+// Licensed under the Apache License, Version 2.0.
+
+/* A block comment */
+
+//go:build linux
+
+// Package p does things.
+package p
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parser.ParseFile failed: %s", err)
+	}
+
+	out := &bytes.Buffer{}
+	m := &mockGen{}
+	m.writeHeaders(out, f)
+
+	expected := "// Copyright 2024 Example Corp.\n" +
+		"// Licensed under the Apache License, Version 2.0.\n" +
+		"\n" +
+		"/* A block comment */\n" +
+		"\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+}
+
+// useKeyCache keeps the keys of generated files in a temporary cache, and
+// returns the cache directory.
+func useKeyCache(t *testing.T) string {
+	dir := t.TempDir()
+	t.Setenv("WITHMOCK_DISABLE_CACHE", "")
+	t.Setenv("WITHMOCK_CACHE_DIR", dir)
+	return dir
+}
+
+func TestCacheFileKey(t *testing.T) {
+	cache := useKeyCache(t)
+	filename := filepath.Join(t.TempDir(), "lib.go")
+
+	if NewCacheFileKey([]byte("ab")) == NewCacheFileKey([]byte("a"), []byte("b")) {
+		t.Errorf("Expected keys for different parts to differ")
+	}
+
+	key := NewCacheFileKey([]byte("package lib\n"), []byte("config"))
+	if key.Matches(filename) {
+		t.Errorf("Expected no match before the file was generated")
+	}
+
+	if err := ioutil.WriteFile(filename, []byte("package lib\n"), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %s", filename, err)
+	}
+	if err := key.Store(filename); err != nil {
+		t.Fatalf("Store failed: %s", err)
+	}
+
+	if !key.Matches(filename) {
+		t.Errorf("Expected stored key to match")
+	}
+	if NewCacheFileKey([]byte("package lib\n"), []byte("other")).Matches(filename) {
+		t.Errorf("Expected key for a different config not to match")
+	}
+
+	// The key is kept in the cache, not alongside the generated file
+	if entries, _ := ioutil.ReadDir(filepath.Dir(filename)); len(entries) != 1 {
+		t.Errorf("Expected only the generated file, got %d entries", len(entries))
+	}
+	if entries, _ := ioutil.ReadDir(filepath.Join(cache, "keys")); len(entries) != 1 {
+		t.Errorf("Expected one key in the cache, got %d", len(entries))
+	}
+
+	// The empty key is never kept
+	if err := CacheFileKey("").Store(filename); err != nil {
+		t.Fatalf("Store failed: %s", err)
+	}
+	if !key.Matches(filename) || CacheFileKey("").Matches(filename) {
+		t.Errorf("Expected the empty key not to be stored")
+	}
+
+	// Missing output doesn't match, even if the key does
+	os.Remove(filename)
+	if key.Matches(filename) {
+		t.Errorf("Expected no match for a missing file")
+	}
+
+	// and the key is pruned
+	if err := pruneKeys(filepath.Join(cache, "keys")); err != nil {
+		t.Fatalf("pruneKeys failed: %s", err)
+	}
+	if entries, _ := ioutil.ReadDir(filepath.Join(cache, "keys")); len(entries) != 0 {
+		t.Errorf("Expected the key for the missing file to be pruned, got %d", len(entries))
+	}
+
+	// Nothing is kept when the cache is disabled
+	t.Setenv("WITHMOCK_DISABLE_CACHE", "1")
+	ioutil.WriteFile(filename, []byte("package lib\n"), 0644)
+	if key.Matches(filename) {
+		t.Errorf("Expected no match with the cache disabled")
+	}
+}
+
+func TestMakePkgUnchangedFiles(t *testing.T) {
+	useKeyCache(t)
+
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	write := func(dir, name, data string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %s", name, err)
+		}
+	}
+
+	write(src, "a.go", "package lib\n\nfunc A() int { return 1 }\n")
+	write(src, "b.go", "package lib\n\nfunc B() int { return 2 }\n")
+
+	cfg := (&Config{}).Mock("example.com/lib")
+	if _, err := MakePkg(src, dst, "example.com/lib", true, cfg); err != nil {
+		t.Fatalf("MakePkg failed: %s", err)
+	}
+
+	// Mark the generated files, so that we can see which are written again
+	marker := "// not regenerated\n"
+	for _, name := range []string{"a.go", "b.go", "lib_mock.go"} {
+		data, err := ioutil.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatalf("Failed to read generated %s: %s", name, err)
+		}
+		write(dst, name, string(data)+marker)
+	}
+
+	write(src, "b.go", "package lib\n\nfunc B() int { return 3 }\n")
+
+	if _, err := MakePkg(src, dst, "example.com/lib", true, cfg); err != nil {
+		t.Fatalf("MakePkg failed: %s", err)
+	}
+
+	expected := map[string]bool{
+		"a.go":        false,
+		"b.go":        true,
+		"lib_mock.go": true,
+	}
+	for name, regenerated := range expected {
+		data, err := ioutil.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatalf("Failed to read generated %s: %s", name, err)
+		}
+		if strings.HasSuffix(string(data), marker) == regenerated {
+			t.Errorf("Expected %s regenerated: %v, got:\n%s", name, regenerated, data)
+		}
+	}
+
+	// A change to the config regenerates everything
+	cfg.MockPrototypes = true
+	if _, err := MakePkg(src, dst, "example.com/lib", true, cfg); err != nil {
+		t.Fatalf("MakePkg failed: %s", err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dst, "a.go")); strings.HasSuffix(string(data), marker) {
+		t.Errorf("Expected a.go to be regenerated for the new config")
+	}
+}
+
+func TestMakePkgTempOutput(t *testing.T) {
+	cache := useKeyCache(t)
+
+	src := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(src, "a.go"), []byte("package lib\n\nfunc A() int { return 1 }\n"), 0644); err != nil {
+		t.Fatalf("Failed to write a.go: %s", err)
+	}
+
+	// Output that won't be there next time doesn't need keys
+	cfg := (&Config{}).Mock("example.com/lib")
+	cfg.tempOutput = true
+	if _, err := MakePkg(src, t.TempDir(), "example.com/lib", true, cfg); err != nil {
+		t.Fatalf("MakePkg failed: %s", err)
+	}
+	if _, err := VerifyUpToDate(src, t.TempDir(), "example.com/lib", true, (&Config{}).Mock("example.com/lib")); err != nil {
+		t.Fatalf("VerifyUpToDate failed: %s", err)
+	}
+
+	if entries, _ := ioutil.ReadDir(filepath.Join(cache, "keys")); len(entries) != 0 {
+		t.Errorf("Expected no keys to be kept, got %d", len(entries))
+	}
+}
+
+func TestMakePkgUnchangedInits(t *testing.T) {
+	useKeyCache(t)
+
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	write := func(name, data string) {
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %s", name, err)
+		}
+	}
+
+	write("a.go", "package lib\n\nfunc A() int { return 1 }\n")
+	write("b.go", "package lib\n\nfunc init() {}\n\nfunc B() int { return 2 }\n")
+
+	cfg := (&Config{}).Mock("example.com/lib")
+	if _, err := MakePkg(src, dst, "example.com/lib", true, cfg); err != nil {
+		t.Fatalf("MakePkg failed: %s", err)
+	}
+
+	// b.go is up to date, so it is kept - and the renamed inits mustn't clash
+	// with the one added to a.go.
+	write("a.go", "package lib\n\nfunc init() {}\n\nfunc A() int { return 1 }\n")
+	if _, err := MakePkg(src, dst, "example.com/lib", true, cfg); err != nil {
+		t.Fatalf("MakePkg failed: %s", err)
+	}
+
+	seen := make(map[string]string)
+	fset := token.NewFileSet()
+	for _, name := range []string{"a.go", "b.go"} {
+		f, err := parser.ParseFile(fset, filepath.Join(dst, name), nil, 0)
+		if err != nil {
+			t.Fatalf("Failed to parse generated %s: %s", name, err)
+		}
+		for _, decl := range f.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Recv != nil || !strings.HasPrefix(fd.Name.Name, "_real_init_") {
+				continue
+			}
+			if other, found := seen[fd.Name.Name]; found {
+				t.Errorf("%s is declared in both %s and %s", fd.Name.Name, other, name)
+			}
+			seen[fd.Name.Name] = name
+		}
+	}
+	if len(seen) != 2 {
+		t.Errorf("Expected two renamed inits, got %v", seen)
+	}
+}
+
+func TestGenericResults(t *testing.T) {
+	src := `package p
+
+type Pair[K comparable, V any] struct {
+	Key K
+	Value V
+}
+
+func Load() (Result[int], error)
+func Get() Pair[string, ext.Box[int]]
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatalf("parser.ParseFile failed: %s", err)
+	}
+
+	m := &mockGen{}
+
+	spec := file.Decls[0].(*ast.GenDecl).Specs[0].(*ast.TypeSpec)
+	if s := m.typeParams(spec.TypeParams); s != "[K comparable, V any]" {
+		t.Errorf("Expected [K comparable, V any], got %s", s)
+	}
+
+	expected := [][]string{
+		{"Result[int]", "error"},
+		{"Pair[string, ext.Box[int]]"},
+	}
+	for i, decl := range file.Decls[1:] {
+		fi := &funcInfo{}
+		for _, result := range decl.(*ast.FuncDecl).Type.Results.List {
+			fi.results = append(fi.results, field{expr: m.exprString(result.Type)})
+		}
+		if rets := fi.retTypes(); !reflect.DeepEqual(rets, expected[i]) {
+			t.Errorf("Expected %v, got %v", expected[i], rets)
+		}
+	}
+}
+
+func TestWriteMockSameTypeResults(t *testing.T) {
+	fi := &funcInfo{name: "Pair"}
+	fi.recv.expr = "*Cache"
+	fi.results = []field{{names: []string{"a", "b"}, expr: "Value"}}
+
+	out := &bytes.Buffer{}
+	out.WriteString("package p\n\n")
+	fi.writeMock(out)
+
+	// One result group with two names is two results
+	s := out.String()
+	for _, want := range []string{
+		"func (_m *Cache) Pair() (Value, Value) {\n",
+		"\t\treturn _m._real_Pair()\n",
+		"\tret0, _ := ret[0].(Value)\n\tret1, _ := ret[1].(Value)\n",
+		"\treturn ret0, ret1\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Expected %q, got:\n%s", want, s)
+		}
+	}
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "", s, 0); err != nil {
+		t.Errorf("Generated code doesn't parse: %s\n%s", err, s)
+	}
+}
+
+func TestWriteMockParamGroups(t *testing.T) {
+	fi := &funcInfo{name: "Set"}
+	fi.params = []field{
+		{names: []string{"a", "b"}, expr: "int"},
+		{names: []string{"c"}, expr: "string"},
+	}
+	fi.results = []field{{expr: "error"}}
+
+	if n := fi.countParams(); n != 3 {
+		t.Errorf("Expected 3 params, got %d", n)
+	}
+
+	out := &bytes.Buffer{}
+	out.WriteString("package p\n\n")
+	fi.writeMock(out)
+	fi.writeRecorder(out, "_package_Rec")
+
+	s := out.String()
+	for _, want := range []string{
+		"func (_m *_packageMock) Set(p0, p1 int, p2 string) (error) {\n",
+		"\t\treturn _real_Set(p0, p1, p2)\n",
+		"\tret := _callController(_controller(), _m, \"Set\", p0, p1, p2)\n",
+		"func (_mr *_package_Rec) Set(a, b, c interface{}) *gomock.Call {\n",
+		"\treturn _expectCall(\"Set\", _controller().RecordCall(_mr.mock, \"Set\", a, b, c))\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Expected %q, got:\n%s", want, s)
+		}
+	}
+
+	// A variadic group after a group with several names
+	fi = &funcInfo{name: "Log", varidic: true}
+	fi.params = []field{
+		{names: []string{"a", "b"}, expr: "int"},
+		{names: []string{"rest"}, expr: "...string"},
+	}
+
+	out.Reset()
+	out.WriteString("package p\n\n")
+	fi.writeMock(out)
+	fi.writeRecorder(out, "_package_Rec")
+
+	s = out.String()
+	for _, want := range []string{
+		"\targs := []interface{}{p0, p1}\n\tfor _, v := range p2 {\n",
+		"func (_mr *_package_Rec) Log(a, b interface{}, rest ...interface{}) *gomock.Call {\n",
+		"\targs := append([]interface{}{a, b}, rest...)\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Expected %q, got:\n%s", want, s)
+		}
+	}
+}
+
+func TestWriteMockAnonStruct(t *testing.T) {
+	m := &mockGen{}
+
+	expr, err := parser.ParseExpr("struct{ time.Duration; A, B int `json:\"a\"` }")
+	if err != nil {
+		t.Fatalf("parser.ParseExpr failed: %s", err)
+	}
+
+	typ := m.exprString(expr)
+	if expected := "struct {\n\ttime.Duration\n\tA, B int `json:\"a\"`\n}"; typ != expected {
+		t.Errorf("Expected %q, got %q", expected, typ)
+	}
+
+	fi := &funcInfo{name: "Stats"}
+	fi.results = []field{{expr: typ}, {expr: "error"}}
+
+	out := &bytes.Buffer{}
+	out.WriteString("package p\n\n")
+	fi.writeMock(out)
+
+	s := out.String()
+	if !strings.Contains(s, "\tret0, _ := ret[0].("+typ+")\n") {
+		t.Errorf("Expected the struct type to be asserted, got:\n%s", s)
+	}
+
+	// gofmt is run over the generated code, so it must parse
+	if _, err := parser.ParseFile(token.NewFileSet(), "", s, 0); err != nil {
+		t.Errorf("Failed to parse the mock: %s\n%s", err, s)
+	}
+}
+
+func TestWriteMockShadowedResult(t *testing.T) {
+	fi := &funcInfo{name: "Count", varidic: true}
+	fi.params = []field{{names: []string{"_ctrl", "_m"}, expr: "int"}, {expr: "...string"}}
+	fi.results = []field{{expr: "ret"}, {expr: "error"}}
+
+	out := &bytes.Buffer{}
+	out.WriteString("package p\n\n")
+	fi.writeMock(out)
+
+	// The locals are renamed, so that ret still refers to the type
+	s := out.String()
+	for _, want := range []string{
+		"func (_m *_packageMock) Count(_p0, _p1 int, _p2 ...string) (ret, error) {\n",
+		"\t\treturn _real_Count(_p0, _p1, _p2...)\n",
+		"\t_args := []interface{}{_p0, _p1}\n",
+		"\t_ret := _callController(_controller(), _m, \"Count\", _args...)\n",
+		"\t_ret0, _ := _ret[0].(ret)\n",
+		"\treturn _ret0, _ret1\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Expected %q, got:\n%s", want, s)
+		}
+	}
+
+	for returns, expected := range map[string]string{
+		"int":              "",
+		"report":           "",
+		"pkg.Type":         "",
+		"map[string]p1":    "_",
+		"func() args":      "_",
+		"[]struct{ ret7 }": "_",
+	} {
+		if prefix := localPrefix([]string{returns}); prefix != expected {
+			t.Errorf("Expected %q for %s, got %q", expected, returns, prefix)
+		}
+	}
+}
+
+func TestWriteMockNamedError(t *testing.T) {
+	fi := &funcInfo{name: "Check", body: []byte("{\n\treturn\n}")}
+	fi.params = []field{{names: []string{"s"}, expr: "string"}}
+	fi.results = []field{{names: []string{"err"}, expr: "error"}}
+
+	out := &bytes.Buffer{}
+	out.WriteString("package p\n\n")
+	fi.writeReal(out)
+	fi.writeMock(out)
+
+	// The real function keeps the named result for its naked return, but the
+	// mock only uses the type - so err can't clash with the mock's locals.
+	s := out.String()
+	for _, want := range []string{
+		"func _real_Check(s string) (err error) {\n",
+		"func (_m *_packageMock) Check(p0 string) (error) {\n",
+		"\t\treturn _real_Check(p0)\n",
+		"\tret0, _ := ret[0].(error)\n\treturn ret0\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Expected %q, got:\n%s", want, s)
+		}
+	}
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "", s, 0); err != nil {
+		t.Errorf("Generated code doesn't parse: %s\n%s", err, s)
+	}
+}
+
+func TestWriteRecorderNames(t *testing.T) {
+	fi := &funcInfo{name: "Send", varidic: true}
+	fi.params = []field{
+		{names: []string{"p1"}, expr: "int"},
+		{names: []string{"_"}, expr: "string"},
+		{names: []string{"args"}, expr: "[]string"},
+		{expr: "bool"},
+		{names: []string{"opts"}, expr: "...Option"},
+	}
+
+	expected := []string{"p1", "p1_", "p2", "p3", "opts"}
+	if names := fi.recorderParams(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+
+	out := &bytes.Buffer{}
+	out.WriteString("package p\n\n")
+	fi.writeRecorder(out, "_package_Rec")
+
+	s := out.String()
+	for _, want := range []string{
+		"func (_mr *_package_Rec) Send(p1, p1_, p2, p3 interface{}, opts ...interface{}) *gomock.Call {\n",
+		"\targs := append([]interface{}{p1, p1_, p2, p3}, opts...)\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Expected %q, got:\n%s", want, s)
+		}
+	}
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "", s, 0); err != nil {
+		t.Errorf("Generated code doesn't parse: %s\n%s", err, s)
+	}
+}
+
+func TestWriteRealNamelessReceiver(t *testing.T) {
+	fi := &funcInfo{name: "Name", body: []byte("{\n\treturn \"counter\"\n}")}
+	fi.recv.expr = "*Counter"
+	fi.results = []field{{expr: "string"}}
+
+	out := &bytes.Buffer{}
+	out.WriteString("package p\n\n")
+	fi.writeReal(out)
+	fi.writeMock(out)
+
+	// The mock has its own receiver, so forwarding to the real method works
+	// even though the original receiver doesn't have a name.
+	s := out.String()
+	for _, want := range []string{
+		"func (*Counter) _real_Name() (",
+		"func (_m *Counter) Name() (string) {\n",
+		"\t\treturn _m._real_Name()\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Expected %q, got:\n%s", want, s)
+		}
+	}
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "", s, 0); err != nil {
+		t.Errorf("Generated code doesn't parse: %s\n%s", err, s)
+	}
+}
+
+func TestWriteRealPragmas(t *testing.T) {
+	src := `package p
+
+// Add adds.
+//
+//go:nosplit
+//go:noinline
+func Add(a, b int) int { return a + b }
+
+// Len returns the length.
+//go:norace
+func (l *List) Len() int { return 0 }
+
+//go:linkname Now time.now
+func Now() (int64, int32, int64)
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parser.ParseFile failed: %s", err)
+	}
+
+	expected := [][]string{
+		{"// Add adds.\n//\n", "//go:nosplit\n//go:noinline\nfunc _real_Add("},
+		{"// Len returns the length.\n", "//go:norace\nfunc (l *List) _real_Len("},
+		{"//go:linkname _real_Now time.now\nfunc _real_Now("},
+	}
+
+	for i, decl := range file.Decls {
+		d := decl.(*ast.FuncDecl)
+		fi := &funcInfo{name: d.Name.Name}
+		fi.doc = docComments(d.Doc)
+		fi.pragmas = pragmas(d.Doc)
+		if d.Recv != nil {
+			fi.recv.name = "l"
+			fi.recv.expr = "*List"
+		}
+
+		out := &bytes.Buffer{}
+		fi.writeReal(out)
+		real := out.String()
+		out.Reset()
+		fi.writeMock(out)
+		mock := out.String()
+
+		for _, want := range expected[i] {
+			if strings.HasPrefix(want, "//go:") {
+				if !strings.Contains(real, want) {
+					t.Errorf("%s: Expected %q in real, got:\n%s", fi.name, want, real)
+				}
+			} else if !strings.Contains(mock, want) {
+				t.Errorf("%s: Expected %q in mock, got:\n%s", fi.name, want, mock)
+			}
+		}
+		if strings.Contains(mock, "//go:") {
+			t.Errorf("%s: Expected no pragmas on the mock, got:\n%s", fi.name, mock)
+		}
+	}
+}
+
+func TestTypeSpecAlias(t *testing.T) {
+	src := `package p
+
+type Set[K comparable] = map[K]struct{}
+type Pairs[K comparable, V any] = []Pair[K, V]
+type Reader = io.Reader
+type Count int
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatalf("parser.ParseFile failed: %s", err)
+	}
+
+	expected := []string{
+		"Set[K comparable] = map[K]struct{}",
+		"Pairs[K comparable, V any] = []Pair[K, V]",
+		"Reader = io.Reader",
+		"Count int",
+	}
+
+	m := &mockGen{}
+
+	for i, decl := range file.Decls {
+		spec := decl.(*ast.GenDecl).Specs[0].(*ast.TypeSpec)
+		if s := m.typeSpec(spec); s != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], s)
+		}
+	}
+}
+
+func TestCallCounts(t *testing.T) {
+	fi := &funcInfo{name: "Bar", gomock: defaultGomock}
+	fi.recv.expr = "*Foo"
+
+	// Recorded calls are always kept for PendingExpectations
+	out := &bytes.Buffer{}
+	fi.writeRecorder(out, "_Foo_Rec")
+	if !strings.Contains(out.String(), "\treturn _expectCall(\"Foo.Bar\", _controller().RecordCall(_mr.mock, \"Bar\"))\n") {
+		t.Errorf("Expected recorder to keep the expectation, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	fi.writeTypedDo(out, "_Foo_Rec")
+	if !strings.Contains(out.String(), "\treturn _expectCall(\"Foo.Bar\", _controller().RecordCall(_mr.mock, \"Bar\").Do(f))\n") {
+		t.Errorf("Expected typed Do to keep the expectation, got:\n%s", out.String())
+	}
+
+	// Calls are only counted if CountCalls is set
+	out.Reset()
+	fi.writeMock(out)
+	if strings.Contains(out.String(), "_countCall") {
+		t.Errorf("Expected no call counting, got:\n%s", out.String())
+	}
+
+	m := &mockGen{MOCK: "MOCK", EXPECT: "EXPECT", gomock: defaultGomock}
+	out.Reset()
+	if err := m.pkg(out, "p"); err != nil {
+		t.Fatalf("m.pkg failed: %s", err)
+	}
+	for _, want := range []string{
+		"\t_reflect \"reflect\"\n",
+		"func (_ *_meta) PendingExpectations() []string {\n",
+		"\t\tmin, num := c.FieldByName(\"minCalls\"), c.FieldByName(\"numCalls\")\n",
+		"\t\t\tpanic(\"withmock: can't find the call counts in gomock.Call for PendingExpectations\")\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q, got:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "CallCount") {
+		t.Errorf("Expected no CallCount, got:\n%s", out.String())
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "", out.Bytes(), 0); err != nil {
+		t.Errorf("Generated pending expectations code doesn't parse: %s", err)
+	}
+
+	m.countCalls = true
+	out.Reset()
+	if err := m.pkg(out, "p"); err != nil {
+		t.Fatalf("m.pkg failed: %s", err)
+	}
+	if !strings.Contains(out.String(), "func (_ *_meta) CallCount(name string) int {\n") {
+		t.Errorf("Expected CallCount, got:\n%s", out.String())
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "", out.Bytes(), 0); err != nil {
+		t.Errorf("Generated call counting code doesn't parse: %s", err)
+	}
+}
+
+func TestWithController(t *testing.T) {
+	fi := &funcInfo{name: "Bar"}
+	fi.recv.expr = "*Foo"
+
+	out := &bytes.Buffer{}
+	fi.writeMock(out)
+	if !strings.Contains(out.String(), "\t_callController(_controller(), _m, \"Bar\")\n") {
+		t.Errorf("Expected mock to get the controller through the lock, got:\n%s", out.String())
+	}
+
+	m := &mockGen{MOCK: "MOCK", EXPECT: "EXPECT", gomock: defaultGomock}
+	out.Reset()
+	if err := m.pkg(out, "p"); err != nil {
+		t.Fatalf("m.pkg failed: %s", err)
+	}
+	if !strings.Contains(out.String(), "func (_ *_meta) WithController(controller *gomock.Controller) (restore func()) {\n") {
+		t.Errorf("Expected WithController, got:\n%s", out.String())
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "", out.Bytes(), 0); err != nil {
+		t.Errorf("Generated meta file doesn't parse: %s", err)
+	}
+}
+
+func TestInstall(t *testing.T) {
+	for _, countCalls := range []bool{false, true} {
+		m := &mockGen{MOCK: "MOCK", EXPECT: "EXPECT", gomock: defaultGomock, countCalls: countCalls}
+		out := &bytes.Buffer{}
+		if err := m.pkg(out, "p"); err != nil {
+			t.Fatalf("m.pkg failed: %s", err)
+		}
+		s := out.String()
+		for _, want := range []string{
+			"func (_ *_meta) Install(t gomock.TestReporter) *gomock.Controller {\n",
+			"\tcontroller := gomock.NewController(t)\n",
+			"\tif c, ok := t.(interface{ Cleanup(func()) }); ok {\n",
+			"\t\t\t_finishController(controller)\n\t\t\t_setController(previous)\n",
+		} {
+			if !strings.Contains(s, want) {
+				t.Errorf("Expected %q, got:\n%s", want, s)
+			}
+		}
+		if got := strings.Count(s, "_resetCallCounts()\n") >= 4; got != countCalls {
+			t.Errorf("Expected Install to reset call counts to be %v, got:\n%s", countCalls, s)
+		}
+		if _, err := parser.ParseFile(token.NewFileSet(), "", out.Bytes(), 0); err != nil {
+			t.Errorf("Generated meta file doesn't parse: %s", err)
+		}
+	}
+}
+
+func TestMakePkgGOOS(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	files := map[string]string{
+		"lib.go":         "package lib\n\nfunc Common() int { return 0 }\n",
+		"lib_linux.go":   "package lib\n\nfunc Linux() int { return 1 }\n",
+		"lib_windows.go": "package lib\n\nfunc Windows() int { return 2 }\n",
+		"lib_arm.go":     "package lib\n\nfunc Arm() int { return 3 }\n",
+		"win.go":         "// +build windows\n\npackage lib\n\nfunc Win() int { return 4 }\n",
+		"lin.go":         "// +build linux darwin\n\npackage lib\n\nfunc Lin() int { return 5 }\n",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(data), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %s", name, err)
+		}
+	}
+
+	cfg := (&Config{}).Mock("example.com/lib")
+	cfg.MatchOSArch = true
+	cfg.GOOS = "windows"
+	cfg.GOARCH = "amd64"
+
+	if _, err := MakePkg(src, dst, "example.com/lib", true, cfg); err != nil {
+		t.Fatalf("MakePkg failed: %s", err)
+	}
+
+	expected := map[string]bool{
+		"lib.go":         true,
+		"lib_linux.go":   false,
+		"lib_windows.go": true,
+		"lib_arm.go":     false,
+		"win.go":         true,
+		"lin.go":         false,
+	}
+	for name, want := range expected {
+		_, err := os.Stat(filepath.Join(dst, name))
+		if got := err == nil; got != want {
+			t.Errorf("%s: expected generated to be %v, got %v", name, want, got)
+		}
+	}
+}
+
+// makePkgFiles writes files into a new source directory, and returns the
+// directory that MakePkg generates example.com/lib into from it - using the
+// default config, as changed by setup.
+func makePkgFiles(t *testing.T, files map[string]string, setup func(cfg *MockConfig)) string {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(data), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %s", name, err)
+		}
+	}
+
+	cfg := (&Config{}).Mock("example.com/lib")
+	setup(cfg)
+	if _, err := MakePkg(src, dst, "example.com/lib", true, cfg); err != nil {
+		t.Fatalf("MakePkg failed: %s", err)
+	}
+
+	return dst
+}
+
+func TestMakePkgCgo(t *testing.T) {
+	files := map[string]string{
+		"lib.go":       "package lib\n\nfunc Common() int { return 0 }\n",
+		"cgo.go":       "//go:build cgo\n\npackage lib\n\nfunc Fast() int { return 1 }\n",
+		"nocgo.go":     "//go:build !cgo\n\npackage lib\n\nfunc Fast() int { return 2 }\n",
+		"old_nocgo.go": "// +build !cgo\n\npackage lib\n\nfunc Old() int { return 3 }\n",
+		"linux_cgo.go": "//go:build linux && cgo\n\npackage lib\n\nfunc Linux() int { return 4 }\n",
+		"custom.go":    "//go:build !purego\n\npackage lib\n\nfunc Custom() int { return 5 }\n",
+	}
+
+	tests := map[string]map[string]bool{
+		"0": {
+			"lib.go":       true,
+			"cgo.go":       false,
+			"nocgo.go":     true,
+			"old_nocgo.go": true,
+			"linux_cgo.go": false,
+			"custom.go":    true,
+		},
+		"1": {
+			"lib.go":       true,
+			"cgo.go":       true,
+			"nocgo.go":     false,
+			"old_nocgo.go": false,
+			"linux_cgo.go": true,
+			"custom.go":    true,
+		},
+	}
+
+	for cgo, expected := range tests {
+		dst := makePkgFiles(t, files, func(cfg *MockConfig) {
+			cfg.MatchOSArch = true
+			cfg.GOOS = "linux"
+			cfg.GOARCH = "amd64"
+			cfg.CgoEnabled = cgo
+		})
+
+		for name, want := range expected {
+			_, err := os.Stat(filepath.Join(dst, name))
+			if got := err == nil; got != want {
+				t.Errorf("CgoEnabled %s: %s: expected generated to be %v, got %v",
+					cgo, name, want, got)
+			}
+		}
+	}
+
+	src := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(src, "lib.go"), []byte(files["lib.go"]), 0600); err != nil {
+		t.Fatalf("Failed to write lib.go: %s", err)
+	}
+
+	cfg := (&Config{}).Mock("example.com/lib")
+	cfg.CgoEnabled = "yes"
+	if _, err := MakePkg(src, t.TempDir(), "example.com/lib", true, cfg); err == nil {
+		t.Errorf("Expected an error for an invalid CgoEnabled")
+	}
+}
+
+func TestMakePkgUnix(t *testing.T) {
+	files := map[string]string{
+		"lib.go":       "package lib\n\nfunc Common() int { return 0 }\n",
+		"unix.go":      "//go:build unix\n\npackage lib\n\nfunc Sep() int { return 1 }\n",
+		"other.go":     "//go:build !unix\n\npackage lib\n\nfunc Sep() int { return 2 }\n",
+		"lib_unix.go":  "package lib\n\nfunc File() int { return 3 }\n",
+		"darwin.go":    "//go:build darwin\n\npackage lib\n\nfunc Darwin() int { return 4 }\n",
+		"lib_linux.go": "package lib\n\nfunc Linux() int { return 5 }\n",
+		"old.go":       "//go:build !go1.1\n\npackage lib\n\nfunc Old() int { return 6 }\n",
+	}
+
+	// unix is only a build constraint, so lib_unix.go is always used.
+	tests := map[string]map[string]bool{
+		"linux": {
+			"lib.go": true, "unix.go": true, "other.go": false,
+			"lib_unix.go": true, "darwin.go": false, "lib_linux.go": true,
+			"old.go": false,
+		},
+		"android": {
+			"lib.go": true, "unix.go": true, "other.go": false,
+			"lib_unix.go": true, "darwin.go": false, "lib_linux.go": true,
+			"old.go": false,
+		},
+		"ios": {
+			"lib.go": true, "unix.go": true, "other.go": false,
+			"lib_unix.go": true, "darwin.go": true, "lib_linux.go": false,
+			"old.go": false,
+		},
+		"freebsd": {
+			"lib.go": true, "unix.go": true, "other.go": false,
+			"lib_unix.go": true, "darwin.go": false, "lib_linux.go": false,
+			"old.go": false,
+		},
+		"windows": {
+			"lib.go": true, "unix.go": false, "other.go": true,
+			"lib_unix.go": true, "darwin.go": false, "lib_linux.go": false,
+			"old.go": false,
+		},
+		"plan9": {
+			"lib.go": true, "unix.go": false, "other.go": true,
+			"lib_unix.go": true, "darwin.go": false, "lib_linux.go": false,
+			"old.go": false,
+		},
+		"js": {
+			"lib.go": true, "unix.go": false, "other.go": true,
+			"lib_unix.go": true, "darwin.go": false, "lib_linux.go": false,
+			"old.go": false,
+		},
+	}
+
+	for goos, expected := range tests {
+		dst := makePkgFiles(t, files, func(cfg *MockConfig) {
+			cfg.MatchOSArch = true
+			cfg.GOOS = goos
+			cfg.GOARCH = "arm64"
+		})
+
+		for name, want := range expected {
+			_, err := os.Stat(filepath.Join(dst, name))
+			if got := err == nil; got != want {
+				t.Errorf("GOOS %s: %s: expected generated to be %v, got %v",
+					goos, name, want, got)
+			}
+		}
+	}
+}
+
+func TestGoodOSArchConstraintsExprs(t *testing.T) {
+	platforms := [][2]string{
+		{"linux", "amd64"}, {"linux", "arm64"}, {"darwin", "arm64"},
+		{"darwin", "amd64"}, {"windows", "386"},
+	}
+
+	// The expected results are in the order of platforms.
+	tests := map[string][]bool{
+		"//go:build (linux && amd64) || (darwin && arm64)":           {true, false, true, false, false},
+		"//go:build !((linux && amd64) || (darwin && arm64))":        {false, true, false, true, true},
+		"//go:build linux && !amd64":                                 {false, true, false, false, false},
+		"//go:build !linux && !darwin":                               {false, false, false, false, true},
+		"//go:build (unix && !linux) || 386":                         {false, false, true, true, true},
+		"//go:build linux && (mytag || !mytag)":                      {true, true, false, false, false},
+		"// +build linux,amd64 darwin,arm64":                         {true, false, true, false, false},
+		"// +build linux darwin\n// +build !amd64":                   {false, true, true, false, false},
+		"//go:build windows\n// +build linux":                        {false, false, false, false, true},
+		"//go:build (linux || windows) && !(arm64 || 386)":           {true, false, false, false, false},
+		"//go:build !(linux && amd64) && !(darwin && arm64)":         {false, true, false, true, true},
+		"//go:build (darwin || linux) && (amd64 || arm64) && ignore": {false, false, false, false, false},
+	}
+
+	for line, expected := range tests {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, "lib.go", line+"\n\npackage lib\n", parser.ParseComments)
+		if err != nil {
+			t.Fatalf("parser.ParseFile failed for %q: %s", line, err)
+		}
+
+		for i, platform := range platforms {
+			ctxt := build.Default
+			ctxt.GOOS, ctxt.GOARCH = platform[0], platform[1]
+			if got := goodOSArchConstraints(&ctxt, f); got != expected[i] {
+				t.Errorf("%q on %s/%s: expected %v, got %v", line, platform[0], platform[1], expected[i], got)
+			}
+		}
+	}
+}
+
+func TestMakePkgExternalFunctions(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	// The ignored tool is a different package, so its external functions
+	// shouldn't be rewritten in the assembly of lib.
+	files := map[string]string{
+		"lib.go":  "package lib\n\nfunc Answer() int\n\nfunc Double(n int) int { return n * 2 }\n",
+		"tool.go": "//go:build ignore\n\npackage main\n\nfunc Answer() int\n\nfunc Double(n int) int\n\nfunc main() {}\n",
+		"lib.s":   "TEXT ·Answer(SB), 4, $0-8\n\tCALL ·Double(SB)\n\tRET\n",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(data), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %s", name, err)
+		}
+	}
+
+	cfg := (&Config{}).Mock("example.com/lib")
+	if _, err := MakePkg(src, dst, "example.com/lib", true, cfg); err != nil {
+		t.Fatalf("MakePkg failed: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dst, "lib.s"))
+	if err != nil {
+		t.Fatalf("Failed to read lib.s: %s", err)
+	}
+	expected := "TEXT ·_real_Answer(SB), 4, $0-8\n\tCALL ·Double(SB)\n\tRET\n"
+	if string(data) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, data)
+	}
+}
+
+func TestMakePkgMockAll(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	if err := ioutil.WriteFile(filepath.Join(src, "lib.go"), []byte("package lib\n\nfunc Get() int { return 1 }\n"), 0600); err != nil {
+		t.Fatalf("Failed to write lib.go: %s", err)
+	}
+
+	cfg := (&Config{}).Mock("example.com/lib")
+	cfg.MockAll = true
+	if _, err := MakePkg(src, dst, "example.com/lib", true, cfg); err != nil {
+		t.Fatalf("MakePkg failed: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dst, "lib_mock.go"))
+	if err != nil {
+		t.Fatalf("Failed to read lib_mock.go: %s", err)
+	}
+	if !regexp.MustCompile(`\t_allMocked += true\n`).Match(data) {
+		t.Errorf("Expected lib to start with everything mocked, got:\n%s", data)
+	}
+}
+
+func TestMakePkgStrict(t *testing.T) {
+	tests := map[string]string{
+		// A comment between declarations is dropped with PreserveComments.
+		"comment": "package lib\n\n// Get gets.\nfunc Get() int { return 1 }\n\n" +
+			"// ---- helpers ----\n\nfunc get() int {\n\t// kept\n\treturn 1\n}\n",
+		// The import can't be resolved, which is only allowed because of the
+		// build constraint.
+		"import": "//go:build linux\n\npackage lib\n\nimport \"example.com/missing/pkg\"\n\n" +
+			"func Get() int { return pkg.Value }\n",
+		// The interface refers to a package that isn't imported, so it can't
+		// be mocked.
+		"interface": "package lib\n\ntype I interface {\n\tGet() pkg.T\n}\n",
+	}
+
+	for name, data := range tests {
+		src := t.TempDir()
+		if err := ioutil.WriteFile(filepath.Join(src, "lib.go"), []byte(data), 0600); err != nil {
+			t.Fatalf("Failed to write lib.go: %s", err)
+		}
+
+		cfg := (&Config{}).Mock("example.com/lib")
+		cfg.PreserveComments = true
+		if _, err := MakePkg(src, t.TempDir(), "example.com/lib", true, cfg); err != nil {
+			t.Errorf("%s: MakePkg failed: %s", name, err)
+		}
+
+		cfg.Strict = true
+		if _, err := MakePkg(src, t.TempDir(), "example.com/lib", true, cfg); err == nil {
+			t.Errorf("%s: Expected an error in strict mode", name)
+		}
+	}
+
+	// Doc and line comments, and comments in function bodies, are all kept.
+	src := t.TempDir()
+	data := "package lib\n\n// T is a type.\ntype T int // line\n\n" +
+		"var f = func() {\n\t// in a literal\n}\n\n" +
+		"//go:generate echo hi\n\nfunc get() int {\n\t// kept\n\treturn 1\n}\n"
+	if err := ioutil.WriteFile(filepath.Join(src, "lib.go"), []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write lib.go: %s", err)
+	}
+	cfg := (&Config{}).Mock("example.com/lib")
+	cfg.PreserveComments = true
+	cfg.Strict = true
+	if _, err := MakePkg(src, t.TempDir(), "example.com/lib", true, cfg); err != nil {
+		t.Errorf("MakePkg failed in strict mode: %s", err)
+	}
+}
+
+func TestStrictUnknownExpr(t *testing.T) {
+	src := "package lib\n\nvar v = 1\n"
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "lib.go", src, 0)
+	if err != nil {
+		t.Fatalf("parser.ParseFile failed: %s", err)
+	}
+
+	// The parser only produces a BadExpr for invalid code, so put one in by
+	// hand.
+	vs := f.Decls[0].(*ast.GenDecl).Specs[0].(*ast.ValueSpec)
+	vs.Values[0] = &ast.BadExpr{From: vs.Values[0].Pos(), To: vs.Values[0].End()}
+
+	for _, strict := range []bool{false, true} {
+		m := &mockGen{
+			fset:      fset,
+			sources:   map[string][]byte{"lib.go": []byte(src)},
+			types:     make(map[string]ast.Expr),
+			recorders: make(map[string]string),
+			ifInfo:    newIfInfo("_ifmocks.go"),
+			strict:    strict,
+		}
+		out := &bytes.Buffer{}
+		_, err := m.file(out, f, "lib.go")
+		if !strict {
+			if err != nil {
+				t.Errorf("m.file failed: %s", err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), "lib.go:3") {
+			t.Errorf("Expected an error naming lib.go:3 in strict mode, got: %v", err)
+		}
+	}
+}
+
+func TestMakePkgNames(t *testing.T) {
+	src := t.TempDir()
+	data := "package lib\n\ntype T struct{}\n\nfunc (t *T) Get() int { return 1 }\n"
+	if err := ioutil.WriteFile(filepath.Join(src, "lib.go"), []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write lib.go: %s", err)
+	}
+
+	for _, names := range [][3]string{
+		{"", "EXPECT", "EXPECT"},
+		{"MOCK", "EXP ECT", "EXPECT"},
+		{"MOCK", "EXPECT", "func"},
+		{"_MOCK", "EXPECT", "EXPECT"},
+		{"MOCK", "MockAll", "EXPECT"},
+		{"MOCK", "EXPECT", "Fallback"},
+		{"M", "M", "EXPECT"},
+	} {
+		cfg := (&Config{}).Mock("example.com/lib")
+		cfg.MOCK, cfg.EXPECT, cfg.ObjEXPECT = names[0], names[1], names[2]
+		if _, err := MakePkg(src, t.TempDir(), "example.com/lib", true, cfg); err == nil {
+			t.Errorf("Expected an error for %q", names)
+		}
+	}
+
+	// Unexported names are fine, for package private mock controls
+	dst := t.TempDir()
+	cfg := (&Config{}).Mock("example.com/lib")
+	cfg.MOCK, cfg.EXPECT, cfg.ObjEXPECT = "mock", "expect", "expect"
+	if _, err := MakePkg(src, dst, "example.com/lib", true, cfg); err != nil {
+		t.Fatalf("MakePkg failed: %s", err)
+	}
+
+	generated := ""
+	for _, name := range []string{"lib.go", "lib_mock.go"} {
+		data, err := ioutil.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %s", name, err)
+		}
+		generated += string(data)
+	}
+	for _, want := range []string{"func mock() *_meta {", "func expect() *_package_Rec {", ") expect() *_T_Rec {"} {
+		if !strings.Contains(generated, want) {
+			t.Errorf("Expected %q, got:\n%s", want, generated)
+		}
+	}
+
+	// Only EXPECT is used when just mocking interfaces
+	cfg = &MockConfig{EXPECT: "EXPECT", InterfaceOnly: true}
+	if err := cfg.checkNames(cfg.InterfaceOnly); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	cfg.EXPECT = "SetController"
+	if err := cfg.checkNames(cfg.InterfaceOnly); err == nil {
+		t.Errorf("Expected an error for EXPECT %q", cfg.EXPECT)
+	}
+}
+
+func TestWriteMockTrace(t *testing.T) {
+	fi := &funcInfo{
+		name:   "Send",
+		params: []field{{names: []string{"to", "msg"}, expr: "string"}},
+		trace:  true,
+	}
+
+	out := &bytes.Buffer{}
+	fi.writeMock(out)
+	if !strings.Contains(out.String(), "\t\t_tracer(\"Send\", []interface{}{p0, p1})\n") {
+		t.Errorf("Expected mock to call tracer, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	fi.varidic = true
+	fi.params = append(fi.params, field{expr: "...int"})
+	fi.writeMock(out)
+	if !strings.Contains(out.String(), "\t\t_tracer(\"Send\", args)\n") {
+		t.Errorf("Expected variadic mock to pass args to tracer, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	fi.trace = false
+	fi.writeMock(out)
+	if strings.Contains(out.String(), "_tracer") {
+		t.Errorf("Expected no tracer call, got:\n%s", out.String())
+	}
+}
+
+func TestWriteMockCountCalls(t *testing.T) {
+	fi := &funcInfo{
+		name:   "Send",
+		params: []field{{names: []string{"msg"}, expr: "string"}},
+		count:  true,
+	}
+	fi.recv.expr = "*Client"
+
+	out := &bytes.Buffer{}
+	fi.writeMock(out)
+	if !strings.Contains(out.String(), "\t_addCallCount(\"Client.Send\")\n") {
+		t.Errorf("Expected mock to count the call, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	fi.count = false
+	fi.writeMock(out)
+	if strings.Contains(out.String(), "_addCallCount") {
+		t.Errorf("Expected no call count, got:\n%s", out.String())
+	}
+
+	m := &mockGen{MOCK: "MOCK", EXPECT: "EXPECT", gomock: defaultGomock, countCalls: true}
+	out.Reset()
+	if err := m.pkg(out, "p"); err != nil {
+		t.Fatalf("m.pkg failed: %s", err)
+	}
+	s := out.String()
+	for _, want := range []string{
+		"func (_ *_meta) CallCount(name string) int {\n",
+		"\t_resetCalls()\n\t_resetCallCounts()\n",
+		"\t_disabledPatterns = nil\n\t_resetCallCounts()\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Expected %q, got:\n%s", want, s)
+		}
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "", s, 0); err != nil {
+		t.Errorf("Generated code doesn't parse: %s\n%s", err, s)
+	}
+}
+
+func TestWriteFake(t *testing.T) {
+	get := &funcInfo{name: "Get"}
+	get.params = []field{{names: []string{"key"}, expr: "string"}}
+	get.results = []field{{expr: "int"}, {expr: "error"}}
+	logf := &funcInfo{name: "Logf", varidic: true}
+	logf.params = []field{{names: []string{"format"}, expr: "string"}, {names: []string{"args"}, expr: "...interface{}"}}
+	closer := &funcInfo{name: "Close"}
+
+	out := &bytes.Buffer{}
+	out.WriteString("package p\n\n")
+	writeFake(out, "Store", []*funcInfo{get, logf, closer})
+
+	s := out.String()
+	for _, want := range []string{
+		"type FakeStore struct{\n",
+		"\tGetFunc func(p0 string) (int, error)\n",
+		"\tLogfFunc func(p0 string, p1 ...interface{}) ()\n",
+		"var _ Store = &FakeStore{}\n",
+		"func (_f *FakeStore) Get(p0 string) (ret0 int, ret1 error) {\n" +
+			"\tif _f.GetFunc != nil {\n\t\treturn _f.GetFunc(p0)\n\t}\n\treturn\n}\n",
+		"\t\t_f.LogfFunc(p0, p1...)\n",
+		"func (_f *FakeStore) Close() () {\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Expected %q, got:\n%s", want, s)
+		}
+	}
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "", s, 0); err != nil {
+		t.Errorf("Generated code doesn't parse: %s\n%s", err, s)
+	}
+
+	if !canFake([]*funcInfo{get, logf, closer}) {
+		t.Errorf("Expected to be able to fake Get, Logf and Close")
+	}
+	if canFake([]*funcInfo{get, {name: "GetFunc"}}) {
+		t.Errorf("Expected a GetFunc method to prevent a fake")
+	}
+}
+
+func TestWriteMockVariadicOnly(t *testing.T) {
+	fi := &funcInfo{name: "Use", varidic: true}
+	fi.recv.expr = "*Router"
+	fi.params = []field{{expr: "...Handler"}}
+
+	out := &bytes.Buffer{}
+	out.WriteString("package p\n\n")
+	fi.writeMock(out)
+	fi.writeRecorder(out, "_Router_Rec")
+
+	// With no other parameters, calls without any variadic arguments should
+	// pass (and record) no arguments at all.
+	s := out.String()
+	for _, want := range []string{
+		"\targs := []interface{}{}\n\tfor _, v := range p0 {\n",
+		"\t_callController(_controller(), _m, \"Use\", args...)\n",
+		"\targs := append([]interface{}{}, p0...)\n",
+		"\treturn _expectCall(\"Router.Use\", _controller().RecordCall(_mr.mock, \"Use\", args...))\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Expected %q, got:\n%s", want, s)
+		}
+	}
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "", s, 0); err != nil {
+		t.Errorf("Generated code doesn't parse: %s\n%s", err, s)
+	}
+}
+
+func TestWriteMockFuncVariadic(t *testing.T) {
+	fi := &funcInfo{name: "Run", varidic: true}
+	fi.params = []field{{expr: "string"}, {expr: "...func(*Config)"}}
+	fi.results = []field{{expr: "error"}}
+
+	out := &bytes.Buffer{}
+	out.WriteString("package p\n\n")
+	fi.writeMock(out)
+	fi.writeRecorder(out, "_meta")
+
+	// Each func is boxed into interface{} on its own, so that it can be
+	// matched by gomock.Any().
+	s := out.String()
+	for _, want := range []string{
+		"func Run(p0 string, p1 ...func(*Config)) (error) {\n",
+		"\tfor _, v := range p1 {\n\t\targs = append(args, v)\n",
+		"func (_mr *_meta) Run(p0 interface{}, p1 ...interface{}) *gomock.Call {\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Expected %q, got:\n%s", want, s)
+		}
+	}
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "", s, 0); err != nil {
+		t.Errorf("Generated code doesn't parse: %s\n%s", err, s)
+	}
+}
+
+func TestWriteMockFallback(t *testing.T) {
+	fi := &funcInfo{name: "Log", varidic: true, fallback: true}
+	fi.recv.expr = "*MockLogger"
+	fi.params = []field{{expr: "string"}, {expr: "...interface{}"}}
+
+	out := &bytes.Buffer{}
+	out.WriteString("package p\n\n")
+	fi.writeMock(out)
+	fi.writeRecorder(out, "_mock_Logger_rec")
+
+	s := out.String()
+	for _, want := range []string{
+		"\tif _m.Fallback != nil && !_isExpected(&_m._expected, \"Log\") {\n" +
+			"\t\t_m.Fallback.Log(p0, p1...)\n\t\treturn\n\t}\n",
+		"\t_expectMethod(&_mr.mock._expected, \"Log\")\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Expected %q, got:\n%s", want, s)
+		}
+	}
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "", s, 0); err != nil {
+		t.Errorf("Generated code doesn't parse: %s\n%s", err, s)
+	}
+}
+
+func TestWriteMockOwnController(t *testing.T) {
+	fi := &funcInfo{name: "Get", ownCtrl: true}
+	fi.recv.expr = "*MockStore"
+	fi.params = []field{{expr: "string"}}
+	fi.results = []field{{expr: "string"}}
+
+	out := &bytes.Buffer{}
+	out.WriteString("package p\n\n")
+	fi.writeMock(out)
+	fi.writeRecorder(out, "_mock_Store_rec")
+
+	s := out.String()
+	for _, want := range []string{
+		"\tret := _callController(_mockController(_m._ctrl), _m, \"Get\", p0)\n",
+		"\treturn _expectCall(\"MockStore.Get\", _mockController(_mr.mock._ctrl).RecordCall(_mr.mock, \"Get\", p0))\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Expected %q, got:\n%s", want, s)
+		}
+	}
+}
+
+func TestCanFallback(t *testing.T) {
+	get := &funcInfo{name: "Get"}
+	fallback := &funcInfo{name: "Fallback"}
+
+	if !canFallback([]*funcInfo{get}) {
+		t.Errorf("Expected Get to allow a Fallback field")
+	}
+	if canFallback([]*funcInfo{get, fallback}) {
+		t.Errorf("Expected a Fallback method to prevent a Fallback field")
+	}
+}
+
+func TestChooseGomockName(t *testing.T) {
+	for src, expected := range map[string]string{
+		"package p\n\nimport \"github.com/golang/mock/gomock\"\n":    "gomock",
+		"package p\n\nimport gm \"github.com/golang/mock/gomock\"\n": "gomock",
+		"package p\n\nimport \"os\"\n\nfunc (t T) gomock() {}\n":     "gomock",
+		"package p\n\nimport gomock \"example.com/mock\"\n":          gomockAlias,
+		"package p\n\nimport \"go.uber.org/mock/gomock\"\n":          gomockAlias,
+		"package p\n\nfunc gomock() {}\n":                            gomockAlias,
+		"package p\n\nvar x, gomock = 1, 2\n":                        gomockAlias,
+		"package p\n\ntype gomock struct{}\n":                        gomockAlias,
+	} {
+		f, err := parser.ParseFile(token.NewFileSet(), "p.go", src, 0)
+		if err != nil {
+			t.Fatalf("parser.ParseFile failed: %s", err)
+		}
+		files := map[string]*ast.File{"p.go": f}
+		if name := chooseGomockName(files, defaultGomock); name != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, src, name)
+		}
+	}
+
+	fi := &funcInfo{name: "Get", gomock: gomockAlias}
+	fi.params = []field{{names: []string{"key"}, expr: "string"}}
+
+	out := &bytes.Buffer{}
+	fi.writeRecorder(out, "_package_Rec")
+	fi.writeTypedDo(out, "_package_Rec")
+
+	s := out.String()
+	if strings.Contains(s, " gomock.") || strings.Contains(s, "*gomock.") {
+		t.Errorf("Expected gomock to be aliased, got:\n%s", s)
+	}
+	for _, want := range []string{
+		"Get(key interface{}) *_wmgomock.Call {\n",
+		"GetDo(f func(p0 string)) *_wmgomock.Call {\n",
+		", _wmgomock.Any()).Do(f))\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Expected %q, got:\n%s", want, s)
+		}
+	}
+
+	m := &mockGen{MOCK: "MOCK", EXPECT: "EXPECT", gomock: defaultGomock, gomockName: gomockAlias}
+	out.Reset()
+	if err := m.pkg(out, "p"); err != nil {
+		t.Fatalf("m.pkg failed: %s", err)
+	}
+	s = out.String()
+	if !strings.Contains(s, "\t_wmgomock \"github.com/golang/mock/gomock\"\n") {
+		t.Errorf("Expected gomock to be imported as _wmgomock, got:\n%s", s)
+	}
+	if strings.Contains(s, " gomock.") || strings.Contains(s, "*gomock.") {
+		t.Errorf("Expected gomock to be aliased, got:\n%s", s)
+	}
+}
+
+func TestMergeGenerated(t *testing.T) {
+	a := "// +build linux\n\npackage p\n\n" +
+		"import gomock \"github.com/golang/mock/gomock\"\n\n" +
+		"import (\n\tos \"os\"\n\tstrings \"strings\"\n)\n\n" +
+		"func A() { os.Exit(len(strings.TrimSpace(\"\"))) }\n" +
+		gomockSentinel("")
+	b := "// +build linux\n\npackage p\n\n" +
+		"import gomock \"github.com/golang/mock/gomock\"\n\n" +
+		"import os \"os\"\n\n" +
+		"func B() { os.Exit(1) }\n" +
+		gomockSentinel("")
+	meta := "package p\n\n" +
+		"import (\n\tgomock \"github.com/golang/mock/gomock\"\n)\n\n" +
+		"var _ctrl *gomock.Controller\n"
+
+	data, merged, err := mergeGenerated([][]byte{[]byte(a), []byte(b)}, []byte(meta), "")
+	if err != nil {
+		t.Fatalf("mergeGenerated failed: %s", err)
+	}
+	if !merged {
+		t.Fatalf("Expected files to be merged")
+	}
+
+	f, err := parser.ParseFile(token.NewFileSet(), "", data, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("Merged file doesn't parse: %s\n%s", err, data)
+	}
+	if len(f.Imports) != 3 {
+		t.Errorf("Expected 3 imports, got %d:\n%s", len(f.Imports), data)
+	}
+	if n := strings.Count(string(data), "gomock.Any()"); n != 1 {
+		t.Errorf("Expected one gomock sentinel, got %d:\n%s", n, data)
+	}
+	if !strings.HasPrefix(string(data), "// +build linux\n") {
+		t.Errorf("Expected build constraint to be kept:\n%s", data)
+	}
+
+	conflicts := map[string]string{
+		"constraints": "// +build darwin\n\npackage p\n",
+		"names":       "package p\n\nimport os \"example.com/os\"\n\nvar _ = os.X\n",
+		"cgo":         "package p\n\nimport \"C\"\n",
+		"dot":         "package p\n\nimport . \"strings\"\n\nvar _ = TrimSpace\n",
+	}
+	for name, c := range conflicts {
+		if name != "constraints" {
+			c = "// +build linux\n\n" + c
+		}
+		_, merged, err := mergeGenerated([][]byte{[]byte(a), []byte(c)}, []byte(meta), "")
+		if err != nil {
+			t.Errorf("%s: mergeGenerated failed: %s", name, err)
+		}
+		if merged {
+			t.Errorf("%s: expected files not to be merged", name)
+		}
+	}
+}
+
+func TestMakePkgFromFiles(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	sources := map[string]string{
+		"a.go": "package lib\n\nfunc A() int { return 1 }\n",
+		"b.go": "package lib\n\ntype B struct{}\n\nfunc (b *B) Get() int { return 2 }\n",
+	}
+
+	fset := token.NewFileSet()
+	files := []*ast.File{}
+	for name, data := range sources {
+		path := filepath.Join(src, name)
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %s", name, err)
+		}
+		f, err := parser.ParseFile(fset, path, data, parser.ParseComments)
+		if err != nil {
+			t.Fatalf("parser.ParseFile(%s) failed: %s", name, err)
+		}
+		files = append(files, f)
+	}
+
+	cfg := (&Config{}).Mock("example.com/lib")
+	if _, err := MakePkgFromFiles(fset, files, src, dst, "example.com/lib", true, cfg); err != nil {
+		t.Fatalf("MakePkgFromFiles failed: %s", err)
+	}
+
+	expected := map[string]string{
+		"a.go":        "func _real_A() int",
+		"b.go":        "func (b *B) _real_Get() int",
+		"lib_mock.go": "func (_m *B) EXPECT() *_B_Rec",
+	}
+	for name, want := range expected {
+		data, err := ioutil.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Errorf("Failed to read generated %s: %s", name, err)
+			continue
+		}
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected %s to contain %q, got:\n%s", name, want, data)
+		}
+	}
+}
+
+func TestQualifyFile(t *testing.T) {
+	orig := dotPackages
+	dotPackages = map[string]*dotPackage{
+		"example.com/other": {
+			name: "other",
+			exported: map[string]bool{
+				"Item": true, "Label": true, "MOCK": true, "New": true,
+			},
+		},
+		"example.com/unused": {
+			name:     "unused",
+			exported: map[string]bool{"Name": true},
+		},
+	}
+	defer func() {
+		dotPackages = orig
+	}()
+
+	src := `package lib
+
+import (
+	"fmt"
+	. "example.com/other"
+	. "example.com/unused"
+)
+
+type W struct{ Name string }
+
+func Stub() Item
+
+func (w *W) Item() Item {
+	Label := fmt.Sprint(Label)
+	return New(Item{Name: Label}, map[Item]int{Item{}: 1}, w.Item)
+}
+`
+
+	want := `package lib
+
+import (
+	"fmt"
+	_dot_other "example.com/other"
+	_ "example.com/unused"
+)
+
+type W struct{ Name string }
+
+func Stub() _dot_other.Item
+
+func (w *W) Item() _dot_other.Item {
+	Label := fmt.Sprint(_dot_other.Label)
+	return _dot_other.New(_dot_other.Item{Name: Label}, map[_dot_other.Item]int{_dot_other.Item{}: 1}, w.Item)
+}
+`
+
+	got, err := qualifyFile("lib.go", []byte(src), "")
+	if err != nil {
+		t.Fatalf("qualifyFile failed: %s", err)
+	}
+
+	if string(got) != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestGetMethodsOverlapping(t *testing.T) {
+	src := `package lib
+
+type X interface{ Close() error }
+type A interface{ X; Read() int }
+type B interface{ X; Write(int) }
+type C interface{ A; B; Close() error; Name() string }
+`
+
+	f, err := parser.ParseFile(token.NewFileSet(), "lib.go", src, 0)
+	if err != nil {
+		t.Fatalf("parser.ParseFile failed: %s", err)
+	}
+
+	info := newIfInfo("lib.go")
+	for _, decl := range f.Decls {
+		for _, spec := range decl.(*ast.GenDecl).Specs {
+			if err := info.addType(spec.(*ast.TypeSpec), map[string]string{}); err != nil {
+				t.Fatalf("addType failed: %s", err)
+			}
+		}
+	}
+	i := Interfaces{"lib": info}
+
+	methods, err := i.getMethods("lib", "C")
+	if err != nil {
+		t.Fatalf("getMethods failed: %s", err)
+	}
+
+	names := []string{}
+	for _, method := range methods {
+		names = append(names, method.name)
+	}
+
+	expected := []string{"Close", "Name", "Read", "Write"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+}
+
+func TestEmbedPatterns(t *testing.T) {
+	src := "package lib\n\n" +
+		"import \"embed\"\n\n" +
+		"//go:embed assets/* \"with space.txt\"\n" +
+		"//go:embed `raw`\n" +
+		"var files embed.FS\n"
+
+	f, err := parser.ParseFile(token.NewFileSet(), "lib.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parser.ParseFile failed: %s", err)
+	}
+
+	patterns := embedPatterns([]*ast.File{f})
+	expected := []string{"assets/*", "with space.txt", "raw"}
+	if !reflect.DeepEqual(patterns, expected) {
+		t.Errorf("Expected %v, got %v", expected, patterns)
+	}
+
+	tests := map[string]bool{
+		"assets": true,
+		"raw":    true,
+		"other":  false,
+	}
+	for name, expected := range tests {
+		if e := isEmbedded(patterns, name); e != expected {
+			t.Errorf("isEmbedded(%s): expected %v, got %v", name, expected, e)
+		}
+	}
+}
+
+func TestOutputPackageName(t *testing.T) {
+	src := t.TempDir()
+
+	data := "package lib\n\ntype T interface{ Get() int }\n\nfunc A() int { return 1 }\n"
+	path := filepath.Join(src, "a.go")
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write a.go: %s", err)
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, data, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parser.ParseFile failed: %s", err)
+	}
+
+	cfg := (&Config{}).Mock("example.com/lib")
+
+	for _, name := range []string{"1lib", "fake-lib", "_", "func"} {
+		cfg.OutputPackageName = name
+		if _, err := MakePkgFromFiles(fset, []*ast.File{f}, src, t.TempDir(), "example.com/lib", true, cfg); err == nil {
+			t.Errorf("Expected error for OutputPackageName %q", name)
+		}
+	}
+
+	dst := t.TempDir()
+	cfg.OutputPackageName = "fakelib"
+	if _, err := MakePkgFromFiles(fset, []*ast.File{f}, src, dst, "example.com/lib", true, cfg); err != nil {
+		t.Fatalf("MakePkgFromFiles failed: %s", err)
+	}
+
+	for _, name := range []string{"a.go", "lib_mock.go", "lib_ifmocks.go"} {
+		data, err := ioutil.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Errorf("Failed to read generated %s: %s", name, err)
+			continue
+		}
+		if !strings.Contains(string(data), "package fakelib\n") {
+			t.Errorf("Expected %s to be in package fakelib, got:\n%s", name, data)
+		}
+	}
+}
+
+func TestWriteMockPointerError(t *testing.T) {
+	fi := &funcInfo{
+		name:    "Check",
+		results: []field{{expr: "*Error"}},
+	}
+
+	out := &bytes.Buffer{}
+	fi.writeMock(out)
+
+	// A nil given to Return must become a nil *Error, just as the real
+	// function would return - it isn't possible to return an untyped nil.
+	if !strings.Contains(out.String(), "\tret0, _ := ret[0].(*Error)\n") {
+		t.Errorf("Expected result to be asserted to *Error, got:\n%s", out.String())
+	}
+}
+
+func TestWriteRegistry(t *testing.T) {
+	out := &bytes.Buffer{}
+	writeRegistry(out, []string{"Writer", "Reader"}, "gomock")
+
+	s := out.String()
+	r := strings.Index(s, "\t\"Reader\": func(ctrl *gomock.Controller) interface{} {\n")
+	w := strings.Index(s, "\t\"Writer\": func(ctrl *gomock.Controller) interface{} {\n")
+	if r < 0 || w < 0 || r > w {
+		t.Errorf("Expected sorted entries for Reader and Writer, got:\n%s", s)
+	}
+	if !strings.Contains(s, "\t\treturn NewMockReader(ctrl)\n") {
+		t.Errorf("Expected Reader entry to return a MockReader, got:\n%s", s)
+	}
+	if strings.Contains(s, "_setController") {
+		t.Errorf("Expected entries not to change the package controller, got:\n%s", s)
+	}
+}
+
+func TestGenInterfaceUsedImports(t *testing.T) {
+	parse := func(src string) *ast.File {
+		f, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+		if err != nil {
+			t.Fatalf("parser.ParseFile failed: %s", err)
+		}
+		return f
+	}
+
+	addTypes := func(info *ifInfo, f *ast.File, imports map[string]string) {
+		for _, decl := range f.Decls {
+			d, ok := decl.(*ast.GenDecl)
+			if !ok || d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				if err := info.addType(spec.(*ast.TypeSpec), imports); err != nil {
+					t.Fatalf("addType failed: %s", err)
+				}
+			}
+		}
+	}
+
+	extInfo := newIfInfo("")
+	addTypes(extInfo, parse(`package ext
+type Opener interface {
+	Open(name string) (io.Reader, context.Context)
+}
+`), map[string]string{"io": "io", "context": "context"})
+
+	libInfo := newIfInfo(filepath.Join(t.TempDir(), "lib_ifmocks.go"))
+	libInfo.EXPECT = "EXPECT"
+	addTypes(libInfo, parse(`package lib
+type Conn interface {
+	ext.Opener
+	Close() error
+}
+`), map[string]string{"ext": "example.com/ext"})
+
+	i := Interfaces{"lib": libInfo, "ext": extInfo}
+	if err := i.genInterface("lib"); err != nil {
+		t.Fatalf("genInterface failed: %s", err)
+	}
+
+	for _, name := range []string{"io", "context"} {
+		if impPath := libInfo.used[name]; impPath != name {
+			t.Errorf("Expected %s to be used, got %v", name, libInfo.used)
+		}
+	}
+}
+
+func TestGenInterfaceSelfReturn(t *testing.T) {
+	parse := func(src string) *ast.File {
+		f, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+		if err != nil {
+			t.Fatalf("parser.ParseFile failed: %s", err)
+		}
+		return f
+	}
+
+	addTypes := func(info *ifInfo, f *ast.File, imports map[string]string) {
+		for _, decl := range f.Decls {
+			d, ok := decl.(*ast.GenDecl)
+			if !ok || d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				if err := info.addType(spec.(*ast.TypeSpec), imports); err != nil {
+					t.Fatalf("addType failed: %s", err)
+				}
+			}
+		}
+	}
+
+	extInfo := newIfInfo("")
+	addTypes(extInfo, parse(`package ext
+type Builder interface {
+	With(n int) Builder
+}
+`), map[string]string{})
+
+	filename := filepath.Join(t.TempDir(), "lib_ifmocks.go")
+	libInfo := newIfInfo(filename)
+	libInfo.EXPECT = "EXPECT"
+	addTypes(libInfo, parse(`package lib
+type Chain interface {
+	ext.Builder
+	Reset() Chain
+}
+`), map[string]string{"ext": "example.com/ext"})
+
+	i := Interfaces{"lib": libInfo, "ext": extInfo}
+	if err := i.genInterface("lib"); err != nil {
+		t.Fatalf("genInterface failed: %s", err)
+	}
+
+	generated, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read generated lib_ifmocks.go: %s", err)
+	}
+
+	// The mocks return the interfaces (so that the mock itself can be
+	// returned), with the embedded interface's type scoped to its package.
+	s := string(generated)
+	for _, want := range []string{
+		"func (_m *MockChain) Reset() (Chain) {\n",
+		"\tret0, _ := ret[0].(Chain)\n",
+		"func (_m *MockChain) With(p0 int) (ext.Builder) {\n",
+		"\tret0, _ := ret[0].(ext.Builder)\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Expected %q, got:\n%s", want, s)
+		}
+	}
+}
+
+func TestConstIota(t *testing.T) {
+	src := `package lib
+
+const (
+	_  = iota
+	KB = 1 << (10 * iota)
+	MB
+	GB
+)
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "lib.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parser.ParseFile failed: %s", err)
+	}
+
+	m := &mockGen{
+		fset:      fset,
+		types:     make(map[string]ast.Expr),
+		recorders: make(map[string]string),
+		ifInfo:    newIfInfo("_ifmocks.go"),
+	}
+	out := &bytes.Buffer{}
+	if _, err := m.file(out, f, "lib.go"); err != nil {
+		t.Fatalf("m.file failed: %s", err)
+	}
+
+	// MB and GB must be left to repeat the KB expression, with iota having
+	// counted the blank identifier.
+	expected := "const (\n\t_ = iota\n\tKB = 1 << (10 * iota)\n\tMB\n\tGB\n)\n"
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+}
+
+func TestGroupedValueSpecs(t *testing.T) {
+	src := `package lib
+
+var (
+	a, b = 1, "50%"
+	c    int
+	x, y int = 1, 2
+)
+
+const (
+	d, e string = "%d", "%%"
+	f           = 3
+)
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "lib.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parser.ParseFile failed: %s", err)
+	}
+
+	m := &mockGen{
+		fset:      fset,
+		types:     make(map[string]ast.Expr),
+		recorders: make(map[string]string),
+		ifInfo:    newIfInfo("_ifmocks.go"),
+	}
+	out := &bytes.Buffer{}
+	if _, err := m.file(out, f, "lib.go"); err != nil {
+		t.Fatalf("m.file failed: %s", err)
+	}
+
+	// The values must be kept as they are, even if they look like verbs.
+	for _, expected := range []string{
+		"var (\n\ta, b = 1, \"50%\"\n\tc int\n\tx, y int = 1, 2\n)\n",
+		"const (\n\td, e string = \"%d\", \"%%\"\n\tf = 3\n)\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestPreserveGenerate(t *testing.T) {
+	src := `package lib
+
+//go:generate stringer -type=Color
+
+// Color is a colour.
+//go:generate echo color
+type Color int
+
+// Name returns the name.
+func (c Color) Name() string { return "red" }
+`
+	filename := filepath.Join(t.TempDir(), "lib.go")
+	if err := ioutil.WriteFile(filename, []byte(src), 0600); err != nil {
+		t.Fatalf("Failed to write lib.go: %s", err)
+	}
+
+	for _, preserve := range []bool{false, true} {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
+		if err != nil {
+			t.Fatalf("parser.ParseFile failed: %s", err)
+		}
+
+		m := &mockGen{
+			fset:             fset,
+			types:            make(map[string]ast.Expr),
+			recorders:        make(map[string]string),
+			ifInfo:           newIfInfo("_ifmocks.go"),
+			preserveComments: true,
+			preserveGenerate: preserve,
+		}
+		out := &bytes.Buffer{}
+		if _, err := m.file(out, f, filename); err != nil {
+			t.Fatalf("m.file failed: %s", err)
+		}
+
+		s := out.String()
+		if !strings.Contains(s, "// Color is a colour.\n") {
+			t.Errorf("Expected other comments to be kept, got:\n%s", s)
+		}
+		for _, directive := range []string{
+			"//go:generate stringer -type=Color\n",
+			"//go:generate echo color\n",
+		} {
+			if n := strings.Count(s, directive); preserve && n != 1 {
+				t.Errorf("Expected %q once, found %d times in:\n%s", directive, n, s)
+			} else if !preserve && n != 0 {
+				t.Errorf("Expected %q to be stripped, got:\n%s", directive, s)
+			}
+		}
+	}
+}
+
+func TestMakePkgPreserveGenerate(t *testing.T) {
+	files := map[string]string{
+		"colors.go": "package lib\n\n//go:generate stringer -type=Color\n\n" +
+			"type Color int\n\nconst (\n\tRed Color = iota\n\tGreen\n)\n",
+	}
+
+	for _, preserve := range []bool{false, true} {
+		dst := makePkgFiles(t, files, func(cfg *MockConfig) {
+			cfg.PreserveGenerate = preserve
+		})
+
+		data, err := ioutil.ReadFile(filepath.Join(dst, "colors.go"))
+		if err != nil {
+			t.Fatalf("Failed to read generated colors.go: %s", err)
+		}
+
+		// By default the directive is removed, so that running go generate
+		// over the mocks doesn't run it again.
+		found := strings.Contains(string(data), "//go:generate stringer -type=Color\n")
+		if found != preserve {
+			t.Errorf("PreserveGenerate %v: expected directive kept to be %v, got:\n%s",
+				preserve, preserve, data)
+		}
+	}
+}
+
+func TestGenericRecorder(t *testing.T) {
+	src := `package lib
+
+type List[T comparable] struct{ items []T }
+
+type IntList = List[int]
+
+func (l *List[T]) Add(v T) { l.items = append(l.items, v) }
+
+func (l *List[E]) First() E { return l.items[0] }
+`
+	filename := filepath.Join(t.TempDir(), "lib.go")
+	if err := ioutil.WriteFile(filename, []byte(src), 0600); err != nil {
+		t.Fatalf("Failed to write lib.go: %s", err)
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parser.ParseFile failed: %s", err)
+	}
+
+	m := &mockGen{
+		fset:      fset,
+		types:     make(map[string]ast.Expr),
+		recorders: make(map[string]string),
+		ifInfo:    newIfInfo("_ifmocks.go"),
+		ObjEXPECT: "EXPECT",
+	}
+	out := &bytes.Buffer{}
+	if _, err := m.file(out, f, filename); err != nil {
+		t.Fatalf("m.file failed: %s", err)
+	}
+	for _, base := range m.recorderTypes() {
+		m.writeRecorderType(out, base)
+	}
+
+	// The recorder has the type parameters (and constraints) of the type,
+	// and each method uses the names that it gave them.
+	s := out.String()
+	for _, want := range []string{
+		"func (_mr *_List_Rec[T]) Add(v interface{}) *gomock.Call {\n",
+		"func (_mr *_List_Rec[E]) First() *gomock.Call {\n",
+		"\treturn _expectCall(\"List.Add\", _controller().RecordCall(_mr.mock, \"Add\", v))\n",
+		"type _List_Rec[T comparable] struct {\n\tmock *List[T]\n}\n",
+		"func (_m *List[T]) EXPECT() *_List_Rec[T] {\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Expected %q, got:\n%s", want, s)
+		}
+	}
+}
+
+func TestUnexportedTypeRecorder(t *testing.T) {
+	src := `package lib
+
+type widget struct{ calls int }
+
+func (w *widget) Do(n int) int { w.calls++; return n }
+
+type gadget struct{}
+
+func (gadget) Name() string { return "gadget" }
+`
+	filename := filepath.Join(t.TempDir(), "lib.go")
+	if err := ioutil.WriteFile(filename, []byte(src), 0600); err != nil {
+		t.Fatalf("Failed to write lib.go: %s", err)
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parser.ParseFile failed: %s", err)
+	}
+
+	m := &mockGen{
+		fset:      fset,
+		types:     make(map[string]ast.Expr),
+		recorders: make(map[string]string),
+		ifInfo:    newIfInfo("_ifmocks.go"),
+		ObjEXPECT: "EXPECT",
+	}
+	out := &bytes.Buffer{}
+	if _, err := m.file(out, f, filename); err != nil {
+		t.Fatalf("m.file failed: %s", err)
+	}
+	for _, base := range m.recorderTypes() {
+		m.writeRecorderType(out, base)
+	}
+
+	// The methods are exported, so they are renamed and mocked even though
+	// the types aren't - and the wrappers let a test create the types.
+	s := out.String()
+	for _, want := range []string{
+		"func (w *widget) _real_Do(n int) ",
+		"		return _m._real_Do(p0)\n",
+		"func (gadget) _real_Name() ",
+		"type Mock_widget struct {\n\twidget\n}\n",
+		"func (_ *_meta) Newwidget() *Mock_widget {\n\treturn &Mock_widget{}\n}\n",
+		"type Mock_gadget struct {\n\tgadget\n}\n",
+		"func (_ *_meta) Newgadget() Mock_gadget {\n\treturn Mock_gadget{}\n}\n",
+		"func (_m *widget) EXPECT() *_widget_Rec {\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Expected %q, got:\n%s", want, s)
+		}
+	}
+}
+
+func TestGenericConstraints(t *testing.T) {
+	src := t.TempDir()
+
+	data := "package lib\n\nimport \"fmt\"\n\n" +
+		"type Labels[T fmt.Stringer] struct{ items []T }\n\n" +
+		"func (l *Labels[T]) Add(v T) { l.items = append(l.items, v) }\n\n" +
+		"func Map[T, U any](v []T, f func(T) U) []U { return nil }\n"
+	if err := ioutil.WriteFile(filepath.Join(src, "lib.go"), []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write lib.go: %s", err)
+	}
+
+	for _, perType := range []bool{false, true} {
+		dst := t.TempDir()
+
+		cfg := (&Config{}).Mock("example.com/lib")
+		cfg.PerTypeFiles = perType
+		if _, err := MakePkg(src, dst, "example.com/lib", true, cfg); err != nil {
+			t.Fatalf("MakePkg failed: %s", err)
+		}
+
+		// The recorder type needs the import used by the constraint
+		recFile := "lib_mock.go"
+		if perType {
+			recFile = "lib_Labels_mock.go"
+		}
+		generated, err := ioutil.ReadFile(filepath.Join(dst, recFile))
+		if err != nil {
+			t.Fatalf("Failed to read generated %s: %s", recFile, err)
+		}
+		s := string(generated)
+		if !strings.Contains(s, "\tfmt \"fmt\"\n") ||
+			!strings.Contains(s, "type _Labels_Rec[T fmt.Stringer] struct {\n") {
+			t.Errorf("Expected the fmt import (per type: %v), got:\n%s", perType, s)
+		}
+
+		// Generic functions can't be mocked, so are left alone
+		generated, err = ioutil.ReadFile(filepath.Join(dst, "lib.go"))
+		if err != nil {
+			t.Fatalf("Failed to read generated lib.go: %s", err)
+		}
+		s = string(generated)
+		if !strings.Contains(s, "func Map[T, U any](v []T, f func(T) U) []U {") ||
+			strings.Contains(s, "_real_Map") {
+			t.Errorf("Expected Map to be unchanged, got:\n%s", s)
+		}
+	}
+}
+
+func TestPerTypeFiles(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	data := "package lib\n\n" +
+		"type A struct{}\n\nfunc (a *A) Get() int { return 1 }\n\n" +
+		"type b struct{}\n\nfunc (b b) Get() int { return 2 }\n"
+	path := filepath.Join(src, "lib.go")
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write lib.go: %s", err)
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, data, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parser.ParseFile failed: %s", err)
+	}
+
+	cfg := (&Config{}).Mock("example.com/lib")
+	cfg.PerTypeFiles = true
+	if _, err := MakePkgFromFiles(fset, []*ast.File{f}, src, dst, "example.com/lib", true, cfg); err != nil {
+		t.Fatalf("MakePkgFromFiles failed: %s", err)
+	}
+
+	expected := map[string]string{
+		"lib_A_mock.go": "func (_m *A) EXPECT() *_A_Rec",
+		"lib_b_mock.go": "func (_ *_meta) Newb() Mock_b",
+	}
+	for name, want := range expected {
+		data, err := ioutil.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Errorf("Failed to read generated %s: %s", name, err)
+			continue
+		}
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected %s to contain %q, got:\n%s", name, want, data)
+		}
+	}
+
+	meta, err := ioutil.ReadFile(filepath.Join(dst, "lib_mock.go"))
+	if err != nil {
+		t.Fatalf("Failed to read generated lib_mock.go: %s", err)
+	}
+	if strings.Contains(string(meta), "EXPECT() *_A_Rec") {
+		t.Errorf("Expected recorder types to be moved out of lib_mock.go, got:\n%s", meta)
+	}
+}
+
+func TestNoRecorders(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	data := "package lib\n\n" +
+		"type Store interface{ Get() int }\n\n" +
+		"type A struct{}\n\nfunc (a *A) Get() int { return 1 }\n\n" +
+		"type b struct{}\n\nfunc (b b) Get() int { return 2 }\n\n" +
+		"func Get() int { return 3 }\n"
+	if err := ioutil.WriteFile(filepath.Join(src, "lib.go"), []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write lib.go: %s", err)
+	}
+
+	cfg := (&Config{}).Mock("example.com/lib")
+	cfg.NoRecorders = true
+	if _, err := MakePkg(src, dst, "example.com/lib", true, cfg); err != nil {
+		t.Fatalf("MakePkg failed: %s", err)
+	}
+
+	for _, name := range []string{"lib.go", "lib_mock.go"} {
+		data, err := ioutil.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatalf("Failed to read generated %s: %s", name, err)
+		}
+		if strings.Contains(string(data), "_Rec") || strings.Contains(string(data), "EXPECT") {
+			t.Errorf("Expected no recorders in %s, got:\n%s", name, data)
+		}
+		if _, err := parser.ParseFile(token.NewFileSet(), name, data, 0); err != nil {
+			t.Errorf("Generated %s doesn't parse: %s", name, err)
+		}
+	}
+
+	// The interface mocks keep their recorders
+	ifmocks, err := ioutil.ReadFile(filepath.Join(dst, "lib_ifmocks.go"))
+	if err != nil {
+		t.Fatalf("Failed to read generated lib_ifmocks.go: %s", err)
+	}
+	if !strings.Contains(string(ifmocks), "func (_m *MockStore) EXPECT() *_mock_Store_rec {\n") {
+		t.Errorf("Expected interface recorder, got:\n%s", ifmocks)
+	}
+}
+
+func TestInterfaceOnly(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	files := map[string]string{
+		"lib.go": "package lib\n\n" +
+			"type closer interface{ Close() error }\n\n" +
+			"type Store interface {\n\tcloser\n\tGet(key string) (*Item, error)\n}\n\n" +
+			"type Item struct{ Value string }\n\n" +
+			"func Open() Store { return nil }\n",
+		"data.txt": "data\n",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(data), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %s", name, err)
+		}
+	}
+
+	cfg := (&Config{}).Mock("example.com/lib")
+	cfg.InterfaceOnly = true
+	imports, err := MakePkg(src, dst, "example.com/lib", true, cfg)
+	if err != nil {
+		t.Fatalf("MakePkg failed: %s", err)
+	}
+
+	if _, found := imports["example.com/lib"]; !found {
+		t.Errorf("Expected the real package to be imported, got %v", imports)
+	}
+
+	entries, err := ioutil.ReadDir(dst)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %s", dst, err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "lib_ifmocks.go" {
+		t.Fatalf("Expected only lib_ifmocks.go to be generated, got %v", entries)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dst, "lib_ifmocks.go"))
+	if err != nil {
+		t.Fatalf("Failed to read generated lib_ifmocks.go: %s", err)
+	}
+	s := string(data)
+	for _, want := range []string{
+		"package lib_mocks\n",
+		"\t. \"example.com/lib\"\n",
+		"func (_m *MockStore) Close() error {\n",
+		"func (_m *MockStore) Get(p0 string) (*Item, error) {\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Expected generated code to contain %q, got:\n%s", want, s)
+		}
+	}
+	if strings.Contains(s, "Mockcloser") || strings.Contains(s, "_real_") {
+		t.Errorf("Expected only the exported interfaces to be mocked, got:\n%s", s)
+	}
+}
+
+func TestInterfaceOnlySize(t *testing.T) {
+	files := map[string]string{
+		"store.go": "package lib\n\n" +
+			"type Store interface {\n\tGet(key string) (string, error)\n\tPut(key, value string) error\n}\n\n" +
+			"type Memory struct{ values map[string]string }\n\n" +
+			"func (m *Memory) Get(key string) (string, error) { return m.values[key], nil }\n\n" +
+			"func (m *Memory) Put(key, value string) error { m.values[key] = value; return nil }\n\n" +
+			"func Prefixed(s Store, prefix string) []string { return nil }\n",
+	}
+
+	size := func(dst string) int64 {
+		total := int64(0)
+		entries, err := ioutil.ReadDir(dst)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %s", dst, err)
+		}
+		for _, entry := range entries {
+			total += entry.Size()
+		}
+		return total
+	}
+
+	full := size(makePkgFiles(t, files, func(cfg *MockConfig) {}))
+	ifOnly := size(makePkgFiles(t, files, func(cfg *MockConfig) {
+		cfg.InterfaceOnly = true
+	}))
+
+	if ifOnly >= full {
+		t.Errorf("Expected interface only output (%d bytes) to be smaller "+
+			"than the full mock (%d bytes)", ifOnly, full)
+	}
+}
+
+func TestPackageDoc(t *testing.T) {
+	src := t.TempDir()
+
+	data := "// Package lib does real things.\npackage lib\n\n" +
+		"// Get gets.\nfunc Get() int { return 1 }\n"
+	if err := ioutil.WriteFile(filepath.Join(src, "lib.go"), []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write lib.go: %s", err)
+	}
+
+	marker := "// Package lib is a mock of example.com/lib, generated by withmock.\n"
+
+	for _, single := range []bool{false, true} {
+		dst := t.TempDir()
+
+		cfg := (&Config{}).Mock("example.com/lib")
+		cfg.PackageDoc = true
+		cfg.SingleFile = single
+		if _, err := MakePkg(src, dst, "example.com/lib", true, cfg); err != nil {
+			t.Fatalf("MakePkg failed: %s", err)
+		}
+
+		// The merged file has the meta file's name
+		if single && exists(filepath.Join(dst, "lib.go")) {
+			t.Errorf("Expected lib.go to be merged into lib_mock.go")
+		}
+		generated, err := ioutil.ReadFile(filepath.Join(dst, "lib_mock.go"))
+		if err != nil {
+			t.Fatalf("Failed to read generated lib_mock.go: %s", err)
+		}
+		if !strings.Contains(string(generated), marker+"//") {
+			t.Errorf("Expected the package doc (single: %v), got:\n%s", single, generated)
+		}
+
+		// go doc should only see our package doc
+		fset := token.NewFileSet()
+		pkgs, err := parser.ParseDir(fset, dst, nil, parser.ParseComments)
+		if err != nil {
+			t.Fatalf("parser.ParseDir failed: %s", err)
+		}
+		d := doc.New(pkgs["lib"], "example.com/lib", 0)
+		if !strings.HasPrefix(d.Doc, "Package lib is a mock of example.com/lib") ||
+			strings.Contains(d.Doc, "real things") {
+			t.Errorf("Expected only the mock package doc (single: %v), got: %q", single, d.Doc)
+		}
+	}
+}
+
+func TestCleanMock(t *testing.T) {
+	src := t.TempDir()
+	dst := filepath.Join(t.TempDir(), "lib")
+
+	files := map[string]string{
+		"lib.go":              "package lib\n\nfunc A() int { return 1 }\n",
+		"data.txt":            "data\n",
+		"internal/private.go": "package internal\n",
+		"vendor/dep/dep.go":   "package dep\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatalf("Failed to create directory for %s: %s", name, err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %s", name, err)
+		}
+	}
+
+	if err := os.MkdirAll(dst, 0700); err != nil {
+		t.Fatalf("Failed to create %s: %s", dst, err)
+	}
+
+	cfg := (&Config{}).Mock("example.com/lib")
+	if _, err := MakePkg(src, dst, "example.com/lib", true, cfg); err != nil {
+		t.Fatalf("MakePkg failed: %s", err)
+	}
+
+	for _, name := range []string{"internal", "vendor", "data.txt"} {
+		if info, err := os.Lstat(filepath.Join(dst, name)); err != nil || info.Mode()&os.ModeSymlink == 0 {
+			t.Fatalf("Expected %s to be a symlink (err: %v)", name, err)
+		}
+	}
+
+	if err := CleanMock(dst); err != nil {
+		t.Fatalf("CleanMock failed: %s", err)
+	}
+
+	if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed (err: %v)", dst, err)
+	}
+
+	for name, data := range files {
+		got, err := ioutil.ReadFile(filepath.Join(src, name))
+		if err != nil || string(got) != data {
+			t.Errorf("Expected source %s to be untouched (err: %v)", name, err)
+		}
+	}
+
+	// Cleaning again is fine, as there is nothing left to remove
+	if err := CleanMock(dst); err != nil {
+		t.Errorf("CleanMock of missing path failed: %s", err)
+	}
+}
+
+func TestWriteEnvControl(t *testing.T) {
+	c := &Config{Mocks: map[string]*MockConfig{
+		"DEFAULT":         {EnvControl: true},
+		"example.com/lib": {EnvControlVar: "LIB_MOCKS"},
+	}}
+	if v := c.Mock("example.com/other").envControlVar(); v != "WITHMOCK_ENABLE" {
+		t.Errorf("Expected default variable WITHMOCK_ENABLE, got %q", v)
+	}
+	if v := (&Config{}).Mock("example.com/other").envControlVar(); v != "" {
+		t.Errorf("Expected no variable without EnvControl, got %q", v)
+	}
+
+	m := &mockGen{
+		pkgName:    "example.com/lib",
+		MOCK:       "MOCK",
+		envControl: c.Mock("example.com/lib").envControlVar(),
+	}
+
+	out := &bytes.Buffer{}
+	m.writeEnvControl(out)
+
+	for _, want := range []string{
+		"\tvalue, _ := _syscall.Getenv(\"LIB_MOCKS\")\n",
+		"\t\tif name == \"example.com/lib\" {\n\t\t\tMOCK().MockAll(true)\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
+
+// eofReaderAt returns io.EOF with reads that end at the end of the data, as
+// io.ReaderAt implementations are allowed to do.
+type eofReaderAt []byte
+
+func (r eofReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n := copy(p, r[off:])
+	if int(off)+n == len(r) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func TestReadSourceEOF(t *testing.T) {
+	src := "package lib\n\nfunc A() int { return 1 }"
+
+	body, err := readSource(eofReaderAt(src), strings.Index(src, "{"), len(src)-1)
+	if err != nil {
+		t.Fatalf("readSource failed: %s", err)
+	}
+	if string(body) != "{ return 1 }" {
+		t.Errorf("Expected \"{ return 1 }\", got %q", body)
+	}
+
+	if _, err := readSource(eofReaderAt(src), strings.Index(src, "{"), len(src)); err != io.EOF {
+		t.Errorf("Expected io.EOF for a short read, got %v", err)
+	}
+
+	// A file ending exactly at the closing brace of its last function
+	filename := filepath.Join(t.TempDir(), "lib.go")
+	if err := ioutil.WriteFile(filename, []byte(src), 0600); err != nil {
+		t.Fatalf("Failed to write lib.go: %s", err)
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parser.ParseFile failed: %s", err)
+	}
+
+	m := &mockGen{
+		fset:      fset,
+		types:     make(map[string]ast.Expr),
+		recorders: make(map[string]string),
+		ifInfo:    newIfInfo("_ifmocks.go"),
+	}
+	out := &bytes.Buffer{}
+	if _, err := m.file(out, f, filename); err != nil {
+		t.Fatalf("m.file failed: %s", err)
+	}
+	if !strings.Contains(out.String(), "{ return 1 }\n") {
+		t.Errorf("Expected real function with body, got:\n%s", out.String())
+	}
+}
+
+func TestMockInterfacesDir(t *testing.T) {
+	src := t.TempDir()
+	data := "package store\n\ntype Store interface {\n\tGet(key string) string\n}\n"
+	if err := ioutil.WriteFile(filepath.Join(src, "store.go"), []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write store.go: %s", err)
+	}
+
+	tmpPath := t.TempDir()
+	base := t.TempDir()
+	t.Setenv("TMPDIR", base)
+
+	expected := filepath.Join(base, "mocks", "src", "example.com", "store", "_mocks_")
+	link := filepath.Join(tmpPath, "src", "example.com", "store", "_mocks_")
+	outputs := map[string]string{
+		"go list -e -f {{.Dir}} example.com/store":          src,
+		"gofmt -w " + filepath.Join(expected, "ifmocks.go"): "",
+	}
+
+	linked := func() bool {
+		_, err := os.Lstat(link)
+		return err == nil
+	}
+
+	mockIfs := func(cfg *MockConfig) (string, func() error, error) {
+		useStubRunner(t, outputs)
+		pkgNames["example.com/store"] = "store"
+		return MockInterfaces(tmpPath, "example.com/store", cfg)
+	}
+
+	cfg := &MockConfig{
+		EXPECT:         "EXPECT",
+		InterfacesDir:  "$TMPDIR/mocks",
+		InterfacesPerm: "0750",
+	}
+	dst, cleanup, err := mockIfs(cfg)
+	if err != nil {
+		t.Fatalf("MockInterfaces failed: %s", err)
+	}
+	if dst != expected {
+		t.Errorf("Expected mocks in %s, got %s", expected, dst)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "ifmocks.go")); err != nil {
+		t.Errorf("Expected ifmocks.go to be generated: %s", err)
+	}
+	if info, err := os.Stat(dst); err != nil || info.Mode().Perm() != 0750 {
+		t.Errorf("Expected mode 0750, got %v (err: %v)", info.Mode(), err)
+	}
+
+	// The mocks must still be found in the GOPATH used for the build
+	if _, err := os.Stat(filepath.Join(link, "ifmocks.go")); err != nil {
+		t.Errorf("Expected ifmocks.go to be linked into tmpPath: %s", err)
+	}
+
+	// By default nothing is removed
+	if err := cleanup(); err != nil {
+		t.Fatalf("cleanup failed: %s", err)
+	}
+	if !exists(expected) {
+		t.Errorf("Expected %s to be kept", expected)
+	}
+
+	// Cleaning up on success keeps the mocks until the cleanup is run
+	os.RemoveAll(dst)
+	os.Remove(link)
+	cfg.InterfacesCleanup = "success"
+	_, cleanup, err = mockIfs(cfg)
+	if err != nil {
+		t.Fatalf("MockInterfaces failed: %s", err)
+	}
+	if !exists(expected) {
+		t.Errorf("Expected %s to be kept until the cleanup", expected)
+	}
+	if err := cleanup(); err != nil {
+		t.Fatalf("cleanup failed: %s", err)
+	}
+	if exists(expected) || linked() {
+		t.Errorf("Expected %s and %s to be removed on success", expected, link)
+	}
+
+	// Cleaning up on failure leaves it alone on success ...
+	cfg.InterfacesCleanup = "failure"
+	_, cleanup, err = mockIfs(cfg)
+	if err != nil {
+		t.Fatalf("MockInterfaces failed: %s", err)
+	}
+	if err := cleanup(); err != nil {
+		t.Fatalf("cleanup failed: %s", err)
+	}
+	if !exists(expected) {
+		t.Errorf("Expected %s to be kept on success", expected)
+	}
+
+	// ... but removes it when generation fails (here gofmt is unknown)
+	os.RemoveAll(dst)
+	os.Remove(link)
+	delete(outputs, "gofmt -w "+filepath.Join(expected, "ifmocks.go"))
+	if _, _, err := mockIfs(cfg); err == nil {
+		t.Fatalf("Expected MockInterfaces to fail")
+	}
+	if exists(expected) || linked() {
+		t.Errorf("Expected %s and %s to be removed on failure", expected, link)
+	}
+
+	for _, bad := range []*MockConfig{
+		{InterfacesPerm: "rwx"},
+		{InterfacesPerm: "17777"},
+		{InterfacesCleanup: "sometimes"},
+	} {
+		if _, _, err := mockIfs(bad); err == nil {
+			t.Errorf("Expected error for %+v", bad)
+		}
+	}
+}
+
+func TestVerifyUpToDate(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	files := map[string]string{
+		"lib.go":   "package lib\n\nfunc Get() int { return 1 }\n",
+		"data.txt": "data\n",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(data), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %s", name, err)
+		}
+	}
+
+	cfg := (&Config{}).Mock("example.com/lib")
+	if _, err := MakePkg(src, dst, "example.com/lib", true, cfg); err != nil {
+		t.Fatalf("MakePkg failed: %s", err)
+	}
+
+	stale, err := VerifyUpToDate(src, dst, "example.com/lib", true, cfg)
+	if err != nil || len(stale) != 0 {
+		t.Errorf("Expected mock to be up to date, got %v (err: %v)", stale, err)
+	}
+
+	// Changing the source changes lib.go, but not the meta file
+	data := "package lib\n\nfunc Get() int { return 2 }\n"
+	if err := ioutil.WriteFile(filepath.Join(src, "lib.go"), []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write lib.go: %s", err)
+	}
+
+	// A file that wouldn't be generated is stale too, even if hidden
+	for _, name := range []string{"old.go", ".old"} {
+		if err := ioutil.WriteFile(filepath.Join(dst, name), []byte("package lib\n"), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %s", name, err)
+		}
+	}
+
+	stale, err = VerifyUpToDate(src, dst, "example.com/lib", true, cfg)
+	if err != nil {
+		t.Fatalf("VerifyUpToDate failed: %s", err)
+	}
+	if expected := []string{".old", "lib.go", "old.go"}; !reflect.DeepEqual(stale, expected) {
+		t.Errorf("Expected %v to be stale, got %v", expected, stale)
+	}
+}
+
+func TestResolvePackageName(t *testing.T) {
+	src := t.TempDir()
+
+	data := "package lib\n\nimport \"example.com/weird/go-client\"\n\n" +
+		"func Get() *client.Conn { return nil }\n"
+	if err := ioutil.WriteFile(filepath.Join(src, "lib.go"), []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write lib.go: %s", err)
+	}
+
+	consulted := []string{}
+	resolve := func(impPath, srcPath string) (string, error) {
+		consulted = append(consulted, impPath)
+		if srcPath != src {
+			t.Errorf("Expected srcPath %s, got %s", src, srcPath)
+		}
+		if impPath == "example.com/weird/go-client" {
+			return "client", nil
+		}
+		return "", fmt.Errorf("unknown package %s", impPath)
+	}
+
+	// The resolver can be set for all packages
+	c := &Config{Mocks: map[string]*MockConfig{
+		"DEFAULT": {ResolvePackageName: resolve},
+	}}
+	cfg := c.Mock("example.com/lib")
+
+	dst := t.TempDir()
+	if _, err := MakePkg(src, dst, "example.com/lib", true, cfg); err != nil {
+		t.Fatalf("MakePkg failed: %s", err)
+	}
+
+	if len(consulted) != 1 || consulted[0] != "example.com/weird/go-client" {
+		t.Errorf("Expected the resolver to be consulted, got %v", consulted)
+	}
+
+	generated, err := ioutil.ReadFile(filepath.Join(dst, "lib.go"))
+	if err != nil {
+		t.Fatalf("Failed to read generated lib.go: %s", err)
+	}
+	if !strings.Contains(string(generated), "import client \"example.com/weird/go-client\"\n") {
+		t.Errorf("Expected the resolved name to be used, got:\n%s", generated)
+	}
+
+	// Errors from the resolver are passed back
+	cfg.ResolvePackageName = func(impPath, srcPath string) (string, error) {
+		return "", fmt.Errorf("no resolving today")
+	}
+	if _, err := MakePkg(src, t.TempDir(), "example.com/lib", true, cfg); err == nil ||
+		!strings.Contains(err.Error(), "no resolving today") {
+		t.Errorf("Expected the resolver error, got %v", err)
+	}
+}
+
+func TestNoTestingImport(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	data := "package lib\n\n" +
+		"type Getter interface{ Get(key string) int }\n\n" +
+		"func Lookup(key string) int { return len(key) }\n"
+	if err := ioutil.WriteFile(filepath.Join(src, "lib.go"), []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write lib.go: %s", err)
+	}
+
+	cfg := (&Config{}).Mock("example.com/lib")
+	cfg.TraceCalls = true
+	cfg.MockRegistry = true
+	cfg.Fallbacks = true
+	if _, err := MakePkg(src, dst, "example.com/lib", true, cfg); err != nil {
+		t.Fatalf("MakePkg failed: %s", err)
+	}
+
+	// The generated code should only rely on gomock.TestReporter, so that it
+	// can be used from benchmarks, fuzz targets or with custom reporters.
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dst, nil, parser.ImportsOnly)
+	if err != nil {
+		t.Fatalf("parser.ParseDir failed: %s", err)
+	}
+	for _, pkg := range pkgs {
+		for name, f := range pkg.Files {
+			for _, imp := range f.Imports {
+				if imp.Path.Value == `"testing"` {
+					t.Errorf("Expected no testing import, found in %s", name)
+				}
+			}
+		}
+	}
+}
+
+func TestMakePkgs(t *testing.T) {
+	orig := pkgNames
+	pkgNames = map[string]string{"example.com/a": "a", "example.com/b": "b"}
+	t.Cleanup(func() {
+		pkgNames = orig
+	})
+
+	sources := map[string]string{
+		"a": "package a\n\nfunc A() int { return 1 }\n",
+		"b": "package b\n\nimport \"example.com/a\"\n\nfunc B() int { return a.A() + 1 }\n",
+		"c": "package c\n\nimport (\n\t\"example.com/a\"\n\t\"example.com/b\"\n)\n\n" +
+			"func C() int { return a.A() + b.B() }\n",
+	}
+
+	base := t.TempDir()
+	specs := []PkgSpec{}
+	for _, name := range []string{"a", "b", "missing", "c"} {
+		src := filepath.Join(base, "src", name)
+		if data, found := sources[name]; found {
+			if err := os.MkdirAll(src, 0700); err != nil {
+				t.Fatalf("Failed to create %s: %s", src, err)
+			}
+			path := filepath.Join(src, name+".go")
+			if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+				t.Fatalf("Failed to write %s: %s", path, err)
+			}
+		}
+		specs = append(specs, PkgSpec{
+			SrcPath: src,
+			DstPath: filepath.Join(base, "dst", name),
+			PkgName: "example.com/" + name,
+			Mock:    true,
+		})
+	}
+
+	cfg := (&Config{}).Mock("DEFAULT")
+	results, err := MakePkgs(specs, cfg)
+	if err == nil || !strings.Contains(err.Error(), "example.com/missing") {
+		t.Errorf("Expected an error for example.com/missing, got %v", err)
+	}
+	if len(results) != len(specs) {
+		t.Fatalf("Expected %d results, got %d", len(specs), len(results))
+	}
+
+	// The failure doesn't stop the other packages being generated
+	for i, result := range results {
+		name := filepath.Base(result.Spec.SrcPath)
+		if name == "missing" {
+			if result.Err == nil {
+				t.Errorf("Expected an error for %s", name)
+			}
+			continue
+		}
+		if result.Err != nil {
+			t.Errorf("Expected no error for %s, got %s", name, result.Err)
+		}
+		if result.Spec != specs[i] {
+			t.Errorf("Expected result %d to be for %v, got %v", i, specs[i], result.Spec)
+		}
+		if !exists(filepath.Join(result.Spec.DstPath, name+".go")) {
+			t.Errorf("Expected %s to be generated", name)
+		}
+	}
+
+	if !results[3].Imports["example.com/b"].ShouldInstall() {
+		t.Errorf("Expected example.com/b to be imported by c, got %v", results[3].Imports)
+	}
+	generated, err := ioutil.ReadFile(filepath.Join(base, "dst", "c", "c.go"))
+	if err != nil {
+		t.Fatalf("Failed to read generated c.go: %s", err)
+	}
+	if !strings.Contains(string(generated), "\tb \"example.com/b\"\n") {
+		t.Errorf("Expected c to import b, got:\n%s", generated)
+	}
+}
@@ -17,30 +17,92 @@ import (
 )
 
 // These lists needs to match the actual list in
-// <goroot>/src/pkg/go/build/syslist.go - which is unfortunately private ... :(
+// <goroot>/src/go/build/syslist.go - which is unfortunately private ... :(
 
 var knownOS = map[string]bool{
+	"aix":       true,
+	"android":   true,
 	"darwin":    true,
 	"dragonfly": true,
 	"freebsd":   true,
+	"hurd":      true,
+	"illumos":   true,
+	"ios":       true,
+	"js":        true,
 	"linux":     true,
 	"nacl":      true,
 	"netbsd":    true,
 	"openbsd":   true,
 	"plan9":     true,
 	"solaris":   true,
+	"wasip1":    true,
 	"windows":   true,
+	"zos":       true,
+}
+
+// unixOS is the set of GOOS values that satisfy the "unix" build constraint.
+// Unlike the GOOS values themselves, unix isn't recognised in file names.
+var unixOS = map[string]bool{
+	"aix":       true,
+	"android":   true,
+	"darwin":    true,
+	"dragonfly": true,
+	"freebsd":   true,
+	"hurd":      true,
+	"illumos":   true,
+	"ios":       true,
+	"linux":     true,
+	"netbsd":    true,
+	"openbsd":   true,
+	"solaris":   true,
 }
 
 var knownArch = map[string]bool{
-	"386":      true,
-	"amd64":    true,
-	"amd64p32": true,
-	"arm":      true,
+	"386":         true,
+	"amd64":       true,
+	"amd64p32":    true,
+	"arm":         true,
+	"armbe":       true,
+	"arm64":       true,
+	"arm64be":     true,
+	"loong64":     true,
+	"mips":        true,
+	"mipsle":      true,
+	"mips64":      true,
+	"mips64le":    true,
+	"mips64p32":   true,
+	"mips64p32le": true,
+	"ppc":         true,
+	"ppc64":       true,
+	"ppc64le":     true,
+	"riscv":       true,
+	"riscv64":     true,
+	"s390":        true,
+	"s390x":       true,
+	"sparc":       true,
+	"sparc64":     true,
+	"wasm":        true,
+}
+
+// matchOS returns true if name (a known OS) matches the system described by
+// ctxt.  As with the go command, android also matches linux, illumos matches
+// solaris and ios matches darwin.
+func matchOS(ctxt *build.Context, name string) bool {
+	switch {
+	case name == ctxt.GOOS:
+		return true
+	case ctxt.GOOS == "android" && name == "linux":
+		return true
+	case ctxt.GOOS == "illumos" && name == "solaris":
+		return true
+	case ctxt.GOOS == "ios" && name == "darwin":
+		return true
+	}
+	return false
 }
 
 // goodOSArchFile returns false if the name contains a $GOOS or $GOARCH
-// suffix which does not match the current system.
+// suffix which does not match the system described by ctxt.
 // The recognized name formats are:
 //
 //     name_$(GOOS).*
@@ -50,9 +112,7 @@ var knownArch = map[string]bool{
 //     name_$(GOARCH)_test.*
 //     name_$(GOOS)_$(GOARCH)_test.*
 //
-func goodOSArchFile(name string, allTags map[string]bool) bool {
-	ctxt := build.Default
-
+func goodOSArchFile(ctxt *build.Context, name string, allTags map[string]bool) bool {
 	if dot := strings.Index(name, "."); dot != -1 {
 		name = name[:dot]
 	}
@@ -66,13 +126,13 @@ func goodOSArchFile(name string, allTags map[string]bool) bool {
 			allTags[l[n-2]] = true
 			allTags[l[n-1]] = true
 		}
-		return l[n-2] == ctxt.GOOS && l[n-1] == ctxt.GOARCH
+		return matchOS(ctxt, l[n-2]) && l[n-1] == ctxt.GOARCH
 	}
 	if n >= 1 && knownOS[l[n-1]] {
 		if allTags != nil {
 			allTags[l[n-1]] = true
 		}
-		return l[n-1] == ctxt.GOOS
+		return matchOS(ctxt, l[n-1])
 	}
 	if n >= 1 && knownArch[l[n-1]] {
 		if allTags != nil {
@@ -166,7 +166,7 @@ func (p *realPackage) Install() error {
 	}
 
 	cmd := p.insideCommand("go", "install", p.label)
-	out, err := cmd.CombinedOutput()
+	out, err := Runner.CombinedOutput(cmd)
 	if err != nil {
 		return fmt.Errorf("Failed to install '%s': %s\noutput:\n%s",
 			p.label, err, out)
@@ -0,0 +1,35 @@
+// Copyright 2013 Julian Phillips.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lib
+
+import (
+	"os/exec"
+)
+
+// CommandRunner is used to run the external commands that we need (go list,
+// gofmt, go install etc.).  Replacing Runner allows the output of those
+// commands to be stubbed out.
+type CommandRunner interface {
+	// Output runs cmd and returns its standard output.
+	Output(cmd *exec.Cmd) ([]byte, error)
+
+	// CombinedOutput runs cmd and returns its combined standard output and
+	// standard error.
+	CombinedOutput(cmd *exec.Cmd) ([]byte, error)
+}
+
+type execRunner struct{}
+
+func (execRunner) Output(cmd *exec.Cmd) ([]byte, error) {
+	return cmd.Output()
+}
+
+func (execRunner) CombinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	return cmd.CombinedOutput()
+}
+
+// Runner is the CommandRunner used to run all external commands, by default
+// the commands are actually executed.
+var Runner CommandRunner = execRunner{}
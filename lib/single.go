@@ -0,0 +1,151 @@
+// Copyright 2013 Julian Phillips.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// gomockSentinel returns the code written at the end of each generated file,
+// to make sure that the gomock import (called name) is used.
+func gomockSentinel(name string) string {
+	return "\n// Make sure gomock is used\nvar _ = " + gomockName(name) + ".Any()\n"
+}
+
+// mergeGenerated combines the generated files in srcs, and the meta file for
+// the package, into a single file.  The comments before the package clause
+// (e.g. build constraints) are taken from the first file, along with the
+// package doc of the meta file (if it has one), and the imports from all of
+// the files are merged into one import declaration.  gomock is the name that
+// the files import gomock as.
+//
+// Files can't always be merged, as they each have their own imports - so
+// false is returned (with no error) if the files import different packages
+// with the same name, dot import a package, use cgo, or have differing build
+// constraints.  The caller should then write the files out separately.
+func mergeGenerated(srcs [][]byte, meta []byte, gomock string) ([]byte, bool, error) {
+	if len(srcs) == 0 {
+		return nil, false, nil
+	}
+
+	type importSpec struct {
+		name, path string
+	}
+
+	fset := token.NewFileSet()
+	names := make(map[string]string)
+	imports := []importSpec{}
+	seen := make(map[importSpec]bool)
+	bodies := [][]byte{}
+	prefix := []byte{}
+	pkgDoc := []byte{}
+	pkgName := ""
+	constraints := ""
+
+	all := append(append([][]byte{}, srcs...), meta)
+
+	for i, src := range all {
+		f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+		if err != nil {
+			return nil, false, err
+		}
+
+		lines := []string{}
+		for _, cg := range f.Comments {
+			if cg.Pos() >= f.Package {
+				break
+			}
+			for _, c := range cg.List {
+				if constraint.IsGoBuild(c.Text) || constraint.IsPlusBuild(c.Text) {
+					lines = append(lines, c.Text)
+				}
+			}
+		}
+
+		if i == len(srcs) && f.Doc != nil {
+			// The meta file only has a package doc if one was asked for
+			start := fset.Position(f.Doc.Pos()).Offset
+			end := fset.Position(f.Doc.End()).Offset
+			pkgDoc = append(src[start:end:end], '\n')
+		}
+
+		if i == 0 {
+			prefix = src[:fset.Position(f.Package).Offset]
+			pkgName = f.Name.Name
+			constraints = strings.Join(lines, "\n")
+		} else if i < len(srcs) && strings.Join(lines, "\n") != constraints {
+			// The meta file is only needed if the other files are used, so
+			// it doesn't matter if its constraints are different.
+			return nil, false, nil
+		}
+
+		for _, spec := range f.Imports {
+			imp := importSpec{path: strings.Trim(spec.Path.Value, "\"")}
+			if spec.Name != nil {
+				imp.name = spec.Name.Name
+			}
+			if imp.path == "C" || imp.name == "." {
+				return nil, false, nil
+			}
+			if imp.name != "" && imp.name != "_" {
+				if path, found := names[imp.name]; found && path != imp.path {
+					return nil, false, nil
+				}
+				names[imp.name] = imp.path
+			}
+			if !seen[imp] {
+				seen[imp] = true
+				imports = append(imports, imp)
+			}
+		}
+
+		// The body is everything after the imports (or the package clause if
+		// there aren't any).
+		end := f.Name.End()
+		for _, decl := range f.Decls {
+			if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+				end = d.End()
+			}
+		}
+		body := src[fset.Position(end).Offset:]
+		body = bytes.Replace(body, []byte(gomockSentinel(gomock)), nil, -1)
+		bodies = append(bodies, body)
+	}
+
+	sort.Slice(imports, func(i, j int) bool {
+		if imports[i].path != imports[j].path {
+			return imports[i].path < imports[j].path
+		}
+		return imports[i].name < imports[j].name
+	})
+
+	out := &bytes.Buffer{}
+	out.Write(prefix)
+	out.Write(pkgDoc)
+	fmt.Fprintf(out, "package %s\n\n", pkgName)
+	fmt.Fprintf(out, "import (\n")
+	for _, imp := range imports {
+		fmt.Fprintf(out, "\t")
+		if imp.name != "" {
+			fmt.Fprintf(out, "%s ", imp.name)
+		}
+		fmt.Fprintf(out, "%q\n", imp.path)
+	}
+	fmt.Fprintf(out, ")\n")
+	for _, body := range bodies {
+		out.Write(body)
+		fmt.Fprintf(out, "\n")
+	}
+	fmt.Fprintf(out, "%s", gomockSentinel(gomock))
+
+	return out.Bytes(), true, nil
+}
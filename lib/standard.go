@@ -43,28 +43,42 @@ func mockFileImports(src, dst string, change map[string]string, cfg *Config) err
 		for _, spec := range g.Specs {
 			s := spec.(*ast.ImportSpec)
 
-			impPath := strings.Trim(s.Path.Value, "\"")
+			orig := strings.Trim(s.Path.Value, "\"")
+			impPath, prefixed := splitMockPrefix(orig)
 			newPath := change[impPath]
 
+			if newPath == "" && prefixed {
+				// Packages that are installed under their own name aren't in
+				// change, but we still need to remove the prefix.
+				newPath = impPath
+			}
+
 			if newPath == "" {
 				// no change needed
 				continue
 			}
 
-			if testFile && getMark(newPath) != testMark {
+			if testFile && !prefixed && getMark(newPath) != testMark {
 				// for test files, we only replace the import if it was marked
 				// to be mocked (as the test code might want the non-mocked
 				// version too), unless the mark is testMark - which means we
 				// are importing the code under test, and we want to make sure
 				// we get the actual code under test, not an unmodified copy.
 				comment := strings.TrimSpace(s.Comment.Text())
-				if strings.ToLower(comment) != "mock" {
+				if strings.ToLower(comment) != "mock" && !cfg.isMocked(impPath) {
 					continue
 				}
 			}
 
+			if len(newPath) < len(orig) {
+				// The rewrites are done in place, so if the original path
+				// was longer (i.e. it had a _mock_/ prefix) then end the
+				// string early and pad out the rest with spaces.
+				newPath += "\"" + strings.Repeat(" ", len(orig)-len(newPath))
+			}
+
 			start := fset.Position(s.Path.Pos()).Offset
-			rewrites = append(rewrites, rewrite{start + 1, change[impPath]})
+			rewrites = append(rewrites, rewrite{start + 1, newPath})
 		}
 	}
 
@@ -89,7 +103,7 @@ func mockFileImports(src, dst string, change map[string]string, cfg *Config) err
 	// Add an init function to setup any mocks, if this is a test file that
 	// needs mocks enabled
 	if strings.HasSuffix(src, "_test.go") {
-		i, err := GetMockedPackages(src)
+		i, err := getMockedPackages(src, cfg)
 		if err != nil {
 			return err
 		}
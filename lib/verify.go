@@ -0,0 +1,95 @@
+// Copyright 2013 Julian Phillips.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// VerifyUpToDate checks that the mock of the package pkgName (found at
+// srcPath) previously generated into dstPath is the same as what MakePkg
+// would generate now (with the same mock and cfg).  The mock is generated
+// into a temporary directory and compared, and the paths (relative to
+// dstPath) of any files that differ, are missing, or shouldn't be there are
+// returned - so the mock is up to date if no paths are returned.
+func VerifyUpToDate(srcPath, dstPath, pkgName string, mock bool, cfg *MockConfig) ([]string, error) {
+	tmpDir, err := ioutil.TempDir("", "withmock-verify")
+	if err != nil {
+		return nil, Cerr{"ioutil.TempDir", err}
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpCfg := *cfg
+	tmpCfg.tempOutput = true
+
+	if _, err := MakePkg(srcPath, tmpDir, pkgName, mock, &tmpCfg); err != nil {
+		return nil, Cerr{"MakePkg", err}
+	}
+
+	expected, err := treeContents(tmpDir)
+	if err != nil {
+		return nil, Cerr{"treeContents", err}
+	}
+
+	actual, err := treeContents(dstPath)
+	if err != nil {
+		return nil, Cerr{"treeContents", err}
+	}
+
+	stale := []string{}
+	for name, contents := range expected {
+		if current, found := actual[name]; !found || current != contents {
+			stale = append(stale, name)
+		}
+	}
+	for name := range actual {
+		if _, found := expected[name]; !found {
+			stale = append(stale, name)
+		}
+	}
+	sort.Strings(stale)
+
+	return stale, nil
+}
+
+// treeContents returns the contents of all of the files under root, keyed by
+// their path relative to root.  Symlinks aren't followed - instead the target
+// is used as the contents (with a prefix to keep it distinct from a file).
+func treeContents(root string) (map[string]string, error) {
+	contents := make(map[string]string)
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			contents[name] = "symlink:" + target
+		case info.Mode().IsRegular():
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			contents[name] = "file:" + string(data)
+		}
+
+		return nil
+	})
+
+	return contents, err
+}
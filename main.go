@@ -22,7 +22,9 @@ var (
 	pkgFile  = flag.String("P", "", "install extra packages listed in the given file")
 	exclFile = flag.String("exclude", "", "any package listed in the given file will not be mocked, even if marked in test code.")
 	cfgFile  = flag.String("c", "", "load config from the specified file")
+	manifest = flag.String("m", "", "mock the packages listed in the specified JSON manifest (instead of -c)")
 	debug    = flag.Bool("debug", false, "enable extra output for debugging mock genertion issues")
+	explain  = flag.Bool("explain", false, "explain why each imported package was (or wasn't) mocked")
 )
 
 func usage() {
@@ -72,6 +74,10 @@ func doit() error {
 		log.SetOutput(w)
 	}
 
+	if *explain {
+		lib.Explainer = log.New(os.Stderr, "withmock: ", 0)
+	}
+
 	// We need at least one argument
 
 	if flag.NArg() < 1 {
@@ -79,6 +85,12 @@ func doit() error {
 		os.Exit(1)
 	}
 
+	// A manifest replaces the config, so only one of them can be given
+
+	if *cfgFile != "" && *manifest != "" {
+		return fmt.Errorf("-c and -m can't be used together")
+	}
+
 	// First we need to create a context
 
 	ctxt, err := lib.NewContext()
@@ -111,6 +123,14 @@ func doit() error {
 		}
 	}
 
+	// Load the manifest if specified
+
+	if *manifest != "" {
+		if err := ctxt.LoadManifest(*manifest); err != nil {
+			return err
+		}
+	}
+
 	// Now we add the package that we want to test to the context, this will
 	// install the imports used by that package (mocking them as approprite).
 
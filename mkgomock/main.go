@@ -14,7 +14,10 @@ import (
 )
 
 var (
-	debug = flag.Bool("debug", false, "enable extra output for debugging mock genertion issues")
+	debug    = flag.Bool("debug", false, "enable extra output for debugging mock genertion issues")
+	buildTag = flag.String("tag", "", "only build the generated files when the given build tag is set")
+	ifOnly   = flag.Bool("interfaces", false, "only generate mocks for the interfaces, in a package that imports the real one")
+	verify   = flag.Bool("verify", false, "check that the mocks already in the destination are up to date, instead of generating them")
 )
 
 func main() {
@@ -36,8 +39,26 @@ func main() {
 	srcPath, dstPath, impPath := args[1], args[2], args[3]
 
 	cfg := &lib.MockConfig{
-		MOCK:   "MOCK",
-		EXPECT: "EXPECT",
+		MOCK:              "MOCK",
+		EXPECT:            "EXPECT",
+		ObjEXPECT:         "EXPECT",
+		GeneratedBuildTag: *buildTag,
+		InterfaceOnly:     *ifOnly,
+	}
+
+	if *verify {
+		stale, err := lib.VerifyUpToDate(srcPath, dstPath, impPath, true, cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+			os.Exit(1)
+		}
+		for _, name := range stale {
+			fmt.Printf("%s\n", name)
+		}
+		if len(stale) > 0 {
+			os.Exit(1)
+		}
+		return
 	}
 
 	_, err := lib.MakePkg(srcPath, dstPath, impPath, true, cfg)
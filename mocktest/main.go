@@ -25,7 +25,9 @@ var (
 	pkgFile  = flag.String("P", "", "install extra packages listed in the given file")
 	exclFile = flag.String("exclude", "", "any package listed in the given file will not be mocked, even if marked in test code.")
 	cfgFile  = flag.String("c", "", "load config from the specified file")
+	manifest = flag.String("m", "", "mock the packages listed in the specified JSON manifest (instead of -c)")
 	debug    = flag.Bool("debug", false, "enable extra output for debugging mock genertion issues")
+	explain  = flag.Bool("explain", false, "explain why each imported package was (or wasn't) mocked")
 )
 
 func usage() {
@@ -75,6 +77,16 @@ func doit() error {
 		log.SetOutput(w)
 	}
 
+	if *explain {
+		lib.Explainer = log.New(os.Stderr, "mocktest: ", 0)
+	}
+
+	// A manifest replaces the config, so only one of them can be given
+
+	if *cfgFile != "" && *manifest != "" {
+		return fmt.Errorf("-c and -m can't be used together")
+	}
+
 	args := flag.Args()
 	if len(args) == 0 {
 		args = []string{"."}
@@ -135,6 +147,14 @@ func doit() error {
 		}
 	}
 
+	// Load the manifest if specified
+
+	if *manifest != "" {
+		if err := ctxt.LoadManifest(*manifest); err != nil {
+			return lib.Cerr{"LoadManifest", err}
+		}
+	}
+
 	// Start building the command string that we will run
 
 	command := "go"
@@ -0,0 +1,29 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/anon_struct/lib"
+)
+
+func TryMe() string {
+	return lib.Describe(struct {
+		A int
+		B string
+	}{1, "x"})
+}
+
+func Sum() int {
+	d := lib.Defaults()
+	return d.A + d.B
+}
+
+func Apply(t *lib.Thing) int {
+	return t.Apply(struct{ Verbose bool }{true}, struct{ N int }{1}).Count
+}
+
+func Configure(o lib.Options) error {
+	o.Set(struct{ Key, Value string }{"k", "v"})
+	return o.Configure(struct {
+		Name string
+		Size int
+	}{"n", 1})
+}
@@ -0,0 +1,70 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/anon_struct/lib" // mock
+)
+
+func TestTryMe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+	lib.EXPECT().Describe(struct {
+		A int
+		B string
+	}{1, "x"}).Return("mocked")
+	lib.EXPECT().Defaults().Return(struct{ A, B int }{3, 4})
+
+	if s := TryMe(); s != "mocked" {
+		t.Errorf("Expected mocked, got %s", s)
+	}
+
+	if n := Sum(); n != 7 {
+		t.Errorf("Expected 7, got %d", n)
+	}
+}
+
+func TestApply(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	thing := &lib.Thing{}
+	thing.EXPECT().Apply(struct{ Verbose bool }{true}, struct{ N int }{1}).Return(struct {
+		Applied bool
+		Count   int
+	}{true, 5})
+
+	if n := Apply(thing); n != 5 {
+		t.Errorf("Expected 5, got %d", n)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	o := lib.MOCK().NewOptions()
+	o.EXPECT().Set(struct{ Key, Value string }{"k", "v"})
+	o.EXPECT().Configure(gomock.Any()).Return(nil)
+
+	if err := Configure(o); err != nil {
+		t.Errorf("Unexpected error return: %s", err)
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if s := TryMe(); s != "1:x" {
+		t.Errorf("Expected 1:x, got %s", s)
+	}
+}
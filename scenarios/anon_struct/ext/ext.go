@@ -0,0 +1,8 @@
+package ext
+
+type Configurer interface {
+	Configure(opts struct {
+		Name string
+		Size int
+	}) error
+}
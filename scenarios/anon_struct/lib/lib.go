@@ -0,0 +1,34 @@
+package lib
+
+import (
+	"fmt"
+
+	"github.com/qur/withmock/scenarios/anon_struct/ext"
+)
+
+func Describe(opts struct {
+	A int
+	B string
+}) string {
+	return fmt.Sprintf("%d:%s", opts.A, opts.B)
+}
+
+func Defaults() struct{ A, B int } {
+	return struct{ A, B int }{1, 2}
+}
+
+type Thing struct{}
+
+func (t *Thing) Apply(opts struct{ Verbose bool }, extra ...struct{ N int }) (res struct {
+	Applied bool
+	Count   int
+}) {
+	res.Applied = true
+	res.Count = len(extra)
+	return
+}
+
+type Options interface {
+	ext.Configurer
+	Set(opts struct{ Key, Value string })
+}
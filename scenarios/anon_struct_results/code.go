@@ -0,0 +1,32 @@
+package code
+
+import (
+	"fmt"
+
+	"github.com/qur/withmock/scenarios/anon_struct_results/lib"
+)
+
+func Describe(name string) string {
+	s, err := lib.Stats(name)
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("%s:%d", s.B, s.A)
+}
+
+func Sum() int {
+	p := lib.Point()
+	return p.X + p.Y
+}
+
+func Label() string {
+	return lib.Stamp().Label
+}
+
+func First(src lib.Source) string {
+	v, ok := src.Next()
+	if !ok {
+		return "none"
+	}
+	return fmt.Sprintf("%d=%s", v.ID, v.Name)
+}
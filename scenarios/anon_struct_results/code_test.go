@@ -0,0 +1,76 @@
+package code
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/anon_struct_results/lib" // mock
+)
+
+func TestMocked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	lib.EXPECT().Stats("x").Return(struct {
+		A int
+		B string
+	}{42, "mocked"}, nil)
+
+	if s := Describe("x"); s != "mocked:42" {
+		t.Errorf("Expected mocked:42, got %q", s)
+	}
+
+	lib.EXPECT().Point().Return(struct{ X, Y int }{3, 4})
+
+	if n := Sum(); n != 7 {
+		t.Errorf("Expected 7, got %d", n)
+	}
+
+	lib.EXPECT().Stamp().Return(&struct {
+		time.Duration
+		Label string `json:"label"`
+	}{time.Minute, "mocked"})
+
+	if l := Label(); l != "mocked" {
+		t.Errorf("Expected mocked, got %q", l)
+	}
+
+	src := lib.NewMockSource(ctrl)
+	src.EXPECT().Next().Return(struct {
+		ID   int
+		Name string
+	}{1, "one"}, true)
+
+	if s := First(src); s != "1=one" {
+		t.Errorf("Expected 1=one, got %q", s)
+	}
+
+	c := &lib.Counter{}
+	c.EXPECT().Pair().Return(struct{ A, B int }{5, 6}, nil)
+
+	if p, _ := c.Pair(); p.A != 5 || p.B != 6 {
+		t.Errorf("Expected {5 6}, got %v", p)
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if s := Describe("abc"); s != "abc:3" {
+		t.Errorf("Expected abc:3, got %q", s)
+	}
+	if s := Describe(""); s != "no name" {
+		t.Errorf("Expected no name, got %q", s)
+	}
+	if n := Sum(); n != 3 {
+		t.Errorf("Expected 3, got %d", n)
+	}
+	if l := Label(); l != "one" {
+		t.Errorf("Expected one, got %q", l)
+	}
+}
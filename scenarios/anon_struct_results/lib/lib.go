@@ -0,0 +1,50 @@
+package lib
+
+import (
+	"errors"
+	"time"
+)
+
+func Stats(name string) (struct {
+	A int
+	B string
+}, error) {
+	if name == "" {
+		return struct {
+			A int
+			B string
+		}{}, errors.New("no name")
+	}
+	return struct {
+		A int
+		B string
+	}{len(name), name}, nil
+}
+
+func Point() struct{ X, Y int } {
+	return struct{ X, Y int }{1, 2}
+}
+
+// Stamp has an embedded field and a tag.
+func Stamp() *struct {
+	time.Duration
+	Label string `json:"label"`
+} {
+	return &struct {
+		time.Duration
+		Label string `json:"label"`
+	}{time.Second, "one"}
+}
+
+type Source interface {
+	Next() (struct {
+		ID   int
+		Name string
+	}, bool)
+}
+
+type Counter struct{}
+
+func (c *Counter) Pair() (struct{ A, B int }, error) {
+	return struct{ A, B int }{1, 2}, nil
+}
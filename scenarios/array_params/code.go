@@ -0,0 +1,15 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/array_params/ext"
+	"github.com/qur/withmock/scenarios/array_params/lib"
+)
+
+func Save(s *lib.Store, a, b, c lib.Item) int {
+	counts := s.Batch([lib.N]lib.Item{a, b, c})
+	return counts[0] + counts[1]
+}
+
+func Shift(s lib.Shape) [ext.Width]ext.Point {
+	return s.Move(lib.Origin())
+}
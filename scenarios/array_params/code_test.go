@@ -0,0 +1,47 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/array_params/ext"
+	"github.com/qur/withmock/scenarios/array_params/lib" // mock
+)
+
+func TestSave(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	a := lib.Item{ID: 1, Name: "a"}
+	b := lib.Item{ID: 2, Name: "b"}
+	c := lib.Item{ID: 3, Name: "c"}
+
+	// Arrays are values, so the expectation matches a different array with
+	// the same contents.
+	s := &lib.Store{}
+	s.EXPECT().Batch([lib.N]lib.Item{a, b, c}).Return([2]int{2, 1})
+
+	if n := Save(s, a, b, c); n != 3 {
+		t.Errorf("Expected 3, got %d", n)
+	}
+}
+
+func TestShift(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	points := [ext.Width]ext.Point{{X: 1, Y: 1}, {X: 2, Y: 2}}
+
+	shape := lib.MOCK().NewShape()
+	lib.EXPECT().Origin().Return([ext.Width]int{1, 1})
+	shape.EXPECT().Move([ext.Width]int{1, 1}).Return(points)
+
+	if p := Shift(shape); p != points {
+		t.Errorf("Expected %v, got %v", points, p)
+	}
+}
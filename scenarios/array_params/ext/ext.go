@@ -0,0 +1,12 @@
+package ext
+
+const Width = 2
+
+type Point struct {
+	X, Y int
+}
+
+type Shape interface {
+	Corners() [Width]Point
+	Move(by [Width]int) [Width]Point
+}
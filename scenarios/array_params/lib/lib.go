@@ -0,0 +1,26 @@
+package lib
+
+import (
+	"github.com/qur/withmock/scenarios/array_params/ext"
+)
+
+const N = 3
+
+type Item struct {
+	ID   int
+	Name string
+}
+
+type Store struct{}
+
+func (s *Store) Batch(items [N]Item) [2]int {
+	return [2]int{}
+}
+
+func Origin() [ext.Width]int {
+	return [ext.Width]int{}
+}
+
+type Shape interface {
+	ext.Shape
+}
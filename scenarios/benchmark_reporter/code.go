@@ -0,0 +1,13 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/benchmark_reporter/lib"
+)
+
+func Total(g lib.Getter, keys ...string) int {
+	total := 0
+	for _, key := range keys {
+		total += g.Get(key) + lib.Lookup(key)
+	}
+	return total
+}
@@ -0,0 +1,75 @@
+package code
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/benchmark_reporter/lib" // mock
+)
+
+func benchmarkTotal(b *testing.B) {
+	ctrl := gomock.NewController(b)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	g := lib.NewMockGetter(ctrl)
+	g.EXPECT().Get("a").Return(1).Times(b.N)
+	lib.EXPECT().Lookup("a").Return(2).Times(b.N)
+
+	for i := 0; i < b.N; i++ {
+		if n := Total(g, "a"); n != 3 {
+			b.Fatalf("Expected 3, got %d", n)
+		}
+	}
+}
+
+func BenchmarkTotal(b *testing.B) {
+	benchmarkTotal(b)
+}
+
+// TestBenchmark runs the benchmark as part of the normal tests, to make sure
+// that the mocks work with a *testing.B.
+func TestBenchmark(t *testing.T) {
+	if r := testing.Benchmark(benchmarkTotal); r.N == 0 {
+		t.Errorf("Expected the benchmark to run")
+	}
+}
+
+// reporter is a gomock.TestReporter that isn't part of the testing package.
+type reporter struct {
+	errors []string
+}
+
+func (r *reporter) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *reporter) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+}
+
+func TestCustomReporter(t *testing.T) {
+	r := &reporter{}
+	ctrl := gomock.NewController(r)
+
+	lib.MOCK().SetController(ctrl)
+
+	g := lib.NewMockGetter(ctrl)
+	g.EXPECT().Get("a").Return(1)
+	lib.EXPECT().Lookup("a").Return(2)
+	lib.EXPECT().Lookup("b").Return(3)
+
+	if n := Total(g, "a"); n != 3 {
+		t.Errorf("Expected 3, got %d", n)
+	}
+
+	// The missing call to Lookup("b") is reported to our reporter
+	ctrl.Finish()
+
+	if len(r.errors) == 0 {
+		t.Errorf("Expected the missing call to be reported")
+	}
+}
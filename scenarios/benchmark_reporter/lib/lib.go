@@ -0,0 +1,17 @@
+package lib
+
+type Getter interface {
+	Get(key string) int
+}
+
+func Lookup(key string) int {
+	return len(key)
+}
+
+type Cache struct {
+	values map[string]int
+}
+
+func (c *Cache) Get(key string) int {
+	return c.values[key]
+}
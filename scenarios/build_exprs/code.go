@@ -0,0 +1,9 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/build_exprs/lib"
+)
+
+func TryMe() string {
+	return lib.Common() + "/" + lib.Kind() + "/" + lib.Family()
+}
@@ -0,0 +1,58 @@
+package code
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/build_exprs/lib" // mock
+)
+
+func expectedKind() string {
+	switch runtime.GOOS + "/" + runtime.GOARCH {
+	case "linux/amd64", "darwin/arm64":
+		return "primary"
+	}
+	return "secondary"
+}
+
+func expectedFamily() string {
+	switch runtime.GOOS {
+	case "windows", "plan9", "js", "wasip1":
+		return "other"
+	case "linux":
+		if runtime.GOARCH == "386" {
+			return "other"
+		}
+	}
+	return "unix"
+}
+
+func TestRealFiles(t *testing.T) {
+	// Only the files whose constraints match the platform are used, so the
+	// real functions report which ones were picked.
+	lib.MOCK().MockAll(false)
+
+	expected := "common/" + expectedKind() + "/" + expectedFamily()
+	if s := TryMe(); s != expected {
+		t.Errorf("Expected %q, got %q", expected, s)
+	}
+}
+
+func TestTryMe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+	lib.MOCK().MockAll(true)
+	defer lib.MOCK().MockAll(false)
+
+	lib.EXPECT().Common().Return("a")
+	lib.EXPECT().Kind().Return("b")
+	lib.EXPECT().Family().Return("c")
+
+	if s := TryMe(); s != "a/b/c" {
+		t.Errorf("Expected \"a/b/c\", got %q", s)
+	}
+}
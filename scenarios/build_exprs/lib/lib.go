@@ -0,0 +1,5 @@
+package lib
+
+func Common() string {
+	return "common"
+}
@@ -0,0 +1,7 @@
+//go:build (linux && amd64) || (darwin && arm64)
+
+package lib
+
+func Kind() string {
+	return "primary"
+}
@@ -0,0 +1,7 @@
+//go:build unix && !(linux && 386)
+
+package lib
+
+func Family() string {
+	return "unix"
+}
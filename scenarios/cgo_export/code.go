@@ -0,0 +1,9 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/cgo_export/lib"
+)
+
+func TryMe() int {
+	return lib.Compute(4)
+}
@@ -0,0 +1,37 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/cgo_export/lib" // mock
+)
+
+func TestTryMe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+	lib.EXPECT().Compute(4).Return(100)
+
+	if n := TryMe(); n != 100 {
+		t.Errorf("Expected 100, got %d", n)
+	}
+}
+
+func TestTryMeReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if n := TryMe(); n != 8 {
+		t.Errorf("Expected 8, got %d", n)
+	}
+}
+
+func TestDouble(t *testing.T) {
+	// Functions exported to C can't be mocked, so Double is always real
+	if n := lib.Double(4); n != 8 {
+		t.Errorf("Expected 8, got %d", n)
+	}
+}
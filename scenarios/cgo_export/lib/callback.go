@@ -0,0 +1,14 @@
+package lib
+
+/*
+extern int Double(int);
+
+static int callDouble(int x) {
+	return Double(x);
+}
+*/
+import "C"
+
+func Compute(x int) int {
+	return int(C.callDouble(C.int(x)))
+}
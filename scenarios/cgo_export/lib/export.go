@@ -0,0 +1,8 @@
+package lib
+
+import "C"
+
+//export Double
+func Double(x int32) int32 {
+	return x * 2
+}
@@ -0,0 +1,16 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/chan_dir/ext"
+	"github.com/qur/withmock/scenarios/chan_dir/lib"
+)
+
+func Publish(b lib.Bus, name string) {
+	lib.Send(b.Sink(), name)
+}
+
+func Listen(b lib.Bus) chan *ext.Event {
+	c := make(chan *ext.Event, 1)
+	b.Subscribe(c)
+	return c
+}
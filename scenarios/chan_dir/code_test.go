@@ -0,0 +1,53 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/chan_dir/ext"
+	"github.com/qur/withmock/scenarios/chan_dir/lib" // mock
+)
+
+func TestPublish(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	c := make(chan ext.Event, 1)
+
+	b := lib.MOCK().NewBus()
+	b.EXPECT().Sink().Return((chan<- ext.Event)(c))
+	lib.EXPECT().Send((chan<- ext.Event)(c), "hello")
+
+	Publish(b, "hello")
+}
+
+func TestListen(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	b := lib.MOCK().NewBus()
+	b.EXPECT().Subscribe(gomock.Any()).Do(func(c chan<- *ext.Event) {
+		c <- &ext.Event{Name: "event"}
+	})
+
+	if e := <-Listen(b); e.Name != "event" {
+		t.Errorf("Expected event, got %s", e.Name)
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	c := make(chan ext.Event, 1)
+	lib.Send(c, "real")
+
+	if e := <-c; e.Name != "real" {
+		t.Errorf("Expected real, got %s", e.Name)
+	}
+}
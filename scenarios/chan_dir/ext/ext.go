@@ -0,0 +1,11 @@
+package ext
+
+type Event struct {
+	Name string
+}
+
+type Source interface {
+	Events() <-chan Event
+	Sink() chan<- Event
+	Subscribe(c chan<- *Event)
+}
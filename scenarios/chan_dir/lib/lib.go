@@ -0,0 +1,14 @@
+package lib
+
+import (
+	"github.com/qur/withmock/scenarios/chan_dir/ext"
+)
+
+type Bus interface {
+	ext.Source
+	Close()
+}
+
+func Send(c chan<- ext.Event, name string) {
+	c <- ext.Event{Name: name}
+}
@@ -0,0 +1,19 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/chan_funcs/ext"
+	"github.com/qur/withmock/scenarios/chan_funcs/lib"
+)
+
+func Next(w lib.Worker) string {
+	return (<-w.Tasks())().Name
+}
+
+func Names(w lib.Worker) []string {
+	names := []string{}
+	w.Each(func(t ext.Task) error {
+		names = append(names, t.Name)
+		return nil
+	})
+	return names
+}
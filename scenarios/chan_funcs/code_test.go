@@ -0,0 +1,44 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/chan_funcs/ext"
+	"github.com/qur/withmock/scenarios/chan_funcs/lib" // mock
+)
+
+func TestNext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	c := make(chan func() ext.Task, 1)
+	c <- func() ext.Task { return ext.Task{Name: "task"} }
+
+	w := lib.MOCK().NewWorker()
+	w.EXPECT().Tasks().Return(c)
+
+	if name := Next(w); name != "task" {
+		t.Errorf("Expected task, got %s", name)
+	}
+}
+
+func TestNames(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	w := lib.MOCK().NewWorker()
+	w.EXPECT().Each(gomock.Any()).Do(func(f func(ext.Task) error) {
+		f(ext.Task{Name: "a"})
+		f(ext.Task{Name: "b"})
+	})
+
+	if names := Names(w); len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Errorf("Expected [a b], got %v", names)
+	}
+}
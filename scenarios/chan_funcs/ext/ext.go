@@ -0,0 +1,11 @@
+package ext
+
+type Task struct {
+	Name string
+}
+
+type Queue interface {
+	Tasks() chan func() Task
+	Each(f func(t Task) error) error
+	Results() <-chan func(Task) (Task, error)
+}
@@ -0,0 +1,10 @@
+package lib
+
+import (
+	"github.com/qur/withmock/scenarios/chan_funcs/ext"
+)
+
+type Worker interface {
+	ext.Queue
+	Stop()
+}
@@ -0,0 +1,9 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/comments/lib"
+)
+
+func TryMe() error {
+	return lib.Wibble(lib.Default)
+}
@@ -0,0 +1,94 @@
+package code
+
+import (
+	"go/build"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/comments/lib" // mock
+)
+
+func TestTryMe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+	lib.EXPECT().Wibble(5).Return(nil)
+
+	if err := TryMe(); err != nil {
+		t.Errorf("Unexpected error return: %s", err)
+	}
+}
+
+func TestComments(t *testing.T) {
+	// Find the source of the (mocked) package we are using
+	pkg, err := build.Import("github.com/qur/withmock/scenarios/comments/lib", ".", build.FindOnly)
+	if err != nil {
+		t.Fatalf("Failed to find lib: %s", err)
+	}
+
+	isLib := func(info os.FileInfo) bool {
+		return info.Name() == "lib.go"
+	}
+
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, pkg.Dir, isLib, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("Failed to parse lib: %s", err)
+	}
+
+	// Note: doc.New takes ownership of the AST, so grab the comments first
+	found := map[string]bool{}
+	for _, f := range pkgs["lib"].Files {
+		for _, cg := range f.Comments {
+			found[strings.TrimSpace(cg.Text())] = true
+		}
+	}
+
+	p := doc.New(pkgs["lib"], pkg.ImportPath, doc.AllDecls)
+
+	docs := map[string]string{}
+	for _, v := range append(p.Consts, p.Vars...) {
+		for _, name := range v.Names {
+			docs[name] = v.Doc
+		}
+	}
+	for _, f := range p.Funcs {
+		docs[f.Name] = f.Doc
+	}
+	for _, typ := range p.Types {
+		docs[typ.Name] = typ.Doc
+		for _, m := range typ.Methods {
+			docs[typ.Name+"."+m.Name] = m.Doc
+		}
+	}
+
+	expected := map[string]string{
+		"Limit":     "Limit is the largest value Wibble will accept.",
+		"Default":   "Default is the value used when none is given.",
+		"Thing":     "Thing is a thing.",
+		"Other":     "Other is another thing.",
+		"Wibble":    "Wibble checks that value is within Limit.",
+		"Thing.Get": "Get returns the value of the thing.",
+		"helper":    "helper is not exported.",
+	}
+
+	for name, want := range expected {
+		if got := strings.TrimSpace(docs[name]); got != want {
+			t.Errorf("%s: expected doc %q, got %q", name, want, got)
+		}
+	}
+
+	// Check the spec level comments made it too
+	for _, want := range []string{"Small is a small value.", "Large is a large value.", "This comment is inside the body."} {
+		if !found[want] {
+			t.Errorf("Expected to find comment %q", want)
+		}
+	}
+}
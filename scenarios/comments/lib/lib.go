@@ -0,0 +1,47 @@
+// Package lib is used to check that comments are preserved.
+package lib
+
+import (
+	"fmt"
+)
+
+// Limit is the largest value Wibble will accept.
+const Limit = 10
+
+const (
+	// Small is a small value.
+	Small = 1
+	Large = 100 // Large is a large value.
+)
+
+// Default is the value used when none is given.
+var Default = 5
+
+// Thing is a thing.
+type Thing struct {
+	Value int
+}
+
+type (
+	// Other is another thing.
+	Other int
+)
+
+// Wibble checks that value is within Limit.
+func Wibble(value int) error {
+	// This comment is inside the body.
+	if value > Limit {
+		return fmt.Errorf("Too big!")
+	}
+	return nil
+}
+
+// Get returns the value of the thing.
+func (t *Thing) Get() int {
+	return t.Value
+}
+
+// helper is not exported.
+func helper() int {
+	return Default
+}
@@ -0,0 +1,9 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/composite_vars/lib"
+)
+
+func TryMe() int {
+	return lib.Count()
+}
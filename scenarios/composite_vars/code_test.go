@@ -0,0 +1,62 @@
+package code
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/composite_vars/lib" // mock
+)
+
+func TestTryMe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+	lib.EXPECT().Count().Return(5)
+
+	if n := TryMe(); n != 5 {
+		t.Errorf("Expected 5, got %d", n)
+	}
+}
+
+func TestValues(t *testing.T) {
+	if p := []lib.Point{{1, 2}, {3, 4}}; !reflect.DeepEqual(lib.Points, p) {
+		t.Errorf("Points: expected %v, got %v", p, lib.Points)
+	}
+
+	pp := []*lib.Point{{X: 1}, nil, {Y: 2}}
+	if !reflect.DeepEqual(lib.PointPtrs, pp) {
+		t.Errorf("PointPtrs: expected %v, got %v", pp, lib.PointPtrs)
+	}
+
+	if g := [][]int{{1}, {2, 3}, {}}; !reflect.DeepEqual(lib.Grid, g) {
+		t.Errorf("Grid: expected %v, got %v", g, lib.Grid)
+	}
+
+	g := map[string][]int{"a": {1, 2}, "b": {}}
+	if !reflect.DeepEqual(lib.Groups, g) {
+		t.Errorf("Groups: expected %v, got %v", g, lib.Groups)
+	}
+
+	bp := map[lib.Point][]lib.Point{
+		{0, 0}: {{1, 1}},
+		{1, 1}: {{2, 2}, {3, 3}},
+	}
+	if !reflect.DeepEqual(lib.ByPoint, bp) {
+		t.Errorf("ByPoint: expected %v, got %v", bp, lib.ByPoint)
+	}
+
+	s := []lib.Shape{
+		{
+			Name:   "line",
+			Points: []lib.Point{{0, 0}, {1, 1}},
+			Tags:   map[string][]string{"kind": {"straight", "short"}},
+		},
+		{Name: "empty"},
+	}
+	if !reflect.DeepEqual(lib.Shapes, s) {
+		t.Errorf("Shapes: expected %v, got %v", s, lib.Shapes)
+	}
+}
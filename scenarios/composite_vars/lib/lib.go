@@ -0,0 +1,40 @@
+package lib
+
+type Point struct {
+	X, Y int
+}
+
+type Shape struct {
+	Name   string
+	Points []Point
+	Tags   map[string][]string
+}
+
+var Points = []Point{{1, 2}, {3, 4}}
+
+var PointPtrs = []*Point{{X: 1}, nil, {Y: 2}}
+
+var Grid = [][]int{{1}, {2, 3}, {}}
+
+var Groups = map[string][]int{
+	"a": {1, 2},
+	"b": {},
+}
+
+var ByPoint = map[Point][]Point{
+	{0, 0}: {{1, 1}},
+	{1, 1}: {{2, 2}, {3, 3}},
+}
+
+var Shapes = []Shape{
+	{
+		Name:   "line",
+		Points: []Point{{0, 0}, {1, 1}},
+		Tags:   map[string][]string{"kind": {"straight", "short"}},
+	},
+	{Name: "empty"},
+}
+
+func Count() int {
+	return len(Shapes)
+}
@@ -0,0 +1,10 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/const_exprs/lib"
+)
+
+func Total(buf *lib.Buffer) int {
+	small, large := buf.Small(), buf.Large()
+	return len(small) + len(large)
+}
@@ -0,0 +1,39 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/const_exprs/lib" // mock
+)
+
+func TestTotal(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	// The mock writes the array lengths out again from the signatures, so
+	// "a - -b" must not become "a--b".
+	buf := &lib.Buffer{}
+	buf.EXPECT().Small().Return([3]byte{})
+	buf.EXPECT().Large().Return([7]byte{})
+
+	if n := Total(buf); n != 10 {
+		t.Errorf("Expected 10, got %d", n)
+	}
+}
+
+func TestSizes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if x, y := lib.Sizes(); x != 3 || y != 7 {
+		t.Errorf("Expected 3, 7, got %d, %d", x, y)
+	}
+}
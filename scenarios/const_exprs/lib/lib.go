@@ -0,0 +1,22 @@
+package lib
+
+const (
+	a = 5
+	b = 2
+)
+
+const x = a + -b
+
+type Buffer struct{}
+
+func (buf *Buffer) Small() [a + -b]byte {
+	return [x]byte{}
+}
+
+func (buf *Buffer) Large() [a - -b]byte {
+	return [a - -b]byte{}
+}
+
+func Sizes() (int, int) {
+	return x, a - -b
+}
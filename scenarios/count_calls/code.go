@@ -0,0 +1,21 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/count_calls/lib"
+)
+
+func PingAll(hosts ...string) int {
+	up := 0
+	for _, host := range hosts {
+		if lib.Ping(host) {
+			up++
+		}
+	}
+	return up
+}
+
+func Warm(c *lib.Cache, keys ...string) {
+	for _, key := range keys {
+		c.Get(key)
+	}
+}
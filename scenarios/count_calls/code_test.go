@@ -0,0 +1,60 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/count_calls/lib" // mock
+)
+
+func TestCallCount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	lib.EXPECT().Ping(gomock.Any()).Return(true).AnyTimes()
+	if n := PingAll("a", "b", "c"); n != 3 {
+		t.Errorf("Expected 3 hosts up, got %d", n)
+	}
+	if n := lib.MOCK().CallCount("Ping"); n != 3 {
+		t.Errorf("Expected 3 calls to Ping, got %d", n)
+	}
+
+	c := &lib.Cache{}
+	c.EXPECT().Get(gomock.Any()).Return("").AnyTimes()
+	Warm(c, "x", "y")
+	if n := lib.MOCK().CallCount("Cache.Get"); n != 2 {
+		t.Errorf("Expected 2 calls to Cache.Get, got %d", n)
+	}
+
+	if n := lib.MOCK().CallCount("Missing"); n != 0 {
+		t.Errorf("Expected no calls to Missing, got %d", n)
+	}
+}
+
+func TestCallCountReset(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	lib.EXPECT().Ping("a").Return(true)
+	PingAll("a")
+	if n := lib.MOCK().CallCount("Ping"); n != 1 {
+		t.Errorf("Expected 1 call to Ping, got %d", n)
+	}
+
+	// Real calls aren't counted, and MockAll starts the counts again
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if n := lib.MOCK().CallCount("Ping"); n != 0 {
+		t.Errorf("Expected the count to be reset, got %d", n)
+	}
+	PingAll("a", "b")
+	if n := lib.MOCK().CallCount("Ping"); n != 0 {
+		t.Errorf("Expected real calls not to be counted, got %d", n)
+	}
+}
@@ -0,0 +1,11 @@
+package lib
+
+func Ping(host string) bool {
+	return host != ""
+}
+
+type Cache struct{}
+
+func (c *Cache) Get(key string) string {
+	return key
+}
@@ -0,0 +1,11 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/dot_import/constraints"
+	"github.com/qur/withmock/scenarios/dot_import/lib"
+)
+
+func TryMe(l lib.Labeller) string {
+	i := constraints.Item{Name: "x"}
+	return l.Name(i) + ":" + l.Label(i) + ":" + lib.Name(lib.Default)
+}
@@ -0,0 +1,37 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/dot_import/constraints"
+	"github.com/qur/withmock/scenarios/dot_import/lib" // mock
+)
+
+func TestTryMe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	i := constraints.Item{Name: "x"}
+
+	l := lib.MOCK().NewLabeller()
+	l.EXPECT().Name(i).Return("name")
+	l.EXPECT().Label(i).Return("label")
+	lib.EXPECT().Name(lib.Default).Return("mocked")
+
+	if s := TryMe(l); s != "name:label:mocked" {
+		t.Errorf("Expected name:label:mocked, got %s", s)
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if s := lib.Name(lib.Default); s != "default" {
+		t.Errorf("Expected default, got %s", s)
+	}
+}
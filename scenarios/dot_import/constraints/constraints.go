@@ -0,0 +1,13 @@
+package constraints
+
+type Ordered interface {
+	~int | ~float64 | ~string
+}
+
+type Item struct {
+	Name string
+}
+
+type Namer interface {
+	Name(i Item) string
+}
@@ -0,0 +1,20 @@
+package lib
+
+import (
+	. "github.com/qur/withmock/scenarios/dot_import/constraints"
+)
+
+type Number interface {
+	~int | Ordered
+}
+
+type Labeller interface {
+	Namer
+	Label(i Item) string
+}
+
+var Default = Item{Name: "default"}
+
+func Name(i Item) string {
+	return i.Name
+}
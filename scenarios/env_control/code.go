@@ -0,0 +1,9 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/env_control/lib"
+)
+
+func Double() int {
+	return 2 * lib.Answer()
+}
@@ -0,0 +1,48 @@
+package code
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/env_control/lib" // mock
+)
+
+type panicReporter struct{}
+
+func (panicReporter) Errorf(format string, args ...interface{}) {
+	panic(fmt.Sprintf(format, args...))
+}
+
+func (panicReporter) Fatalf(format string, args ...interface{}) {
+	panic(fmt.Sprintf(format, args...))
+}
+
+// mockedAtInit records if lib was mocked before the init function added to
+// this file by withmock (which enables all the mocks) is run - so it can only
+// have been turned on by WITHMOCK_ENABLE.
+var mockedAtInit = func() bool {
+	lib.MOCK().SetController(gomock.NewController(panicReporter{}))
+	lib.EXPECT().Answer().Return(1).AnyTimes()
+	return lib.Answer() == 1
+}()
+
+func TestEnvControl(t *testing.T) {
+	if !mockedAtInit {
+		t.Errorf("Expected WITHMOCK_ENABLE to turn on mocking of lib")
+	}
+}
+
+func TestDouble(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	lib.EXPECT().Answer().Return(2)
+
+	if n := Double(); n != 4 {
+		t.Errorf("Expected 4, got %d", n)
+	}
+}
@@ -0,0 +1,10 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/exclude_subpkgs/lib"
+	"github.com/qur/withmock/scenarios/exclude_subpkgs/lib/real"
+)
+
+func TryMe() int {
+	return lib.Wibble() + real.Value()
+}
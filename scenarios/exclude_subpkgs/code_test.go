@@ -0,0 +1,46 @@
+package code
+
+import (
+	"go/build"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/exclude_subpkgs/lib" // mock
+)
+
+func TestTryMe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+	lib.EXPECT().Wibble().Return(10)
+
+	if n := TryMe(); n != 11 {
+		t.Errorf("Expected 11, got %d", n)
+	}
+}
+
+func TestExcluded(t *testing.T) {
+	// Find the (mocked) package we are using
+	pkg, err := build.Import("github.com/qur/withmock/scenarios/exclude_subpkgs/lib", ".", build.FindOnly)
+	if err != nil {
+		t.Fatalf("Failed to find lib: %s", err)
+	}
+
+	// The excluded sub-package is linked to the original
+	info, err := os.Lstat(filepath.Join(pkg.Dir, "real"))
+	if err != nil {
+		t.Fatalf("Failed to find real: %s", err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Expected real to be a symlink, got mode %s", info.Mode())
+	}
+
+	// Other sub-packages aren't
+	if info, err := os.Lstat(filepath.Join(pkg.Dir, "other")); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		t.Errorf("Expected other not to be a symlink")
+	}
+}
@@ -0,0 +1,9 @@
+package lib
+
+import (
+	"github.com/qur/withmock/scenarios/exclude_subpkgs/lib/real"
+)
+
+func Wibble() int {
+	return real.Value()
+}
@@ -0,0 +1,5 @@
+package other
+
+func Value() int {
+	return 2
+}
@@ -0,0 +1,5 @@
+package real
+
+func Value() int {
+	return 1
+}
@@ -0,0 +1,19 @@
+package code
+
+import "fmt"
+
+type Store interface {
+	Get(key string) (string, error)
+	Put(key, value string) error
+}
+
+func Greet(s Store, key string) (string, error) {
+	name, err := s.Get(key)
+	if err != nil {
+		return "", err
+	}
+	if err := s.Put(key, name); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("hello %s", name), nil
+}
@@ -0,0 +1,38 @@
+package code_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/qur/withmock/scenarios/fakes"
+	"github.com/qur/withmock/scenarios/fakes/_mocks_"
+)
+
+func TestFake(t *testing.T) {
+	// Only Get is stubbed, Put returns the zero value (i.e. nil)
+	store := &code_mocks.FakeStore{
+		GetFunc: func(key string) (string, error) {
+			return "bob", nil
+		},
+	}
+
+	s, err := code.Greet(store, "user")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if s != "hello bob" {
+		t.Errorf("Expected \"hello bob\", got %q", s)
+	}
+}
+
+func TestFakeError(t *testing.T) {
+	store := &code_mocks.FakeStore{}
+	store.PutFunc = func(key, value string) error {
+		return errors.New("full")
+	}
+
+	// Get isn't stubbed, so returns "" and nil
+	if _, err := code.Greet(store, "user"); err == nil || err.Error() != "full" {
+		t.Errorf("Expected error \"full\", got %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/fluent/ext"
+	"github.com/qur/withmock/scenarios/fluent/lib"
+)
+
+func Build() int {
+	return lib.NewBuilder().With(1).With(2).Sum()
+}
+
+func Add(v lib.Value) int {
+	return v.Add(1).Add(2).Get()
+}
+
+func Follow(c lib.Chainer) *ext.Link {
+	return c.Self().Next()
+}
@@ -0,0 +1,73 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/fluent/ext"
+	"github.com/qur/withmock/scenarios/fluent/lib" // mock
+)
+
+func TestBuild(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	b1 := &lib.Builder{}
+	b2 := &lib.Builder{}
+	b3 := &lib.Builder{}
+
+	lib.EXPECT().NewBuilder().Return(b1)
+	b1.EXPECT().With(1).Return(b2)
+	b2.EXPECT().With(2).Return(b3)
+	b3.EXPECT().Sum().Return(10)
+
+	if sum := Build(); sum != 10 {
+		t.Errorf("Expected 10, got %d", sum)
+	}
+}
+
+func TestBuildReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if sum := Build(); sum != 3 {
+		t.Errorf("Expected 3, got %d", sum)
+	}
+}
+
+func TestAdd(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	v := lib.Value{}
+
+	v.EXPECT().Add(1).Return(v)
+	v.EXPECT().Add(2).Return(v)
+	v.EXPECT().Get().Return(5)
+
+	if n := Add(v); n != 5 {
+		t.Errorf("Expected 5, got %d", n)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	c := lib.MOCK().NewChainer()
+	link := &ext.Link{Name: "next"}
+
+	c.EXPECT().Self().Return(c)
+	c.EXPECT().Next().Return(link)
+
+	if l := Follow(c); l != link {
+		t.Errorf("Expected %v, got %v", link, l)
+	}
+}
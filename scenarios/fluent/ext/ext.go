@@ -0,0 +1,10 @@
+package ext
+
+type Link struct {
+	Name string
+}
+
+type Chain interface {
+	Next() *Link
+	Self() Chain
+}
@@ -0,0 +1,43 @@
+package lib
+
+import (
+	"github.com/qur/withmock/scenarios/fluent/ext"
+)
+
+type Chainer interface {
+	ext.Chain
+	Len() int
+}
+
+type Builder struct {
+	parts []int
+}
+
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+func (b *Builder) With(x int) *Builder {
+	b.parts = append(b.parts, x)
+	return b
+}
+
+func (b *Builder) Sum() int {
+	sum := 0
+	for _, x := range b.parts {
+		sum += x
+	}
+	return sum
+}
+
+type Value struct {
+	n int
+}
+
+func (v Value) Add(x int) Value {
+	return Value{v.n + x}
+}
+
+func (v Value) Get() int {
+	return v.n
+}
@@ -0,0 +1,15 @@
+package code
+
+import (
+	"fmt"
+
+	"github.com/qur/withmock/scenarios/formatter/lib"
+)
+
+func TryMe(f lib.Failure) string {
+	return lib.Report(f)
+}
+
+func Wrap(f lib.Failure) error {
+	return fmt.Errorf("wrapped: %v", f)
+}
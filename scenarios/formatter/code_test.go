@@ -0,0 +1,116 @@
+package code
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/formatter/lib" // mock
+)
+
+// reporter records the failure reported by the controller, instead of failing
+// the test.
+type reporter struct {
+	msg string
+}
+
+func (r *reporter) Errorf(format string, args ...interface{}) {
+	r.msg = fmt.Sprintf(format, args...)
+}
+
+func (r *reporter) Fatalf(format string, args ...interface{}) {
+	r.msg = fmt.Sprintf(format, args...)
+	panic(r)
+}
+
+func TestError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	f := lib.MOCK().NewFailure()
+	f.EXPECT().Error().Return("boom")
+
+	// Outside of the controller Error is mocked as usual
+	if err := Wrap(f); err.Error() != "wrapped: boom" {
+		t.Errorf("Expected wrapped: boom, got %s", err)
+	}
+}
+
+func TestUnexpectedArg(t *testing.T) {
+	r := &reporter{}
+	ctrl := gomock.NewController(r)
+
+	lib.MOCK().SetController(ctrl)
+
+	lib.EXPECT().Report(gomock.Nil()).Return("nil")
+
+	func() {
+		defer func() {
+			if p := recover(); p != r {
+				panic(p)
+			}
+		}()
+		TryMe(lib.MOCK().NewFailure())
+	}()
+
+	// Formatting the arguments mustn't call back into the controller
+	if !strings.Contains(r.msg, "*MockFailure") {
+		t.Errorf("Expected failure to mention *MockFailure, got: %s", r.msg)
+	}
+}
+
+func TestString(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	n := lib.MOCK().NewNamed()
+	n.EXPECT().String().Return("name")
+	lib.EXPECT().Describe(n).Return("described")
+
+	if s := lib.Describe(n); s != "described" {
+		t.Errorf("Expected described, got %s", s)
+	}
+	if s := n.String(); s != "name" {
+		t.Errorf("Expected name, got %s", s)
+	}
+}
+
+func TestFinishMissingCall(t *testing.T) {
+	r := &reporter{}
+	ctrl := gomock.NewController(r)
+
+	lib.MOCK().SetController(ctrl)
+
+	n := lib.MOCK().NewNamed()
+	lib.EXPECT().Describe(n).Return("described")
+
+	// Finish formats the missing call (and so n) with the controller locked,
+	// so n.String mustn't call back into the controller.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() {
+			if p := recover(); p != nil && p != r {
+				panic(p)
+			}
+		}()
+		lib.MOCK().Finish()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Finish deadlocked formatting the missing call")
+	}
+
+	if !strings.Contains(r.msg, "missing call") {
+		t.Errorf("Expected a missing call to be reported, got: %s", r.msg)
+	}
+}
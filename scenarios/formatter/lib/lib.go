@@ -0,0 +1,18 @@
+package lib
+
+type Failure interface {
+	Error() string
+	Code() int
+}
+
+type Named interface {
+	String() string
+}
+
+func Report(f Failure) string {
+	return f.Error()
+}
+
+func Describe(n Named) string {
+	return n.String()
+}
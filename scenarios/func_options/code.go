@@ -0,0 +1,21 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/func_options/lib"
+)
+
+func Start(addr, name string) error {
+	return lib.Run(addr, lib.WithName(name), func(c *lib.Config) {
+		c.Retries = 3
+	})
+}
+
+func Shutdown(hooks ...func()) int {
+	return lib.Hooks(hooks...)
+}
+
+func Serve(s *lib.Server, retries int) *lib.Config {
+	return s.Serve(func(c *lib.Config) {
+		c.Retries = retries
+	})
+}
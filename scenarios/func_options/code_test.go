@@ -0,0 +1,67 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/func_options/lib" // mock
+)
+
+func TestOptions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	// funcs aren't comparable, so gomock.Eq can't match them - but they can
+	// be matched with gomock.Any(), and still called from Do.
+	opt := func(*lib.Config) {}
+	lib.EXPECT().WithName("test").Return(opt)
+	lib.EXPECT().Run("localhost", gomock.Any(), gomock.Any()).Do(
+		func(addr string, opts ...func(*lib.Config)) {
+			c := &lib.Config{}
+			for _, o := range opts {
+				o(c)
+			}
+			if c.Retries != 3 {
+				t.Errorf("Expected 3 retries, got %d", c.Retries)
+			}
+		}).Return(nil)
+
+	if err := Start("localhost", "test"); err != nil {
+		t.Errorf("Expected nil, got %s", err)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	lib.EXPECT().Hooks().Return(0)
+	lib.EXPECT().Hooks(gomock.Any(), gomock.Any()).Return(2)
+
+	if n := Shutdown(); n != 0 {
+		t.Errorf("Expected 0, got %d", n)
+	}
+	if n := Shutdown(func() {}, func() {}); n != 2 {
+		t.Errorf("Expected 2, got %d", n)
+	}
+}
+
+func TestMethodOptions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	s := &lib.Server{}
+	want := &lib.Config{Retries: 5}
+	s.EXPECT().Serve(gomock.Any()).Return(want)
+
+	if c := Serve(s, 5); c != want {
+		t.Errorf("Expected %v, got %v", want, c)
+	}
+}
@@ -0,0 +1,39 @@
+package lib
+
+type Config struct {
+	Name    string
+	Retries int
+}
+
+type Option func(*Config)
+
+func WithName(name string) func(*Config) {
+	return func(c *Config) {
+		c.Name = name
+	}
+}
+
+func Run(addr string, opts ...func(*Config)) error {
+	c := &Config{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return nil
+}
+
+func Hooks(hooks ...func()) int {
+	for _, hook := range hooks {
+		hook()
+	}
+	return len(hooks)
+}
+
+type Server struct{}
+
+func (s *Server) Serve(opts ...Option) *Config {
+	c := &Config{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
@@ -0,0 +1,22 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/generated_names/lib"
+)
+
+func Area(w, h int) int {
+	return lib.Scale(w, h)
+}
+
+func Words(s string) int {
+	words, err := lib.Split(s)
+	if err != nil {
+		return -1
+	}
+	return int(lib.Count(true, words...))
+}
+
+func First(p lib.Parser, s string) int {
+	_, n := p.Parse(s, 1)
+	return int(n)
+}
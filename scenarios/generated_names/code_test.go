@@ -0,0 +1,56 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/generated_names/lib" // mock
+)
+
+func TestMocked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	lib.EXPECT().Scale(2, 3).Return(42)
+	if n := Area(2, 3); n != 42 {
+		t.Errorf("Expected 42, got %d", n)
+	}
+
+	// Values of the unexported types can't be made here, so the zero values
+	// are returned.
+	lib.EXPECT().Split("a b").Return(nil, nil)
+	lib.EXPECT().Count(true)
+	if n := Words("a b"); n != 0 {
+		t.Errorf("Expected 0, got %d", n)
+	}
+
+	b := &lib.Box{}
+	b.EXPECT().Add(1, "x").Return(7)
+	if n := b.Add(1, "x"); n != 7 {
+		t.Errorf("Expected 7, got %d", n)
+	}
+
+	p := lib.NewMockParser(ctrl)
+	p.EXPECT().Parse("x", 1)
+	if n := First(p, "x"); n != 0 {
+		t.Errorf("Expected 0, got %d", n)
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if n := Area(2, 3); n != 6 {
+		t.Errorf("Expected 6, got %d", n)
+	}
+	if n := Words("a"); n != 1 {
+		t.Errorf("Expected 1, got %d", n)
+	}
+	if n := (&lib.Box{}).Add(2, ""); n != 2 {
+		t.Errorf("Expected 2, got %d", n)
+	}
+}
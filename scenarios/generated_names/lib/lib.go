@@ -0,0 +1,42 @@
+package lib
+
+// The parameters and types here use the names of identifiers in the
+// generated mocks.
+
+type ret int
+
+type p0 string
+
+type args []string
+
+func Scale(_ctrl, _m int) int {
+	return _ctrl * _m
+}
+
+func Count(init bool, ret0 ...string) ret {
+	if !init {
+		return 0
+	}
+	return ret(len(ret0))
+}
+
+func Name(p1 int, ret string) p0 {
+	return p0(ret)
+}
+
+func Split(s string) (args, error) {
+	return args{s}, nil
+}
+
+type Box struct {
+	n int
+}
+
+func (_m *Box) Add(_ctrl int, _mr string) int {
+	_m.n += _ctrl
+	return _m.n
+}
+
+type Parser interface {
+	Parse(p0 string, ret int) (args, ret)
+}
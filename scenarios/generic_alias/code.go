@@ -0,0 +1,9 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/generic_alias/lib"
+)
+
+func TryMe(s map[string]struct{}) []string {
+	return lib.Keys(s)
+}
@@ -0,0 +1,41 @@
+package code
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/generic_alias/lib" // mock
+)
+
+func TestTryMe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	s := map[string]struct{}{"a": {}}
+	lib.EXPECT().Keys(s).Return([]string{"mocked"})
+
+	if keys := TryMe(s); !reflect.DeepEqual(keys, []string{"mocked"}) {
+		t.Errorf("Expected [mocked], got %v", keys)
+	}
+}
+
+func TestAliases(t *testing.T) {
+	// Aliases must still be the same type as the aliased type, rather than a
+	// new type.
+	if a, b := reflect.TypeOf(lib.Set[string]{}), reflect.TypeOf(map[string]struct{}{}); a != b {
+		t.Errorf("Expected lib.Set[string] to be %v, got %v", b, a)
+	}
+
+	if a, b := reflect.TypeOf(lib.Index{}), reflect.TypeOf(map[string]int{}); a != b {
+		t.Errorf("Expected lib.Index to be %v, got %v", b, a)
+	}
+
+	pairs := lib.Pairs[string, int]{}
+	if a, b := reflect.TypeOf(pairs), reflect.TypeOf([]lib.Pair[string, int]{}); a != b {
+		t.Errorf("Expected lib.Pairs[string, int] to be %v, got %v", b, a)
+	}
+}
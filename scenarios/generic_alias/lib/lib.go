@@ -0,0 +1,37 @@
+package lib
+
+import (
+	"sort"
+)
+
+type Set[K comparable] = map[K]struct{}
+
+type Index = map[string]int
+
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+type Pairs[K comparable, V any] = []Pair[K, V]
+
+func Keys(s Set[string]) []string {
+	keys := make([]string, 0, len(s))
+	for k := range s {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func Lookup(i Index, key string) int {
+	return i[key]
+}
+
+func Entries(i Index) Pairs[string, int] {
+	pairs := Pairs[string, int]{}
+	for k, v := range i {
+		pairs = append(pairs, Pair[string, int]{k, v})
+	}
+	return pairs
+}
@@ -0,0 +1,17 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/generic_methods/lib"
+)
+
+func Fill(l *lib.IntList, values ...int) (int, int) {
+	for _, v := range values {
+		l.Add(v)
+	}
+	first, _ := l.First()
+	return first, l.Len()
+}
+
+func Describe(s lib.Setting) string {
+	return s.String()
+}
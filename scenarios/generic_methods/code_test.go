@@ -0,0 +1,63 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/generic_methods/lib" // mock
+)
+
+func TestAlias(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	// EXPECT works through the alias of the instantiated type
+	l := &lib.IntList{}
+	l.EXPECT().Add(1)
+	l.EXPECT().Add(2)
+	l.EXPECT().First().Return(42, true)
+	l.EXPECT().Len().Return(7)
+
+	first, n := Fill(l, 1, 2)
+	if first != 42 || n != 7 {
+		t.Errorf("Expected 42, 7 - got %d, %d", first, n)
+	}
+
+	s := lib.Setting{Key: "k", Value: 1}
+	s.EXPECT().String().Return("mocked")
+
+	if d := Describe(s); d != "mocked" {
+		t.Errorf("Expected mocked, got %q", d)
+	}
+}
+
+func TestUnexported(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	c := &lib.Mock_counter[string]{}
+	c.EXPECT().Inc("a").Return(5)
+
+	if n := c.Inc("a"); n != 5 {
+		t.Errorf("Expected 5, got %d", n)
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	first, n := Fill(&lib.IntList{}, 3, 4, 5)
+	if first != 3 || n != 3 {
+		t.Errorf("Expected 3, 3 - got %d, %d", first, n)
+	}
+
+	if n := lib.Count("a", "b", "a"); n != 2 {
+		t.Errorf("Expected 2, got %d", n)
+	}
+}
@@ -0,0 +1,56 @@
+package lib
+
+type List[T any] struct {
+	items []T
+}
+
+type IntList = List[int]
+
+func (l *List[T]) Add(v T) {
+	l.items = append(l.items, v)
+}
+
+func (l *List[T]) Len() int {
+	return len(l.items)
+}
+
+// First names the type parameter differently, which is allowed.
+func (l *List[E]) First() (E, bool) {
+	var zero E
+	if len(l.items) == 0 {
+		return zero, false
+	}
+	return l.items[0], true
+}
+
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+type Setting = Pair[string, int]
+
+func (p Pair[K, V]) String() string {
+	return "pair"
+}
+
+type counter[T comparable] struct {
+	counts map[T]int
+}
+
+func (c *counter[T]) Inc(v T) int {
+	if c.counts == nil {
+		c.counts = make(map[T]int)
+	}
+	c.counts[v]++
+	return c.counts[v]
+}
+
+func Count(values ...string) int {
+	c := &counter[string]{}
+	n := 0
+	for _, v := range values {
+		n = c.Inc(v)
+	}
+	return n
+}
@@ -0,0 +1,18 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/generic_pointers/ext"
+	"github.com/qur/withmock/scenarios/generic_pointers/lib"
+)
+
+func Total(m *lib.Map[string, int], key string) int {
+	l, ok := lib.Lookup(m, key)
+	if !ok {
+		return 0
+	}
+	return lib.Sum(l)
+}
+
+func Has(idx lib.Index, s *ext.Set[ext.Key], key ext.Key) bool {
+	return idx.Find(s, key) != nil
+}
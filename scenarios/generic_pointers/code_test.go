@@ -0,0 +1,51 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/generic_pointers/ext"
+	"github.com/qur/withmock/scenarios/generic_pointers/lib" // mock
+)
+
+func TestTotal(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	m := &lib.Map[string, int]{}
+	l := &lib.List[int]{Items: []int{1, 2}}
+	lib.EXPECT().Lookup(m, "a").Return(l, true)
+	lib.EXPECT().Sum(l).Return(3)
+
+	if n := Total(m, "a"); n != 3 {
+		t.Errorf("Expected 3, got %d", n)
+	}
+}
+
+func TestHas(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	s := &ext.Set[ext.Key]{}
+	idx := lib.MOCK().NewIndex()
+	idx.EXPECT().Find(s, ext.Key("a")).Return(s)
+
+	if !Has(idx, s, "a") {
+		t.Errorf("Expected Has to return true")
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	m := &lib.Map[string, int]{Items: map[string]int{"a": 5}}
+	if n := Total(m, "a"); n != 5 {
+		t.Errorf("Expected 5, got %d", n)
+	}
+}
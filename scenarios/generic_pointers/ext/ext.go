@@ -0,0 +1,11 @@
+package ext
+
+type Key string
+
+type Set[T comparable] struct {
+	Items map[T]bool
+}
+
+type Index interface {
+	Find(s *Set[Key], key Key) *Set[Key]
+}
@@ -0,0 +1,30 @@
+package lib
+
+import (
+	"github.com/qur/withmock/scenarios/generic_pointers/ext"
+)
+
+type List[T any] struct {
+	Items []T
+}
+
+type Map[K comparable, V any] struct {
+	Items map[K]V
+}
+
+func Sum(l *List[int]) int {
+	n := 0
+	for _, v := range l.Items {
+		n += v
+	}
+	return n
+}
+
+func Lookup(m *Map[string, int], key string) (*List[int], bool) {
+	v, ok := m.Items[key]
+	return &List[int]{Items: []int{v}}, ok
+}
+
+type Index interface {
+	ext.Index
+}
@@ -0,0 +1,17 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/generic_results/lib"
+)
+
+func TryMe() (int, error) {
+	r, err := lib.Load("name")
+	if err != nil {
+		return 0, err
+	}
+	b, err := lib.Boxed()
+	if err != nil {
+		return 0, err
+	}
+	return r.Value + lib.First().Value + b.Value.Value, nil
+}
@@ -0,0 +1,41 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/generic_results/ext"
+	"github.com/qur/withmock/scenarios/generic_results/lib" // mock
+)
+
+func TestTryMe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+	lib.EXPECT().Load("name").Return(lib.Result[int]{Value: 10, OK: true}, nil)
+	lib.EXPECT().First().Return(lib.Pair[string, int]{"x", 20})
+	lib.EXPECT().Boxed().Return(lib.Pair[string, ext.Box[int]]{"y", ext.Box[int]{Value: 30}}, nil)
+
+	n, err := TryMe()
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if n != 60 {
+		t.Errorf("Expected 60, got %d", n)
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	n, err := TryMe()
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if n != 7 {
+		t.Errorf("Expected 7, got %d", n)
+	}
+}
@@ -0,0 +1,5 @@
+package ext
+
+type Box[T any] struct {
+	Value T
+}
@@ -0,0 +1,27 @@
+package lib
+
+import (
+	"github.com/qur/withmock/scenarios/generic_results/ext"
+)
+
+type Result[T any] struct {
+	Value T
+	OK    bool
+}
+
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+func Load(name string) (Result[int], error) {
+	return Result[int]{Value: len(name), OK: true}, nil
+}
+
+func First() Pair[string, int] {
+	return Pair[string, int]{"a", 1}
+}
+
+func Boxed() (Pair[string, ext.Box[int]], error) {
+	return Pair[string, ext.Box[int]]{"b", ext.Box[int]{Value: 2}}, nil
+}
@@ -0,0 +1,39 @@
+package code
+
+import (
+	"strings"
+
+	"github.com/qur/withmock/scenarios/generic_store/lib"
+)
+
+type User struct {
+	Name string
+}
+
+func (u User) Key() string {
+	return strings.ToLower(u.Name)
+}
+
+func (u User) String() string {
+	return "user:" + u.Name
+}
+
+func Lookup(s *lib.Store[string], id string) string {
+	v, found := s.Get(id)
+	if !found {
+		return "missing"
+	}
+	return v
+}
+
+func FindUser(x *lib.Index[User], key string) string {
+	u, found := x.Find(key)
+	if !found {
+		return "missing"
+	}
+	return u.Name
+}
+
+func Join(l *lib.Labels[User]) string {
+	return strings.Join(l.Strings(), ",")
+}
@@ -0,0 +1,71 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/generic_store/lib" // mock
+)
+
+func TestMocked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	s := &lib.Store[string]{}
+	s.EXPECT().Get("a").Return("mocked", true)
+	s.EXPECT().Get("b").Return("", false)
+
+	if v := Lookup(s, "a"); v != "mocked" {
+		t.Errorf("Expected mocked, got %q", v)
+	}
+	if v := Lookup(s, "b"); v != "missing" {
+		t.Errorf("Expected missing, got %q", v)
+	}
+
+	x := &lib.Index[User]{}
+	x.EXPECT().Find("bob").Return(User{Name: "Robert"}, true)
+
+	if name := FindUser(x, "bob"); name != "Robert" {
+		t.Errorf("Expected Robert, got %q", name)
+	}
+
+	l := &lib.Labels[User]{}
+	l.EXPECT().Strings().Return([]string{"a", "b"})
+
+	if s := Join(l); s != "a,b" {
+		t.Errorf("Expected a,b, got %q", s)
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	s := lib.NewStore[string]()
+	s.Put("a", "real")
+
+	if v := Lookup(s, "a"); v != "real" {
+		t.Errorf("Expected real, got %q", v)
+	}
+	if v := Lookup(s, "b"); v != "missing" {
+		t.Errorf("Expected missing, got %q", v)
+	}
+
+	x := &lib.Index[User]{}
+	x.Add(User{Name: "Bob"})
+
+	if name := FindUser(x, "bob"); name != "Bob" {
+		t.Errorf("Expected Bob, got %q", name)
+	}
+
+	l := &lib.Labels[User]{}
+	l.Add(User{Name: "a"})
+	l.Add(User{Name: "b"})
+
+	if s := Join(l); s != "user:a,user:b" {
+		t.Errorf("Expected user:a,user:b, got %q", s)
+	}
+}
@@ -0,0 +1,60 @@
+package lib
+
+import "fmt"
+
+type Store[T any] struct {
+	items map[string]T
+}
+
+func NewStore[T any]() *Store[T] {
+	return &Store[T]{items: make(map[string]T)}
+}
+
+func (s *Store[T]) Put(id string, v T) {
+	s.items[id] = v
+}
+
+func (s *Store[T]) Get(id string) (T, bool) {
+	v, found := s.items[id]
+	return v, found
+}
+
+// Keyed constrains the items of an Index.
+type Keyed interface {
+	Key() string
+}
+
+type Index[T Keyed] struct {
+	items []T
+}
+
+func (x *Index[T]) Add(v T) {
+	x.items = append(x.items, v)
+}
+
+func (x *Index[T]) Find(key string) (T, bool) {
+	for _, v := range x.items {
+		if v.Key() == key {
+			return v, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// Labels has a constraint from another package.
+type Labels[T fmt.Stringer] struct {
+	items []T
+}
+
+func (l *Labels[T]) Add(v T) {
+	l.items = append(l.items, v)
+}
+
+func (l *Labels[T]) Strings() []string {
+	s := make([]string, 0, len(l.items))
+	for _, v := range l.items {
+		s = append(s, v.String())
+	}
+	return s
+}
@@ -0,0 +1,9 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/go_embed/lib"
+)
+
+func Banner() string {
+	return lib.Greeting() + " " + lib.Version()
+}
@@ -0,0 +1,32 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/go_embed/lib" // mock
+)
+
+func TestBanner(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	lib.EXPECT().Greeting().Return("hi")
+	lib.EXPECT().Version().Return("0.1")
+
+	if b := Banner(); b != "hi 0.1" {
+		t.Errorf("Expected \"hi 0.1\", got %q", b)
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if b := Banner(); b != "hello 1.2.3" {
+		t.Errorf("Expected \"hello 1.2.3\", got %q", b)
+	}
+}
@@ -0,0 +1,28 @@
+package lib
+
+import (
+	_ "embed"
+	"embed"
+	"strings"
+)
+
+//go:embed version.txt
+var version string
+
+var (
+	// assets holds the static files.
+	//go:embed assets/*
+	assets embed.FS
+)
+
+func Version() string {
+	return strings.TrimSpace(version)
+}
+
+func Greeting() string {
+	data, err := assets.ReadFile("assets/greeting.txt")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
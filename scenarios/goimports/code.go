@@ -0,0 +1,15 @@
+package code
+
+import (
+	"time"
+
+	"github.com/qur/withmock/scenarios/goimports/lib"
+)
+
+func TryMe() int {
+	return lib.Compute()
+}
+
+func WaitFor(t lib.Thing) error {
+	return t.Wait(time.Second)
+}
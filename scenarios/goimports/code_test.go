@@ -0,0 +1,45 @@
+package code
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/goimports/lib" // mock
+)
+
+func TestTryMe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+	lib.EXPECT().Compute().Return(1)
+
+	if v := TryMe(); v != 1 {
+		t.Errorf("Expected mocked value 1, got %d", v)
+	}
+}
+
+func TestTryMeReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if v := TryMe(); v != 42 {
+		t.Errorf("Expected real value 42, got %d", v)
+	}
+}
+
+func TestWaitFor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	thing := lib.MOCK().NewThing()
+	thing.EXPECT().Wait(time.Second).Return(nil)
+
+	if err := WaitFor(thing); err != nil {
+		t.Errorf("Unexpected error return: %s", err)
+	}
+}
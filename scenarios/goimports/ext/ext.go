@@ -0,0 +1,9 @@
+package ext
+
+import (
+	"time"
+)
+
+type Waiter interface {
+	Wait(d time.Duration) error
+}
@@ -0,0 +1,18 @@
+package lib
+
+import (
+	"io"
+
+	"github.com/qur/withmock/scenarios/goimports/dep"
+	"github.com/qur/withmock/scenarios/goimports/ext"
+)
+
+type Thing interface {
+	ext.Waiter
+	io.Reader
+	Name() string
+}
+
+func Compute() int {
+	return helper.Value()
+}
@@ -0,0 +1,9 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/gomock_name/lib"
+)
+
+func Describe(s *lib.Store, g lib.Greeter) string {
+	return lib.Mode() + " " + s.Get("key") + " " + g.Greet("bob")
+}
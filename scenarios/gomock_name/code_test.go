@@ -0,0 +1,42 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/gomock_name/lib" // mock
+)
+
+type greeter struct{}
+
+func (greeter) Greet(name string) string {
+	return "hello " + name
+}
+
+func TestMocked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	s := &lib.Store{}
+	g := lib.NewMockGreeter(ctrl)
+
+	lib.EXPECT().Mode().Return("mocked")
+	s.EXPECT().Get("key").Return("value")
+	g.EXPECT().Greet("bob").Return("hi")
+
+	if d := Describe(s, g); d != "mocked value hi" {
+		t.Errorf("Expected \"mocked value hi\", got %q", d)
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if d := Describe(&lib.Store{}, greeter{}); d != "real real:key hello bob" {
+		t.Errorf("Expected \"real real:key hello bob\", got %q", d)
+	}
+}
@@ -0,0 +1,19 @@
+package lib
+
+// gomock clashes with the name that the generated code would normally import
+// gomock as.
+var gomock = "real"
+
+func Mode() string {
+	return gomock
+}
+
+type Greeter interface {
+	Greet(name string) string
+}
+
+type Store struct{}
+
+func (s *Store) Get(key string) string {
+	return gomock + ":" + key
+}
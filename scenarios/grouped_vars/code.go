@@ -0,0 +1,11 @@
+package code
+
+import (
+	"fmt"
+
+	"github.com/qur/withmock/scenarios/grouped_vars/lib"
+)
+
+func TryMe() string {
+	return fmt.Sprintf(lib.Format, lib.Total())
+}
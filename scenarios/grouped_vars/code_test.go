@@ -0,0 +1,42 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/grouped_vars/lib" // mock
+)
+
+func TestValues(t *testing.T) {
+	if lib.First != 1 || lib.Second != "50%" {
+		t.Errorf("Expected 1, \"50%%\", got %d, %q", lib.First, lib.Second)
+	}
+	if lib.Count != 0 {
+		t.Errorf("Expected 0, got %d", lib.Count)
+	}
+	if lib.X != 3 || lib.Y != 4 {
+		t.Errorf("Expected 3, 4, got %d, %d", lib.X, lib.Y)
+	}
+	if lib.Ratio != 0.5 || lib.Scale != 2 {
+		t.Errorf("Expected 0.5, 2, got %v, %v", lib.Ratio, lib.Scale)
+	}
+	if lib.Format != "%d items" || lib.Escaped != "100%%" {
+		t.Errorf("Expected \"%%d items\", \"100%%%%\", got %q, %q", lib.Format, lib.Escaped)
+	}
+	if lib.Answer != 42 || lib.Low != 1 || lib.High != 10 {
+		t.Errorf("Expected 42, 1, 10, got %d, %d, %d", lib.Answer, lib.Low, lib.High)
+	}
+}
+
+func TestTryMe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+	lib.EXPECT().Total().Return(5)
+
+	if s := TryMe(); s != "5 items" {
+		t.Errorf("Expected \"5 items\", got %q", s)
+	}
+}
@@ -0,0 +1,18 @@
+package lib
+
+var (
+	First, Second = 1, "50%"
+	Count         int
+	X, Y          int     = 3, 4
+	Ratio, Scale  float64 = 0.5, 2
+)
+
+const (
+	Format, Escaped string = "%d items", "100%%"
+	Answer                 = 42
+	Low, High       int    = 1, 10
+)
+
+func Total() int {
+	return X + Y
+}
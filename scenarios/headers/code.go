@@ -0,0 +1,9 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/headers/lib"
+)
+
+func TryMe() int {
+	return lib.Wibble(5)
+}
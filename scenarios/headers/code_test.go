@@ -0,0 +1,49 @@
+package code
+
+import (
+	"go/build"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/headers/lib" // mock
+)
+
+func TestTryMe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+	lib.EXPECT().Wibble(5).Return(1)
+
+	if n := TryMe(); n != 1 {
+		t.Errorf("Expected 1, got %d", n)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	// Find the source of the (mocked) package we are using
+	pkg, err := build.Import("github.com/qur/withmock/scenarios/headers/lib", ".", build.FindOnly)
+	if err != nil {
+		t.Fatalf("Failed to find lib: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(pkg.Dir, "lib.go"))
+	if err != nil {
+		t.Fatalf("Failed to read lib: %s", err)
+	}
+	src := string(data)
+
+	header := "// Copyright 2024 Example Corp.  All rights reserved.\n" +
+		"// Licensed under the Example License.\n"
+	if !strings.Contains(src, header) {
+		t.Errorf("License header missing from generated code:\n%s", src)
+	}
+
+	if !strings.Contains(src, "_real_Wibble") {
+		t.Errorf("Expected to find generated code, got:\n%s", src)
+	}
+}
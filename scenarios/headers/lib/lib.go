@@ -0,0 +1,11 @@
+// Copyright 2024 Example Corp.  All rights reserved.
+// Licensed under the Example License.
+
+// +build !never
+
+// Package lib has a license header.
+package lib
+
+func Wibble(x int) int {
+	return x * 2
+}
@@ -0,0 +1,17 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/iface_results/lib"
+)
+
+func Name(s lib.Source) (string, error) {
+	buf := make([]byte, 4)
+	if _, err := s.Read(buf); err != nil {
+		return "", err
+	}
+	return s.Get().Name, nil
+}
+
+func Opened() bool {
+	return lib.Open("x") != nil
+}
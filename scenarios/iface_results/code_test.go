@@ -0,0 +1,52 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/iface_results/ext"
+	"github.com/qur/withmock/scenarios/iface_results/lib" // mock
+)
+
+func TestName(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	s := lib.MOCK().NewSource()
+	s.EXPECT().Read(gomock.Any()).Return(4, nil)
+	s.EXPECT().Get().Return(ext.Value{Name: "mocked"})
+
+	name, err := Name(s)
+	if err != nil {
+		t.Errorf("Unexpected error return: %s", err)
+	}
+	if name != "mocked" {
+		t.Errorf("Expected mocked, got %s", name)
+	}
+}
+
+func TestOpened(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	s := lib.MOCK().NewSource()
+	lib.EXPECT().Open("x").Return(s)
+
+	if !Opened() {
+		t.Errorf("Expected Opened to return true")
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if Opened() {
+		t.Errorf("Expected Opened to return false")
+	}
+}
@@ -0,0 +1,5 @@
+package ext
+
+type Value struct {
+	Name string
+}
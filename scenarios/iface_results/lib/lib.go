@@ -0,0 +1,17 @@
+package lib
+
+import (
+	"github.com/qur/withmock/scenarios/iface_results/ext"
+)
+
+func Open(name string) interface {
+	Read(p []byte) (n int, err error)
+	Get() (v ext.Value)
+} {
+	return nil
+}
+
+type Source interface {
+	Read(p []byte) (n int, err error)
+	Get() (v ext.Value)
+}
@@ -0,0 +1,25 @@
+package code
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/qur/withmock/scenarios/imported_containers/lib"
+)
+
+func ReadAll(readers []io.Reader) string {
+	s := ""
+	for _, r := range readers {
+		data, _ := ioutil.ReadAll(r)
+		s += string(data)
+	}
+	return s
+}
+
+func Joined(names ...string) string {
+	return ReadAll(lib.Readers(names...))
+}
+
+func Keys(o lib.Opener) int {
+	return len(o.Scopes()) + len(lib.Contexts("a"))
+}
@@ -0,0 +1,54 @@
+package code
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/imported_containers/lib" // mock
+)
+
+func TestMocked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	readers := []io.Reader{strings.NewReader("x"), strings.NewReader("y")}
+	lib.EXPECT().Readers("a", "b").Return(readers)
+	if s := Joined("a", "b"); s != "xy" {
+		t.Errorf("Expected xy, got %q", s)
+	}
+
+	o := lib.NewMockOpener(ctrl)
+	o.EXPECT().Scopes().Return(map[string]context.Context{
+		"a": context.Background(),
+		"b": context.TODO(),
+	})
+	lib.EXPECT().Contexts("a").Return(nil)
+	if n := Keys(o); n != 2 {
+		t.Errorf("Expected 2, got %d", n)
+	}
+
+	s := &lib.Source{}
+	s.EXPECT().Open("f").Return(nil, nil)
+	if rcs, err := s.Open("f"); rcs != nil || err != nil {
+		t.Errorf("Expected nil, nil - got %v, %v", rcs, err)
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if s := Joined("a", "b"); s != "ab" {
+		t.Errorf("Expected ab, got %q", s)
+	}
+
+	if rcs, err := (&lib.Source{}).Open("f"); len(rcs) != 1 || err != nil {
+		t.Errorf("Expected one reader, got %v, %v", rcs, err)
+	}
+}
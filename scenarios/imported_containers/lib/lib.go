@@ -0,0 +1,36 @@
+package lib
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// Readers and Contexts only use io and context in their results, which the
+// mock asserts to.
+func Readers(names ...string) []io.Reader {
+	readers := []io.Reader{}
+	for _, name := range names {
+		readers = append(readers, strings.NewReader(name))
+	}
+	return readers
+}
+
+func Contexts(keys ...string) map[string]context.Context {
+	contexts := map[string]context.Context{}
+	for _, key := range keys {
+		contexts[key] = context.Background()
+	}
+	return contexts
+}
+
+type Source struct{}
+
+func (s *Source) Open(name string) ([]io.ReadCloser, error) {
+	return []io.ReadCloser{io.NopCloser(strings.NewReader(name))}, nil
+}
+
+type Opener interface {
+	OpenAll(names ...string) []io.Reader
+	Scopes() map[string]context.Context
+}
@@ -0,0 +1,26 @@
+package code
+
+import (
+	"io/ioutil"
+
+	"github.com/qur/withmock/scenarios/imported_results/lib"
+)
+
+func Read(name string) (string, error) {
+	r, ctx, err := lib.Open(name)
+	if err != nil {
+		return "", err
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadAll(r)
+	return string(data), err
+}
+
+func ReadConn(c lib.Conn, name string) (string, error) {
+	defer c.Close()
+	r, _ := c.Open(name)
+	data, err := ioutil.ReadAll(r)
+	return string(data), err
+}
@@ -0,0 +1,39 @@
+package code
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/imported_results/lib" // mock
+)
+
+func TestRead(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	lib.EXPECT().Open("foo").Return(strings.NewReader("bar"), context.Background(), nil)
+
+	if s, err := Read("foo"); err != nil || s != "bar" {
+		t.Errorf("Expected \"bar\", got %q (err: %v)", s, err)
+	}
+}
+
+func TestReadConn(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	c := lib.MOCK().NewConn()
+	c.EXPECT().Open("foo").Return(strings.NewReader("baz"), context.Background())
+	c.EXPECT().Close().Return(nil)
+
+	if s, err := ReadConn(c, "foo"); err != nil || s != "baz" {
+		t.Errorf("Expected \"baz\", got %q (err: %v)", s, err)
+	}
+}
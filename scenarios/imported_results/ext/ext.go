@@ -0,0 +1,10 @@
+package ext
+
+import (
+	"context"
+	"io"
+)
+
+type Opener interface {
+	Open(name string) (io.Reader, context.Context)
+}
@@ -0,0 +1,24 @@
+package lib
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/qur/withmock/scenarios/imported_results/ext"
+)
+
+func Open(name string) (io.Reader, context.Context, error) {
+	return strings.NewReader(name), context.Background(), nil
+}
+
+type Source struct{}
+
+func (s *Source) Open(name string) (io.Reader, context.Context) {
+	return strings.NewReader(name), context.Background()
+}
+
+type Conn interface {
+	ext.Opener
+	Close() error
+}
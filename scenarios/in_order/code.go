@@ -0,0 +1,13 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/in_order/lib"
+)
+
+func Touch(name string) error {
+	fd, err := lib.Open(name)
+	if err != nil {
+		return err
+	}
+	return lib.Close(fd)
+}
@@ -0,0 +1,25 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/in_order/lib" // mock
+)
+
+func TestTouch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	lib.MOCK().ExpectInOrder(
+		lib.EXPECT().Open("foo").Return(3, nil),
+		lib.EXPECT().Close(3).Return(nil),
+	)
+
+	if err := Touch("foo"); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,9 @@
+package lib
+
+func Open(name string) (int, error) {
+	return 0, nil
+}
+
+func Close(fd int) error {
+	return nil
+}
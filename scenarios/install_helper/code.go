@@ -0,0 +1,13 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/install_helper/lib"
+)
+
+func Find(c *lib.Cache, key string) string {
+	if v := c.Get(key); v != "" {
+		return v
+	}
+	v, _ := lib.Lookup(key)
+	return v
+}
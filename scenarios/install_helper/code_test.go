@@ -0,0 +1,35 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/qur/withmock/scenarios/install_helper/lib" // mock
+)
+
+func TestFind(t *testing.T) {
+	t.Run("cached", func(t *testing.T) {
+		lib.MOCK().Install(t)
+
+		c := &lib.Cache{}
+		c.EXPECT().Get("a").Return("cached")
+		if s := Find(c, "a"); s != "cached" {
+			t.Errorf("Expected \"cached\", got %q", s)
+		}
+	})
+
+	t.Run("lookup", func(t *testing.T) {
+		lib.MOCK().Install(t)
+
+		c := &lib.Cache{}
+		c.EXPECT().Get("a").Return("")
+		lib.EXPECT().Lookup("a").Return("found", true)
+		if s := Find(c, "a"); s != "found" {
+			t.Errorf("Expected \"found\", got %q", s)
+		}
+	})
+
+	// Each subtest cleaned up after itself.
+	if pending := lib.MOCK().PendingExpectations(); len(pending) != 0 {
+		t.Errorf("Expected no pending expectations, got %v", pending)
+	}
+}
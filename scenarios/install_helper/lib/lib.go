@@ -0,0 +1,13 @@
+package lib
+
+func Lookup(key string) (string, bool) {
+	return "", false
+}
+
+type Cache struct {
+	values map[string]string
+}
+
+func (c *Cache) Get(key string) string {
+	return c.values[key]
+}
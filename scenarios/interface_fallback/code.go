@@ -0,0 +1,21 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/interface_fallback/lib"
+)
+
+// Purge removes all of the keys with the given prefix from s, returning the
+// number of keys removed.
+func Purge(s lib.Store, prefix string) int {
+	keys := s.Keys(prefix)
+	s.Delete(keys...)
+	return len(keys)
+}
+
+func Lookup(s lib.Store, key string) string {
+	v, err := s.Get(key)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return v
+}
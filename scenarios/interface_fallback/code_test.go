@@ -0,0 +1,75 @@
+package code
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/interface_fallback/lib" // mock
+)
+
+func TestFallback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	// The real MemStore type is mocked too, so use a simple implementation
+	// from the test as the fallback.
+	real := fakeStore{"a/1": "one", "a/2": "two", "b/1": "three"}
+
+	store := &lib.MockStore{Fallback: real}
+
+	// Only Get is stubbed, Keys and Delete are passed to the fallback.
+	store.EXPECT().Get("a/1").Return("", errors.New("boom"))
+
+	if v := Lookup(store, "a/1"); v != "error: boom" {
+		t.Errorf("Expected stubbed Get, got %q", v)
+	}
+
+	if n := Purge(store, "a/"); n != 2 {
+		t.Errorf("Expected 2 keys purged, got %d", n)
+	}
+	if len(real) != 1 {
+		t.Errorf("Expected fallback to delete keys, left %v", real)
+	}
+}
+
+func TestNoFallback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	// Without a Fallback every call must be expected, as normal.
+	store := &lib.MockStore{}
+	store.EXPECT().Keys("a/").Return([]string{"a/1"})
+	store.EXPECT().Delete("a/1")
+
+	if n := Purge(store, "a/"); n != 1 {
+		t.Errorf("Expected 1 key purged, got %d", n)
+	}
+}
+
+type fakeStore map[string]string
+
+func (f fakeStore) Get(key string) (string, error) {
+	return f[key], nil
+}
+
+func (f fakeStore) Keys(prefix string) []string {
+	keys := []string{}
+	for k := range f {
+		if len(k) >= len(prefix) && k[:len(prefix)] == prefix {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func (f fakeStore) Delete(keys ...string) {
+	for _, k := range keys {
+		delete(f, k)
+	}
+}
@@ -0,0 +1,31 @@
+package lib
+
+import "strings"
+
+type Store interface {
+	Get(key string) (string, error)
+	Keys(prefix string) []string
+	Delete(keys ...string)
+}
+
+type MemStore map[string]string
+
+func (m MemStore) Get(key string) (string, error) {
+	return m[key], nil
+}
+
+func (m MemStore) Keys(prefix string) []string {
+	keys := []string{}
+	for k := range m {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func (m MemStore) Delete(keys ...string) {
+	for _, k := range keys {
+		delete(m, k)
+	}
+}
@@ -0,0 +1,9 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/iota_blank/lib"
+)
+
+func FreeMB() int64 {
+	return lib.Free() / lib.MB
+}
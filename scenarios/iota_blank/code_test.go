@@ -0,0 +1,34 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/iota_blank/lib" // mock
+)
+
+func TestConsts(t *testing.T) {
+	if lib.KB != 1<<10 {
+		t.Errorf("Expected KB to be %d, got %d", 1<<10, lib.KB)
+	}
+	if lib.MB != 1<<20 {
+		t.Errorf("Expected MB to be %d, got %d", 1<<20, lib.MB)
+	}
+	if lib.GB != 1<<30 {
+		t.Errorf("Expected GB to be %d, got %d", 1<<30, lib.GB)
+	}
+}
+
+func TestFreeMB(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	lib.EXPECT().Free().Return(int64(2 * lib.GB))
+
+	if n := FreeMB(); n != 2048 {
+		t.Errorf("Expected 2048, got %d", n)
+	}
+}
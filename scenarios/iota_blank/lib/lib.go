@@ -0,0 +1,12 @@
+package lib
+
+const (
+	_  = iota
+	KB = 1 << (10 * iota)
+	MB
+	GB
+)
+
+func Free() int64 {
+	return 4 * GB
+}
@@ -0,0 +1,14 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/method_pragmas/lib"
+)
+
+func Twice(c *lib.Counter) int {
+	c.Incr()
+	return lib.Double(c.Incr())
+}
+
+func Current(c *lib.Counter) int {
+	return c.Count()
+}
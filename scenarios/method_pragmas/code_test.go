@@ -0,0 +1,42 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/method_pragmas/lib" // mock
+)
+
+func TestMocked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	c := &lib.Counter{}
+	c.EXPECT().Incr().Return(5)
+	c.EXPECT().Incr().Return(6)
+	lib.EXPECT().Double(6).Return(7)
+	if n := Twice(c); n != 7 {
+		t.Errorf("Expected 7, got %d", n)
+	}
+
+	c.EXPECT().Count().Return(3)
+	if n := Current(c); n != 3 {
+		t.Errorf("Expected 3, got %d", n)
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	c := &lib.Counter{}
+	if n := Twice(c); n != 4 {
+		t.Errorf("Expected 4, got %d", n)
+	}
+	if n := Current(c); n != 2 {
+		t.Errorf("Expected 2, got %d", n)
+	}
+}
@@ -0,0 +1,27 @@
+package lib
+
+type Counter struct {
+	n int
+}
+
+// Incr adds one to the count, and returns the new count.  It mustn't be
+// inlined, so that it shows up in profiles.
+//
+//go:noinline
+func (c *Counter) Incr() int {
+	c.n++
+	return c.n
+}
+
+//go:nosplit
+//go:norace
+func (c Counter) Count() int {
+	return c.n
+}
+
+// Double doubles n.
+//
+//go:noinline
+func Double(n int) int {
+	return n * 2
+}
@@ -0,0 +1,13 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/mock_prefix/lib"
+)
+
+func Describe(key string) string {
+	value, err := lib.Lookup(key)
+	if err != nil {
+		return key + ": " + err.Error()
+	}
+	return key + " = " + value
+}
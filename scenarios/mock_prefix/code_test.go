@@ -0,0 +1,27 @@
+package code
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	// The _mock_/ prefix marks the import for mocking, instead of a comment
+	"_mock_/github.com/qur/withmock/scenarios/mock_prefix/lib"
+)
+
+func TestDescribe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+	lib.EXPECT().Lookup("a").Return("1", nil)
+	lib.EXPECT().Lookup("b").Return("", errors.New("missing"))
+
+	if s := Describe("a"); s != "a = 1" {
+		t.Errorf("Expected \"a = 1\", got %q", s)
+	}
+	if s := Describe("b"); s != "b: missing" {
+		t.Errorf("Expected \"b: missing\", got %q", s)
+	}
+}
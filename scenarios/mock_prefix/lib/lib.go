@@ -0,0 +1,9 @@
+package lib
+
+import (
+	"errors"
+)
+
+func Lookup(key string) (string, error) {
+	return "", errors.New("not implemented")
+}
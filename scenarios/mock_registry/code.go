@@ -0,0 +1,16 @@
+package code
+
+import (
+	"fmt"
+
+	"github.com/qur/withmock/scenarios/mock_registry/lib"
+)
+
+type Service struct {
+	Clock  lib.Clock
+	Logger lib.Logger
+}
+
+func (s *Service) Tick() {
+	s.Logger.Log(fmt.Sprintf("tick %d", s.Clock.Now()))
+}
@@ -0,0 +1,37 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/mock_registry/lib" // mock
+)
+
+func TestRegistry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	if len(lib.MockRegistry) != 2 {
+		t.Fatalf("Expected 2 registered mocks, got %d", len(lib.MockRegistry))
+	}
+
+	// A mock from the registry uses the controller it was created with, or
+	// the package controller if it was given nil.
+	lib.MOCK().SetController(ctrl)
+
+	clock, ok := lib.MockRegistry["Clock"](ctrl).(*lib.MockClock)
+	if !ok {
+		t.Fatalf("Expected *lib.MockClock from registry")
+	}
+	logger, ok := lib.MockRegistry["Logger"](nil).(*lib.MockLogger)
+	if !ok {
+		t.Fatalf("Expected *lib.MockLogger from registry")
+	}
+
+	clock.EXPECT().Now().Return(int64(42))
+	logger.EXPECT().Log("tick 42")
+
+	s := &Service{Clock: clock, Logger: logger}
+	s.Tick()
+}
@@ -0,0 +1,9 @@
+package lib
+
+type Clock interface {
+	Now() int64
+}
+
+type Logger interface {
+	Log(msg string)
+}
@@ -0,0 +1,19 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/named_error/lib"
+)
+
+func Validate(s string) string {
+	if err := lib.Check(s); err != nil {
+		return err.Error()
+	}
+	return "ok"
+}
+
+func Shutdown(c *lib.Conn, fail bool) error {
+	if err := c.Flush(); err != nil {
+		return err
+	}
+	return lib.Close(fail)
+}
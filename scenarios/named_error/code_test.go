@@ -0,0 +1,61 @@
+package code
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/named_error/lib" // mock
+)
+
+func TestMocked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	lib.EXPECT().Check("x").Return(errors.New("mocked"))
+	lib.EXPECT().Check("y").Return(nil)
+
+	if s := Validate("x"); s != "mocked" {
+		t.Errorf("Expected mocked, got %q", s)
+	}
+	if s := Validate("y"); s != "ok" {
+		t.Errorf("Expected ok, got %q", s)
+	}
+
+	c := &lib.Conn{}
+	c.EXPECT().Flush().Return(nil)
+	lib.EXPECT().Close(true).Return(nil)
+
+	if err := Shutdown(c, true); err != nil {
+		t.Errorf("Expected nil, got %s", err)
+	}
+
+	lib.EXPECT().Join("a", "").Return(lib.ErrEmpty)
+	if err := lib.Join("a", ""); err != lib.ErrEmpty {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if s := Validate(""); s != "empty" {
+		t.Errorf("Expected empty, got %q", s)
+	}
+	if s := Validate("x"); s != "ok" {
+		t.Errorf("Expected ok, got %q", s)
+	}
+
+	// The deferred function must still set the named result
+	if err := Shutdown(&lib.Conn{}, true); err == nil || err.Error() != "close failed" {
+		t.Errorf("Expected close failed, got %v", err)
+	}
+
+	if err := lib.Join("a", "", "b"); err != lib.ErrEmpty {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package lib
+
+import "errors"
+
+var ErrEmpty = errors.New("empty")
+
+// Check uses a naked return of its named result.
+func Check(s string) (err error) {
+	if s == "" {
+		err = ErrEmpty
+	}
+	return
+}
+
+// Close sets its named result from a deferred function.
+func Close(fail bool) (err error) {
+	defer func() {
+		if fail {
+			err = errors.New("close failed")
+		}
+	}()
+	return nil
+}
+
+func Join(parts ...string) (err error) {
+	for _, p := range parts {
+		if err = Check(p); err != nil {
+			return
+		}
+	}
+	return
+}
+
+type Conn struct{}
+
+func (c *Conn) Flush() (err error) {
+	return
+}
@@ -0,0 +1,17 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/nameless_receivers/lib"
+)
+
+func Describe(c *lib.Counter) string {
+	return c.Kind("a ") + " called " + c.Name()
+}
+
+func Blank(c *lib.Counter) int {
+	return c.Blank()
+}
+
+func Empty(l *lib.List[int]) bool {
+	return l.Empty()
+}
@@ -0,0 +1,52 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/nameless_receivers/lib" // mock
+)
+
+func TestMocked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	c := &lib.Counter{}
+	c.EXPECT().Kind("a ").Return("a mock")
+	c.EXPECT().Name().Return("mock")
+	if s := Describe(c); s != "a mock called mock" {
+		t.Errorf("Expected \"a mock called mock\", got %q", s)
+	}
+
+	c.EXPECT().Blank().Return(2)
+	if n := Blank(c); n != 2 {
+		t.Errorf("Expected 2, got %d", n)
+	}
+
+	l := &lib.List[int]{}
+	l.EXPECT().Empty().Return(false)
+	if Empty(l) {
+		t.Errorf("Expected the mocked list not to be empty")
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	c := &lib.Counter{}
+	if s := Describe(c); s != "a counter called counter" {
+		t.Errorf("Expected \"a counter called counter\", got %q", s)
+	}
+
+	if n := Blank(c); n != 1 {
+		t.Errorf("Expected 1, got %d", n)
+	}
+
+	if !Empty(&lib.List[int]{}) {
+		t.Errorf("Expected the real list to be empty")
+	}
+}
@@ -0,0 +1,26 @@
+package lib
+
+type Counter struct {
+	n int
+}
+
+// Name and Kind don't name their receivers.
+func (*Counter) Name() string {
+	return "counter"
+}
+
+func (Counter) Kind(prefix string) string {
+	return prefix + "counter"
+}
+
+func (_ *Counter) Blank() int {
+	return 1
+}
+
+type List[T any] struct {
+	items []T
+}
+
+func (*List[T]) Empty() bool {
+	return true
+}
@@ -0,0 +1,9 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/nested_controllers/lib"
+)
+
+func Get(key string) string {
+	return lib.Fetch(key)
+}
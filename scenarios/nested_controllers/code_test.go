@@ -0,0 +1,63 @@
+package code
+
+import (
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/nested_controllers/lib" // mock
+)
+
+type panicReporter struct{}
+
+func (panicReporter) Errorf(format string, args ...interface{}) {
+	panic("unexpected error: " + format)
+}
+
+func (panicReporter) Fatalf(format string, args ...interface{}) {
+	panic("unexpected fatal: " + format)
+}
+
+// TestMain sets up a controller for the whole binary, which the tests replace
+// for their own expectations - and then put back again.
+func TestMain(m *testing.M) {
+	ctrl := gomock.NewController(panicReporter{})
+	lib.MOCK().SetController(ctrl)
+	lib.EXPECT().Fetch(gomock.Any()).Return("main").AnyTimes()
+
+	os.Exit(m.Run())
+}
+
+func TestNested(t *testing.T) {
+	if v := Get("a"); v != "main" {
+		t.Errorf("Expected main, got %q", v)
+	}
+
+	outer := gomock.NewController(t)
+	defer outer.Finish()
+	restoreOuter := lib.MOCK().WithController(outer)
+	lib.EXPECT().Fetch("a").Return("outer")
+
+	t.Run("inner", func(t *testing.T) {
+		inner := gomock.NewController(t)
+		defer inner.Finish()
+		restoreInner := lib.MOCK().WithController(inner)
+		defer restoreInner()
+		lib.EXPECT().Fetch("a").Return("inner")
+
+		if v := Get("a"); v != "inner" {
+			t.Errorf("Expected inner, got %q", v)
+		}
+	})
+
+	if v := Get("a"); v != "outer" {
+		t.Errorf("Expected outer, got %q", v)
+	}
+
+	restoreOuter()
+
+	if v := Get("a"); v != "main" {
+		t.Errorf("Expected main, got %q", v)
+	}
+}
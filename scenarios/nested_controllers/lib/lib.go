@@ -0,0 +1,5 @@
+package lib
+
+func Fetch(key string) string {
+	return key
+}
@@ -0,0 +1,10 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/never_mock/infra"
+	"github.com/qur/withmock/scenarios/never_mock/lib"
+)
+
+func Get(key string) string {
+	return lib.Lookup(infra.Normalise(key))
+}
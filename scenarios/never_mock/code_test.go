@@ -0,0 +1,29 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/never_mock/infra" // mock
+	"github.com/qur/withmock/scenarios/never_mock/lib"   // mock
+)
+
+func TestNeverMock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	// infra is marked for mocking, but is listed in NeverMock - so the real
+	// code is used, and no expectations are needed.
+	lib.EXPECT().Lookup("key").Return("mocked")
+
+	if s := Get("  KEY "); s != "mocked" {
+		t.Errorf("Expected mocked, got %q", s)
+	}
+
+	if s := infra.Normalise(" A "); s != "a" {
+		t.Errorf("Expected a, got %q", s)
+	}
+}
@@ -0,0 +1,7 @@
+package infra
+
+import "strings"
+
+func Normalise(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
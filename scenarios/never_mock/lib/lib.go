@@ -0,0 +1,5 @@
+package lib
+
+func Lookup(key string) string {
+	return "real:" + key
+}
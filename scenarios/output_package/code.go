@@ -0,0 +1,9 @@
+package code
+
+import (
+	lib "github.com/qur/withmock/scenarios/output_package/lib"
+)
+
+func Lookup(name, key string) string {
+	return lib.Open(name).Get(key)
+}
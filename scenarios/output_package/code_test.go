@@ -0,0 +1,24 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	fakelib "github.com/qur/withmock/scenarios/output_package/lib" // mock
+)
+
+func TestLookup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fakelib.MOCK().SetController(ctrl)
+
+	s := fakelib.MOCK().NewStore()
+	fakelib.EXPECT().Open("db").Return(s)
+	s.EXPECT().Get("a").Return("b")
+
+	if v := Lookup("db", "a"); v != "b" {
+		t.Errorf("Expected b, got %q", v)
+	}
+}
@@ -0,0 +1,9 @@
+package lib
+
+type Store interface {
+	Get(key string) string
+}
+
+func Open(name string) Store {
+	return nil
+}
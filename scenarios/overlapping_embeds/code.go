@@ -0,0 +1,17 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/overlapping_embeds/lib"
+)
+
+func Copy(name string) (int, error) {
+	rw := lib.Open(name)
+	defer rw.Close()
+
+	n, err := rw.Read()
+	if err != nil {
+		return 0, err
+	}
+
+	return n, rw.Write(n)
+}
@@ -0,0 +1,30 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/overlapping_embeds/lib" // mock
+)
+
+func TestCopy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	rw := lib.MOCK().NewReadWriter()
+	lib.EXPECT().Open("foo").Return(rw)
+	rw.EXPECT().Read().Return(3, nil)
+	rw.EXPECT().Write(3).Return(nil)
+	rw.EXPECT().Close().Return(nil)
+
+	n, err := Copy("foo")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if n != 3 {
+		t.Errorf("Expected 3, got %d", n)
+	}
+}
@@ -0,0 +1,14 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/parallel_controllers/lib"
+)
+
+// Copy copies the value of key from src to dst.
+func Copy(src, dst lib.Store, key string) error {
+	value, err := src.Get(key)
+	if err != nil {
+		return err
+	}
+	return dst.Put(key, value)
+}
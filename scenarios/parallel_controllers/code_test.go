@@ -0,0 +1,100 @@
+package code
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/parallel_controllers/lib" // mock
+)
+
+func TestParallel(t *testing.T) {
+	for _, name := range []string{"a", "b"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Each subtest has its own controller, which its mocks use
+			// instead of the package controller.
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			src := lib.NewMockStore(ctrl)
+			dst := lib.NewMockStore(ctrl)
+
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("%s%d", name, i)
+				src.EXPECT().Get(key).Return(name, nil)
+				dst.EXPECT().Put(key, name).Return(nil)
+
+				if err := Copy(src, dst, key); err != nil {
+					t.Errorf("Copy failed: %s", err)
+				}
+			}
+		})
+	}
+}
+
+// reporter records the failures reported by a controller.
+type reporter struct {
+	sync.Mutex
+	errors []string
+}
+
+func (r *reporter) Errorf(format string, args ...interface{}) {
+	r.Lock()
+	defer r.Unlock()
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+// Fatalf doesn't stop the test, as gomock only uses it at the end of Finish.
+func (r *reporter) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+}
+
+func TestSeparate(t *testing.T) {
+	ra, rb := &reporter{}, &reporter{}
+	ctrlA := gomock.NewController(ra)
+	ctrlB := gomock.NewController(rb)
+
+	a := lib.NewMockStore(ctrlA)
+	b := lib.NewMockStore(ctrlB)
+
+	a.EXPECT().Put("k", "v").Return(nil)
+	b.EXPECT().Put("k", "v").Return(nil)
+
+	// Only a is called, so only ctrlB has a missing call
+	if err := a.Put("k", "v"); err != nil {
+		t.Errorf("Put failed: %s", err)
+	}
+
+	ctrlA.Finish()
+	ctrlB.Finish()
+
+	if len(ra.errors) != 0 {
+		t.Errorf("Expected no errors from ctrlA, got %v", ra.errors)
+	}
+	if len(rb.errors) == 0 {
+		t.Errorf("Expected a missing call error from ctrlB")
+	}
+}
+
+func TestPackageController(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	// Mocks without their own controller use the package controller
+	src := &lib.MockStore{}
+	dst := lib.NewMockStore(nil)
+
+	src.EXPECT().Get("k").Return("v", nil)
+	dst.EXPECT().Put("k", "v").Return(nil)
+
+	if err := Copy(src, dst, "k"); err != nil {
+		t.Errorf("Copy failed: %s", err)
+	}
+}
@@ -0,0 +1,6 @@
+package lib
+
+type Store interface {
+	Get(key string) (string, error)
+	Put(key, value string) error
+}
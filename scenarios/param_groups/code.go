@@ -0,0 +1,17 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/param_groups/lib"
+)
+
+func Label(name string) string {
+	return lib.Pad(8, '.', name)
+}
+
+func Total(values ...int) int {
+	return lib.Sum(values[0], values[1], values[2:]...)
+}
+
+func Title(j *lib.Joiner, a, b string) string {
+	return j.Join(a, b, true)
+}
@@ -0,0 +1,54 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/param_groups/lib" // mock
+)
+
+func TestMocked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	lib.EXPECT().Pad(8, int('.'), "abc").Return("mocked")
+	if s := Label("abc"); s != "mocked" {
+		t.Errorf("Expected mocked, got %q", s)
+	}
+
+	lib.EXPECT().Sum(1, 2, 3, 4).Return(42)
+	if n := Total(1, 2, 3, 4); n != 42 {
+		t.Errorf("Expected 42, got %d", n)
+	}
+
+	lib.EXPECT().Sum(1, 2).Return(7)
+	if n := Total(1, 2); n != 7 {
+		t.Errorf("Expected 7, got %d", n)
+	}
+
+	j := &lib.Joiner{}
+	j.EXPECT().Join("a", "b", gomock.Any()).Return("a+b")
+	if s := Title(j, "a", "b"); s != "a+b" {
+		t.Errorf("Expected a+b, got %q", s)
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if s := Label("abc"); s != "abc....." {
+		t.Errorf("Expected abc....., got %q", s)
+	}
+
+	if n := Total(1, 2, 3, 4); n != 10 {
+		t.Errorf("Expected 10, got %d", n)
+	}
+
+	if s := Title(&lib.Joiner{Sep: "-"}, "a", "b"); s != "A-B" {
+		t.Errorf("Expected A-B, got %q", s)
+	}
+}
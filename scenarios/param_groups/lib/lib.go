@@ -0,0 +1,31 @@
+package lib
+
+import "strings"
+
+// Pad mixes a parameter group with more than one name with a single name.
+func Pad(width, fill int, s string) string {
+	for len(s) < width {
+		s += string(rune(fill))
+	}
+	return s
+}
+
+func Sum(a, b int, rest ...int) int {
+	total := a + b
+	for _, v := range rest {
+		total += v
+	}
+	return total
+}
+
+type Joiner struct {
+	Sep string
+}
+
+func (j *Joiner) Join(a, b string, upper bool) string {
+	s := a + j.Sep + b
+	if upper {
+		s = strings.ToUpper(s)
+	}
+	return s
+}
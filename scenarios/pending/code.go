@@ -0,0 +1,13 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/pending/lib"
+)
+
+func Lookup(c *lib.Cache, key string) string {
+	if v := c.Get(key); v != "" {
+		return v
+	}
+	v, _ := lib.Fetch(key)
+	return v
+}
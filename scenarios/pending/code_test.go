@@ -0,0 +1,65 @@
+package code
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/pending/lib" // mock
+)
+
+func TestPendingExpectations(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	c := &lib.Cache{}
+	c.EXPECT().Get("a").Return("")
+	c.EXPECT().Get("b").Return("b")
+	lib.EXPECT().Fetch("a").Return("a", nil)
+
+	if v := Lookup(c, "a"); v != "a" {
+		t.Errorf("Expected a, got %q", v)
+	}
+
+	pending := lib.MOCK().PendingExpectations()
+	if expected := []string{"Cache.Get"}; !reflect.DeepEqual(pending, expected) {
+		t.Errorf("Expected pending %v, got %v", expected, pending)
+	}
+
+	if v := Lookup(c, "b"); v != "b" {
+		t.Errorf("Expected b, got %q", v)
+	}
+
+	if pending := lib.MOCK().PendingExpectations(); len(pending) != 0 {
+		t.Errorf("Expected no pending expectations, got %v", pending)
+	}
+}
+
+func TestPendingTimes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	c := &lib.Cache{}
+	c.EXPECT().Get("a").Return("a").Times(2)
+	c.EXPECT().Get("b").Return("b").AnyTimes()
+	lib.EXPECT().Fetch("c").Return("c", nil).MaxTimes(3)
+
+	Lookup(c, "a")
+
+	// AnyTimes and MaxTimes don't need any calls, but Times(2) needs two
+	pending := lib.MOCK().PendingExpectations()
+	if expected := []string{"Cache.Get"}; !reflect.DeepEqual(pending, expected) {
+		t.Errorf("Expected pending %v, got %v", expected, pending)
+	}
+
+	Lookup(c, "a")
+
+	if pending := lib.MOCK().PendingExpectations(); len(pending) != 0 {
+		t.Errorf("Expected no pending expectations, got %v", pending)
+	}
+}
@@ -0,0 +1,13 @@
+package lib
+
+func Fetch(key string) (string, error) {
+	return "", nil
+}
+
+type Cache struct {
+	data map[string]string
+}
+
+func (c *Cache) Get(key string) string {
+	return c.data[key]
+}
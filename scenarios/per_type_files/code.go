@@ -0,0 +1,9 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/per_type_files/lib"
+)
+
+func Copy(c *lib.Cache, s *lib.Store, key string) error {
+	return s.Put(key, c.Get(key))
+}
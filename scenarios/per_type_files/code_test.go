@@ -0,0 +1,48 @@
+package code
+
+import (
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/per_type_files/lib" // mock
+)
+
+func TestCopy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	c := &lib.Cache{}
+	s := &lib.Store{}
+	c.EXPECT().Get("a").Return("b")
+	s.EXPECT().Put("a", "b").Return(nil)
+
+	if err := Copy(c, s, "a"); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+// filename returns the base name of the file that declares f.
+func filename(f interface{}) string {
+	file, _ := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).FileLine(0)
+	return filepath.Base(file)
+}
+
+func TestLayout(t *testing.T) {
+	expected := map[string]interface{}{
+		"lib_Cache_mock.go": (*lib.Cache).EXPECT,
+		"lib_Store_mock.go": (*lib.Store).EXPECT,
+		"lib_Name_mock.go":  lib.Name.EXPECT,
+		"lib_mock.go":       lib.MOCK,
+	}
+	for name, f := range expected {
+		if file := filename(f); file != name {
+			t.Errorf("Expected declaration in %s, got %s", name, file)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package lib
+
+type Cache struct{}
+
+func (c *Cache) Get(key string) string {
+	return ""
+}
+
+type Store struct{}
+
+func (s *Store) Put(key, value string) error {
+	return nil
+}
+
+type Name string
+
+func (n Name) Upper() Name {
+	return n
+}
@@ -0,0 +1,20 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/pointer_errors/lib"
+)
+
+// Validate converts the *lib.Error from Check into an error properly, so that
+// no error is a nil error.
+func Validate(v int) error {
+	if err := lib.Check(v); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ValidateTrap returns the *lib.Error from Check as an error directly, which
+// is never a nil error - even when Check returns nil.
+func ValidateTrap(v int) error {
+	return lib.Check(v)
+}
@@ -0,0 +1,63 @@
+package code
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/pointer_errors/lib" // mock
+)
+
+func TestValidate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	lib.EXPECT().Check(1).Return(nil)
+	lib.EXPECT().Check(-1).Return(&lib.Error{Code: -1})
+
+	if err := Validate(1); err != nil {
+		t.Errorf("Expected nil error, got %#v", err)
+	}
+
+	var e *lib.Error
+	if err := Validate(-1); !errors.As(err, &e) || e.Code != -1 {
+		t.Errorf("Expected *lib.Error with code -1, got %#v", err)
+	}
+}
+
+func TestTypedNil(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	// Return(nil) gives a nil *lib.Error, exactly like the real function -
+	// so the mock doesn't hide the typed nil problem in ValidateTrap.
+	lib.EXPECT().Check(1).Return(nil)
+
+	if err := lib.Check(1); err != nil {
+		t.Errorf("Expected nil *lib.Error, got %#v", err)
+	}
+
+	lib.EXPECT().Check(1).Return(nil)
+
+	if err := ValidateTrap(1); err == nil {
+		t.Errorf("Expected non-nil error holding a nil *lib.Error")
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if err := Validate(1); err != nil {
+		t.Errorf("Expected nil error, got %#v", err)
+	}
+
+	if err := ValidateTrap(1); err == nil {
+		t.Errorf("Expected non-nil error holding a nil *lib.Error")
+	}
+}
@@ -0,0 +1,20 @@
+package lib
+
+import (
+	"fmt"
+)
+
+type Error struct {
+	Code int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("error %d", e.Code)
+}
+
+func Check(v int) *Error {
+	if v < 0 {
+		return &Error{Code: v}
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package code
+
+import (
+	"io/ioutil"
+
+	"github.com/qur/withmock/scenarios/pointer_interfaces/lib"
+)
+
+func ReadAll() string {
+	data, _ := ioutil.ReadAll(*lib.Reader())
+	return string(data)
+}
+
+func Get() string {
+	return (*lib.Local()).Get()
+}
+
+func OpenGet(o lib.Opener, name string) string {
+	r, err := o.Open(name)
+	if err != nil {
+		return ""
+	}
+	data, _ := ioutil.ReadAll(*r)
+	return string(data) + (*o.Store()).Get()
+}
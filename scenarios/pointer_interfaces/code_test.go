@@ -0,0 +1,55 @@
+package code
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/pointer_interfaces/lib" // mock
+)
+
+type store string
+
+func (s store) Get() string {
+	return string(s)
+}
+
+func TestMocked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	var r io.Reader = strings.NewReader("mock")
+	lib.EXPECT().Reader().Return(&r)
+	if s := ReadAll(); s != "mock" {
+		t.Errorf("Expected \"mock\", got %q", s)
+	}
+
+	var s lib.Store = store("mock")
+	lib.EXPECT().Local().Return(&s)
+	if v := Get(); v != "mock" {
+		t.Errorf("Expected \"mock\", got %q", v)
+	}
+
+	o := lib.MOCK().NewOpener()
+	o.EXPECT().Open("a").Return(&r, nil)
+	o.EXPECT().Store().Return(&s)
+	if v := OpenGet(o, "a"); v != "mock" {
+		t.Errorf("Expected \"mock\", got %q", v)
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if s := ReadAll(); s != "real" {
+		t.Errorf("Expected \"real\", got %q", s)
+	}
+	if s := Get(); s != "real" {
+		t.Errorf("Expected \"real\", got %q", s)
+	}
+}
@@ -0,0 +1,32 @@
+package lib
+
+import (
+	"io"
+	"strings"
+)
+
+type Store interface {
+	Get() string
+}
+
+type memStore struct{}
+
+func (memStore) Get() string {
+	return "real"
+}
+
+func Reader() *io.Reader {
+	var r io.Reader = strings.NewReader("real")
+	return &r
+}
+
+func Local() *Store {
+	var s Store = memStore{}
+	return &s
+}
+
+// Opener returns pointers to interfaces from its methods as well.
+type Opener interface {
+	Open(name string) (*io.Reader, error)
+	Store() *Store
+}
@@ -0,0 +1,9 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/predeclared_any/lib"
+)
+
+func Fetch(c lib.Cache, key any) any {
+	return lib.Identity(c.Get(key))
+}
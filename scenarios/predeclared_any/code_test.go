@@ -0,0 +1,48 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/predeclared_any/ext"
+	"github.com/qur/withmock/scenarios/predeclared_any/lib" // mock
+)
+
+func TestFetch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	c := lib.MOCK().NewCache()
+	c.EXPECT().Get("a").Return(1)
+	lib.EXPECT().Identity(1).Return(2)
+
+	if v := Fetch(c, "a"); v != 2 {
+		t.Errorf("Expected 2, got %v", v)
+	}
+}
+
+func TestVariadicAny(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	c := lib.MOCK().NewCache()
+	c.EXPECT().Put("a", 1, 2).Return(ext.Value{V: 3})
+
+	if v := c.Put("a", 1, 2); v.V != 3 {
+		t.Errorf("Expected 3, got %v", v.V)
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if n := lib.Lookup([]string{"a", "b"}, "b"); n != 2 {
+		t.Errorf("Expected 2, got %d", n)
+	}
+}
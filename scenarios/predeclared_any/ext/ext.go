@@ -0,0 +1,11 @@
+package ext
+
+type Value struct {
+	V any
+}
+
+type Store interface {
+	Get(key any) any
+	Put(key any, values ...any) Value
+	All() []any
+}
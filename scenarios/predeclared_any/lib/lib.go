@@ -0,0 +1,31 @@
+package lib
+
+import (
+	"github.com/qur/withmock/scenarios/predeclared_any/ext"
+)
+
+type Cache interface {
+	ext.Store
+	Len() int
+}
+
+type Key interface {
+	comparable
+}
+
+func Identity(x any) any {
+	return x
+}
+
+type Set[K Key] map[K]struct{}
+
+func Lookup(keys []string, key string) int {
+	set := Set[string]{}
+	for _, k := range keys {
+		set[k] = struct{}{}
+	}
+	if _, found := set[key]; !found {
+		return -1
+	}
+	return len(set)
+}
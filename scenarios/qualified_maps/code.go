@@ -0,0 +1,17 @@
+package code
+
+import (
+	"time"
+
+	"github.com/qur/withmock/scenarios/qualified_maps/ext"
+	"github.com/qur/withmock/scenarios/qualified_maps/lib"
+)
+
+func Refresh(t *lib.Table, idx lib.Index) ([ext.Size]byte, time.Duration) {
+	sum := idx.Lookup(t.Entries)
+	return sum, idx.Ages()["a"]
+}
+
+func Update(t *lib.Table, key ext.Key, n int) [ext.Size]byte {
+	return t.Merge(map[ext.Key]ext.Value{key: {N: n}})
+}
@@ -0,0 +1,48 @@
+package code
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/qualified_maps/ext"
+	"github.com/qur/withmock/scenarios/qualified_maps/lib" // mock
+)
+
+func TestRefresh(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	// The methods of Index are promoted from ext, so the map and array types
+	// have to be scoped without breaking them up.
+	entries := map[ext.Key]ext.Value{"a": {N: 1}}
+	sum := [ext.Size]byte{1, 2, 3, 4}
+
+	idx := lib.MOCK().NewIndex()
+	idx.EXPECT().Lookup(entries).Return(sum)
+	idx.EXPECT().Ages().Return(map[ext.Key]time.Duration{"a": time.Second})
+
+	s, age := Refresh(&lib.Table{Entries: entries}, idx)
+	if s != sum || age != time.Second {
+		t.Errorf("Expected %v and 1s, got %v and %s", sum, s, age)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	sum := [ext.Size]byte{4, 3, 2, 1}
+
+	table := &lib.Table{}
+	table.EXPECT().Merge(map[ext.Key]ext.Value{"b": {N: 2}}).Return(sum)
+
+	if s := Update(table, "b", 2); s != sum {
+		t.Errorf("Expected %v, got %v", sum, s)
+	}
+}
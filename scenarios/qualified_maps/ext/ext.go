@@ -0,0 +1,20 @@
+package ext
+
+import (
+	"crypto/sha256"
+	"time"
+)
+
+const Size = 4
+
+type Key string
+
+type Value struct {
+	N int
+}
+
+type Index interface {
+	Lookup(keys map[Key]Value) [Size]byte
+	Digest(data map[Key][]byte) [sha256.Size]byte
+	Ages() map[Key]time.Duration
+}
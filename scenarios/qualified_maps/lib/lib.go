@@ -0,0 +1,22 @@
+package lib
+
+import (
+	"github.com/qur/withmock/scenarios/qualified_maps/ext"
+)
+
+type Table struct {
+	Entries map[ext.Key]ext.Value
+	Sum     [ext.Size]byte
+}
+
+func (t *Table) Entry(key ext.Key) ext.Value {
+	return t.Entries[key]
+}
+
+func (t *Table) Merge(entries map[ext.Key]ext.Value) [ext.Size]byte {
+	return t.Sum
+}
+
+type Index interface {
+	ext.Index
+}
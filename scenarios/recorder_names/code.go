@@ -0,0 +1,17 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/recorder_names/lib"
+)
+
+func Notify(to string, opts ...string) string {
+	return lib.Send(to, 0, []string{"hello"}, opts...)
+}
+
+func Save(s *lib.Store, key string) error {
+	return s.Put(key, len(key))
+}
+
+func Load(s *lib.Store, key string) interface{} {
+	return s.Get(key, true)
+}
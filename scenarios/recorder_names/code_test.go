@@ -0,0 +1,45 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/recorder_names/lib" // mock
+)
+
+func TestMocked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	lib.EXPECT().Send("bob", 0, []string{"hello"}, "x", "y").Return("sent")
+	if s := Notify("bob", "x", "y"); s != "sent" {
+		t.Errorf("Expected sent, got %q", s)
+	}
+
+	s := &lib.Store{}
+	s.EXPECT().Put("key", 3).Return(nil)
+	if err := Save(s, "key"); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	s.EXPECT().Get("key", true).Return("value")
+	if v := Load(s, "key"); v != "value" {
+		t.Errorf("Expected value, got %v", v)
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if s := Notify("bob", "x"); s != "bob [hello] [x]" {
+		t.Errorf("Expected bob [hello] [x], got %q", s)
+	}
+
+	if v := Load(&lib.Store{}, "key"); v != "key" {
+		t.Errorf("Expected key, got %v", v)
+	}
+}
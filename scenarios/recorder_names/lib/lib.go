@@ -0,0 +1,20 @@
+package lib
+
+import "fmt"
+
+// Send has a mix of named, blank and unnamed parameters, and one named args
+// (which the recorder uses itself).
+func Send(to string, _ int, args []string, opts ...string) string {
+	return fmt.Sprintf("%s %v %v", to, args, opts)
+}
+
+type Store struct{}
+
+func (s *Store) Put(key string, value interface{}) error {
+	return nil
+}
+
+// Get uses names that the recorder would pick for unnamed parameters.
+func (s *Store) Get(p1 string, _ bool) interface{} {
+	return p1
+}
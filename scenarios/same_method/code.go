@@ -0,0 +1,9 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/same_method/lib"
+)
+
+func TryMe(a *lib.A, b lib.B, n int) (int, int, int) {
+	return a.Do(n), b.Do(n), lib.Do(n)
+}
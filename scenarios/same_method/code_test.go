@@ -0,0 +1,59 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/same_method/lib" // mock
+)
+
+func TestEnableOne(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+	lib.MOCK().EnableMock("A.Do")
+
+	a := &lib.A{}
+	a.EXPECT().Do(1).Return(10)
+
+	x, y, z := TryMe(a, lib.B{}, 1)
+
+	if x != 10 {
+		t.Errorf("Expected mocked A.Do to return 10, got %d", x)
+	}
+	if y != 3 {
+		t.Errorf("Expected real B.Do to return 3, got %d", y)
+	}
+	if z != 4 {
+		t.Errorf("Expected real Do to return 4, got %d", z)
+	}
+}
+
+func TestDisableOne(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+	lib.MOCK().MockAll(true)
+	lib.MOCK().DisableMock("A.Do")
+
+	b := lib.B{}
+	b.EXPECT().Do(1).Return(20)
+	lib.EXPECT().Do(1).Return(30)
+
+	x, y, z := TryMe(&lib.A{}, b, 1)
+
+	if x != 2 {
+		t.Errorf("Expected real A.Do to return 2, got %d", x)
+	}
+	if y != 20 {
+		t.Errorf("Expected mocked B.Do to return 20, got %d", y)
+	}
+	if z != 30 {
+		t.Errorf("Expected mocked Do to return 30, got %d", z)
+	}
+}
@@ -0,0 +1,17 @@
+package lib
+
+type A struct{}
+
+func (a *A) Do(n int) int {
+	return n + 1
+}
+
+type B struct{}
+
+func (b B) Do(n int) int {
+	return n + 2
+}
+
+func Do(n int) int {
+	return n + 3
+}
@@ -0,0 +1,15 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/same_type_results/lib"
+)
+
+func Sum(s lib.Source) int {
+	a, b := s.Pair()
+	return a.N + b.N
+}
+
+func Spread(n int) int {
+	lo, hi := lib.Split(n)
+	return hi.N - lo.N
+}
@@ -0,0 +1,51 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/same_type_results/lib" // mock
+)
+
+func TestMocked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	c := &lib.Cache{}
+	c.EXPECT().Pair().Return(lib.Value{N: 1}, lib.Value{N: 2})
+	lib.EXPECT().Split(7).Return(lib.Value{N: 1}, lib.Value{N: 6})
+
+	if n := Sum(c); n != 3 {
+		t.Errorf("Expected 3, got %d", n)
+	}
+	if n := Spread(7); n != 5 {
+		t.Errorf("Expected 5, got %d", n)
+	}
+
+	s := lib.MockSource{}
+	s.EXPECT().Pair().Return(lib.Value{N: 4}, lib.Value{N: 5})
+
+	if n := Sum(&s); n != 9 {
+		t.Errorf("Expected 9, got %d", n)
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if n := Sum(lib.NewCache(10, 20)); n != 30 {
+		t.Errorf("Expected 30, got %d", n)
+	}
+	if n := Spread(7); n != 1 {
+		t.Errorf("Expected 1, got %d", n)
+	}
+
+	a, b, err := lib.NewCache(0, 0).Lookup("key")
+	if err != nil || a.N != 3 || b != nil {
+		t.Errorf("Expected 3, nil, nil - got %v, %v, %v", a, b, err)
+	}
+}
@@ -0,0 +1,34 @@
+package lib
+
+type Value struct {
+	N int
+}
+
+type Cache struct {
+	first, second int
+}
+
+func NewCache(first, second int) *Cache {
+	return &Cache{first: first, second: second}
+}
+
+// Pair uses its named results, which the real code must still see.
+func (c *Cache) Pair() (a, b Value) {
+	a.N = c.first
+	b.N = c.second
+	return
+}
+
+func (c *Cache) Lookup(key string) (a, b *Value, err error) {
+	return &Value{len(key)}, nil, nil
+}
+
+func Split(n int) (lo, hi Value) {
+	lo.N = n / 2
+	hi.N = n - lo.N
+	return
+}
+
+type Source interface {
+	Pair() (a, b Value)
+}
@@ -0,0 +1,25 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/self_returning/lib"
+)
+
+func Make(b lib.Builder) string {
+	return b.With(1).With(2).Build()
+}
+
+func Depth(n lib.Node) int {
+	depth := 0
+	for {
+		parent, ok := n.Parent()
+		if !ok {
+			return depth
+		}
+		n = parent
+		depth++
+	}
+}
+
+func Again(c lib.Chain) string {
+	return c.Reset().With(3).Build()
+}
@@ -0,0 +1,54 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/self_returning/lib" // mock
+)
+
+func TestMocked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	// The mock can be returned from its own methods, as it is a Builder
+	b := lib.NewMockBuilder(ctrl)
+	b.EXPECT().With(1).Return(b)
+	b.EXPECT().With(2).Return(b)
+	b.EXPECT().Build().Return("mocked")
+
+	if s := Make(b); s != "mocked" {
+		t.Errorf("Expected mocked, got %q", s)
+	}
+
+	root := lib.NewMockNode(ctrl)
+	child := lib.NewMockNode(ctrl)
+	child.EXPECT().Parent().Return(root, true)
+	root.EXPECT().Parent().Return(nil, false)
+
+	if d := Depth(child); d != 1 {
+		t.Errorf("Expected 1, got %d", d)
+	}
+
+	// The embedded method returns the other package's interface
+	c := lib.NewMockChain(ctrl)
+	c.EXPECT().Reset().Return(c)
+	c.EXPECT().With(3).Return(c)
+	c.EXPECT().Build().Return("again")
+
+	if s := Again(c); s != "again" {
+		t.Errorf("Expected again, got %q", s)
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if s := Make(lib.NewBuilder()); s != "12" {
+		t.Errorf("Expected 12, got %q", s)
+	}
+}
@@ -0,0 +1,6 @@
+package ext
+
+type Builder interface {
+	With(n int) Builder
+	Build() string
+}
@@ -0,0 +1,45 @@
+package lib
+
+import (
+	"strconv"
+
+	"github.com/qur/withmock/scenarios/self_returning/ext"
+)
+
+type Builder interface {
+	With(n int) Builder
+	Build() string
+}
+
+// Node returns itself as part of a larger result.
+type Node interface {
+	Children() ([]Node, error)
+	Parent() (Node, bool)
+}
+
+type builder struct {
+	parts []string
+}
+
+func NewBuilder() Builder {
+	return &builder{}
+}
+
+func (b *builder) With(n int) Builder {
+	b.parts = append(b.parts, strconv.Itoa(n))
+	return b
+}
+
+func (b *builder) Build() string {
+	s := ""
+	for _, p := range b.parts {
+		s += p
+	}
+	return s
+}
+
+// Chain embeds an interface from another package that returns itself.
+type Chain interface {
+	ext.Builder
+	Reset() Chain
+}
@@ -0,0 +1,9 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/shared_externals/lib"
+)
+
+func Value() int {
+	return lib.Double(lib.Answer())
+}
@@ -0,0 +1,31 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/shared_externals/lib" // mock
+)
+
+func TestMocked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	lib.EXPECT().Answer().Return(1)
+	lib.EXPECT().Double(1).Return(3)
+	if n := Value(); n != 3 {
+		t.Errorf("Expected 3, got %d", n)
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if n := Value(); n != 84 {
+		t.Errorf("Expected 84, got %d", n)
+	}
+}
@@ -0,0 +1,8 @@
+package lib
+
+// Answer is implemented in lib.s
+func Answer() int
+
+func Double(n int) int {
+	return n * 2
+}
@@ -0,0 +1,3 @@
+TEXT ·Answer(SB), 7, $0
+        MOVQ    $42, ret+0(FP)
+	RET
@@ -0,0 +1,16 @@
+//go:build ignore
+
+// This is a separate tool, which shares the name of the external function in
+// lib (but not the implementation).
+
+package main
+
+import "fmt"
+
+func Answer() int
+
+func Double(n int) int
+
+func main() {
+	fmt.Println(Double(Answer()))
+}
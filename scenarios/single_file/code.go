@@ -0,0 +1,10 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/single_file/lib"
+)
+
+func TryMe(name string) (string, string) {
+	c := &lib.Counter{}
+	return lib.Greet(name), c.Add(2)
+}
@@ -0,0 +1,38 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/single_file/lib" // mock
+)
+
+func TestTryMe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+	lib.MOCK().DisableMock("Counter.Add")
+	defer lib.MOCK().MockAll(true)
+
+	lib.EXPECT().Greet("bob").Return("mocked")
+
+	g, a := TryMe("bob")
+
+	if g != "mocked" {
+		t.Errorf("Expected mocked, got %q", g)
+	}
+	if a != "2!" {
+		t.Errorf("Expected 2!, got %q", a)
+	}
+}
+
+func TestInits(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if !lib.Ready() {
+		t.Errorf("Expected the init functions from all the files to be called")
+	}
+}
@@ -0,0 +1,15 @@
+package lib
+
+import (
+	"strings"
+)
+
+var greeting string
+
+func init() {
+	greeting = "hello"
+}
+
+func Greet(name string) string {
+	return greeting + " " + strings.TrimSpace(name)
+}
@@ -0,0 +1,21 @@
+package lib
+
+import (
+	"fmt"
+	str "strings"
+)
+
+var count int
+
+func init() {
+	count = 1
+}
+
+type Counter struct {
+	n int
+}
+
+func (c *Counter) Add(n int) string {
+	c.n += n
+	return fmt.Sprintf("%d", c.n) + str.Repeat("!", count)
+}
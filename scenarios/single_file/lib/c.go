@@ -0,0 +1,13 @@
+package lib
+
+import (
+	"fmt"
+)
+
+type Shouter interface {
+	Shout(msg string) fmt.Stringer
+}
+
+func Ready() bool {
+	return greeting != "" && count > 0
+}
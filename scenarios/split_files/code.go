@@ -0,0 +1,21 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/split_files/lib"
+)
+
+func Fill(s *lib.Store, n int) int {
+	for i := 0; i < n; i++ {
+		s.Add(1)
+	}
+	return s.Size()
+}
+
+type Incer interface {
+	Inc() int
+}
+
+func Twice(i Incer) int {
+	i.Inc()
+	return i.Inc()
+}
@@ -0,0 +1,55 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/split_files/lib" // mock
+)
+
+func TestFill(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	s := &lib.Store{}
+	s.EXPECT().Add(1).Times(2)
+	s.EXPECT().Size().Return(10)
+
+	if n := Fill(s, 2); n != 10 {
+		t.Errorf("Expected 10, got %d", n)
+	}
+}
+
+func TestValue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	s := lib.Store{}
+	s.EXPECT().Size().Return(3)
+
+	if n := s.Size(); n != 3 {
+		t.Errorf("Expected 3, got %d", n)
+	}
+}
+
+func TestUnexported(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	c := lib.MOCK().Newcounter()
+	gomock.InOrder(
+		c.EXPECT().Inc().Return(1),
+		c.EXPECT().Inc().Return(2),
+	)
+
+	if n := Twice(c); n != 2 {
+		t.Errorf("Expected 2, got %d", n)
+	}
+}
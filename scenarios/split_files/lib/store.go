@@ -0,0 +1,9 @@
+package lib
+
+func (s *Store) Add(n int) {
+	s.size += n
+}
+
+func (s *Store) Name() string {
+	return s.name
+}
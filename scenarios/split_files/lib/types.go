@@ -0,0 +1,14 @@
+package lib
+
+type Store struct {
+	name string
+	size int
+}
+
+func NewStore(name string) *Store {
+	return &Store{name: name}
+}
+
+type counter struct {
+	n int
+}
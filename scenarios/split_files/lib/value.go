@@ -0,0 +1,10 @@
+package lib
+
+func (s Store) Size() int {
+	return s.size
+}
+
+func (c *counter) Inc() int {
+	c.n++
+	return c.n
+}
@@ -0,0 +1,24 @@
+package code
+
+import (
+	"io/ioutil"
+
+	"github.com/qur/withmock/scenarios/split_imports/lib"
+)
+
+func Read(name string) string {
+	data, err := ioutil.ReadAll(lib.Open(name))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func Count(names ...string) int {
+	return len(lib.OpenAll(names...))
+}
+
+func Name(name string) string {
+	n, _ := lib.Lookup(name)
+	return n.Name
+}
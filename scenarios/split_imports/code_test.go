@@ -0,0 +1,47 @@
+package code
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/split_imports/lib" // mock
+)
+
+func TestMocked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	lib.EXPECT().Open("a").Return(strings.NewReader("mocked"))
+	if s := Read("a"); s != "mocked" {
+		t.Errorf("Expected \"mocked\", got %q", s)
+	}
+
+	lib.EXPECT().OpenAll("a", "b").Return([]lib.Source{nil, nil, nil})
+	if n := Count("a", "b"); n != 3 {
+		t.Errorf("Expected 3, got %d", n)
+	}
+
+	lib.EXPECT().Lookup("a").Return(lib.Named{Name: "b"}, lib.Stamp{})
+	if s := Name("a"); s != "b" {
+		t.Errorf("Expected \"b\", got %q", s)
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	if s := Read("a"); s != "a" {
+		t.Errorf("Expected \"a\", got %q", s)
+	}
+	if n := Count("a", "b"); n != 2 {
+		t.Errorf("Expected 2, got %d", n)
+	}
+	if s := Name("a"); s != "a" {
+		t.Errorf("Expected \"a\", got %q", s)
+	}
+}
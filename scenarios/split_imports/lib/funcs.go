@@ -0,0 +1,21 @@
+package lib
+
+import (
+	"strings"
+)
+
+func Open(name string) Source {
+	return strings.NewReader(name)
+}
+
+func OpenAll(names ...string) []Source {
+	srcs := make([]Source, 0, len(names))
+	for _, name := range names {
+		srcs = append(srcs, Open(name))
+	}
+	return srcs
+}
+
+func Lookup(name string) (Named, Stamp) {
+	return Named{Name: name, Src: Open(name)}, Stamp{}
+}
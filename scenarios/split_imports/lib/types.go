@@ -0,0 +1,17 @@
+package lib
+
+import (
+	"io"
+	"time"
+)
+
+// Source is declared here, where io is imported - but is only used by the
+// functions in funcs.go, which doesn't import io.
+type Source = io.Reader
+
+type Stamp time.Time
+
+type Named struct {
+	Name string
+	Src  io.Reader
+}
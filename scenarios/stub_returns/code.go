@@ -0,0 +1,14 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/stub_returns/lib"
+)
+
+func TryMe() (bool, int, error) {
+	n, err := lib.Count()
+	return lib.Wibble(), n, err
+}
+
+func TryOther() int {
+	return lib.Other()
+}
@@ -0,0 +1,70 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/stub_returns/lib" // mock
+)
+
+func TestMocked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+	lib.EXPECT().Wibble().Return(false)
+	lib.EXPECT().Count().Return(1, nil)
+
+	ok, n, err := TryMe()
+
+	if ok || n != 1 || err != nil {
+		t.Errorf("Expected false, 1, nil - got %v, %d, %v", ok, n, err)
+	}
+}
+
+func TestStubReturns(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	ok, n, err := TryMe()
+
+	if !ok || n != 42 || err != nil {
+		t.Errorf("Expected true, 42, nil - got %v, %d, %v", ok, n, err)
+	}
+}
+
+func TestStubPanics(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Expected stub without returns to panic")
+		}
+	}()
+
+	TryOther()
+}
+
+func TestStubHandler(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	called := ""
+	lib.MOCK().SetStubHandler(func(name string) {
+		called = name
+	})
+	defer lib.MOCK().SetStubHandler(nil)
+
+	func() {
+		defer func() {
+			recover()
+		}()
+		TryOther()
+	}()
+
+	if called != "Other" {
+		t.Errorf("Expected stub handler to be called for Other, got %q", called)
+	}
+}
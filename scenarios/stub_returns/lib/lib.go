@@ -0,0 +1,7 @@
+package lib
+
+func Wibble() bool
+
+func Count() (int, error)
+
+func Other() int
@@ -0,0 +1,13 @@
+TEXT ·Wibble(SB), 7, $0
+        MOVB    $0, ret+0(FP)
+	RET
+
+TEXT ·Count(SB), 7, $0
+        MOVQ    $0, ret+0(FP)
+        MOVQ    $0, ret1_itable+8(FP)
+        MOVQ    $0, ret1_data+16(FP)
+	RET
+
+TEXT ·Other(SB), 7, $0
+        MOVQ    $0, ret+0(FP)
+	RET
@@ -0,0 +1,9 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/subpkg_mockall/lib"
+)
+
+func TryMe() int {
+	return lib.Wibble()
+}
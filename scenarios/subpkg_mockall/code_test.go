@@ -0,0 +1,38 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/subpkg_mockall/lib"
+	"github.com/qur/withmock/scenarios/subpkg_mockall/lib/fake"
+	"github.com/qur/withmock/scenarios/subpkg_mockall/lib/live"
+)
+
+func TestTryMe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+	fake.MOCK().SetController(ctrl)
+	live.MOCK().SetController(ctrl)
+
+	// lib isn't marked for mocking, so it is real until asked otherwise.  fake
+	// starts out mocked, and live stays real despite its own config - as lib's
+	// config takes precedence.
+	fake.EXPECT().Value().Return(10)
+
+	if n := TryMe(); n != 12 {
+		t.Errorf("Expected 12, got %d", n)
+	}
+}
+
+func TestMockAllOff(t *testing.T) {
+	fake.MOCK().MockAll(false)
+	defer fake.MOCK().MockAll(true)
+
+	if n := TryMe(); n != 3 {
+		t.Errorf("Expected 3, got %d", n)
+	}
+}
@@ -0,0 +1,5 @@
+package fake
+
+func Value() int {
+	return 1
+}
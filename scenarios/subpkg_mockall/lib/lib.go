@@ -0,0 +1,10 @@
+package lib
+
+import (
+	"github.com/qur/withmock/scenarios/subpkg_mockall/lib/fake"
+	"github.com/qur/withmock/scenarios/subpkg_mockall/lib/live"
+)
+
+func Wibble() int {
+	return fake.Value() + live.Value()
+}
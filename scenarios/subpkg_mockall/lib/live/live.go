@@ -0,0 +1,5 @@
+package live
+
+func Value() int {
+	return 2
+}
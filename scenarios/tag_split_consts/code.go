@@ -0,0 +1,12 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/tag_split_consts/lib"
+)
+
+func Describe() string {
+	if lib.Debug() {
+		return lib.Mode() + " (verbose)"
+	}
+	return lib.Mode()
+}
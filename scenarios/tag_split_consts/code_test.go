@@ -0,0 +1,30 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/tag_split_consts/lib" // mock
+)
+
+func TestDescribe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	lib.EXPECT().Debug().Return(true)
+	lib.EXPECT().Mode().Return("mocked")
+
+	if s := Describe(); s != "mocked (verbose)" {
+		t.Errorf("Expected mocked (verbose), got %q", s)
+	}
+}
+
+func TestLevel(t *testing.T) {
+	// Only release.go is built without the debug tag
+	if lib.Level != 0 {
+		t.Errorf("Expected release Level, got %d", lib.Level)
+	}
+}
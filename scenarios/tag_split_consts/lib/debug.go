@@ -0,0 +1,11 @@
+//go:build debug
+
+package lib
+
+const debug = true
+
+var Level = 2
+
+func Mode() string {
+	return "debug"
+}
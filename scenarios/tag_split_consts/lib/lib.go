@@ -0,0 +1,5 @@
+package lib
+
+func Debug() bool {
+	return debug
+}
@@ -0,0 +1,11 @@
+//go:build !debug
+
+package lib
+
+const debug = false
+
+var Level = 0
+
+func Mode() string {
+	return "release"
+}
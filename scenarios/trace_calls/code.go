@@ -0,0 +1,14 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/trace_calls/lib"
+)
+
+func Notify(to string) error {
+	lib.Log("notify %s", to)
+	return lib.Send(to, 3)
+}
+
+func Fetch(g lib.Getter, path string) (string, error) {
+	return g.Get(path)
+}
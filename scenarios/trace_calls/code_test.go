@@ -0,0 +1,53 @@
+package code
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/trace_calls/lib" // mock
+)
+
+type traced struct {
+	name string
+	args []interface{}
+}
+
+func TestTracer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	calls := []traced{}
+	lib.MOCK().SetTracer(func(name string, args []interface{}) {
+		calls = append(calls, traced{name, args})
+	})
+	defer lib.MOCK().SetTracer(nil)
+
+	lib.EXPECT().Log("notify %s", "bob")
+	lib.EXPECT().Send("bob", 3).Return(nil)
+
+	c := &lib.Client{}
+	c.EXPECT().Get("/x").Return("x", nil)
+
+	g := lib.MOCK().NewGetter()
+	g.EXPECT().Get("/y").Return("y", nil)
+
+	if err := Notify("bob"); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	Fetch(c, "/x")
+	Fetch(g, "/y")
+
+	expected := []traced{
+		{"Log", []interface{}{"notify %s", "bob"}},
+		{"Send", []interface{}{"bob", 3}},
+		{"Client.Get", []interface{}{"/x"}},
+		{"MockGetter.Get", []interface{}{"/y"}},
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected calls %v, got %v", expected, calls)
+	}
+}
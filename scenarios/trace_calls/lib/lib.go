@@ -0,0 +1,20 @@
+package lib
+
+func Send(to string, retries int) error {
+	return nil
+}
+
+func Log(format string, args ...interface{}) {
+}
+
+type Client struct {
+	addr string
+}
+
+func (c *Client) Get(path string) (string, error) {
+	return "", nil
+}
+
+type Getter interface {
+	Get(path string) (string, error)
+}
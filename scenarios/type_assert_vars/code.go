@@ -0,0 +1,9 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/type_assert_vars/lib"
+)
+
+func TryMe(key string) interface{} {
+	return lib.Get(key)
+}
@@ -0,0 +1,52 @@
+package code
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/type_assert_vars/lib" // mock
+)
+
+func TestTryMe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+	lib.EXPECT().Get("x").Return(5)
+
+	if v := TryMe("x"); v != 5 {
+		t.Errorf("Expected 5, got %v", v)
+	}
+}
+
+func TestValues(t *testing.T) {
+	if lib.ValueThing != lib.Value {
+		t.Errorf("ValueThing: expected %v, got %v", lib.Value, lib.ValueThing)
+	}
+
+	if _, ok := lib.Looked.(*lib.Thing); !ok {
+		t.Errorf("Looked: expected *lib.Thing, got %T", lib.Looked)
+	}
+
+	if lib.LookedName != "a" {
+		t.Errorf("LookedName: expected a, got %q", lib.LookedName)
+	}
+
+	if lib.Number != 42 {
+		t.Errorf("Number: expected 42, got %d", lib.Number)
+	}
+
+	if lib.Label != "thing:a" {
+		t.Errorf("Label: expected thing:a, got %q", lib.Label)
+	}
+
+	if p := []string{"x", "y"}; !reflect.DeepEqual(lib.Parts, p) {
+		t.Errorf("Parts: expected %v, got %v", p, lib.Parts)
+	}
+
+	if lib.Upper != "A" {
+		t.Errorf("Upper: expected A, got %q", lib.Upper)
+	}
+}
@@ -0,0 +1,57 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Named interface {
+	Name() string
+}
+
+type Thing struct {
+	name string
+}
+
+func (t *Thing) Name() string {
+	return t.name
+}
+
+func (t *Thing) String() string {
+	return "thing:" + t.name
+}
+
+var registry = map[string]interface{}{
+	"a": &Thing{"a"},
+	"n": 42,
+}
+
+func lookup(key string) interface{} {
+	return registry[key]
+}
+
+func makers() []func() interface{} {
+	return []func() interface{}{
+		func() interface{} { return []string{"x", "y"} },
+	}
+}
+
+var Value interface{} = &Thing{"value"}
+
+var ValueThing = Value.(*Thing)
+
+var Looked = lookup("a").(Named)
+
+var LookedName = lookup("a").(*Thing).Name()
+
+var Number = lookup("n").(int)
+
+var Label = registry["a"].(fmt.Stringer).String()
+
+var Parts = makers()[0]().([]string)
+
+var Upper = strings.ToUpper(lookup("a").(Named).Name())
+
+func Get(key string) interface{} {
+	return lookup(key)
+}
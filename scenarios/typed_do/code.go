@@ -0,0 +1,17 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/typed_do/lib"
+)
+
+func Notify(to string) error {
+	return lib.Send(&lib.Message{To: to, Body: "hello"}, 3)
+}
+
+func Save(s *lib.Store, key string, value int) {
+	s.Put(key, value*2)
+}
+
+func Forward(s lib.Sender, msg *lib.Message) error {
+	return s.Send(msg)
+}
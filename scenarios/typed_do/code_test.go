@@ -0,0 +1,72 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/typed_do/lib" // mock
+)
+
+func TestNotify(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	var sent *lib.Message
+	var retries int
+	lib.EXPECT().SendDo(func(msg *lib.Message, n int) {
+		sent, retries = msg, n
+	}).Return(nil)
+
+	if err := Notify("bob"); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	if sent == nil || sent.To != "bob" || sent.Body != "hello" {
+		t.Errorf("Unexpected message sent: %+v", sent)
+	}
+	if retries != 3 {
+		t.Errorf("Expected 3 retries, got %d", retries)
+	}
+}
+
+func TestSave(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	s := &lib.Store{}
+	got := map[string]int{}
+	s.EXPECT().PutDo(func(key string, value int) {
+		got[key] = value
+	})
+
+	Save(s, "a", 2)
+
+	if got["a"] != 4 {
+		t.Errorf("Expected a=4, got %v", got)
+	}
+}
+
+func TestForward(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	msg := &lib.Message{To: "alice"}
+
+	s := lib.MOCK().NewSender()
+	s.EXPECT().SendDo(func(m *lib.Message) {
+		if m != msg {
+			t.Errorf("Expected %p, got %p", msg, m)
+		}
+	}).Return(nil)
+
+	if err := Forward(s, msg); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
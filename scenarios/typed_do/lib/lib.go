@@ -0,0 +1,22 @@
+package lib
+
+type Message struct {
+	To   string
+	Body string
+}
+
+func Send(msg *Message, retries int) error {
+	return nil
+}
+
+type Store struct {
+	data map[string]int
+}
+
+func (s *Store) Put(key string, value int) {
+	s.data[key] = value
+}
+
+type Sender interface {
+	Send(msg *Message) error
+}
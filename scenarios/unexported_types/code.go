@@ -0,0 +1,13 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/unexported_types/lib"
+)
+
+func DoTwice(d lib.Doer, n int) int {
+	return d.Do(d.Do(n))
+}
+
+func Label(n interface{ Name() string }) string {
+	return "<" + n.Name() + ">"
+}
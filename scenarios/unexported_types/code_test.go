@@ -0,0 +1,46 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/unexported_types/lib" // mock
+)
+
+func TestMocked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	w := lib.MOCK().Newwidget()
+	gomock.InOrder(
+		w.EXPECT().Do(1).Return(10),
+		w.EXPECT().Do(10).Return(20),
+	)
+	if n := DoTwice(w, 1); n != 20 {
+		t.Errorf("Expected 20, got %d", n)
+	}
+
+	g := lib.MOCK().Newgadget()
+	g.EXPECT().Name().Return("mock")
+	if s := Label(g); s != "<mock>" {
+		t.Errorf("Expected \"<mock>\", got %q", s)
+	}
+}
+
+func TestReal(t *testing.T) {
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+
+	// The real methods are called through the wrapper as well.
+	w := lib.MOCK().Newwidget()
+	if n := DoTwice(w, 1); n != 4 {
+		t.Errorf("Expected 4, got %d", n)
+	}
+
+	if s := Label(lib.MOCK().Newgadget()); s != "<>" {
+		t.Errorf("Expected \"<>\", got %q", s)
+	}
+}
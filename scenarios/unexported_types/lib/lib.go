@@ -0,0 +1,27 @@
+package lib
+
+type widget struct {
+	calls int
+}
+
+func (w *widget) Do(n int) int {
+	w.calls++
+	return n + w.calls
+}
+
+type gadget struct {
+	name string
+}
+
+func (g gadget) Name() string {
+	return g.name
+}
+
+// Doer is implemented by *widget.
+type Doer interface {
+	Do(n int) int
+}
+
+func NewDoer() Doer {
+	return &widget{}
+}
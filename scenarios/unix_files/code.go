@@ -0,0 +1,9 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/unix_files/sep"
+)
+
+func Join(elems ...string) string {
+	return sep.Join(elems)
+}
@@ -0,0 +1,11 @@
+package code
+
+import (
+	"testing"
+)
+
+func TestJoin(t *testing.T) {
+	if s := Join("a", "b"); s != "a/b" {
+		t.Errorf("Expected a/b, got %s", s)
+	}
+}
@@ -0,0 +1,12 @@
+package sep
+
+func Join(elems []string) string {
+	s := ""
+	for i, e := range elems {
+		if i > 0 {
+			s += separator()
+		}
+		s += e
+	}
+	return s
+}
@@ -0,0 +1,7 @@
+//go:build unix
+
+package sep
+
+func separator() string {
+	return "/"
+}
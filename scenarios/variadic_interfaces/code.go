@@ -0,0 +1,13 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/variadic_interfaces/lib"
+)
+
+func Setup(r *lib.Router, handlers ...lib.Handler) int {
+	return r.Use(handlers...)
+}
+
+func Wrap(handlers ...lib.Handler) lib.Handler {
+	return lib.Chain(handlers...)
+}
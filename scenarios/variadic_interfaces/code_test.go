@@ -0,0 +1,57 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/variadic_interfaces/lib" // mock
+)
+
+func TestSetup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	h1 := lib.MOCK().NewHandler()
+	h2 := lib.MOCK().NewHandler()
+
+	// Each interface value is matched against the expectation on its own, so
+	// the number of variadic arguments has to match too.
+	r := &lib.Router{}
+	r.EXPECT().Use().Return(0)
+	r.EXPECT().Use(h1).Return(1)
+	r.EXPECT().Use(gomock.Eq(h1), h2).Return(2)
+
+	if n := Setup(r); n != 0 {
+		t.Errorf("Expected 0, got %d", n)
+	}
+	if n := Setup(r, h1); n != 1 {
+		t.Errorf("Expected 1, got %d", n)
+	}
+	if n := Setup(r, h1, h2); n != 2 {
+		t.Errorf("Expected 2, got %d", n)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+
+	h1 := lib.MOCK().NewHandler()
+	h2 := lib.MOCK().NewHandler()
+	chained := lib.MOCK().NewHandler()
+
+	lib.EXPECT().Chain().Return(nil)
+	lib.EXPECT().Chain(h2, h1).Return(chained)
+
+	if h := Wrap(); h != nil {
+		t.Errorf("Expected nil, got %v", h)
+	}
+	if h := Wrap(h2, h1); h != chained {
+		t.Errorf("Expected the chained handler, got %v", h)
+	}
+}
@@ -0,0 +1,18 @@
+package lib
+
+type Handler interface {
+	Handle(req string) string
+}
+
+type Router struct {
+	handlers []Handler
+}
+
+func (r *Router) Use(handlers ...Handler) int {
+	r.handlers = append(r.handlers, handlers...)
+	return len(r.handlers)
+}
+
+func Chain(handlers ...Handler) Handler {
+	return nil
+}
@@ -0,0 +1,9 @@
+package code
+
+import (
+	"github.com/qur/withmock/scenarios/wildcard_mocks/lib"
+)
+
+func TryMe(a *lib.A, ab *lib.AB, n int) (int, int, int, int) {
+	return a.Get(n), a.Put(n), ab.Get(n), lib.Get(n)
+}
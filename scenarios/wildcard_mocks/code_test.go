@@ -0,0 +1,85 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/qur/withmock/scenarios/wildcard_mocks/lib" // mock
+)
+
+func TestEnableType(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+	lib.MOCK().EnableMock("A.*")
+
+	a := &lib.A{}
+	a.EXPECT().Get(1).Return(10)
+	a.EXPECT().Put(1).Return(20)
+
+	w, x, y, z := TryMe(a, &lib.AB{}, 1)
+
+	if w != 10 || x != 20 {
+		t.Errorf("Expected mocked A methods to return 10, 20 - got %d, %d", w, x)
+	}
+	if y != 4 {
+		t.Errorf("Expected real AB.Get to return 4, got %d", y)
+	}
+	if z != 5 {
+		t.Errorf("Expected real Get to return 5, got %d", z)
+	}
+}
+
+func TestExactOverridesPattern(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+	lib.MOCK().MockAll(false)
+	defer lib.MOCK().MockAll(true)
+	lib.MOCK().EnableMock("A*")
+	lib.MOCK().DisableMock("A.Put")
+
+	a := &lib.A{}
+	ab := &lib.AB{}
+	a.EXPECT().Get(1).Return(10)
+	ab.EXPECT().Get(1).Return(30)
+
+	w, x, y, z := TryMe(a, ab, 1)
+
+	if w != 10 || y != 30 {
+		t.Errorf("Expected mocked Get methods to return 10, 30 - got %d, %d", w, y)
+	}
+	if x != 3 {
+		t.Errorf("Expected real A.Put to return 3, got %d", x)
+	}
+	if z != 5 {
+		t.Errorf("Expected real Get to return 5, got %d", z)
+	}
+}
+
+func TestDisableType(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lib.MOCK().SetController(ctrl)
+	lib.MOCK().MockAll(true)
+	lib.MOCK().DisableMock("A.*")
+
+	ab := &lib.AB{}
+	ab.EXPECT().Get(1).Return(30)
+	lib.EXPECT().Get(1).Return(40)
+
+	w, x, y, z := TryMe(&lib.A{}, ab, 1)
+
+	if w != 2 || x != 3 {
+		t.Errorf("Expected real A methods to return 2, 3 - got %d, %d", w, x)
+	}
+	if y != 30 || z != 40 {
+		t.Errorf("Expected mocked AB.Get and Get to return 30, 40 - got %d, %d", y, z)
+	}
+}
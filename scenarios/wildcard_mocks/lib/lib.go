@@ -0,0 +1,21 @@
+package lib
+
+type A struct{}
+
+func (a *A) Get(n int) int {
+	return n + 1
+}
+
+func (a *A) Put(n int) int {
+	return n + 2
+}
+
+type AB struct{}
+
+func (ab *AB) Get(n int) int {
+	return n + 3
+}
+
+func Get(n int) int {
+	return n + 4
+}